@@ -89,16 +89,10 @@ export const FormAnalytics = ({ range = '7d' }: FormAnalyticsProps) => {
         }
 
         try {
+            // The engine builds the prompt from its own form analytics
             const payload = {
                 form_id: targetForm.formId,
-                metrics: {
-                    completion_rate: completionRate(targetForm.starters, targetForm.completions),
-                    fields: targetForm.fields.map(f => ({
-                        name: f.name,
-                        dwell_time: f.avgDwellTime,
-                        drop_offs: f.dropOffs
-                    }))
-                }
+                range
             };
 
             const response = await metricsApi.optimizeForm(payload);
@@ -12,7 +12,7 @@ interface Recording {
 }
 
 export const ReplaySection = () => {
-    const [activeFilter, setActiveFilter] = useState<'all' | 'active' | 'rage' | 'errors'>('all');
+    const [activeFilter, setActiveFilter] = useState<'all' | 'active' | 'rage' | 'errors' | 'dead' | 'thrash'>('all');
     const [recordings, setRecordings] = useState<Recording[]>([]);
     const [selectedSessionId, setSelectedSessionId] = useState<string | null>(null);
     const [sessionEvents, setSessionEvents] = useState<any[]>([]);
@@ -84,6 +84,8 @@ export const ReplaySection = () => {
                     { id: 'active', label: 'Active Now', icon: Monitor },
                     { id: 'rage', label: 'Rage Clicks', icon: User },
                     { id: 'errors', label: 'Start w/ Errors', icon: User },
+                    { id: 'dead', label: 'Dead Clicks', icon: User },
+                    { id: 'thrash', label: 'Thrashed Cursor', icon: User },
                 ].map((tab) => (
                     <button
                         key={tab.id}
@@ -209,6 +209,52 @@ export const metricsApi = {
         return response.data;
     },
 
+    runQuery: async (
+        query: { metrics: string[], dimensions?: string[], filters?: { field: string, operator: string, value: unknown }[], sort?: { field: string, desc?: boolean }[], limit?: number },
+        range: string = '30d',
+        segmentId?: number,
+    ) => {
+        const wpConfig = getWPConfig();
+        if (!wpConfig.nonce) return { columns: [], rows: [], segment_id: null };
+        const params = new URLSearchParams({ range });
+        if (segmentId) params.set('segment_id', String(segmentId));
+        const response = await api.post(`apex/v1/tunnel?path=${encodeURIComponent(`/v1/query?${params}`)}`, query);
+        return response.data;
+    },
+
+    getCustomerSegments: async () => {
+        const wpConfig = getWPConfig();
+        if (!wpConfig.nonce) return { customers: 0, segments: [], model: null, updated_at: null };
+        const response = await api.get('apex/v1/tunnel', { params: { path: '/v1/customers/segments' } });
+        return response.data;
+    },
+
+    getCustomers: async (segment?: string, sort: string = 'revenue', limit: number = 50, offset: number = 0) => {
+        const wpConfig = getWPConfig();
+        if (!wpConfig.nonce) return { customers: [], total: 0, limit, offset };
+        const params = new URLSearchParams({ sort, limit: String(limit), offset: String(offset) });
+        if (segment) params.set('segment', segment);
+        const response = await api.get('apex/v1/tunnel', { params: { path: `/v1/customers?${params}` } });
+        return response.data;
+    },
+
+    getExperiments: async () => {
+        const wpConfig = getWPConfig();
+        if (!wpConfig.nonce) return { experiments: [], unregistered: [] };
+        const response = await api.get('apex/v1/tunnel', { params: { path: '/v1/experiments' } });
+        return response.data;
+    },
+
+    getExperimentResults: async (id: number, metric?: { metric: string, goal_event?: string, goal_url?: string, funnel_id?: number }) => {
+        const wpConfig = getWPConfig();
+        if (!wpConfig.nonce) return { experiment: null, results: null, segment_id: null };
+        const params = new URLSearchParams();
+        Object.entries(metric || {}).forEach(([k, v]) => { if (v !== undefined && v !== '') params.set(k, String(v)); });
+        const query = params.toString();
+        const response = await api.get('apex/v1/tunnel', { params: { path: `/v1/experiments/${id}/results${query ? `?${query}` : ''}` } });
+        return response.data;
+    },
+
     getSegments: async () => {
         const wpConfig = getWPConfig();
         if (!wpConfig.nonce) return [
@@ -0,0 +1,185 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Series granularities for anomaly detection
+const (
+	SeriesHourly = "hour"
+	SeriesDaily  = "day"
+)
+
+// SeriesPoint is one bucket of a metric time series
+type SeriesPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// AnomalyOptions tunes the seasonal robust z-score detector
+type AnomalyOptions struct {
+	Granularity string  // "hour" (hour-of-week baseline) or "day" (day-of-week baseline)
+	Threshold   float64 // robust z-score needed to flag a point
+	MinHistory  int     // same-slot samples required before a point can be judged
+	MinValue    float64 // ignore buckets where both actual and expected are below this
+}
+
+// Anomaly is a bucket that deviates from its seasonal baseline
+type Anomaly struct {
+	Time      time.Time `json:"time"`
+	Value     float64   `json:"value"`
+	Expected  float64   `json:"expected"`
+	Score     float64   `json:"score"`     // robust z-score (signed)
+	Direction string    `json:"direction"` // "spike" or "drop"
+}
+
+// Contribution is how much one channel/page moved relative to its baseline
+type Contribution struct {
+	Key      string  `json:"key"`
+	Value    float64 `json:"value"`
+	Expected float64 `json:"expected"`
+	Delta    float64 `json:"delta"`
+	Share    float64 `json:"share"` // % of the total movement explained
+}
+
+// SensitivityThreshold maps low/medium/high (or a number) to a z-score threshold
+func SensitivityThreshold(s string) (float64, error) {
+	switch s {
+	case "", "medium":
+		return 3.5, nil
+	case "low":
+		return 5, nil
+	case "high":
+		return 2.5, nil
+	}
+	var z float64
+	if _, err := fmt.Sscanf(s, "%g", &z); err != nil || z <= 0 {
+		return 0, fmt.Errorf("sensitivity must be low, medium, high or a positive z-score")
+	}
+	return z, nil
+}
+
+// SeasonalSlot buckets a time into hour-of-week (hourly series) or day-of-week (daily series)
+func SeasonalSlot(t time.Time, granularity string) int {
+	if granularity == SeriesHourly {
+		return int(t.Weekday())*24 + t.Hour()
+	}
+	return int(t.Weekday())
+}
+
+// SeasonalBaseline returns the median and robust scale of the same-slot values before index i
+func SeasonalBaseline(series []SeriesPoint, i int, granularity string) (median, scale float64, n int) {
+	slot := SeasonalSlot(series[i].Time, granularity)
+	var history []float64
+	for j := 0; j < i; j++ {
+		if SeasonalSlot(series[j].Time, granularity) == slot {
+			history = append(history, series[j].Value)
+		}
+	}
+	if len(history) == 0 {
+		return 0, 0, 0
+	}
+
+	median = Median(history)
+	deviations := make([]float64, len(history))
+	for k, v := range history {
+		deviations[k] = math.Abs(v - median)
+	}
+	mad := Median(deviations)
+
+	// MAD collapses to 0 on flat history; fall back to a Poisson-like floor
+	scale = math.Max(1.4826*mad, math.Sqrt(math.Abs(median)))
+	if scale == 0 {
+		scale = 1
+	}
+	return median, scale, len(history)
+}
+
+// DetectAnomalies judges every point against the seasonal history that precedes it
+func DetectAnomalies(series []SeriesPoint, opts AnomalyOptions) []Anomaly {
+	sort.SliceStable(series, func(i, j int) bool { return series[i].Time.Before(series[j].Time) })
+	if opts.MinHistory <= 0 {
+		opts.MinHistory = 3
+	}
+
+	var anomalies []Anomaly
+	for i := range series {
+		if a, ok := judge(series, i, opts); ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+	return anomalies
+}
+
+// DetectLatest judges only the last point of the series
+func DetectLatest(series []SeriesPoint, opts AnomalyOptions) (Anomaly, bool) {
+	if len(series) == 0 {
+		return Anomaly{}, false
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].Time.Before(series[j].Time) })
+	if opts.MinHistory <= 0 {
+		opts.MinHistory = 3
+	}
+	return judge(series, len(series)-1, opts)
+}
+
+func judge(series []SeriesPoint, i int, opts AnomalyOptions) (Anomaly, bool) {
+	expected, scale, n := SeasonalBaseline(series, i, opts.Granularity)
+	if n < opts.MinHistory {
+		return Anomaly{}, false
+	}
+	v := series[i].Value
+	if v < opts.MinValue && expected < opts.MinValue {
+		return Anomaly{}, false
+	}
+	z := (v - expected) / scale
+	if math.Abs(z) < opts.Threshold {
+		return Anomaly{}, false
+	}
+	dir := "spike"
+	if z < 0 {
+		dir = "drop"
+	}
+	return Anomaly{Time: series[i].Time, Value: v, Expected: expected, Score: z, Direction: dir}, true
+}
+
+// Contributions explains an anomaly by comparing per-key values in the anomalous bucket with
+// their baseline, ranked by how much of the total movement each key accounts for
+func Contributions(current, baseline map[string]float64, limit int) []Contribution {
+	keys := map[string]bool{}
+	for k := range current {
+		keys[k] = true
+	}
+	for k := range baseline {
+		keys[k] = true
+	}
+
+	var totalDelta float64
+	var out []Contribution
+	for k := range keys {
+		c := Contribution{Key: k, Value: current[k], Expected: baseline[k]}
+		c.Delta = c.Value - c.Expected
+		totalDelta += c.Delta
+		out = append(out, c)
+	}
+	for i := range out {
+		if totalDelta != 0 {
+			out[i].Share = out[i].Delta / totalDelta * 100
+		}
+	}
+
+	// Keys moving in the same direction as the total come first
+	sort.Slice(out, func(i, j int) bool {
+		if totalDelta < 0 {
+			return out[i].Delta < out[j].Delta
+		}
+		return out[i].Delta > out[j].Delta
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
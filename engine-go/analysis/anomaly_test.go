@@ -0,0 +1,64 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectAnomaliesWeeklySeason(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) // a Monday
+	var series []SeriesPoint
+	for i := 0; i < 56; i++ {
+		day := start.AddDate(0, 0, i)
+		// Weekends are quieter; small deterministic jitter
+		v := 100.0 + float64(i%5) - 2
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			v = 40 + float64(i%3)
+		}
+		series = append(series, SeriesPoint{Time: day, Value: v})
+	}
+	series[50].Value = 300 // a Tuesday spike
+	series[54].Value = 100 // a Saturday at weekday level: unusual for its slot
+	series[55].Value = 0   // a Sunday outage
+
+	anomalies := DetectAnomalies(series, AnomalyOptions{Granularity: SeriesDaily, Threshold: 3.5})
+	require.Len(t, anomalies, 3)
+	assert.Equal(t, series[50].Time, anomalies[0].Time)
+	assert.Equal(t, "spike", anomalies[0].Direction)
+	assert.InDelta(t, 100, anomalies[0].Expected, 2)
+	assert.Equal(t, "spike", anomalies[1].Direction)
+	assert.Equal(t, "drop", anomalies[2].Direction)
+	assert.Less(t, anomalies[2].Score, -3.5)
+
+	latest, ok := DetectLatest(series, AnomalyOptions{Granularity: SeriesDaily, Threshold: 3.5})
+	assert.True(t, ok)
+	assert.Equal(t, series[55].Time, latest.Time)
+
+	// Too little same-slot history to judge, and buckets below MinValue are ignored
+	assert.Empty(t, DetectAnomalies(series[:21], AnomalyOptions{Granularity: SeriesDaily, Threshold: 3.5, MinHistory: 3}))
+	_, ok = DetectLatest(series, AnomalyOptions{Granularity: SeriesDaily, Threshold: 3.5, MinValue: 50})
+	assert.False(t, ok)
+}
+
+func TestSensitivityThreshold(t *testing.T) {
+	z, err := SensitivityThreshold("high")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, z)
+	z, err = SensitivityThreshold("4.2")
+	require.NoError(t, err)
+	assert.Equal(t, 4.2, z)
+	_, err = SensitivityThreshold("-1")
+	assert.Error(t, err)
+}
+
+func TestContributions(t *testing.T) {
+	out := Contributions(map[string]float64{"organic": 150, "direct": 50}, map[string]float64{"organic": 100, "direct": 50, "email": 10}, 0)
+	require.Len(t, out, 3)
+	assert.Equal(t, "organic", out[0].Key)
+	assert.Equal(t, 125.0, out[0].Share)
+	assert.Equal(t, "email", out[2].Key)
+	assert.Equal(t, -10.0, out[2].Delta)
+}
@@ -0,0 +1,309 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Attribution models
+const (
+	ModelFirstTouch    = "first_touch"
+	ModelLastTouch     = "last_touch"
+	ModelLinear        = "linear"
+	ModelTimeDecay     = "time_decay"
+	ModelPositionBased = "position_based"
+	ModelDataDriven    = "data_driven"
+)
+
+// AttributionModels lists every supported model in display order
+var AttributionModels = []string{ModelFirstTouch, ModelLastTouch, ModelLinear, ModelTimeDecay, ModelPositionBased, ModelDataDriven}
+
+// timeDecayHalfLife halves a touchpoint's weight for every 7 days before the conversion
+const timeDecayHalfLife = 7 * 24 * time.Hour
+
+// Touchpoint is one session that preceded a conversion
+type Touchpoint struct {
+	Time     time.Time `json:"time"`
+	Channel  string    `json:"channel"`
+	Campaign string    `json:"campaign"`
+}
+
+// Journey is a person's touchpoint path, ending either in a conversion or nowhere
+type Journey struct {
+	PersonID    string       `json:"person_id"`
+	Touchpoints []Touchpoint `json:"touchpoints"`
+	Converted   bool         `json:"converted"`
+	ConvertedAt time.Time    `json:"converted_at,omitempty"`
+	Revenue     float64      `json:"revenue"`
+}
+
+// AttributionRow is the credit one channel/campaign receives under a model
+type AttributionRow struct {
+	Key         string  `json:"key"`
+	Conversions float64 `json:"conversions"`
+	Revenue     float64 `json:"revenue"`
+}
+
+// BuildJourneys turns pageview and order_completed events into journeys. Each order becomes a
+// converting journey made of the sessions within the lookback window before it; touchpoints are
+// not reused by a later order. People with sessions but no order in [from, to) form one
+// non-converting journey, which the data-driven model needs.
+func BuildJourneys(events []TrackedEvent, from, to time.Time, lookback time.Duration) []Journey {
+	byPerson := map[string][]TrackedEvent{}
+	var order []string
+	for _, e := range events {
+		if _, ok := byPerson[e.PersonID]; !ok {
+			order = append(order, e.PersonID)
+		}
+		byPerson[e.PersonID] = append(byPerson[e.PersonID], e)
+	}
+
+	var journeys []Journey
+	for _, pid := range order {
+		evs := byPerson[pid]
+		sort.SliceStable(evs, func(i, j int) bool { return evs[i].Time.Before(evs[j].Time) })
+
+		var touches []Touchpoint
+		seenSession := map[string]bool{}
+		used := 0 // touchpoints already credited to an earlier order
+		converted := false
+
+		for _, e := range evs {
+			if e.Type == "order_completed" {
+				if e.Time.Before(from) || !e.Time.Before(to) {
+					used = len(touches)
+					continue
+				}
+				j := Journey{PersonID: pid, Converted: true, ConvertedAt: e.Time}
+				j.Revenue, _ = toFloat(e.Props["revenue"])
+				for _, t := range touches[used:] {
+					if e.Time.Sub(t.Time) <= lookback {
+						j.Touchpoints = append(j.Touchpoints, t)
+					}
+				}
+				if len(j.Touchpoints) == 0 {
+					j.Touchpoints = []Touchpoint{{Time: e.Time, Channel: ChannelDirect, Campaign: "(none)"}}
+				}
+				journeys = append(journeys, j)
+				used = len(touches)
+				converted = true
+				continue
+			}
+
+			if seenSession[e.SessionID] {
+				continue
+			}
+			seenSession[e.SessionID] = true
+			touches = append(touches, Touchpoint{Time: e.Time, Channel: e.Channel, Campaign: CampaignFromURL(e.URL)})
+		}
+
+		if !converted && used < len(touches) {
+			var tail []Touchpoint
+			for _, t := range touches[used:] {
+				if !t.Time.Before(from) && t.Time.Before(to) {
+					tail = append(tail, t)
+				}
+			}
+			if len(tail) > 0 {
+				journeys = append(journeys, Journey{PersonID: pid, Touchpoints: tail})
+			}
+		}
+	}
+	return journeys
+}
+
+// Attribute distributes conversions and revenue across channels ("channel") or campaigns
+// ("campaign") using the given model
+func Attribute(journeys []Journey, model, dimension string) ([]AttributionRow, error) {
+	key := func(t Touchpoint) string { return t.Channel }
+	if dimension == "campaign" {
+		key = func(t Touchpoint) string { return t.Campaign }
+	} else if dimension != "" && dimension != "channel" {
+		return nil, fmt.Errorf("unknown dimension %q", dimension)
+	}
+
+	credit := map[string]*AttributionRow{}
+	add := func(k string, share float64, j Journey) {
+		if _, ok := credit[k]; !ok {
+			credit[k] = &AttributionRow{Key: k}
+		}
+		credit[k].Conversions += share
+		credit[k].Revenue += share * j.Revenue
+	}
+
+	if model == ModelDataDriven {
+		shares := markovShares(journeys, key)
+		var totalConv, totalRev float64
+		for _, j := range journeys {
+			if j.Converted {
+				totalConv++
+				totalRev += j.Revenue
+			}
+		}
+		for k, s := range shares {
+			credit[k] = &AttributionRow{Key: k, Conversions: s * totalConv, Revenue: s * totalRev}
+		}
+		return sortedRows(credit), nil
+	}
+
+	for _, j := range journeys {
+		if !j.Converted || len(j.Touchpoints) == 0 {
+			continue
+		}
+		weights, err := touchWeights(j, model)
+		if err != nil {
+			return nil, err
+		}
+		for i, t := range j.Touchpoints {
+			add(key(t), weights[i], j)
+		}
+	}
+	return sortedRows(credit), nil
+}
+
+// touchWeights returns per-touchpoint credit that sums to 1
+func touchWeights(j Journey, model string) ([]float64, error) {
+	n := len(j.Touchpoints)
+	w := make([]float64, n)
+	switch model {
+	case ModelFirstTouch:
+		w[0] = 1
+	case ModelLastTouch:
+		w[n-1] = 1
+	case ModelLinear:
+		for i := range w {
+			w[i] = 1 / float64(n)
+		}
+	case ModelTimeDecay:
+		var sum float64
+		for i, t := range j.Touchpoints {
+			age := j.ConvertedAt.Sub(t.Time)
+			w[i] = math.Pow(0.5, float64(age)/float64(timeDecayHalfLife))
+			sum += w[i]
+		}
+		for i := range w {
+			w[i] /= sum
+		}
+	case ModelPositionBased:
+		// 40% first, 40% last, 20% shared by the middle
+		switch n {
+		case 1:
+			w[0] = 1
+		case 2:
+			w[0], w[1] = 0.5, 0.5
+		default:
+			w[0], w[n-1] = 0.4, 0.4
+			for i := 1; i < n-1; i++ {
+				w[i] = 0.2 / float64(n-2)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown attribution model %q", model)
+	}
+	return w, nil
+}
+
+// Markov chain states besides the channels themselves
+const (
+	stateStart      = "(start)"
+	stateConversion = "(conversion)"
+	stateNull       = "(null)"
+)
+
+// markovShares computes each channel's share of conversions from its removal effect in a
+// first-order Markov chain built from all journeys
+func markovShares(journeys []Journey, key func(Touchpoint) string) map[string]float64 {
+	transitions := map[string]map[string]float64{}
+	addEdge := func(from, to string) {
+		if transitions[from] == nil {
+			transitions[from] = map[string]float64{}
+		}
+		transitions[from][to]++
+	}
+
+	channels := map[string]bool{}
+	for _, j := range journeys {
+		prev := stateStart
+		for _, t := range j.Touchpoints {
+			k := key(t)
+			channels[k] = true
+			addEdge(prev, k)
+			prev = k
+		}
+		if j.Converted {
+			addEdge(prev, stateConversion)
+		} else {
+			addEdge(prev, stateNull)
+		}
+	}
+
+	base := conversionProbability(transitions, "")
+	shares := map[string]float64{}
+	if base == 0 {
+		return shares
+	}
+
+	var total float64
+	effects := map[string]float64{}
+	for ch := range channels {
+		effect := (base - conversionProbability(transitions, ch)) / base
+		if effect < 0 {
+			effect = 0
+		}
+		effects[ch] = effect
+		total += effect
+	}
+	for ch, e := range effects {
+		if total > 0 {
+			shares[ch] = e / total
+		}
+	}
+	return shares
+}
+
+// conversionProbability solves the absorbing chain by value iteration. A removed channel
+// behaves like the null state.
+func conversionProbability(transitions map[string]map[string]float64, removed string) float64 {
+	p := map[string]float64{stateConversion: 1}
+	for iter := 0; iter < 200; iter++ {
+		var delta float64
+		for from, outs := range transitions {
+			if from == removed {
+				continue
+			}
+			var total, value float64
+			for to, n := range outs {
+				total += n
+				if to != removed {
+					value += n * p[to]
+				}
+			}
+			if total == 0 {
+				continue
+			}
+			next := value / total
+			delta = math.Max(delta, math.Abs(next-p[from]))
+			p[from] = next
+		}
+		if delta < 1e-9 {
+			break
+		}
+	}
+	return p[stateStart]
+}
+
+func sortedRows(credit map[string]*AttributionRow) []AttributionRow {
+	rows := make([]AttributionRow, 0, len(credit))
+	for _, r := range credit {
+		rows = append(rows, *r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Revenue != rows[j].Revenue {
+			return rows[i].Revenue > rows[j].Revenue
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildJourneys(t *testing.T) {
+	t0 := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return t0.AddDate(0, 0, n) }
+	pv := func(person, session, channel string, at time.Time) TrackedEvent {
+		return TrackedEvent{PersonID: person, SessionID: session, Type: "pageview", Channel: channel, URL: "https://site.com/", Time: at}
+	}
+	order := func(person string, revenue interface{}, at time.Time) TrackedEvent {
+		return TrackedEvent{PersonID: person, Type: "order_completed", Props: map[string]interface{}{"revenue": revenue}, Time: at}
+	}
+	email := pv("p", "s2", ChannelEmail, day(-10))
+	email.URL = "https://site.com/?utm_campaign=summer"
+
+	events := []TrackedEvent{
+		// p: the organic session is outside the lookback, and the second order only gets the
+		// session after the first
+		pv("p", "s1", ChannelOrganicSearch, day(-40)),
+		email,
+		pv("p", "s2", ChannelEmail, day(-10).Add(time.Minute)), // same session, one touchpoint
+		order("p", "120", t0),
+		pv("p", "s3", ChannelDirect, day(1)),
+		order("p", 30.0, day(2)),
+		// q: no order, so one non-converting journey of the sessions in range
+		pv("q", "q0", ChannelReferral, day(-5)),
+		pv("q", "q1", ChannelReferral, day(3)),
+		// w: an order without any session is credited to Direct
+		order("w", 10.0, day(4)),
+		// r: an order before the range uses up the earlier sessions
+		pv("r", "r0", ChannelSocial, day(-4)),
+		order("r", 50.0, day(-3)),
+		pv("r", "r1", ChannelSocial, day(5)),
+	}
+
+	journeys := BuildJourneys(events, day(-1), day(10), 30*24*time.Hour)
+	require.Len(t, journeys, 5)
+
+	p1, p2, q, w, r := journeys[0], journeys[1], journeys[2], journeys[3], journeys[4]
+	assert.True(t, p1.Converted)
+	assert.Equal(t, 120.0, p1.Revenue)
+	assert.Equal(t, []Touchpoint{{Time: day(-10), Channel: ChannelEmail, Campaign: "summer"}}, p1.Touchpoints)
+	assert.Equal(t, 30.0, p2.Revenue)
+	require.Len(t, p2.Touchpoints, 1)
+	assert.Equal(t, ChannelDirect, p2.Touchpoints[0].Channel)
+
+	assert.False(t, q.Converted)
+	assert.Equal(t, []Touchpoint{{Time: day(3), Channel: ChannelReferral, Campaign: "(none)"}}, q.Touchpoints)
+
+	assert.Equal(t, []Touchpoint{{Time: day(4), Channel: ChannelDirect, Campaign: "(none)"}}, w.Touchpoints)
+
+	assert.Equal(t, "r", r.PersonID)
+	assert.False(t, r.Converted)
+	assert.Equal(t, []Touchpoint{{Time: day(5), Channel: ChannelSocial, Campaign: "(none)"}}, r.Touchpoints)
+}
+
+func TestTouchWeights(t *testing.T) {
+	t0 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	journey := func(n int) Journey {
+		j := Journey{Converted: true, ConvertedAt: t0}
+		for i := 0; i < n; i++ {
+			j.Touchpoints = append(j.Touchpoints, Touchpoint{Time: t0.AddDate(0, 0, -7*(n-1-i))})
+		}
+		return j
+	}
+
+	cases := []struct {
+		model string
+		n     int
+		want  []float64
+	}{
+		{ModelFirstTouch, 3, []float64{1, 0, 0}},
+		{ModelLastTouch, 3, []float64{0, 0, 1}},
+		{ModelLinear, 4, []float64{0.25, 0.25, 0.25, 0.25}},
+		{ModelPositionBased, 1, []float64{1}},
+		{ModelPositionBased, 2, []float64{0.5, 0.5}},
+		{ModelPositionBased, 3, []float64{0.4, 0.2, 0.4}},
+		{ModelPositionBased, 4, []float64{0.4, 0.1, 0.1, 0.4}},
+		// 14, 7 and 0 days old weigh 1/4, 1/2 and 1 before normalizing
+		{ModelTimeDecay, 3, []float64{1.0 / 7, 2.0 / 7, 4.0 / 7}},
+		{ModelTimeDecay, 1, []float64{1}},
+	}
+	for _, c := range cases {
+		w, err := touchWeights(journey(c.n), c.model)
+		require.NoError(t, err, c.model)
+		assert.InDeltaSlice(t, c.want, w, 1e-9, "%s with %d touchpoints", c.model, c.n)
+	}
+
+	_, err := touchWeights(journey(2), "u_shaped")
+	assert.Error(t, err)
+}
+
+// markovJourneys: A→B converts, A alone and B alone do not. Start goes to A 2/3 of the time and
+// to B 1/3; A continues to B half the time; B converts half the time. So P(convert) = 1/3,
+// without A it is 1/6 and without B it is 0: removal effects 0.5 and 1, shares 1/3 and 2/3.
+func markovJourneys() []Journey {
+	tp := func(ch string) Touchpoint { return Touchpoint{Channel: ch} }
+	return []Journey{
+		{Touchpoints: []Touchpoint{tp("A"), tp("B")}, Converted: true, Revenue: 90},
+		{Touchpoints: []Touchpoint{tp("A")}},
+		{Touchpoints: []Touchpoint{tp("B")}},
+	}
+}
+
+func TestConversionProbability(t *testing.T) {
+	transitions := map[string]map[string]float64{
+		stateStart: {"A": 2, "B": 1},
+		"A":        {"B": 1, stateNull: 1},
+		"B":        {stateConversion: 1, stateNull: 1},
+	}
+	assert.InDelta(t, 1.0/3, conversionProbability(transitions, ""), 1e-6)
+	assert.InDelta(t, 1.0/6, conversionProbability(transitions, "A"), 1e-6)
+	assert.InDelta(t, 0, conversionProbability(transitions, "B"), 1e-6)
+	assert.Zero(t, conversionProbability(map[string]map[string]float64{stateStart: {"A": 1}, "A": {stateNull: 1}}, ""))
+}
+
+func TestMarkovShares(t *testing.T) {
+	shares := markovShares(markovJourneys(), func(t Touchpoint) string { return t.Channel })
+	require.Len(t, shares, 2)
+	assert.InDelta(t, 1.0/3, shares["A"], 1e-6)
+	assert.InDelta(t, 2.0/3, shares["B"], 1e-6)
+
+	// Without any conversion there is nothing to share
+	assert.Empty(t, markovShares(markovJourneys()[1:], func(t Touchpoint) string { return t.Channel }))
+
+	rows, err := Attribute(markovJourneys(), ModelDataDriven, "channel")
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	byKey := map[string]AttributionRow{rows[0].Key: rows[0], rows[1].Key: rows[1]}
+	assert.InDelta(t, 2.0/3, byKey["B"].Conversions, 1e-6)
+	assert.InDelta(t, 60, byKey["B"].Revenue, 1e-4)
+	assert.InDelta(t, 30, byKey["A"].Revenue, 1e-4)
+}
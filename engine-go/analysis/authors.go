@@ -2,114 +2,439 @@ package analysis
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
 )
 
+// Leaderboard sort keys
+const (
+	AuthorSortScore      = "score"
+	AuthorSortViews      = "views"
+	AuthorSortEngaged    = "engaged_time"
+	AuthorSortScroll     = "scroll_completion"
+	AuthorSortConversion = "conversions"
+	AuthorSortDecay      = "decay_rate"
+)
+
+// scrollComplete is the max scroll depth (%) that counts as reading to the end
+const scrollComplete = 90
+
+// PageVisit is one session's time on one URL, built from its pageview/heartbeat/leave events
+type PageVisit struct {
+	SessionID string
+	URL       string
+	PostID    int
+	AuthorID  int
+	Day       string
+	Views     int
+	Scroll    float64 // max scroll depth %
+	Dwell     float64 // seconds between first and last event on the page
+}
+
+// AuthorInfo is a resolved WordPress author
+type AuthorInfo struct {
+	ID   int
+	Name string
+}
+
+// AuthorTrendPoint is one day of an author's trend line
+type AuthorTrendPoint struct {
+	Date        string  `json:"date"`
+	Views       int     `json:"views"`
+	EngagedTime float64 `json:"engaged_time"`
+}
+
 type AuthorStats struct {
-	AuthorID   int     `json:"author_id"`
-	Name       string  `json:"name"`
-	TotalViews int     `json:"total_views"`
-	AvgTime    float64 `json:"avg_time"`
-	Score      float64 `json:"score"` // Composite score
+	AuthorID         int                `json:"author_id"`
+	Name             string             `json:"name"`
+	TotalViews       int                `json:"total_views"`
+	AvgTime          float64            `json:"avg_time"`          // mean engaged seconds per view
+	ScrollCompletion float64            `json:"scroll_completion"` // % of visits reaching scrollComplete
+	Conversions      int                `json:"conversions"`       // converting sessions that read the author
+	DecayRate        float64            `json:"decay_rate"`        // % of the author's posts currently decaying
+	Posts            int                `json:"posts"`
+	Score            float64            `json:"score"` // Composite score
+	Trend            []AuthorTrendPoint `json:"trend"`
+}
+
+// AuthorOptions selects the leaderboard ordering
+type AuthorOptions struct {
+	Sort  string
+	Limit int
+}
+
+// Validate applies defaults and rejects unknown sort keys
+func (o *AuthorOptions) Validate() error {
+	switch o.Sort {
+	case "":
+		o.Sort = AuthorSortScore
+	case AuthorSortScore, AuthorSortViews, AuthorSortEngaged, AuthorSortScroll, AuthorSortConversion, AuthorSortDecay:
+	default:
+		return fmt.Errorf("unknown sort %q", o.Sort)
+	}
+	if o.Limit <= 0 {
+		o.Limit = 20
+	}
+	return nil
+}
+
+// CalculateAuthorLeaderboard ranks authors by engagement over a period. Decay compares the
+// period against the same number of days before it.
+func CalculateAuthorLeaderboard(db *sql.DB, opts AuthorOptions, period Period) ([]AuthorStats, error) {
+	visits, err := LoadPageVisits(db, period.Start, period.End)
+	if err != nil {
+		return nil, err
+	}
+	if len(visits) == 0 {
+		return []AuthorStats{}, nil
+	}
+
+	authors, err := resolveAuthors(db, visits)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := convertingSessions(db, period.Start, period.End)
+	if err != nil {
+		return nil, err
+	}
+
+	decayOpts := DecayOptions{Mode: DecayPeriod, Window: period.Days(), Limit: 1000}
+	decayOpts.Validate()
+	decaying, err := CalculateContentDecay(db, decayOpts, period.End)
+	if err != nil {
+		return nil, err
+	}
+	decayingURLs := map[string]bool{}
+	for _, d := range decaying {
+		decayingURLs[d.URL] = true
+	}
+
+	results := RankAuthors(visits, authors, converted, decayingURLs)
+	SortAuthors(results, opts.Sort)
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
 }
 
-// CalculateAuthorLeaderboard ranks authors by engagement
-func CalculateAuthorLeaderboard(db *sql.DB) ([]AuthorStats, error) {
-	// We need to parse existing JSON payloads from the DB.
-	// Since MySQL 5.7+ supports JSON_EXTRACT, we can try that.
-	// However, for compatibility and simplicity in this Go layer, let's fetch recent events and aggregate in memory
-	// OR query assuming `pid` and `aid` will be populated from now on.
-
-	// Query: Get recent pageviews with their payload
-	// Limiting to last 10000 events for performance in this demo
-	// In production, we'd use a derived table or dedicated columns.
-	query := `
-		SELECT 
-			e.payload,
-			u.display_name
-		FROM wp_apex_events e
-		LEFT JOIN wp_users u ON 1=0 -- Join logic handled in loop or assuming valid AID
-		WHERE e.event_type IN ('leave', 'heartbeat') 
-		AND e.created_at >= DATE_SUB(NOW(), INTERVAL 7 DAY)
-		ORDER BY e.created_at DESC
-		LIMIT 5000
-	`
-	// Wait, if we just added `aid` to the payload, old data won't have it.
-	// So this leaderboard will only populate as new data comes in.
-	// To make it look "alive" immediately, I will mock the aggregation or try to join via wp_posts using URL if possible.
-
-	// Improved Query: Try to join wp_posts on URL if possible?
-	// Let's rely on the mock/simulation for the "Verify" step if data is empty.
-
-	// For the actual implementation, let's assume `aid` is in the payload.
-	// We fetch raw events and process.
-
-	rows, err := db.Query(query)
+// LoadPageVisits groups engagement events by (session, URL). Post and author IDs come from the
+// page metadata the tracker attaches (pid, aid).
+func LoadPageVisits(db *sql.DB, from, to time.Time) ([]PageVisit, error) {
+	rows, err := db.Query(`
+		SELECT session_id, url,
+			MAX(CAST(COALESCE(JSON_UNQUOTE(JSON_EXTRACT(payload, '$.pid')), '0') AS UNSIGNED)),
+			MAX(CAST(COALESCE(JSON_UNQUOTE(JSON_EXTRACT(payload, '$.aid')), '0') AS UNSIGNED)),
+			DATE_FORMAT(MIN(created_at), '%Y-%m-%d'),
+			SUM(event_type = 'pageview'),
+			COALESCE(MAX(CAST(JSON_UNQUOTE(JSON_EXTRACT(payload, '$.sc')) AS DECIMAL(6,2))), 0),
+			TIMESTAMPDIFF(SECOND, MIN(created_at), MAX(created_at))
+		FROM wp_apex_events
+		WHERE event_type IN ('pageview', 'heartbeat', 'leave') AND created_at >= ? AND created_at < ?
+		GROUP BY session_id, url`, from, to)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %v", err)
 	}
 	defer rows.Close()
 
-	statsMap := make(map[int]*AuthorStats)
+	var visits []PageVisit
+	for rows.Next() {
+		var v PageVisit
+		if err := rows.Scan(&v.SessionID, &v.URL, &v.PostID, &v.AuthorID, &v.Day, &v.Views, &v.Scroll, &v.Dwell); err != nil {
+			return nil, err
+		}
+		visits = append(visits, v)
+	}
+	return visits, rows.Err()
+}
 
-	// Mock names map since we might not have wp_users access easily depending on privileges??
-	// Actually we do have DB access.
+// resolveAuthors fills in AuthorID for visits without one and returns every author's name.
+// Plugin-pushed metadata is matched by post ID, then by URL; wp_posts.post_author covers posts
+// the plugin never pushed. wp_posts and wp_users are optional, since the engine's database is
+// not always WordPress's, so failing to read them falls back to the metadata names.
+func resolveAuthors(db *sql.DB, visits []PageVisit) (map[int]AuthorInfo, error) {
+	postIDs := map[int]bool{}
+	var urls []interface{}
+	seenURL := map[string]bool{}
+	for _, v := range visits {
+		if v.AuthorID > 0 {
+			continue
+		}
+		if v.PostID > 0 {
+			postIDs[v.PostID] = true
+		}
+		if !seenURL[v.URL] {
+			seenURL[v.URL] = true
+			urls = append(urls, v.URL)
+		}
+	}
 
-	// Let's use a simpler approach for the MVP:
-	// Generate mock stats if real data is insufficient, to demonstrate the UI.
-	// But honestly, I'll write the logic to aggregate "pid" / "aid" from payload.
+	postAuthor := map[int]int{}
+	urlAuthor := map[string]int{}
+	names := map[int]string{}
+	if len(urls) > 0 {
+		args := urls
+		where := `url IN (?` + strings.Repeat(", ?", len(urls)-1) + `)`
+		if len(postIDs) > 0 {
+			where += ` OR post_id IN (?` + strings.Repeat(", ?", len(postIDs)-1) + `)`
+			for id := range postIDs {
+				args = append(args, id)
+			}
+		}
+		rows, err := db.Query(`SELECT url, post_id, author_id, author_name FROM wp_apex_post_meta WHERE `+where, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var url, name string
+			var postID, author int
+			if rows.Scan(&url, &postID, &author, &name) == nil && author > 0 {
+				postAuthor[postID] = author
+				urlAuthor[url] = author
+				names[author] = name
+			}
+		}
+		rows.Close()
+	}
 
+	var missing []interface{}
+	for id := range postIDs {
+		if _, ok := postAuthor[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		rows, err := db.Query(`SELECT ID, post_author FROM wp_posts WHERE ID IN (?`+strings.Repeat(", ?", len(missing)-1)+`)`, missing...)
+		if err == nil {
+			for rows.Next() {
+				var id, author int
+				if rows.Scan(&id, &author) == nil && author > 0 {
+					postAuthor[id] = author
+				}
+			}
+			rows.Close()
+		}
+	}
+
+	authorIDs := map[int]bool{}
+	for i := range visits {
+		v := &visits[i]
+		if v.AuthorID == 0 {
+			// A post ID that neither source knows still falls back to the URL
+			if a, ok := postAuthor[v.PostID]; ok && v.PostID > 0 {
+				v.AuthorID = a
+			} else {
+				v.AuthorID = urlAuthor[v.URL]
+			}
+		}
+		if v.AuthorID > 0 {
+			authorIDs[v.AuthorID] = true
+		}
+	}
+
+	authors := map[int]AuthorInfo{}
+	if len(authorIDs) == 0 {
+		return authors, nil
+	}
+	ids := make([]interface{}, 0, len(authorIDs))
+	for id := range authorIDs {
+		ids = append(ids, id)
+		authors[id] = AuthorInfo{ID: id, Name: names[id]}
+	}
+	rows, err := db.Query(`SELECT ID, display_name FROM wp_users WHERE ID IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`, ids...)
+	if err == nil {
+		for rows.Next() {
+			var id int
+			var name string
+			if rows.Scan(&id, &name) == nil && name != "" {
+				authors[id] = AuthorInfo{ID: id, Name: name}
+			}
+		}
+		rows.Close()
+	}
+	for id, a := range authors {
+		if a.Name == "" {
+			authors[id] = AuthorInfo{ID: id, Name: fmt.Sprintf("Author %d", id)}
+		}
+	}
+	return authors, nil
+}
+
+// convertingSessions returns sessions with a completed order in the range
+func convertingSessions(db *sql.DB, from, to time.Time) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT DISTINCT session_id FROM wp_apex_events
+		WHERE event_type = 'order_completed' AND created_at >= ? AND created_at < ?`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]bool{}
 	for rows.Next() {
-		var payloadRaw []byte
-		var rName sql.NullString // Placeholder
-		if err := rows.Scan(&payloadRaw, &rName); err != nil {
-			continue
+		var sid string
+		if rows.Scan(&sid) == nil {
+			out[sid] = true
 		}
+	}
+	return out, rows.Err()
+}
 
-		var data map[string]interface{}
-		if err := json.Unmarshal(payloadRaw, &data); err != nil {
+// RankAuthors aggregates visits per resolved author. The composite score is a weighted mean of
+// each metric's percentile rank among authors (views 30%, engaged time 25%, scroll completion
+// 20%, conversions 15%, absence of decay 10%), scaled to 0-100.
+func RankAuthors(visits []PageVisit, authors map[int]AuthorInfo, converted map[string]bool, decayingURLs map[string]bool) []AuthorStats {
+	type acc struct {
+		stats     AuthorStats
+		visits    int
+		completed int
+		dwell     float64
+		sessions  map[string]bool
+		urls      map[string]bool
+		trend     map[string]*AuthorTrendPoint
+	}
+	byAuthor := map[int]*acc{}
+	for _, v := range visits {
+		if v.AuthorID <= 0 {
 			continue
 		}
+		a := byAuthor[v.AuthorID]
+		if a == nil {
+			info, ok := authors[v.AuthorID]
+			if !ok {
+				info = AuthorInfo{ID: v.AuthorID, Name: fmt.Sprintf("Author %d", v.AuthorID)}
+			}
+			a = &acc{
+				stats:    AuthorStats{AuthorID: info.ID, Name: info.Name},
+				sessions: map[string]bool{},
+				urls:     map[string]bool{},
+				trend:    map[string]*AuthorTrendPoint{},
+			}
+			byAuthor[v.AuthorID] = a
+		}
 
-		d, ok := data["d"].(map[string]interface{})
-		if !ok {
-			continue
+		a.visits++
+		a.stats.TotalViews += v.Views
+		a.dwell += v.Dwell
+		if v.Scroll >= scrollComplete {
+			a.completed++
 		}
+		a.sessions[v.SessionID] = true
+		a.urls[v.URL] = true
 
-		aid, ok := d["aid"].(float64) // JSON numbers are floats
-		if !ok || aid == 0 {
-			continue
+		p := a.trend[v.Day]
+		if p == nil {
+			p = &AuthorTrendPoint{Date: v.Day}
+			a.trend[v.Day] = p
 		}
+		p.Views += v.Views
+		p.EngagedTime += v.Dwell
+	}
 
-		ts, _ := d["ts"].(float64)
+	results := make([]AuthorStats, 0, len(byAuthor))
+	for _, a := range byAuthor {
+		s := a.stats
+		if s.TotalViews > 0 {
+			s.AvgTime = math.Round(a.dwell/float64(s.TotalViews)*10) / 10
+		}
+		s.ScrollCompletion = math.Round(float64(a.completed)/float64(a.visits)*1000) / 10
+		for sid := range a.sessions {
+			if converted[sid] {
+				s.Conversions++
+			}
+		}
+		s.Posts = len(a.urls)
+		decaying := 0
+		for u := range a.urls {
+			if decayingURLs[u] {
+				decaying++
+			}
+		}
+		s.DecayRate = math.Round(float64(decaying)/float64(s.Posts)*1000) / 10
 
-		if _, exists := statsMap[int(aid)]; !exists {
-			statsMap[int(aid)] = &AuthorStats{AuthorID: int(aid), Name: fmt.Sprintf("Author %d", int(aid))}
+		s.Trend = make([]AuthorTrendPoint, 0, len(a.trend))
+		for _, p := range a.trend {
+			s.Trend = append(s.Trend, *p)
 		}
+		sort.Slice(s.Trend, func(i, j int) bool { return s.Trend[i].Date < s.Trend[j].Date })
 
-		entry := statsMap[int(aid)]
-		entry.TotalViews++
-		entry.AvgTime += ts
+		results = append(results, s)
 	}
 
-	var results []AuthorStats
-	for _, s := range statsMap {
-		if s.TotalViews > 0 {
-			s.AvgTime = s.AvgTime / float64(s.TotalViews)
-			s.Score = float64(s.TotalViews) * s.AvgTime // Simple Engagement Score
-			results = append(results, *s)
+	scoreAuthors(results)
+	return results
+}
+
+func scoreAuthors(results []AuthorStats) {
+	metrics := []struct {
+		weight float64
+		value  func(AuthorStats) float64
+	}{
+		{0.30, func(s AuthorStats) float64 { return float64(s.TotalViews) }},
+		{0.25, func(s AuthorStats) float64 { return s.AvgTime }},
+		{0.20, func(s AuthorStats) float64 { return s.ScrollCompletion }},
+		{0.15, func(s AuthorStats) float64 { return float64(s.Conversions) }},
+		{0.10, func(s AuthorStats) float64 { return -s.DecayRate }},
+	}
+	for i := range results {
+		results[i].Score = 0
+	}
+	for _, m := range metrics {
+		for i := range results {
+			results[i].Score += m.weight * percentileRank(results, i, m.value)
 		}
 	}
+	for i := range results {
+		results[i].Score = math.Round(results[i].Score*1000) / 10
+	}
+}
 
-	if len(results) == 0 {
-		// Return Mock Signal if empty (for demo/walkthrough)
-		return []AuthorStats{
-			{AuthorID: 1, Name: "Sarah Connor", TotalViews: 1250, AvgTime: 145, Score: 181250},
-			{AuthorID: 2, Name: "John Doe", TotalViews: 980, AvgTime: 65, Score: 63700},
-			{AuthorID: 3, Name: "Jane Smith", TotalViews: 3400, AvgTime: 230, Score: 782000},
-		}, nil
+// percentileRank is the share of other authors with a lower value, counting ties as half
+func percentileRank(results []AuthorStats, i int, value func(AuthorStats) float64) float64 {
+	if len(results) < 2 {
+		return 1
+	}
+	v := value(results[i])
+	var below float64
+	for j := range results {
+		if j == i {
+			continue
+		}
+		switch w := value(results[j]); {
+		case w < v:
+			below++
+		case w == v:
+			below += 0.5
+		}
 	}
+	return below / float64(len(results)-1)
+}
 
-	return results, nil
+// SortAuthors orders the leaderboard by a sort key (decay rate ascending, everything else descending)
+func SortAuthors(results []AuthorStats, key string) {
+	value := func(s AuthorStats) float64 {
+		switch key {
+		case AuthorSortViews:
+			return float64(s.TotalViews)
+		case AuthorSortEngaged:
+			return s.AvgTime
+		case AuthorSortScroll:
+			return s.ScrollCompletion
+		case AuthorSortConversion:
+			return float64(s.Conversions)
+		case AuthorSortDecay:
+			return -s.DecayRate
+		default:
+			return s.Score
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		vi, vj := value(results[i]), value(results[j])
+		if vi != vj {
+			return vi > vj
+		}
+		return results[i].AuthorID < results[j].AuthorID
+	})
 }
@@ -0,0 +1,64 @@
+package analysis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankAuthors(t *testing.T) {
+	visits := []PageVisit{
+		{SessionID: "s1", URL: "/a", AuthorID: 1, Day: "2024-06-01", Views: 1, Scroll: 95, Dwell: 120},
+		{SessionID: "s2", URL: "/a", AuthorID: 1, Day: "2024-06-02", Views: 1, Scroll: 100, Dwell: 180},
+		{SessionID: "s3", URL: "/b", AuthorID: 2, Day: "2024-06-01", Views: 2, Scroll: 20, Dwell: 10},
+		{SessionID: "s4", URL: "/c", AuthorID: 2, Day: "2024-06-01", Views: 1, Scroll: 30, Dwell: 5},
+		{SessionID: "s5", URL: "/d", AuthorID: 0, Day: "2024-06-01", Views: 9},
+	}
+	authors := map[int]AuthorInfo{1: {ID: 1, Name: "Ada"}, 2: {ID: 2, Name: "Bo"}}
+
+	results := RankAuthors(visits, authors, map[string]bool{"s2": true}, map[string]bool{"/b": true})
+	SortAuthors(results, AuthorSortScore)
+	require.Len(t, results, 2)
+
+	ada, bo := results[0], results[1]
+	assert.Equal(t, "Ada", ada.Name)
+	assert.Equal(t, 2, ada.TotalViews)
+	assert.InDelta(t, 150, ada.AvgTime, 0.01)
+	assert.InDelta(t, 100, ada.ScrollCompletion, 0.01)
+	assert.Equal(t, 1, ada.Conversions)
+	assert.Len(t, ada.Trend, 2)
+
+	assert.Equal(t, 3, bo.TotalViews)
+	assert.InDelta(t, 50, bo.DecayRate, 0.01)
+	assert.Greater(t, ada.Score, bo.Score)
+
+	SortAuthors(results, AuthorSortViews)
+	assert.Equal(t, "Bo", results[0].Name)
+}
+
+func TestResolveAuthorsWithoutWordPressTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	visits := []PageVisit{
+		{SessionID: "s1", URL: "/a", PostID: 5}, // post 5 is unknown by ID but its URL was pushed
+		{SessionID: "s2", URL: "/b", PostID: 7},
+		{SessionID: "s3", URL: "/c", AuthorID: 9},
+	}
+	mock.ExpectQuery("FROM wp_apex_post_meta WHERE url IN \\(\\?, \\?\\) OR post_id IN \\(\\?, \\?\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"url", "post_id", "author_id", "author_name"}).
+			AddRow("/a", 50, 3, "Ada"))
+	mock.ExpectQuery("FROM wp_posts").WillReturnError(errors.New("Table 'wp_posts' doesn't exist"))
+	mock.ExpectQuery("FROM wp_users").WillReturnError(errors.New("Table 'wp_users' doesn't exist"))
+
+	authors, err := resolveAuthors(db, visits)
+	require.NoError(t, err)
+	assert.Equal(t, 3, visits[0].AuthorID)
+	assert.Equal(t, 0, visits[1].AuthorID)
+	assert.Equal(t, map[int]AuthorInfo{3: {ID: 3, Name: "Ada"}, 9: {ID: 9, Name: "Author 9"}}, authors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
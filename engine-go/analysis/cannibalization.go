@@ -1,29 +1,263 @@
 package analysis
 
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Brand segments for cannibalization analysis
+const (
+	SegmentAll      = "all"
+	SegmentBrand    = "brand"
+	SegmentNonBrand = "non_brand"
+)
+
+// GSCRow is one Search Console (query, page) row, summed over a date range
+type GSCRow struct {
+	Query       string  `json:"query"`
+	Page        string  `json:"page"`
+	Clicks      float64 `json:"clicks"`
+	Impressions float64 `json:"impressions"`
+	Position    float64 `json:"position"` // impression-weighted average
+}
+
+// CTRCurve is the expected organic CTR at positions 1..N
+var CTRCurve = []float64{0.28, 0.157, 0.11, 0.08, 0.072, 0.051, 0.04, 0.032, 0.028, 0.025,
+	0.02, 0.017, 0.015, 0.013, 0.012, 0.011, 0.01, 0.009, 0.008, 0.007}
+
+// ExpectedCTR interpolates CTRCurve at a (fractional) position
+func ExpectedCTR(position float64) float64 {
+	if position <= 1 {
+		return CTRCurve[0]
+	}
+	last := float64(len(CTRCurve))
+	if position >= last {
+		return CTRCurve[len(CTRCurve)-1] * last / position
+	}
+	lo := int(math.Floor(position))
+	frac := position - float64(lo)
+	return CTRCurve[lo-1] + (CTRCurve[lo]-CTRCurve[lo-1])*frac
+}
+
+// CannibalizationOptions tunes which queries count as cannibalized
+type CannibalizationOptions struct {
+	MinImpressions float64  // query impressions needed to be considered
+	MinShare       float64  // % of query impressions the second page must hold
+	BrandTerms     []string // lowercase substrings that make a query "brand"
+	Segment        string   // all, brand or non_brand
+}
+
+// CannibalPage is one URL's share of a cannibalized query
+type CannibalPage struct {
+	URL             string  `json:"url"`
+	Clicks          float64 `json:"clicks"`
+	Impressions     float64 `json:"impressions"`
+	Position        float64 `json:"position"`
+	ImpressionShare float64 `json:"impression_share"`
+}
+
+// CannibalizationResult is a query whose impressions are split across several URLs
 type CannibalizationResult struct {
-	Keyword    string    `json:"keyword"`
-	Urls       []string  `json:"urls"`
-	Positions  []float64 `json:"positions"`
-	LostClicks int       `json:"lost_clicks"`
-}
-
-// CheckCannibalization detects if multiple pages rank for the same keyword
-func CheckCannibalization() ([]CannibalizationResult, error) {
-	// Mock Logic for MVP (Simulating GSC analysis)
-	// Real implementation would query GSC API for (Query, Page) tuples and find duplicates for Query
-
-	return []CannibalizationResult{
-		{
-			Keyword:    "best ai plugins",
-			Urls:       []string{"/blog/top-10-ai-plugins", "/blog/best-wordpress-plugins-2024"},
-			Positions:  []float64{4.5, 6.2},
-			LostClicks: 45,
-		},
-		{
-			Keyword:    "increase wordpress speed",
-			Urls:       []string{"/guide/speed-optimization", "/blog/cache-plugins"},
-			Positions:  []float64{8.1, 9.5},
-			LostClicks: 12,
-		},
-	}, nil
+	Keyword     string         `json:"keyword"`
+	Urls        []string       `json:"urls"`
+	Positions   []float64      `json:"positions"`
+	LostClicks  int            `json:"lost_clicks"`
+	Clicks      float64        `json:"clicks"`
+	Impressions float64        `json:"impressions"`
+	Brand       bool           `json:"brand"`
+	Pages       []CannibalPage `json:"pages"`
+}
+
+// ConsolidationCandidate groups pages that compete on the same queries, with the page that
+// should absorb the others
+type ConsolidationCandidate struct {
+	Primary    string   `json:"primary"`
+	Secondary  []string `json:"secondary"`
+	Queries    []string `json:"queries"`
+	LostClicks int      `json:"lost_clicks"`
+	Action     string   `json:"action"` // "merge" (redirect secondaries) or "differentiate"
+}
+
+// IsBrandQuery reports whether a query contains any brand term
+func IsBrandQuery(query string, brandTerms []string) bool {
+	q := strings.ToLower(query)
+	for _, t := range brandTerms {
+		if t != "" && strings.Contains(q, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCannibalization finds queries where two or more URLs each hold a meaningful share of
+// impressions. Lost clicks estimate what a single page at the best current position would earn
+// with all of the query's impressions, minus the clicks actually received.
+func CheckCannibalization(rows []GSCRow, opts CannibalizationOptions) []CannibalizationResult {
+	if opts.MinImpressions <= 0 {
+		opts.MinImpressions = 100
+	}
+	if opts.MinShare <= 0 {
+		opts.MinShare = 10
+	}
+
+	type acc struct {
+		clicks, impressions, posWeighted float64
+	}
+	byQuery := map[string]map[string]*acc{}
+	for _, r := range rows {
+		q := strings.ToLower(strings.TrimSpace(r.Query))
+		if q == "" || r.Page == "" {
+			continue
+		}
+		if byQuery[q] == nil {
+			byQuery[q] = map[string]*acc{}
+		}
+		a := byQuery[q][r.Page]
+		if a == nil {
+			a = &acc{}
+			byQuery[q][r.Page] = a
+		}
+		a.clicks += r.Clicks
+		a.impressions += r.Impressions
+		a.posWeighted += r.Position * r.Impressions
+	}
+
+	results := []CannibalizationResult{}
+	for q, pages := range byQuery {
+		brand := IsBrandQuery(q, opts.BrandTerms)
+		if (opts.Segment == SegmentBrand && !brand) || (opts.Segment == SegmentNonBrand && brand) {
+			continue
+		}
+
+		res := CannibalizationResult{Keyword: q, Brand: brand}
+		for url, a := range pages {
+			res.Clicks += a.clicks
+			res.Impressions += a.impressions
+			p := CannibalPage{URL: url, Clicks: a.clicks, Impressions: a.impressions}
+			if a.impressions > 0 {
+				p.Position = a.posWeighted / a.impressions
+			}
+			res.Pages = append(res.Pages, p)
+		}
+		if res.Impressions < opts.MinImpressions {
+			continue
+		}
+
+		competing := 0
+		best := math.Inf(1)
+		for i := range res.Pages {
+			res.Pages[i].ImpressionShare = res.Pages[i].Impressions / res.Impressions * 100
+			if res.Pages[i].ImpressionShare >= opts.MinShare {
+				competing++
+			}
+			if res.Pages[i].Impressions > 0 && res.Pages[i].Position < best {
+				best = res.Pages[i].Position
+			}
+		}
+		if competing < 2 {
+			continue
+		}
+
+		sort.Slice(res.Pages, func(i, j int) bool {
+			if res.Pages[i].Clicks != res.Pages[j].Clicks {
+				return res.Pages[i].Clicks > res.Pages[j].Clicks
+			}
+			return res.Pages[i].Impressions > res.Pages[j].Impressions
+		})
+		for _, p := range res.Pages {
+			res.Urls = append(res.Urls, p.URL)
+			res.Positions = append(res.Positions, math.Round(p.Position*10)/10)
+		}
+		potential := res.Impressions * ExpectedCTR(best)
+		res.LostClicks = int(math.Max(math.Round(potential-res.Clicks), 0))
+
+		results = append(results, res)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].LostClicks != results[j].LostClicks {
+			return results[i].LostClicks > results[j].LostClicks
+		}
+		return results[i].Keyword < results[j].Keyword
+	})
+	return results
+}
+
+// ConsolidationCandidates clusters cannibalized queries by the pages they share. Within a
+// cluster the page with the most clicks is primary. Secondaries earning under 20% of the
+// cluster's clicks are merge candidates; otherwise the pages should be differentiated.
+func ConsolidationCandidates(results []CannibalizationResult) []ConsolidationCandidate {
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(u string) string {
+		if parent[u] != u {
+			parent[u] = find(parent[u])
+		}
+		return parent[u]
+	}
+	for _, r := range results {
+		for _, u := range r.Urls {
+			if _, ok := parent[u]; !ok {
+				parent[u] = u
+			}
+		}
+		for _, u := range r.Urls[1:] {
+			parent[find(u)] = find(r.Urls[0])
+		}
+	}
+
+	type cluster struct {
+		clicks  map[string]float64
+		queries []string
+		lost    int
+	}
+	clusters := map[string]*cluster{}
+	for _, r := range results {
+		root := find(r.Urls[0])
+		cl := clusters[root]
+		if cl == nil {
+			cl = &cluster{clicks: map[string]float64{}}
+			clusters[root] = cl
+		}
+		cl.queries = append(cl.queries, r.Keyword)
+		cl.lost += r.LostClicks
+		for _, p := range r.Pages {
+			cl.clicks[p.URL] += p.Clicks
+		}
+	}
+
+	candidates := []ConsolidationCandidate{}
+	for _, cl := range clusters {
+		var urls []string
+		var total float64
+		for u, c := range cl.clicks {
+			urls = append(urls, u)
+			total += c
+		}
+		sort.Slice(urls, func(i, j int) bool {
+			if cl.clicks[urls[i]] != cl.clicks[urls[j]] {
+				return cl.clicks[urls[i]] > cl.clicks[urls[j]]
+			}
+			return urls[i] < urls[j]
+		})
+
+		c := ConsolidationCandidate{Primary: urls[0], Secondary: urls[1:], Queries: cl.queries, LostClicks: cl.lost, Action: "merge"}
+		for _, u := range c.Secondary {
+			if total > 0 && cl.clicks[u]/total >= 0.2 {
+				c.Action = "differentiate"
+				break
+			}
+		}
+		sort.Strings(c.Queries)
+		candidates = append(candidates, c)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].LostClicks != candidates[j].LostClicks {
+			return candidates[i].LostClicks > candidates[j].LostClicks
+		}
+		return candidates[i].Primary < candidates[j].Primary
+	})
+	return candidates
 }
@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadGSCFixture(t *testing.T) []GSCRow {
+	data, err := os.ReadFile("testdata/gsc_rows.json")
+	require.NoError(t, err)
+	var rows []GSCRow
+	require.NoError(t, json.Unmarshal(data, &rows))
+	return rows
+}
+
+func TestCheckCannibalization(t *testing.T) {
+	rows := loadGSCFixture(t)
+	opts := CannibalizationOptions{BrandTerms: []string{"apex"}}
+
+	results := CheckCannibalization(rows, opts)
+	byKeyword := map[string]CannibalizationResult{}
+	for _, r := range results {
+		byKeyword[r.Keyword] = r
+	}
+
+	// A dominant page with a stray long-tail URL, and low-volume queries, are not cannibalization
+	assert.NotContains(t, byKeyword, "wordpress seo checklist")
+	assert.NotContains(t, byKeyword, "tiny query")
+	require.Len(t, results, 4)
+
+	// Query variants are merged and the page with more clicks comes first
+	best := byKeyword["best ai plugins"]
+	assert.Equal(t, []string{"/blog/top-10-ai-plugins", "/blog/best-wordpress-plugins-2024"}, best.Urls)
+	assert.Equal(t, 2300.0, best.Impressions)
+	// All 2300 impressions at the best position, (4.5*1200 + 4.1*300) / 1500 = 4.42, minus the 65 clicks received
+	assert.InDelta(t, 4.42, best.Pages[0].Position, 0.001)
+	assert.InDelta(t, 2300*ExpectedCTR(4.42)-65, float64(best.LostClicks), 1)
+	assert.True(t, byKeyword["apex insights pricing"].Brand)
+
+	nonBrand := CheckCannibalization(rows, CannibalizationOptions{BrandTerms: []string{"apex"}, Segment: SegmentNonBrand})
+	assert.Len(t, nonBrand, 3)
+	brand := CheckCannibalization(rows, CannibalizationOptions{BrandTerms: []string{"apex"}, Segment: SegmentBrand})
+	require.Len(t, brand, 1)
+	assert.Equal(t, "apex insights pricing", brand[0].Keyword)
+}
+
+func TestConsolidationCandidates(t *testing.T) {
+	results := CheckCannibalization(loadGSCFixture(t), CannibalizationOptions{Segment: SegmentNonBrand, BrandTerms: []string{"apex"}})
+	candidates := ConsolidationCandidates(results)
+	require.Len(t, candidates, 2)
+
+	byPrimary := map[string]ConsolidationCandidate{}
+	for _, c := range candidates {
+		byPrimary[c.Primary] = c
+	}
+
+	plugins := byPrimary["/blog/top-10-ai-plugins"]
+	assert.Equal(t, []string{"/blog/best-wordpress-plugins-2024"}, plugins.Secondary)
+	assert.Equal(t, []string{"ai plugins for wordpress", "best ai plugins"}, plugins.Queries)
+	assert.Equal(t, "merge", plugins.Action)
+
+	// Two pages with near-equal clicks serve different intents rather than duplicates
+	speed := byPrimary["/guide/speed-optimization"]
+	assert.Equal(t, "differentiate", speed.Action)
+}
+
+func TestExpectedCTR(t *testing.T) {
+	assert.Equal(t, CTRCurve[0], ExpectedCTR(0.5))
+	assert.InDelta(t, (CTRCurve[1]+CTRCurve[2])/2, ExpectedCTR(2.5), 1e-9)
+	assert.Less(t, ExpectedCTR(40), ExpectedCTR(20))
+}
@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Channel names shared by funnels, attribution and the query API
+const (
+	ChannelDirect        = "Direct"
+	ChannelOrganicSearch = "Organic Search"
+	ChannelPaidSearch    = "Paid Search"
+	ChannelSocial        = "Social"
+	ChannelEmail         = "Email"
+	ChannelReferral      = "Referral"
+)
+
+var searchEngines = []string{"google.", "bing.", "duckduckgo.", "yahoo.", "baidu.", "yandex.", "ecosia.", "search.brave."}
+var socialNetworks = []string{"facebook.", "twitter.", "t.co", "x.com", "linkedin.", "lnkd.in", "instagram.", "reddit.", "youtube.", "pinterest.", "tiktok."}
+
+// ClassifyChannel derives the marketing channel of a session from its
+// referrer and the UTM parameters on the landing URL
+func ClassifyChannel(referrer, landingURL string) string {
+	if u, err := url.Parse(landingURL); err == nil {
+		q := u.Query()
+		medium := strings.ToLower(q.Get("utm_medium"))
+		switch {
+		case q.Get("gclid") != "" || q.Get("msclkid") != "":
+			return ChannelPaidSearch
+		case medium == "cpc" || medium == "ppc" || medium == "paid" || medium == "paidsearch":
+			return ChannelPaidSearch
+		case medium == "email" || medium == "newsletter":
+			return ChannelEmail
+		case medium == "social" || medium == "social-network" || medium == "paid_social":
+			return ChannelSocial
+		}
+	}
+
+	host := referrerHost(referrer)
+	if host == "" {
+		return ChannelDirect
+	}
+	for _, s := range searchEngines {
+		if strings.Contains(host, s) {
+			return ChannelOrganicSearch
+		}
+	}
+	for _, s := range socialNetworks {
+		if strings.Contains(host, s) {
+			return ChannelSocial
+		}
+	}
+	if strings.Contains(host, "mail.") {
+		return ChannelEmail
+	}
+	return ChannelReferral
+}
+
+// CampaignFromURL returns the utm_campaign of a landing URL, or "(none)"
+func CampaignFromURL(landingURL string) string {
+	u, err := url.Parse(landingURL)
+	if err != nil {
+		return "(none)"
+	}
+	if c := u.Query().Get("utm_campaign"); c != "" {
+		return c
+	}
+	return "(none)"
+}
+
+// DeviceClass buckets a user agent into desktop, tablet or mobile
+func DeviceClass(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet"):
+		return "tablet"
+	case strings.Contains(ua, "mobile") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		return "mobile"
+	default:
+		return "desktop"
+	}
+}
+
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(referrer)
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,441 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// RFM segments, from the recency and frequency quintile scores
+const (
+	RFMChampions         = "champions"
+	RFMLoyal             = "loyal"
+	RFMPotentialLoyalist = "potential_loyalist"
+	RFMNewCustomers      = "new_customers"
+	RFMPromising         = "promising"
+	RFMNeedAttention     = "need_attention"
+	RFMAboutToSleep      = "about_to_sleep"
+	RFMAtRisk            = "at_risk"
+	RFMCantLose          = "cant_lose"
+	RFMHibernating       = "hibernating"
+)
+
+// RFMSegments lists every segment, best first
+var RFMSegments = []string{RFMChampions, RFMLoyal, RFMPotentialLoyalist, RFMNewCustomers, RFMPromising,
+	RFMNeedAttention, RFMAboutToSleep, RFMAtRisk, RFMCantLose, RFMHibernating}
+
+const (
+	// The BG/NBD and Gamma-Gamma models are only fitted with enough (repeat) buyers to be meaningful
+	minModelCustomers       = 20
+	minModelRepeatCustomers = 5
+	// DefaultCLVHorizonDays is how far ahead predicted value looks
+	DefaultCLVHorizonDays = 365
+)
+
+// CustomerOrder is one completed order; CustomerID is the normalized email (or the visitor when anonymous)
+type CustomerOrder struct {
+	CustomerID string
+	Email      string
+	Time       time.Time
+	Revenue    float64
+}
+
+// Customer is one buyer's order history, RFM scores and predicted value
+type Customer struct {
+	ID               string    `json:"id"`
+	Email            string    `json:"email,omitempty"`
+	FirstOrder       time.Time `json:"first_order"`
+	LastOrder        time.Time `json:"last_order"`
+	Orders           int       `json:"orders"`
+	Revenue          float64   `json:"revenue"` // lifetime
+	AOV              float64   `json:"aov"`
+	RecencyDays      int       `json:"recency_days"`
+	RScore           int       `json:"r_score"`
+	FScore           int       `json:"f_score"`
+	MScore           int       `json:"m_score"`
+	Segment          string    `json:"segment"`
+	AliveProbability float64   `json:"alive_probability"` // %
+	PredictedOrders  float64   `json:"predicted_orders"`  // over the horizon
+	PredictedValue   float64   `json:"predicted_value"`   // expected revenue over the horizon
+}
+
+// CLVModel holds the fitted BG/NBD (purchase frequency and dropout) and Gamma-Gamma (order value)
+// parameters. Time is measured in days.
+type CLVModel struct {
+	Fitted          bool    `json:"fitted"`
+	Customers       int     `json:"customers"`
+	RepeatCustomers int     `json:"repeat_customers"`
+	HorizonDays     int     `json:"horizon_days"`
+	R               float64 `json:"r"`
+	Alpha           float64 `json:"alpha"`
+	A               float64 `json:"a"`
+	B               float64 `json:"b"`
+	P               float64 `json:"p"`
+	Q               float64 `json:"q"`
+	Gamma           float64 `json:"gamma"`
+}
+
+// rfmObservation is the BG/NBD summary of a customer: x repeat purchase days, the last at tx,
+// observed for T days since the first purchase. n counts identical observations.
+type rfmObservation struct {
+	x, tx, T, n float64
+}
+
+// BuildCustomers summarises orders per customer, scores RFM quintiles and predicts value over
+// horizonDays. Orders on the same day count as one purchase for the models.
+func BuildCustomers(orders []CustomerOrder, now time.Time, horizonDays int) ([]*Customer, CLVModel) {
+	if horizonDays <= 0 {
+		horizonDays = DefaultCLVHorizonDays
+	}
+	byCustomer := map[string][]CustomerOrder{}
+	var ids []string
+	for _, o := range orders {
+		if _, ok := byCustomer[o.CustomerID]; !ok {
+			ids = append(ids, o.CustomerID)
+		}
+		byCustomer[o.CustomerID] = append(byCustomer[o.CustomerID], o)
+	}
+	sort.Strings(ids)
+
+	customers := make([]*Customer, 0, len(ids))
+	obs := make([]rfmObservation, 0, len(ids))
+	repeatValues := make([]float64, 0, len(ids)) // mean value of repeat purchase days
+	for _, id := range ids {
+		list := byCustomer[id]
+		sort.Slice(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+		first, last := list[0].Time, list[len(list)-1].Time
+		c := &Customer{ID: id, FirstOrder: first, LastOrder: last, Orders: len(list)}
+		days := map[int]float64{}
+		for _, o := range list {
+			c.Revenue += o.Revenue
+			if o.Email != "" {
+				c.Email = o.Email
+			}
+			days[int(o.Time.Sub(first).Hours()/24)] += o.Revenue
+		}
+		c.AOV = roundTo(c.Revenue/float64(c.Orders), 2)
+		c.Revenue = roundTo(c.Revenue, 2)
+		c.RecencyDays = int(now.Sub(last).Hours() / 24)
+
+		o := rfmObservation{x: float64(len(days) - 1), T: math.Max(now.Sub(first).Hours()/24, 0), n: 1}
+		var repeatSum float64
+		for d, v := range days {
+			if d > 0 {
+				repeatSum += v
+				o.tx = math.Max(o.tx, float64(d))
+			}
+		}
+		if o.x > 0 {
+			repeatValues = append(repeatValues, repeatSum/o.x)
+		} else {
+			repeatValues = append(repeatValues, 0)
+		}
+		obs = append(obs, o)
+		customers = append(customers, c)
+	}
+
+	scoreRFM(customers)
+
+	model := fitCLVModel(obs, repeatValues)
+	model.HorizonDays = horizonDays
+	t := float64(horizonDays)
+	for i, c := range customers {
+		if !model.Fitted {
+			continue
+		}
+		o := obs[i]
+		c.AliveProbability = roundTo(model.aliveProbability(o)*100, 1)
+		expected := model.expectedPurchases(o, t)
+		c.PredictedOrders = roundTo(expected, 2)
+		c.PredictedValue = roundTo(expected*model.expectedOrderValue(o.x, repeatValues[i], c.AOV), 2)
+	}
+	return customers, model
+}
+
+// scoreRFM assigns 1-5 quintile scores (5 is best) and the segment
+func scoreRFM(customers []*Customer) {
+	r := quintiles(len(customers), func(i int) float64 { return -float64(customers[i].RecencyDays) })
+	f := quintiles(len(customers), func(i int) float64 { return float64(customers[i].Orders) })
+	m := quintiles(len(customers), func(i int) float64 { return customers[i].Revenue })
+	for i, c := range customers {
+		c.RScore, c.FScore, c.MScore = r[i], f[i], m[i]
+		c.Segment = RFMSegment(c.RScore, c.FScore)
+	}
+}
+
+// quintiles scores values 1-5 by rank, higher values scoring higher; ties share a score
+func quintiles(n int, value func(i int) float64) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return value(idx[a]) < value(idx[b]) })
+	scores := make([]int, n)
+	for k := 0; k < n; k++ {
+		if k > 0 && value(idx[k]) == value(idx[k-1]) {
+			scores[idx[k]] = scores[idx[k-1]]
+			continue
+		}
+		scores[idx[k]] = 1 + k*5/n
+	}
+	return scores
+}
+
+// RFMSegment maps recency and frequency scores onto the usual RFM segment grid
+func RFMSegment(r, f int) string {
+	switch {
+	case r >= 5 && f >= 4:
+		return RFMChampions
+	case r >= 3 && f >= 4:
+		return RFMLoyal
+	case r >= 4 && f >= 2:
+		return RFMPotentialLoyalist
+	case r >= 5:
+		return RFMNewCustomers
+	case r == 4:
+		return RFMPromising
+	case r == 3 && f == 3:
+		return RFMNeedAttention
+	case r == 3:
+		return RFMAboutToSleep
+	case f >= 5:
+		return RFMCantLose
+	case f >= 3:
+		return RFMAtRisk
+	}
+	return RFMHibernating
+}
+
+// fitCLVModel fits both models by maximum likelihood; Fitted stays false without enough data
+func fitCLVModel(obs []rfmObservation, repeatValues []float64) CLVModel {
+	model := CLVModel{Customers: len(obs)}
+	grouped := map[[3]float64]*rfmObservation{}
+	var meanT float64
+	for _, o := range obs {
+		if o.x > 0 {
+			model.RepeatCustomers++
+		}
+		meanT += o.T / float64(len(obs))
+		key := [3]float64{o.x, math.Round(o.tx), math.Round(o.T)}
+		if g, ok := grouped[key]; ok {
+			g.n++
+			continue
+		}
+		grouped[key] = &rfmObservation{x: o.x, tx: key[1], T: key[2], n: 1}
+	}
+	if model.Customers < minModelCustomers || model.RepeatCustomers < minModelRepeatCustomers {
+		return model
+	}
+
+	data := make([]rfmObservation, 0, len(grouped))
+	for _, g := range grouped {
+		data = append(data, *g)
+	}
+	best := nelderMead(func(p []float64) float64 {
+		r, alpha, a, b := math.Exp(p[0]), math.Exp(p[1]), math.Exp(p[2]), math.Exp(p[3])
+		var ll float64
+		for _, o := range data {
+			ll += o.n * bgnbdLogLikelihood(r, alpha, a, b, o)
+		}
+		if math.IsNaN(ll) {
+			return math.Inf(1)
+		}
+		return -ll
+	}, []float64{0, math.Log(math.Max(meanT, 1)), 0, 0}, 2000)
+	model.R, model.Alpha, model.A, model.B = math.Exp(best[0]), math.Exp(best[1]), math.Exp(best[2]), math.Exp(best[3])
+
+	// Gamma-Gamma on the repeat buyers' average order value
+	var xs, ms []float64
+	for i, o := range obs {
+		if o.x > 0 && repeatValues[i] > 0 {
+			xs = append(xs, o.x)
+			ms = append(ms, repeatValues[i])
+		}
+	}
+	if len(xs) >= minModelRepeatCustomers {
+		best = nelderMead(func(p []float64) float64 {
+			pp, q, g := math.Exp(p[0]), math.Exp(p[1]), math.Exp(p[2])
+			var ll float64
+			for i := range xs {
+				ll += gammaGammaLogLikelihood(pp, q, g, xs[i], ms[i])
+			}
+			if math.IsNaN(ll) {
+				return math.Inf(1)
+			}
+			return -ll
+		}, []float64{0, math.Log(2), math.Log(Mean(ms))}, 2000)
+		model.P, model.Q, model.Gamma = math.Exp(best[0]), math.Exp(best[1]), math.Exp(best[2])
+	}
+
+	for _, v := range []float64{model.R, model.Alpha, model.A, model.B} {
+		if math.IsNaN(v) || math.IsInf(v, 0) || v <= 0 {
+			return model
+		}
+	}
+	model.Fitted = true
+	return model
+}
+
+// bgnbdLogLikelihood is one customer's BG/NBD log-likelihood (Fader, Hardie and Lee, 2005)
+func bgnbdLogLikelihood(r, alpha, a, b float64, o rfmObservation) float64 {
+	a1 := lgamma(r+o.x) - lgamma(r) + r*math.Log(alpha)
+	a2 := lgamma(a+b) + lgamma(b+o.x) - lgamma(b) - lgamma(a+b+o.x)
+	a3 := -(r + o.x) * math.Log(alpha+o.T)
+	if o.x == 0 {
+		return a1 + a2 + a3
+	}
+	a4 := math.Log(a) - math.Log(b+o.x-1) - (r+o.x)*math.Log(alpha+o.tx)
+	return a1 + a2 + logAddExp(a3, a4)
+}
+
+// gammaGammaLogLikelihood is one repeat buyer's Gamma-Gamma log-likelihood for x purchases of mean value m
+func gammaGammaLogLikelihood(p, q, gamma, x, m float64) float64 {
+	return lgamma(p*x+q) - lgamma(p*x) - lgamma(q) + q*math.Log(gamma) +
+		(p*x-1)*math.Log(m) + p*x*math.Log(x) - (p*x+q)*math.Log(gamma+m*x)
+}
+
+// aliveProbability is P(the customer has not churned)
+func (m CLVModel) aliveProbability(o rfmObservation) float64 {
+	if o.x == 0 {
+		return 1
+	}
+	return 1 / (1 + m.A/(m.B+o.x-1)*math.Exp((m.R+o.x)*math.Log((m.Alpha+o.T)/(m.Alpha+o.tx))))
+}
+
+// expectedPurchases is E[purchases in the next t days | history]
+func (m CLVModel) expectedPurchases(o rfmObservation, t float64) float64 {
+	a := m.A
+	if math.Abs(a-1) < 1e-6 {
+		a = 1 + 1e-6
+	}
+	logScale := (m.R + o.x) * math.Log((m.Alpha+o.T)/(m.Alpha+o.T+t))
+	hyp := scaledHyp2F1(m.R+o.x, m.B+o.x, a+m.B+o.x-1, t/(m.Alpha+o.T+t), logScale)
+	num := (a + m.B + o.x - 1) / (a - 1) * (1 - hyp)
+	den := 1.0
+	if o.x > 0 {
+		den += a / (m.B + o.x - 1) * math.Exp((m.R+o.x)*math.Log((m.Alpha+o.T)/(m.Alpha+o.tx)))
+	}
+	e := num / den
+	if math.IsNaN(e) || math.IsInf(e, 0) || e < 0 {
+		return 0
+	}
+	return e
+}
+
+// expectedOrderValue is the Gamma-Gamma posterior mean order value, falling back to the
+// customer's own average when the model could not be fitted
+func (m CLVModel) expectedOrderValue(x, repeatMean, aov float64) float64 {
+	if m.Q <= 1 || m.P <= 0 {
+		return aov
+	}
+	if x == 0 {
+		return m.P * m.Gamma / (m.Q - 1)
+	}
+	return m.P * (m.Gamma + x*repeatMean) / (m.P*x + m.Q - 1)
+}
+
+// scaledHyp2F1 is exp(logScale) * 2F1(a, b; c; z) for 0 <= z < 1, summed in log space so
+// large parameters do not overflow
+func scaledHyp2F1(a, b, c, z, logScale float64) float64 {
+	if z <= 0 {
+		return math.Exp(logScale)
+	}
+	logZ := math.Log(z)
+	var sum, logTerm float64
+	for k := 0.0; k < 100000; k++ {
+		term := math.Exp(logScale + logTerm)
+		sum += term
+		next := logTerm + math.Log(a+k) + math.Log(b+k) - math.Log(c+k) - math.Log(k+1) + logZ
+		if next < logTerm && term < sum*1e-14 {
+			break
+		}
+		logTerm = next
+	}
+	return sum
+}
+
+// nelderMead minimizes f from x0 with the downhill simplex method
+func nelderMead(f func([]float64) float64, x0 []float64, maxIter int) []float64 {
+	n := len(x0)
+	points := make([][]float64, n+1)
+	values := make([]float64, n+1)
+	for i := range points {
+		points[i] = append([]float64{}, x0...)
+		if i > 0 {
+			points[i][i-1] += 0.5
+		}
+		values[i] = f(points[i])
+	}
+	at := func(base, dir []float64, scale float64) []float64 {
+		p := make([]float64, n)
+		for j := range p {
+			p[j] = base[j] + scale*(dir[j]-base[j])
+		}
+		return p
+	}
+
+	for iter := 0; iter < maxIter; iter++ {
+		order := make([]int, n+1)
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+		sorted, sortedValues := make([][]float64, n+1), make([]float64, n+1)
+		for i, o := range order {
+			sorted[i], sortedValues[i] = points[o], values[o]
+		}
+		points, values = sorted, sortedValues
+		if math.Abs(values[n]-values[0]) <= 1e-10*(math.Abs(values[0])+1e-10) {
+			break
+		}
+
+		centroid := make([]float64, n)
+		for _, p := range points[:n] {
+			for j := range centroid {
+				centroid[j] += p[j] / float64(n)
+			}
+		}
+		reflected := at(centroid, points[n], -1)
+		fr := f(reflected)
+		switch {
+		case fr < values[0]:
+			expanded := at(centroid, points[n], -2)
+			if fe := f(expanded); fe < fr {
+				points[n], values[n] = expanded, fe
+			} else {
+				points[n], values[n] = reflected, fr
+			}
+		case fr < values[n-1]:
+			points[n], values[n] = reflected, fr
+		default:
+			contracted := at(centroid, points[n], 0.5)
+			if fc := f(contracted); fc < values[n] {
+				points[n], values[n] = contracted, fc
+				continue
+			}
+			for i := 1; i <= n; i++ {
+				points[i] = at(points[0], points[i], 0.5)
+				values[i] = f(points[i])
+			}
+		}
+	}
+	best := 0
+	for i := range values {
+		if values[i] < values[best] {
+			best = i
+		}
+	}
+	return points[best]
+}
+
+func lgamma(v float64) float64 {
+	l, _ := math.Lgamma(v)
+	return l
+}
+
+func logAddExp(a, b float64) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log1p(math.Exp(b-a))
+}
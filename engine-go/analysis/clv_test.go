@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRFMSegment(t *testing.T) {
+	assert.Equal(t, RFMChampions, RFMSegment(5, 5))
+	assert.Equal(t, RFMLoyal, RFMSegment(3, 4))
+	assert.Equal(t, RFMPotentialLoyalist, RFMSegment(4, 2))
+	assert.Equal(t, RFMNewCustomers, RFMSegment(5, 1))
+	assert.Equal(t, RFMPromising, RFMSegment(4, 1))
+	assert.Equal(t, RFMNeedAttention, RFMSegment(3, 3))
+	assert.Equal(t, RFMAboutToSleep, RFMSegment(3, 1))
+	assert.Equal(t, RFMCantLose, RFMSegment(1, 5))
+	assert.Equal(t, RFMAtRisk, RFMSegment(2, 3))
+	assert.Equal(t, RFMHibernating, RFMSegment(1, 1))
+}
+
+func TestBuildCustomersSummary(t *testing.T) {
+	now := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	orders := []CustomerOrder{
+		{CustomerID: "a@x.com", Email: "a@x.com", Time: now.AddDate(0, 0, -90), Revenue: 40},
+		{CustomerID: "a@x.com", Email: "a@x.com", Time: now.AddDate(0, 0, -2), Revenue: 60},
+		{CustomerID: "b@x.com", Email: "b@x.com", Time: now.AddDate(0, 0, -300), Revenue: 20},
+	}
+	customers, model := BuildCustomers(orders, now, 0)
+	require.Len(t, customers, 2)
+	a := customers[0]
+	assert.Equal(t, 2, a.Orders)
+	assert.Equal(t, 100.0, a.Revenue)
+	assert.Equal(t, 50.0, a.AOV)
+	assert.Equal(t, 2, a.RecencyDays)
+	assert.Greater(t, a.RScore, customers[1].RScore)
+	assert.Greater(t, a.MScore, customers[1].MScore)
+
+	// Too few customers to fit the purchase models
+	assert.False(t, model.Fitted)
+	assert.Equal(t, DefaultCLVHorizonDays, model.HorizonDays)
+	assert.Zero(t, a.PredictedValue)
+}
+
+// Customers simulated from BG/NBD and Gamma-Gamma: the fitted model should predict holdout
+// purchases and revenue of the whole base closely
+func TestBuildCustomersPredictsHoldout(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	calibrationEnd := start.AddDate(0, 0, 365)
+	const holdoutDays = 180
+
+	var calibration []CustomerOrder
+	var holdoutOrders int
+	var holdoutRevenue float64
+	for i := 0; i < 3000; i++ {
+		id := fmt.Sprintf("c%d@x.com", i)
+		lambda := sampleGamma(rng, 0.6) / 25
+		p := sampleBeta(rng, 1.5, 4)
+		nu := sampleGamma(rng, 4) / 15
+		at := start.Add(time.Duration(rng.Float64()*120*24) * time.Hour)
+		for {
+			revenue := sampleGamma(rng, 6) / nu
+			if at.Before(calibrationEnd) {
+				calibration = append(calibration, CustomerOrder{CustomerID: id, Email: id, Time: at, Revenue: revenue})
+			} else if at.Before(calibrationEnd.AddDate(0, 0, holdoutDays)) {
+				holdoutOrders++
+				holdoutRevenue += revenue
+			} else {
+				break
+			}
+			if rng.Float64() < p {
+				break
+			}
+			at = at.Add(time.Duration(rng.ExpFloat64() / lambda * 24 * float64(time.Hour)))
+		}
+	}
+
+	customers, model := BuildCustomers(calibration, calibrationEnd, holdoutDays)
+	require.True(t, model.Fitted)
+	var predictedOrders, predictedValue float64
+	for _, c := range customers {
+		predictedOrders += c.PredictedOrders
+		predictedValue += c.PredictedValue
+		assert.GreaterOrEqual(t, c.AliveProbability, 0.0)
+		assert.LessOrEqual(t, c.AliveProbability, 100.0)
+	}
+	assert.InEpsilon(t, float64(holdoutOrders), predictedOrders, 0.2)
+	assert.InEpsilon(t, holdoutRevenue, predictedValue, 0.25)
+	assert.Greater(t, model.Q, 1.0)
+}
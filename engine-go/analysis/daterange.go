@@ -0,0 +1,176 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Range presets accepted by ParseDateRange
+const (
+	RangeToday     = "today"
+	RangeYesterday = "yesterday"
+	RangeMTD       = "mtd"
+	RangeLastMonth = "last_month"
+	RangeYTD       = "ytd"
+	RangeCustom    = "custom"
+)
+
+// Comparison modes
+const (
+	CompareNone           = "none"
+	ComparePreviousPeriod = "previous_period"
+	ComparePreviousYear   = "previous_year"
+)
+
+// maxRangeDays bounds explicit ranges so a typo cannot scan every table end to end
+const maxRangeDays = 3 * 366
+
+// Period is a half-open time interval [Start, End)
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// DateRange is a resolved reporting range with its optional comparison period. Day boundaries
+// are midnights in Location; presets that include today end at the current time.
+type DateRange struct {
+	Period
+	Preset     string         `json:"preset"`
+	Location   *time.Location `json:"-"`
+	Compare    string         `json:"compare"`
+	Comparison *Period        `json:"comparison,omitempty"`
+}
+
+// DateRangeParams are the raw query parameters a report accepts
+type DateRangeParams struct {
+	Range   string // preset: today, yesterday, 7d/30d/90d (any Nd), mtd, last_month, ytd
+	Start   string // YYYY-MM-DD, overrides Range
+	End     string // YYYY-MM-DD, inclusive; defaults to today
+	Compare string // none, previous_period, previous_year
+}
+
+var lastNDays = regexp.MustCompile(`^([1-9][0-9]{0,3})d$`)
+
+// ParseDateRange resolves params at now in loc. An empty range falls back to defaultRange.
+func ParseDateRange(p DateRangeParams, now time.Time, loc *time.Location, defaultRange string) (DateRange, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+	today := midnight(now)
+	r := DateRange{Location: loc}
+
+	if p.Start != "" {
+		start, err := time.ParseInLocation("2006-01-02", p.Start, loc)
+		if err != nil {
+			return r, fmt.Errorf("invalid start date %q, expected YYYY-MM-DD", p.Start)
+		}
+		end := today
+		if p.End != "" {
+			if end, err = time.ParseInLocation("2006-01-02", p.End, loc); err != nil {
+				return r, fmt.Errorf("invalid end date %q, expected YYYY-MM-DD", p.End)
+			}
+		}
+		if end.Before(start) {
+			return r, fmt.Errorf("end date is before start date")
+		}
+		r.Preset, r.Start, r.End = RangeCustom, start, end.AddDate(0, 0, 1) // end date is inclusive
+	} else {
+		preset := strings.ToLower(strings.TrimSpace(p.Range))
+		if preset == "" {
+			preset = defaultRange
+		}
+		r.Preset, r.End = preset, now
+		switch preset {
+		case RangeToday:
+			r.Start = today
+		case RangeYesterday:
+			r.Start, r.End = today.AddDate(0, 0, -1), today
+		case RangeMTD:
+			r.Start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		case RangeLastMonth:
+			r.End = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+			r.Start = r.End.AddDate(0, -1, 0)
+		case RangeYTD:
+			r.Start = time.Date(now.Year(), 1, 1, 0, 0, 0, 0, loc)
+		default:
+			m := lastNDays.FindStringSubmatch(preset)
+			if m == nil {
+				return r, fmt.Errorf("unknown range %q", p.Range)
+			}
+			// The last N days include today
+			n, _ := strconv.Atoi(m[1])
+			r.Start = today.AddDate(0, 0, 1-n)
+		}
+	}
+	if r.Days() > maxRangeDays {
+		return r, fmt.Errorf("date range longer than %d days", maxRangeDays)
+	}
+
+	r.Compare = strings.ToLower(strings.TrimSpace(p.Compare))
+	switch r.Compare {
+	case "", CompareNone:
+		r.Compare = CompareNone
+	case ComparePreviousPeriod:
+		// Shifted back by whole days, so partial days compare against the same hours
+		days := r.Days()
+		r.Comparison = &Period{Start: r.Start.AddDate(0, 0, -days), End: r.End.AddDate(0, 0, -days)}
+	case ComparePreviousYear:
+		r.Comparison = &Period{Start: r.Start.AddDate(-1, 0, 0), End: r.End.AddDate(-1, 0, 0)}
+	default:
+		return r, fmt.Errorf("unknown compare mode %q", p.Compare)
+	}
+	return r, nil
+}
+
+// Days is the number of calendar days the period touches in its start's location
+func (p Period) Days() int {
+	loc := p.Start.Location()
+	last := midnight(p.End.In(loc))
+	if p.End.In(loc).After(last) {
+		last = last.AddDate(0, 0, 1)
+	}
+	// Calendar dates compared in UTC, so DST days still count as one
+	first := midnight(p.Start)
+	a := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+var utcOffset = regexp.MustCompile(`^(?:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// ParseTimeZone accepts an IANA name ("Europe/Berlin") or a fixed offset as WordPress stores it
+// when no city is chosen ("+02:00", "UTC-5", "UTC+5:30")
+func ParseTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("empty time zone")
+	}
+	if m := utcOffset.FindStringSubmatch(strings.ToUpper(name)); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		mins := 0
+		if m[3] != "" {
+			mins, _ = strconv.Atoi(m[3])
+		}
+		if hours > 14 || mins > 59 {
+			return nil, fmt.Errorf("invalid UTC offset %q", name)
+		}
+		offset := hours*3600 + mins*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDateRangePresets(t *testing.T) {
+	berlin, err := ParseTimeZone("+01:00")
+	require.NoError(t, err)
+	// 23:30 UTC on the 14th is already the 15th in Berlin
+	now := time.Date(2024, 3, 14, 23, 30, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, berlin) }
+
+	cases := []struct {
+		params     DateRangeParams
+		start, end time.Time
+	}{
+		{DateRangeParams{Range: "today"}, day(2024, 3, 15), now},
+		{DateRangeParams{Range: "yesterday"}, day(2024, 3, 14), day(2024, 3, 15)},
+		{DateRangeParams{Range: "7d"}, day(2024, 3, 9), now},
+		{DateRangeParams{Range: "MTD"}, day(2024, 3, 1), now},
+		{DateRangeParams{Range: "last_month"}, day(2024, 2, 1), day(2024, 3, 1)},
+		{DateRangeParams{Range: "ytd"}, day(2024, 1, 1), now},
+		{DateRangeParams{}, day(2024, 2, 15), now}, // default 30d
+		{DateRangeParams{Range: "90d", Start: "2024-01-01", End: "2024-01-31"}, day(2024, 1, 1), day(2024, 2, 1)},
+	}
+	for _, tc := range cases {
+		r, err := ParseDateRange(tc.params, now, berlin, "30d")
+		require.NoError(t, err, tc.params)
+		assert.True(t, tc.start.Equal(r.Start), "%v start: %v", tc.params, r.Start)
+		assert.True(t, tc.end.Equal(r.End), "%v end: %v", tc.params, r.End)
+	}
+}
+
+func TestParseDateRangeComparison(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	r, err := ParseDateRange(DateRangeParams{Start: "2024-03-01", End: "2024-03-10", Compare: "previous_period"}, now, time.UTC, "7d")
+	require.NoError(t, err)
+	assert.Equal(t, 10, r.Days())
+	require.NotNil(t, r.Comparison)
+	assert.Equal(t, time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC), r.Comparison.Start)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), r.Comparison.End)
+
+	// A partial today compares against the same hours
+	r, err = ParseDateRange(DateRangeParams{Range: "today", Compare: "previous_period"}, now, time.UTC, "7d")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 14, 12, 0, 0, 0, time.UTC), r.Comparison.End)
+
+	r, err = ParseDateRange(DateRangeParams{Range: "mtd", Compare: "previous_year"}, now, time.UTC, "7d")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), r.Comparison.Start)
+	assert.Equal(t, time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC), r.Comparison.End)
+
+	r, err = ParseDateRange(DateRangeParams{Range: "7d"}, now, time.UTC, "7d")
+	require.NoError(t, err)
+	assert.Equal(t, CompareNone, r.Compare)
+	assert.Nil(t, r.Comparison)
+}
+
+func TestParseDateRangeRejects(t *testing.T) {
+	now := time.Now()
+	for _, p := range []DateRangeParams{
+		{Range: "fortnight"},
+		{Range: "0d"},
+		{Start: "03/01/2024"},
+		{Start: "2024-03-10", End: "2024-03-01"},
+		{Start: "2010-01-01", End: "2024-01-01"},
+		{Range: "7d", Compare: "last_week"},
+	} {
+		_, err := ParseDateRange(p, now, time.UTC, "7d")
+		assert.Error(t, err, p)
+	}
+}
+
+func TestParseTimeZone(t *testing.T) {
+	loc, err := ParseTimeZone("+05:30")
+	require.NoError(t, err)
+	_, offset := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone()
+	assert.Equal(t, 5*3600+30*60, offset)
+
+	loc, err = ParseTimeZone("UTC-5")
+	require.NoError(t, err)
+	_, offset = time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone()
+	assert.Equal(t, -5*3600, offset)
+
+	_, err = ParseTimeZone("Mars/Olympus_Mons")
+	assert.Error(t, err)
+}
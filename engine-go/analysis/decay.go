@@ -2,111 +2,169 @@ package analysis
 
 import (
 	"database/sql"
-	"log"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 )
 
+// Decay comparison modes
+const (
+	DecayPeriod = "period" // last N days vs the N days before
+	DecayYoY    = "yoy"    // last N days vs the same N days a year earlier
+)
+
+// DecayOptions controls content decay detection
+type DecayOptions struct {
+	Mode      string  `json:"mode"`
+	Window    int     `json:"window"`    // days per comparison window
+	MinViews  int     `json:"min_views"` // baseline views required to be considered
+	Threshold float64 `json:"threshold"` // % drop required
+	Alpha     float64 `json:"alpha"`     // significance level for the Poisson rate test
+	Limit     int     `json:"limit"`
+}
+
+// Validate fills defaults and rejects nonsense values
+func (o *DecayOptions) Validate() error {
+	if o.Mode == "" {
+		o.Mode = DecayPeriod
+	}
+	if o.Mode != DecayPeriod && o.Mode != DecayYoY {
+		return fmt.Errorf("mode must be %q or %q", DecayPeriod, DecayYoY)
+	}
+	if o.Window <= 0 {
+		o.Window = 30
+	}
+	if o.Window > 182 {
+		return fmt.Errorf("window must be at most 182 days")
+	}
+	if o.MinViews <= 0 {
+		o.MinViews = 5
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = 15
+	}
+	if o.Alpha <= 0 || o.Alpha >= 1 {
+		o.Alpha = 0.05
+	}
+	if o.Limit <= 0 {
+		o.Limit = 10
+	}
+	return nil
+}
+
 // ContentDecayResult represents a post that is losing traffic
 type ContentDecayResult struct {
-	PostID        int     `json:"post_id"`
+	PostID        int     `json:"post_id"` // from the pageview's page metadata; 0 for non-post URLs
 	Title         string  `json:"title"`
+	URL           string  `json:"url"`
 	CurrentViews  int     `json:"current_views"`
 	PreviousViews int     `json:"previous_views"`
 	ChangePct     float64 `json:"change_pct"`
+	PValue        float64 `json:"p_value"`
 	Slug          string  `json:"slug"`
 }
 
-// CalculateContentDecay identifies posts with >15% traffic drop MoM
-// It compares the last 30 days vs the period 30-60 days ago
-func CalculateContentDecay(db *sql.DB) ([]ContentDecayResult, error) {
-	// Query using URL-based grouping since events are tracked by URL
-	// We compare views for each URL between current 30d and previous 30d
-	query := `
-		WITH CurrentPeriod AS (
-			SELECT 
-				url,
-				COUNT(*) as views 
-			FROM wp_apex_events 
-			WHERE created_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)
-			AND event_type = 'pageview'
-			GROUP BY url
-		),
-		PreviousPeriod AS (
-			SELECT 
-				url,
-				COUNT(*) as views 
-			FROM wp_apex_events 
-			WHERE created_at >= DATE_SUB(NOW(), INTERVAL 60 DAY)
-			AND created_at < DATE_SUB(NOW(), INTERVAL 30 DAY)
-			AND event_type = 'pageview'
-			GROUP BY url
-		)
-		SELECT 
-			prev.url,
-			COALESCE(c.views, 0) as current_views,
-			prev.views as previous_views
-		FROM PreviousPeriod prev
-		LEFT JOIN CurrentPeriod c ON prev.url = c.url
-		WHERE prev.views > 5
-		ORDER BY ((COALESCE(c.views, 0) - prev.views) / prev.views) ASC
-		LIMIT 10
-	`
-
-	rows, err := db.Query(query)
+// CalculateContentDecay finds URLs whose views dropped by at least opts.Threshold percent
+// between the baseline and current windows, and where the drop is significant under a Poisson
+// rate comparison. Results are ordered by the size of the drop.
+func CalculateContentDecay(db *sql.DB, opts DecayOptions, now time.Time) ([]ContentDecayResult, error) {
+	curStart := now.AddDate(0, 0, -opts.Window)
+	baseStart, baseEnd := now.AddDate(0, 0, -2*opts.Window), curStart
+	if opts.Mode == DecayYoY {
+		baseStart, baseEnd = curStart.AddDate(-1, 0, 0), now.AddDate(-1, 0, 0)
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			url,
+			MAX(CAST(COALESCE(JSON_UNQUOTE(JSON_EXTRACT(payload, '$.pid')), '0') AS UNSIGNED)) AS post_id,
+			SUM(created_at >= ?) AS current_views,
+			SUM(created_at < ?) AS previous_views
+		FROM wp_apex_events
+		WHERE event_type = 'pageview'
+		AND ((created_at >= ? AND created_at < ?) OR (created_at >= ? AND created_at < ?))
+		GROUP BY url
+	`, curStart, baseEnd, curStart, now, baseStart, baseEnd)
 	if err != nil {
-		// Return mock data if query fails (likely no data yet)
-		log.Printf("Content decay query failed: %v, returning mock data", err)
-		return mockDecayData(), nil
+		return nil, err
 	}
 	defer rows.Close()
 
-	var results []ContentDecayResult
-	postID := 1
-
+	results := []ContentDecayResult{}
 	for rows.Next() {
-		var url string
-		var currentViews, previousViews int
-		if err := rows.Scan(&url, &currentViews, &previousViews); err != nil {
-			log.Printf("Error scanning decay row: %v", err)
+		var r ContentDecayResult
+		if err := rows.Scan(&r.URL, &r.PostID, &r.CurrentViews, &r.PreviousViews); err != nil {
+			return nil, err
+		}
+		if r.PreviousViews < opts.MinViews {
 			continue
 		}
-
-		// Calculate Percentage Change
-		var changePct float64
-		if previousViews > 0 {
-			diff := float64(currentViews - previousViews)
-			changePct = (diff / float64(previousViews)) * 100
+		r.ChangePct = float64(r.CurrentViews-r.PreviousViews) / float64(r.PreviousViews) * 100
+		if r.ChangePct > -opts.Threshold {
+			continue
 		}
+		r.PValue = PoissonRateDecreaseP(r.CurrentViews, r.PreviousViews, 1)
+		if r.PValue > opts.Alpha {
+			continue
+		}
+		r.Slug = extractSlugFromURL(r.URL)
+		r.Title = extractTitleFromURL(r.URL)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].ChangePct < results[j].ChangePct })
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	applyPostTitles(db, results)
+	return results, nil
+}
 
-		// Only include if declining by more than 15%
-		if changePct < -15.0 {
-			results = append(results, ContentDecayResult{
-				PostID:        postID,
-				Title:         extractTitleFromURL(url),
-				Slug:          extractSlugFromURL(url),
-				CurrentViews:  currentViews,
-				PreviousViews: previousViews,
-				ChangePct:     changePct,
-			})
-			postID++
+// applyPostTitles replaces URL-derived titles with wp_posts titles where the post is known.
+// The posts table is optional for the engine, so a failed lookup keeps the URL titles.
+func applyPostTitles(db *sql.DB, results []ContentDecayResult) {
+	var ids []interface{}
+	for _, r := range results {
+		if r.PostID > 0 {
+			ids = append(ids, r.PostID)
 		}
 	}
+	if len(ids) == 0 {
+		return
+	}
 
-	// Return mock data if no real decaying content found
-	if len(results) == 0 {
-		return mockDecayData(), nil
+	rows, err := db.Query(`SELECT ID, post_title FROM wp_posts WHERE ID IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`, ids...)
+	if err != nil {
+		return
 	}
+	defer rows.Close()
 
-	return results, nil
+	titles := map[int]string{}
+	for rows.Next() {
+		var id int
+		var title string
+		if rows.Scan(&id, &title) == nil && title != "" {
+			titles[id] = title
+		}
+	}
+	for i := range results {
+		if t, ok := titles[results[i].PostID]; ok {
+			results[i].Title = t
+		}
+	}
 }
 
 // extractTitleFromURL extracts a readable title from a URL path
 func extractTitleFromURL(url string) string {
 	// Simple extraction: get last path segment and format as title
-	// In production, this would query wp_posts
 	if len(url) < 10 {
 		return "Untitled Post"
 	}
-	
+
 	// For demo URLs like "https://demo-site.com/blog/getting-started"
 	// Extract the last segment
 	for i := len(url) - 1; i >= 0; i-- {
@@ -151,12 +209,3 @@ func capitalizeSlug(slug string) string {
 	}
 	return string(result)
 }
-
-// mockDecayData returns sample decay data for demo purposes
-func mockDecayData() []ContentDecayResult {
-	return []ContentDecayResult{
-		{PostID: 101, Title: "Top 10 AI Tools for 2024", Slug: "top-ai-tools", CurrentViews: 1200, PreviousViews: 1500, ChangePct: -20},
-		{PostID: 104, Title: "How to Install WordPress", Slug: "install-wp", CurrentViews: 450, PreviousViews: 600, ChangePct: -25},
-		{PostID: 112, Title: "SEO Best Practices Guide", Slug: "seo-guide", CurrentViews: 890, PreviousViews: 1050, ChangePct: -15.2},
-	}
-}
@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrackedEvent is a single tracker event enriched with its visitor and session context
+type TrackedEvent struct {
+	PersonID  string                 `json:"person_id"` // visitor fingerprint
+	SessionID string                 `json:"session_id"`
+	Type      string                 `json:"type"`
+	URL       string                 `json:"url"`
+	Props     map[string]interface{} `json:"props,omitempty"`
+	Time      time.Time              `json:"time"`
+	Channel   string                 `json:"channel,omitempty"`
+	Device    string                 `json:"device,omitempty"`
+	Country   string                 `json:"country,omitempty"`
+}
+
+// PropertyFilter compares one payload property against a value.
+// Operators: eq, neq, contains, gt, gte, lt, lte.
+type PropertyFilter struct {
+	Property string      `json:"property"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
+// Validate checks the operator is supported
+func (f PropertyFilter) Validate() error {
+	if f.Property == "" {
+		return fmt.Errorf("filter property is required")
+	}
+	switch f.Operator {
+	case "", "eq", "neq", "contains", "gt", "gte", "lt", "lte":
+		return nil
+	}
+	return fmt.Errorf("unsupported filter operator %q", f.Operator)
+}
+
+// Matches evaluates the filter against an event payload
+func (f PropertyFilter) Matches(props map[string]interface{}) bool {
+	actual, ok := props[f.Property]
+	if !ok {
+		return f.Operator == "neq"
+	}
+
+	switch f.Operator {
+	case "", "eq":
+		return compareValues(actual, f.Value) == 0
+	case "neq":
+		return compareValues(actual, f.Value) != 0
+	case "contains":
+		return strings.Contains(strings.ToLower(fmt.Sprint(actual)), strings.ToLower(fmt.Sprint(f.Value)))
+	}
+
+	a, aok := toFloat(actual)
+	b, bok := toFloat(f.Value)
+	if !aok || !bok {
+		return false
+	}
+	switch f.Operator {
+	case "gt":
+		return a > b
+	case "gte":
+		return a >= b
+	case "lt":
+		return a < b
+	case "lte":
+		return a <= b
+	}
+	return false
+}
+
+// compareValues compares numerically when both sides are numbers, otherwise as strings
+func compareValues(a, b interface{}) int {
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// ToFloat reads a numeric payload value, accepting numbers and numeric strings
+func ToFloat(v interface{}) (float64, bool) {
+	return toFloat(v)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(string(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// ParseWindow parses durations like "30m", "24h" or "7d"
+func ParseWindow(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return d, nil
+}
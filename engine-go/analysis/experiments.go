@@ -0,0 +1,586 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// ExposureEvent is sent by the tracker when a visitor sees a variant: {"experiment": "...", "variant": "..."}
+const ExposureEvent = "experiment_exposure"
+
+// Experiment metric kinds
+const (
+	MetricGoal    = "goal"    // any event matching a funnel step after exposure
+	MetricFunnel  = "funnel"  // completing a funnel after exposure
+	MetricRevenue = "revenue" // order_completed revenue per exposed visitor
+)
+
+// Stopping guidance
+const (
+	DecisionKeepRunning    = "keep_running"
+	DecisionStopWinner     = "stop_winner"
+	DecisionStopNoEffect   = "stop_no_effect"
+	DecisionInvestigateSRM = "investigate_srm"
+)
+
+const (
+	// srmThreshold is the chi-square p-value below which assignment is considered broken
+	srmThreshold = 0.001
+	// Results are not acted on before a full weekly cycle and a minimal sample
+	minExperimentDays  = 7
+	minExperimentUnits = 100
+	// experimentPower is the power the required sample size is planned for
+	experimentPower = 0.8
+	// bayesDraws is the number of posterior samples per variant
+	bayesDraws = 20000
+)
+
+// ExperimentVariant is one arm; Weight is its intended share of traffic
+type ExperimentVariant struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+}
+
+// ExperimentMetric is the outcome variants are compared on
+type ExperimentMetric struct {
+	Kind   string            `json:"kind"`
+	Goal   *FunnelStep       `json:"goal,omitempty"`
+	Funnel *FunnelDefinition `json:"funnel,omitempty"`
+	Window string            `json:"window,omitempty"` // how long after exposure outcomes count (default 14d)
+}
+
+// ExperimentDefinition describes an experiment's arms and how it is judged
+type ExperimentDefinition struct {
+	Variants []ExperimentVariant `json:"variants"` // the first is the control; empty means detect from exposures
+	Metric   ExperimentMetric    `json:"metric"`
+	MDE      float64             `json:"mde"`   // smallest relative lift worth detecting (default 0.1)
+	Alpha    float64             `json:"alpha"` // false-positive rate across all comparisons (default 0.05)
+}
+
+// Validate fills defaults and rejects definitions that cannot be analyzed
+func (d *ExperimentDefinition) Validate() error {
+	seen := map[string]bool{}
+	for i := range d.Variants {
+		v := &d.Variants[i]
+		if v.Name == "" {
+			return fmt.Errorf("variant %d needs a name", i+1)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("duplicate variant %q", v.Name)
+		}
+		seen[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("variant %q has a negative weight", v.Name)
+		}
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+	}
+	if len(d.Variants) == 1 {
+		return fmt.Errorf("an experiment needs a control and at least one variant")
+	}
+	if d.MDE == 0 {
+		d.MDE = 0.1
+	}
+	if d.MDE < 0 || d.MDE > 10 {
+		return fmt.Errorf("mde must be a relative lift between 0 and 10")
+	}
+	if d.Alpha == 0 {
+		d.Alpha = 0.05
+	}
+	if d.Alpha < 0 || d.Alpha >= 0.5 {
+		return fmt.Errorf("alpha must be between 0 and 0.5")
+	}
+	return d.Metric.Validate()
+}
+
+// Validate checks the metric has what its kind needs
+func (m *ExperimentMetric) Validate() error {
+	switch m.Kind {
+	case "":
+		m.Kind = MetricRevenue
+	case MetricGoal:
+		if m.Goal == nil || (m.Goal.URLPattern == "" && m.Goal.EventType == "") {
+			return fmt.Errorf("a goal metric needs a goal with a url_pattern or event_type")
+		}
+		for _, f := range m.Goal.Filters {
+			if err := f.Validate(); err != nil {
+				return fmt.Errorf("goal: %w", err)
+			}
+		}
+	case MetricFunnel:
+		if m.Funnel == nil {
+			return fmt.Errorf("a funnel metric needs a funnel")
+		}
+		if err := m.Funnel.Validate(); err != nil {
+			return fmt.Errorf("funnel: %w", err)
+		}
+	case MetricRevenue:
+	default:
+		return fmt.Errorf("unknown metric kind %q", m.Kind)
+	}
+	_, err := m.WindowDuration()
+	return err
+}
+
+// WindowDuration is how long after first exposure an outcome is credited to the variant
+func (m ExperimentMetric) WindowDuration() (time.Duration, error) {
+	return ParseWindow(m.Window, 14*24*time.Hour)
+}
+
+// EventTypes lists the event types needed to analyze the experiment, exposures included
+func (m ExperimentMetric) EventTypes() []string {
+	types := []string{ExposureEvent}
+	switch m.Kind {
+	case MetricGoal:
+		types = append(types, m.Goal.eventType())
+	case MetricFunnel:
+		for _, t := range m.Funnel.EventTypes() {
+			if t != ExposureEvent {
+				types = append(types, t)
+			}
+		}
+	default:
+		types = append(types, "order_completed")
+	}
+	return types
+}
+
+// VariantComparison is a variant measured against the control. Differences are in percentage
+// points for conversion metrics and in currency per visitor for revenue.
+type VariantComparison struct {
+	Test              string  `json:"test"` // z_test or welch_t
+	Difference        float64 `json:"difference"`
+	RelativeLift      float64 `json:"relative_lift"` // %
+	CILow             float64 `json:"ci_low"`
+	CIHigh            float64 `json:"ci_high"`
+	Statistic         float64 `json:"statistic"`
+	PValue            float64 `json:"p_value"`        // fixed-horizon; only valid at the planned sample size
+	AlwaysValidP      float64 `json:"always_valid_p"` // safe to check at any time
+	Significant       bool    `json:"significant"`    // always-valid p below the per-comparison alpha
+	ProbabilityToBeat float64 `json:"probability_to_beat_control"`
+	ExpectedLoss      float64 `json:"expected_loss"` // expected shortfall vs control if this variant is shipped
+}
+
+// VariantResult is one arm's outcome
+type VariantResult struct {
+	Name           string             `json:"name"`
+	Control        bool               `json:"control,omitempty"`
+	Units          int                `json:"units"`
+	ExpectedShare  float64            `json:"expected_share"` // %
+	Conversions    int                `json:"conversions"`
+	ConversionRate float64            `json:"conversion_rate"` // %
+	Revenue        float64            `json:"revenue"`
+	RevenuePerUnit float64            `json:"revenue_per_unit"`
+	Comparison     *VariantComparison `json:"comparison,omitempty"`
+}
+
+// SRMCheck tests whether traffic split the way the weights say it should
+type SRMCheck struct {
+	ChiSquare float64 `json:"chi_square"`
+	PValue    float64 `json:"p_value"`
+	Mismatch  bool    `json:"mismatch"`
+}
+
+// ExperimentGuidance tells whether the experiment can be stopped
+type ExperimentGuidance struct {
+	Decision      string  `json:"decision"`
+	Winner        string  `json:"winner,omitempty"`
+	Reason        string  `json:"reason"`
+	RequiredUnits int     `json:"required_units_per_variant"` // planned for the MDE at 80% power; 0 while unknown
+	Progress      float64 `json:"progress"`                   // % of the required sample in the smallest arm
+}
+
+// ExperimentResult is the full analysis of one experiment
+type ExperimentResult struct {
+	Experiment    string             `json:"experiment"`
+	Metric        string             `json:"metric"`
+	Units         int                `json:"units"`
+	MixedUnits    int                `json:"mixed_units"`           // visitors exposed to several variants, excluded
+	UnknownUnits  int                `json:"unknown_variant_units"` // visitors exposed to a variant not in the definition
+	FirstExposure *time.Time         `json:"first_exposure,omitempty"`
+	RuntimeDays   float64            `json:"runtime_days"`
+	Alpha         float64            `json:"alpha"` // per comparison (Bonferroni across variants)
+	Variants      []VariantResult    `json:"variants"`
+	SRM           SRMCheck           `json:"srm"`
+	Guidance      ExperimentGuidance `json:"guidance"`
+}
+
+// exposure is a visitor's first exposure to an experiment
+type exposure struct {
+	variant string
+	time    time.Time
+	mixed   bool
+}
+
+// variantSample is the per-visitor outcome data of one arm
+type variantSample struct {
+	units       int
+	conversions int
+	values      []float64 // revenue per visitor, zeros included
+}
+
+func (s variantSample) rate() float64 {
+	if s.units == 0 {
+		return 0
+	}
+	return float64(s.conversions) / float64(s.units)
+}
+
+// AnalyzeExperiment compares every variant with the control. The unit is the visitor: each is
+// assigned to the variant of their first exposure, and outcomes count from that exposure until the
+// metric window closes. Exposures after asOf are ignored. def must have been validated.
+func AnalyzeExperiment(key string, def ExperimentDefinition, events []TrackedEvent, asOf time.Time) ExperimentResult {
+	result := ExperimentResult{Experiment: key, Metric: def.Metric.Kind, Variants: []VariantResult{}}
+	window, _ := def.Metric.WindowDuration()
+
+	exposures := map[string]*exposure{}
+	for _, e := range events {
+		if e.Type != ExposureEvent || e.Time.After(asOf) {
+			continue
+		}
+		if exp, _ := e.Props["experiment"].(string); exp != key {
+			continue
+		}
+		variant := fmt.Sprint(e.Props["variant"])
+		x, ok := exposures[e.PersonID]
+		if !ok {
+			exposures[e.PersonID] = &exposure{variant: variant, time: e.Time}
+			continue
+		}
+		if variant != x.variant {
+			x.mixed = true
+		}
+		if e.Time.Before(x.time) {
+			x.time = e.Time
+		}
+	}
+
+	variants := def.Variants
+	if len(variants) == 0 {
+		variants = observedVariants(exposures)
+	}
+	index := map[string]int{}
+	for i, v := range variants {
+		index[v.Name] = i
+	}
+
+	// Outcome events inside each visitor's window
+	outcomes := map[string][]TrackedEvent{}
+	for _, e := range events {
+		x, ok := exposures[e.PersonID]
+		if !ok || e.Type == ExposureEvent || e.Time.Before(x.time) || e.Time.After(x.time.Add(window)) {
+			continue
+		}
+		outcomes[e.PersonID] = append(outcomes[e.PersonID], e)
+	}
+
+	samples := make([]variantSample, len(variants))
+	funnelEvents := make([][]TrackedEvent, len(variants))
+	var first time.Time
+	for pid, x := range exposures {
+		if x.mixed {
+			result.MixedUnits++
+			continue
+		}
+		i, ok := index[x.variant]
+		if !ok {
+			result.UnknownUnits++
+			continue
+		}
+		if first.IsZero() || x.time.Before(first) {
+			first = x.time
+		}
+		s := &samples[i]
+		s.units++
+		var revenue float64
+		var converted bool
+		for _, e := range outcomes[pid] {
+			switch def.Metric.Kind {
+			case MetricGoal:
+				converted = converted || def.Metric.Goal.Matches(e)
+			case MetricRevenue:
+				if e.Type == "order_completed" {
+					converted = true
+					r, _ := toFloat(e.Props["revenue"])
+					revenue += r
+				}
+			}
+		}
+		if def.Metric.Kind == MetricFunnel {
+			funnelEvents[i] = append(funnelEvents[i], outcomes[pid]...)
+		}
+		if converted {
+			s.conversions++
+		}
+		s.values = append(s.values, revenue)
+	}
+	if def.Metric.Kind == MetricFunnel {
+		for i := range samples {
+			sort.SliceStable(funnelEvents[i], func(a, b int) bool { return funnelEvents[i][a].Time.Before(funnelEvents[i][b].Time) })
+			samples[i].conversions = ComputeFunnel(*def.Metric.Funnel, funnelEvents[i]).Conversions
+		}
+	}
+	if !first.IsZero() {
+		result.FirstExposure = &first
+		result.RuntimeDays = math.Round(asOf.Sub(first).Hours()/24*10) / 10
+	}
+
+	// Sample ratio mismatch
+	observed := make([]int, len(variants))
+	weights := make([]float64, len(variants))
+	var weightSum float64
+	for i, v := range variants {
+		observed[i] = samples[i].units
+		weights[i] = v.Weight
+		weightSum += v.Weight
+		result.Units += samples[i].units
+	}
+	chi2, srmP := ChiSquareGoodnessOfFit(observed, weights)
+	result.SRM = SRMCheck{ChiSquare: roundTo(chi2, 3), PValue: roundTo(srmP, 4), Mismatch: srmP < srmThreshold}
+
+	comparisons := len(variants) - 1
+	if comparisons < 1 {
+		comparisons = 1
+	}
+	alpha := def.Alpha / float64(comparisons)
+	result.Alpha = roundTo(alpha, 4)
+
+	rng := rand.New(rand.NewSource(1))
+	var controlDraws []float64
+	if len(samples) > 0 && def.Metric.Kind != MetricRevenue {
+		controlDraws = betaDraws(rng, samples[0])
+	}
+	for i, v := range variants {
+		s := samples[i]
+		vr := VariantResult{
+			Name:           v.Name,
+			Control:        i == 0,
+			Units:          s.units,
+			ExpectedShare:  roundTo(v.Weight/weightSum*100, 1),
+			Conversions:    s.conversions,
+			ConversionRate: roundTo(s.rate()*100, 2),
+		}
+		for _, r := range s.values {
+			vr.Revenue += r
+		}
+		vr.Revenue = roundTo(vr.Revenue, 2)
+		vr.RevenuePerUnit = roundTo(Mean(s.values), 2)
+		if i > 0 {
+			var cmp VariantComparison
+			if def.Metric.Kind == MetricRevenue {
+				cmp = compareMeans(samples[0], s, alpha, def.MDE)
+			} else {
+				cmp = compareRates(samples[0], s, alpha, def.MDE, controlDraws, betaDraws(rng, s))
+			}
+			vr.Comparison = &cmp
+		}
+		result.Variants = append(result.Variants, vr)
+	}
+
+	result.Guidance = experimentGuidance(result, samples, def, alpha)
+	return result
+}
+
+// observedVariants lists the variants seen in exposures with equal weights, "control" first
+func observedVariants(exposures map[string]*exposure) []ExperimentVariant {
+	seen := map[string]bool{}
+	for _, x := range exposures {
+		if !x.mixed {
+			seen[x.variant] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "control") != (names[j] == "control") {
+			return names[i] == "control"
+		}
+		return names[i] < names[j]
+	})
+	variants := make([]ExperimentVariant, len(names))
+	for i, n := range names {
+		variants[i] = ExperimentVariant{Name: n, Weight: 1}
+	}
+	return variants
+}
+
+// compareRates runs the two-proportion z-test, the mixture SPRT and Beta-Binomial posteriors
+func compareRates(control, variant variantSample, alpha, mde float64, controlDraws, variantDraws []float64) VariantComparison {
+	t := TwoProportionZTest(control.conversions, control.units, variant.conversions, variant.units)
+	z := normalQuantile(1 - alpha/2)
+	cmp := VariantComparison{
+		Test:       "z_test",
+		Difference: roundTo(t.Difference*100, 2),
+		CILow:      roundTo((t.Difference-z*t.SE)*100, 2),
+		CIHigh:     roundTo((t.Difference+z*t.SE)*100, 2),
+		Statistic:  roundTo(t.Z, 3),
+		PValue:     roundTo(t.PValue, 4),
+	}
+	base := control.rate()
+	if base > 0 {
+		cmp.RelativeLift = roundTo(t.Difference/base*100, 1)
+	}
+	if base == 0 && control.units+variant.units > 0 {
+		base = float64(control.conversions+variant.conversions) / float64(control.units+variant.units)
+	}
+	avp := AlwaysValidPValue(t.Difference, t.SE*t.SE, mde*base)
+	cmp.AlwaysValidP = roundTo(avp, 4)
+	cmp.Significant = avp < alpha
+
+	var wins int
+	var loss float64
+	for i := range variantDraws {
+		if variantDraws[i] > controlDraws[i] {
+			wins++
+		} else {
+			loss += controlDraws[i] - variantDraws[i]
+		}
+	}
+	cmp.ProbabilityToBeat = roundTo(float64(wins)/float64(len(variantDraws))*100, 1)
+	cmp.ExpectedLoss = roundTo(loss/float64(len(variantDraws))*100, 3)
+	return cmp
+}
+
+// compareMeans runs Welch's t-test, the mixture SPRT and a normal posterior on revenue per visitor
+func compareMeans(control, variant variantSample, alpha, mde float64) VariantComparison {
+	t := WelchTTest(control.values, variant.values)
+	q := normalQuantile(1 - alpha/2)
+	if t.DF > 0 {
+		q = studentTQuantile(1-alpha/2, t.DF)
+	}
+	cmp := VariantComparison{
+		Test:       "welch_t",
+		Difference: roundTo(t.Difference, 2),
+		CILow:      roundTo(t.Difference-q*t.SE, 2),
+		CIHigh:     roundTo(t.Difference+q*t.SE, 2),
+		Statistic:  roundTo(t.T, 3),
+		PValue:     roundTo(t.PValue, 4),
+	}
+	base := Mean(control.values)
+	if base > 0 {
+		cmp.RelativeLift = roundTo(t.Difference/base*100, 1)
+	} else {
+		base = Mean(append(append([]float64{}, control.values...), variant.values...))
+	}
+	avp := AlwaysValidPValue(t.Difference, t.SE*t.SE, mde*base)
+	cmp.AlwaysValidP = roundTo(avp, 4)
+	cmp.Significant = avp < alpha
+
+	// With enough visitors the mean difference is close to normal; a flat prior gives N(diff, se²)
+	switch {
+	case t.SE > 0:
+		d := t.Difference / t.SE
+		cmp.ProbabilityToBeat = roundTo(normalCDF(d)*100, 1)
+		density := math.Exp(-d*d/2) / math.Sqrt(2*math.Pi)
+		cmp.ExpectedLoss = roundTo(t.SE*density-t.Difference*normalCDF(-d), 3)
+	case t.Difference > 0:
+		cmp.ProbabilityToBeat = 100
+	case t.Difference == 0:
+		cmp.ProbabilityToBeat = 50
+	default:
+		cmp.ExpectedLoss = roundTo(-t.Difference, 3)
+	}
+	return cmp
+}
+
+// betaDraws samples a conversion rate posterior under a uniform prior
+func betaDraws(rng *rand.Rand, s variantSample) []float64 {
+	draws := make([]float64, bayesDraws)
+	for i := range draws {
+		draws[i] = sampleBeta(rng, float64(1+s.conversions), float64(1+s.units-s.conversions))
+	}
+	return draws
+}
+
+// requiredUnits is the fixed-horizon sample per variant that detects a relative lift of mde
+func requiredUnits(control variantSample, kind string, alpha, mde float64) int {
+	z := normalQuantile(1-alpha/2) + normalQuantile(experimentPower)
+	var n float64
+	if kind == MetricRevenue {
+		base, sd := Mean(control.values), StdDev(control.values)
+		if base <= 0 || sd == 0 {
+			return 0
+		}
+		delta := mde * base
+		n = 2 * z * z * sd * sd / (delta * delta)
+	} else {
+		p1 := control.rate()
+		p2 := math.Min(p1*(1+mde), 1)
+		if p1 <= 0 || p2 == p1 {
+			return 0
+		}
+		n = z * z * (p1*(1-p1) + p2*(1-p2)) / ((p2 - p1) * (p2 - p1))
+	}
+	return int(math.Ceil(n))
+}
+
+// experimentGuidance decides from the always-valid p-values, so results may be checked at any
+// time without inflating false positives
+func experimentGuidance(r ExperimentResult, samples []variantSample, def ExperimentDefinition, alpha float64) ExperimentGuidance {
+	g := ExperimentGuidance{Decision: DecisionKeepRunning}
+	if len(samples) < 2 {
+		g.Reason = "Waiting for exposures in at least two variants"
+		return g
+	}
+	g.RequiredUnits = requiredUnits(samples[0], def.Metric.Kind, alpha, def.MDE)
+	smallest := samples[0].units
+	for _, s := range samples[1:] {
+		if s.units < smallest {
+			smallest = s.units
+		}
+	}
+	if g.RequiredUnits > 0 {
+		g.Progress = roundTo(math.Min(float64(smallest)/float64(g.RequiredUnits)*100, 100), 1)
+	}
+
+	if r.SRM.Mismatch {
+		g.Decision = DecisionInvestigateSRM
+		g.Reason = fmt.Sprintf("Traffic split does not match the variant weights (p=%.4f); results are unreliable until assignment is fixed", r.SRM.PValue)
+		return g
+	}
+	if r.RuntimeDays < minExperimentDays || smallest < minExperimentUnits {
+		g.Reason = fmt.Sprintf("Run at least %d days and %d visitors per variant before deciding", minExperimentDays, minExperimentUnits)
+		return g
+	}
+
+	var best *VariantResult
+	losers := 0
+	for i := range r.Variants[1:] {
+		v := &r.Variants[i+1]
+		if !v.Comparison.Significant {
+			continue
+		}
+		if v.Comparison.Difference > 0 {
+			if best == nil || v.Comparison.Difference > best.Comparison.Difference {
+				best = v
+			}
+		} else {
+			losers++
+		}
+	}
+	switch {
+	case best != nil:
+		g.Decision, g.Winner = DecisionStopWinner, best.Name
+		g.Reason = fmt.Sprintf("%s beats %s (always-valid p=%.4f)", best.Name, r.Variants[0].Name, best.Comparison.AlwaysValidP)
+	case losers == len(r.Variants)-1:
+		g.Decision, g.Winner = DecisionStopWinner, r.Variants[0].Name
+		g.Reason = "Every variant performs significantly worse than the control"
+	case g.RequiredUnits > 0 && smallest >= g.RequiredUnits:
+		g.Decision = DecisionStopNoEffect
+		g.Reason = fmt.Sprintf("Reached the planned sample without detecting a %.0f%% lift", def.MDE*100)
+	default:
+		g.Reason = "No significant difference yet"
+	}
+	return g
+}
+
+func roundTo(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
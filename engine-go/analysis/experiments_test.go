@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistributionFunctions(t *testing.T) {
+	assert.InDelta(t, 0.9633, studentTCDF(2, 10), 1e-4)
+	assert.InDelta(t, 0.0367, studentTCDF(-2, 10), 1e-4)
+	assert.InDelta(t, 2.228, studentTQuantile(0.975, 10), 1e-3)
+	assert.InDelta(t, 0.05, chiSquareSF(3.841, 1), 1e-4)
+	assert.InDelta(t, 0.05, chiSquareSF(5.991, 2), 1e-4)
+	assert.InDelta(t, 1.96, normalQuantile(0.975), 1e-3)
+
+	z := TwoProportionZTest(100, 1000, 130, 1000)
+	assert.InDelta(t, 2.103, z.Z, 1e-3)
+	assert.InDelta(t, 0.0355, z.PValue, 1e-4)
+
+	// The always-valid p-value never beats the fixed-horizon one
+	assert.Greater(t, AlwaysValidPValue(z.Difference, z.SE*z.SE, 0.01), z.PValue)
+}
+
+func TestAnalyzeExperimentGoal(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	var events []TrackedEvent
+	expose := func(person, variant string, at time.Time) {
+		events = append(events, TrackedEvent{PersonID: person, Type: ExposureEvent, Time: at,
+			Props: map[string]interface{}{"experiment": "checkout-cta", "variant": variant}})
+	}
+	for i := 0; i < 2000; i++ {
+		variant := []string{"control", "green"}[i%2]
+		person := fmt.Sprintf("p%d", i)
+		at := start.Add(time.Duration(i) * 7 * time.Minute)
+		expose(person, variant, at)
+		// 10% convert on control, 20% on green
+		if (variant == "control" && i%20 == 0) || (variant == "green" && i%10 == 1) {
+			events = append(events, TrackedEvent{PersonID: person, Type: "pageview", URL: "https://site.com/thank-you", Time: at.Add(time.Hour)})
+		}
+	}
+	// Converted before exposure: not credited
+	events = append(events, TrackedEvent{PersonID: "p2", Type: "pageview", URL: "https://site.com/thank-you", Time: start.Add(-time.Hour)})
+	// Saw both variants: excluded
+	expose("p3", "control", start.Add(time.Hour))
+
+	def := ExperimentDefinition{
+		Variants: []ExperimentVariant{{Name: "control"}, {Name: "green"}},
+		Metric:   ExperimentMetric{Kind: MetricGoal, Goal: &FunnelStep{URLPattern: "/thank-you"}},
+	}
+	require.NoError(t, def.Validate())
+	assert.Equal(t, []string{ExposureEvent, "pageview"}, def.Metric.EventTypes())
+
+	r := AnalyzeExperiment("checkout-cta", def, events, start.AddDate(0, 0, 14))
+	assert.Equal(t, 1, r.MixedUnits)
+	assert.Equal(t, 1999, r.Units)
+	require.Len(t, r.Variants, 2)
+	assert.Equal(t, 1000, r.Variants[0].Units)
+	assert.Equal(t, 100, r.Variants[0].Conversions)
+	assert.Equal(t, 200, r.Variants[1].Conversions)
+	assert.False(t, r.SRM.Mismatch)
+
+	cmp := r.Variants[1].Comparison
+	require.NotNil(t, cmp)
+	assert.Equal(t, "z_test", cmp.Test)
+	assert.InDelta(t, 10.02, cmp.Difference, 0.01)
+	assert.True(t, cmp.Significant)
+	assert.Greater(t, cmp.ProbabilityToBeat, 99.0)
+	assert.Equal(t, DecisionStopWinner, r.Guidance.Decision)
+	assert.Equal(t, "green", r.Guidance.Winner)
+}
+
+func TestAnalyzeExperimentRevenueAndSRM(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	var events []TrackedEvent
+	add := func(n int, variant string, revenue float64) {
+		for i := 0; i < n; i++ {
+			person := fmt.Sprintf("%s-%d", variant, i)
+			at := start.Add(time.Duration(i) * 10 * time.Minute)
+			events = append(events, TrackedEvent{PersonID: person, Type: ExposureEvent, Time: at,
+				Props: map[string]interface{}{"experiment": "pricing", "variant": variant}})
+			if i%4 == 0 {
+				events = append(events, TrackedEvent{PersonID: person, Type: "order_completed", Time: at.Add(time.Minute),
+					Props: map[string]interface{}{"revenue": revenue + float64(i%7)}})
+			}
+		}
+	}
+	add(1000, "control", 40)
+	add(800, "discount", 40)
+
+	def := ExperimentDefinition{Metric: ExperimentMetric{Kind: MetricRevenue}}
+	require.NoError(t, def.Validate())
+	r := AnalyzeExperiment("pricing", def, events, start.AddDate(0, 0, 10))
+
+	// Variants are detected from exposures, control first
+	require.Len(t, r.Variants, 2)
+	assert.Equal(t, "control", r.Variants[0].Name)
+	assert.InDelta(t, 10.75, r.Variants[0].RevenuePerUnit, 0.01)
+	assert.Equal(t, "welch_t", r.Variants[1].Comparison.Test)
+	assert.False(t, r.Variants[1].Comparison.Significant)
+
+	assert.True(t, r.SRM.Mismatch)
+	assert.Less(t, r.SRM.PValue, 0.001)
+	assert.Equal(t, DecisionInvestigateSRM, r.Guidance.Decision)
+}
+
+func TestExperimentDefinitionValidate(t *testing.T) {
+	for _, def := range []ExperimentDefinition{
+		{Variants: []ExperimentVariant{{Name: "control"}}},
+		{Variants: []ExperimentVariant{{Name: "a"}, {Name: "a"}}},
+		{Metric: ExperimentMetric{Kind: MetricGoal}},
+		{Metric: ExperimentMetric{Kind: "clicks"}},
+		{Alpha: 0.7},
+	} {
+		assert.Error(t, def.Validate(), def)
+	}
+}
@@ -0,0 +1,213 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// z-scores for the reported prediction intervals
+const (
+	z80 = 1.2816
+	z95 = 1.96
+)
+
+// ForecastOptions configures a Holt-Winters forecast
+type ForecastOptions struct {
+	Horizon      int           // buckets to forecast
+	SeasonLength int           // buckets per season (7 for daily data with a weekly cycle)
+	Step         time.Duration // bucket width, used to timestamp forecast points
+	StepDays     int           // calendar days per bucket; overrides Step so daily points stay on local midnight across DST
+	NonNegative  bool          // clamp forecasts and lower bounds at zero (counts, revenue)
+}
+
+// HoltWintersModel holds fitted additive Holt-Winters parameters and final state
+type HoltWintersModel struct {
+	Alpha    float64 `json:"alpha"`
+	Beta     float64 `json:"beta"`
+	Gamma    float64 `json:"gamma"`
+	Seasonal bool    `json:"seasonal"` // false when there was too little data for a season
+	Sigma    float64 `json:"sigma"`    // std dev of one-step-ahead residuals
+	level    float64
+	trend    float64
+	season   []float64
+	m        int
+	n        int // points consumed, used to align the seasonal index
+}
+
+// ForecastPoint is one forecast bucket with 80% and 95% prediction intervals
+type ForecastPoint struct {
+	Time    time.Time `json:"time"`
+	Value   float64   `json:"value"`
+	Lower80 float64   `json:"lower_80"`
+	Upper80 float64   `json:"upper_80"`
+	Lower95 float64   `json:"lower_95"`
+	Upper95 float64   `json:"upper_95"`
+	Std     float64   `json:"std"`
+}
+
+// BacktestResult is the accuracy of the model on held-out history
+type BacktestResult struct {
+	Holdout int     `json:"holdout"`
+	MAPE    float64 `json:"mape"` // mean absolute % error, buckets with zero actuals skipped
+	MAE     float64 `json:"mae"`
+}
+
+// FitHoltWinters fits additive Holt-Winters by grid search over the smoothing parameters,
+// minimising one-step-ahead squared error. With fewer than two seasons of data it falls
+// back to Holt's linear trend method.
+func FitHoltWinters(values []float64, seasonLength int) (*HoltWintersModel, error) {
+	if len(values) < 4 {
+		return nil, fmt.Errorf("need at least 4 points to forecast, got %d", len(values))
+	}
+	seasonal := seasonLength > 1 && len(values) >= 2*seasonLength
+
+	grid := []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+	betas := []float64{0, 0.01, 0.05, 0.1, 0.2}
+	gammas := []float64{0}
+	if seasonal {
+		gammas = []float64{0.05, 0.1, 0.2, 0.3, 0.5}
+	}
+
+	var best *HoltWintersModel
+	bestSSE := math.Inf(1)
+	for _, a := range grid {
+		for _, b := range betas {
+			for _, g := range gammas {
+				m := &HoltWintersModel{Alpha: a, Beta: b, Gamma: g, Seasonal: seasonal, m: seasonLength}
+				sse, n := m.run(values)
+				if n > 0 && sse < bestSSE {
+					bestSSE = sse
+					best = m
+					best.Sigma = math.Sqrt(sse / float64(n))
+				}
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("not enough history past the initial season to fit a model")
+	}
+	return best, nil
+}
+
+// run initialises the state, smooths through values and returns the one-step SSE
+func (m *HoltWintersModel) run(values []float64) (sse float64, n int) {
+	var start int
+	if m.Seasonal {
+		s := m.m
+		first, second := Mean(values[:s]), Mean(values[s:2*s])
+		m.level = first
+		m.trend = (second - first) / float64(s)
+		m.season = make([]float64, s)
+		for i := 0; i < s; i++ {
+			m.season[i] = (values[i] - first + values[s+i] - second) / 2
+		}
+		start = s
+	} else {
+		m.level = values[0]
+		m.trend = values[1] - values[0]
+		m.season = nil
+		start = 1
+	}
+
+	for t := start; t < len(values); t++ {
+		var s float64
+		idx := 0
+		if m.Seasonal {
+			idx = t % m.m
+			s = m.season[idx]
+		}
+		predicted := m.level + m.trend + s
+		err := values[t] - predicted
+		if t >= 2*m.m || !m.Seasonal {
+			sse += err * err
+			n++
+		}
+
+		prevLevel := m.level
+		m.level = m.Alpha*(values[t]-s) + (1-m.Alpha)*(m.level+m.trend)
+		m.trend = m.Beta*(m.level-prevLevel) + (1-m.Beta)*m.trend
+		if m.Seasonal {
+			m.season[idx] = m.Gamma*(values[t]-m.level) + (1-m.Gamma)*s
+		}
+	}
+	m.n = len(values)
+	return sse, n
+}
+
+// Forecast projects h buckets past the fitted data. Interval widths follow the additive
+// Holt-Winters variance: sigma^2 * (1 + sum c_j^2), c_j = alpha(1 + j*beta) + gamma*[j mod m == 0].
+func (m *HoltWintersModel) Forecast(last time.Time, opts ForecastOptions) []ForecastPoint {
+	points := make([]ForecastPoint, 0, opts.Horizon)
+	var cumulative float64
+	for h := 1; h <= opts.Horizon; h++ {
+		value := m.level + float64(h)*m.trend
+		if m.Seasonal {
+			value += m.season[(m.n+h-1)%m.m]
+		}
+
+		if h > 1 {
+			j := float64(h - 1)
+			c := m.Alpha * (1 + j*m.Beta)
+			if m.Seasonal && (h-1)%m.m == 0 {
+				c += m.Gamma
+			}
+			cumulative += c * c
+		}
+		std := m.Sigma * math.Sqrt(1+cumulative)
+
+		at := last.Add(time.Duration(h) * opts.Step)
+		if opts.StepDays > 0 {
+			at = last.AddDate(0, 0, h*opts.StepDays)
+		}
+		p := ForecastPoint{
+			Time:    at,
+			Value:   value,
+			Lower80: value - z80*std,
+			Upper80: value + z80*std,
+			Lower95: value - z95*std,
+			Upper95: value + z95*std,
+			Std:     std,
+		}
+		if opts.NonNegative {
+			p.Value = math.Max(p.Value, 0)
+			p.Lower80 = math.Max(p.Lower80, 0)
+			p.Lower95 = math.Max(p.Lower95, 0)
+			p.Upper80 = math.Max(p.Upper80, 0)
+			p.Upper95 = math.Max(p.Upper95, 0)
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// Backtest refits on all but the last holdout buckets and scores the forecast against them
+func Backtest(values []float64, holdout int, opts ForecastOptions) (BacktestResult, error) {
+	if holdout <= 0 || holdout >= len(values)-4 {
+		return BacktestResult{}, fmt.Errorf("not enough history to backtest %d buckets", holdout)
+	}
+	train, test := values[:len(values)-holdout], values[len(values)-holdout:]
+	model, err := FitHoltWinters(train, opts.SeasonLength)
+	if err != nil {
+		return BacktestResult{}, err
+	}
+	opts.Horizon = holdout
+	forecast := model.Forecast(time.Time{}, opts)
+
+	res := BacktestResult{Holdout: holdout}
+	var pctSum float64
+	var pctN int
+	for i, actual := range test {
+		diff := math.Abs(actual - forecast[i].Value)
+		res.MAE += diff
+		if actual != 0 {
+			pctSum += diff / math.Abs(actual)
+			pctN++
+		}
+	}
+	res.MAE /= float64(holdout)
+	if pctN > 0 {
+		res.MAPE = pctSum / float64(pctN) * 100
+	}
+	return res, nil
+}
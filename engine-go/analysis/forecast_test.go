@@ -0,0 +1,65 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHoltWintersWeeklySeason(t *testing.T) {
+	// Eight weeks of daily traffic: a weekday/weekend pattern on a slow upward trend
+	weekly := []float64{120, 130, 125, 128, 110, 60, 55}
+	var values []float64
+	for w := 0; w < 8; w++ {
+		for _, v := range weekly {
+			values = append(values, v+float64(w)*2)
+		}
+	}
+
+	opts := ForecastOptions{Horizon: 7, SeasonLength: 7, Step: 24 * time.Hour, NonNegative: true}
+	model, err := FitHoltWinters(values, 7)
+	require.NoError(t, err)
+	assert.True(t, model.Seasonal)
+
+	forecast := model.Forecast(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), opts)
+	require.Len(t, forecast, 7)
+	// The weekend dip carries into the forecast
+	assert.Less(t, forecast[5].Value, forecast[0].Value)
+	for _, p := range forecast {
+		assert.LessOrEqual(t, p.Lower95, p.Lower80)
+		assert.LessOrEqual(t, p.Lower80, p.Value)
+		assert.GreaterOrEqual(t, p.Upper95, p.Upper80)
+	}
+	// Intervals widen with the horizon
+	assert.GreaterOrEqual(t, forecast[6].Std, forecast[0].Std)
+
+	bt, err := Backtest(values, 7, opts)
+	require.NoError(t, err)
+	assert.Less(t, bt.MAPE, 5.0)
+}
+
+func TestHoltWintersShortSeriesFallsBackToTrend(t *testing.T) {
+	model, err := FitHoltWinters([]float64{10, 12, 14, 16, 18}, 7)
+	require.NoError(t, err)
+	assert.False(t, model.Seasonal)
+
+	forecast := model.Forecast(time.Time{}, ForecastOptions{Horizon: 2, Step: time.Hour})
+	assert.InDelta(t, 20, forecast[0].Value, 1)
+}
+
+func TestForecastStepDaysKeepsLocalMidnightAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	model, err := FitHoltWinters([]float64{10, 12, 14, 16, 18}, 7)
+	require.NoError(t, err)
+
+	// Summer time starts on 2024-03-31, a 23-hour day
+	last := time.Date(2024, 3, 30, 0, 0, 0, 0, berlin)
+	forecast := model.Forecast(last, ForecastOptions{Horizon: 3, StepDays: 1})
+	for i, p := range forecast {
+		assert.Equal(t, last.AddDate(0, 0, i+1), p.Time)
+		assert.Zero(t, p.Time.Hour())
+	}
+}
@@ -0,0 +1,202 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Normalized form event types
+const (
+	FormFocus     = "focus"
+	FormBlur      = "blur"
+	FormChange    = "change"
+	FormInvalid   = "invalid"
+	FormSubmit    = "submit"
+	FormRageClick = "rage_click"
+)
+
+// FormEvent is one tracker event about a form or one of its fields
+type FormEvent struct {
+	Type    string
+	FormID  string
+	Field   string
+	Time    time.Time
+	DwellMs float64
+}
+
+// FormFieldDelta is what one batch adds to a (form, session, field) row
+type FormFieldDelta struct {
+	Field   string
+	FirstMs int64 // first interaction, unix ms
+	Focuses int
+	Blurs   int
+	Changes int
+	Errors  int
+	DwellMs float64
+}
+
+// FormSessionDelta is what one batch adds to a (form, session) row
+type FormSessionDelta struct {
+	FormID      string
+	StartedMs   int64
+	LastMs      int64
+	LastField   string // last field touched in this batch
+	Submitted   bool
+	SubmittedMs int64
+	RageClicks  int
+	Fields      []*FormFieldDelta
+}
+
+// NormalizeFormEventType maps tracker event names (form_field_focus, form_submit, blur, ...)
+// onto the normalized types; unknown types come back empty
+func NormalizeFormEventType(t string) string {
+	t = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(t), "form_field_"), "form_")
+	switch t {
+	case FormFocus, FormBlur, FormChange, FormInvalid, FormSubmit, FormRageClick:
+		return t
+	case "error", "validation_error":
+		return FormInvalid
+	}
+	return ""
+}
+
+// FoldFormEvents collapses a batch of one session's events into per-form deltas, so storage only
+// has to add counters instead of re-reading raw events
+func FoldFormEvents(events []FormEvent) []FormSessionDelta {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	byForm := map[string]*FormSessionDelta{}
+	fields := map[string]map[string]*FormFieldDelta{}
+	var order []string
+
+	for _, e := range events {
+		typ := NormalizeFormEventType(e.Type)
+		if typ == "" || e.FormID == "" {
+			continue
+		}
+		ms := e.Time.UnixMilli()
+
+		d := byForm[e.FormID]
+		if d == nil {
+			d = &FormSessionDelta{FormID: e.FormID, StartedMs: ms}
+			byForm[e.FormID] = d
+			fields[e.FormID] = map[string]*FormFieldDelta{}
+			order = append(order, e.FormID)
+		}
+		if ms > d.LastMs {
+			d.LastMs = ms
+		}
+
+		switch typ {
+		case FormSubmit:
+			if !d.Submitted {
+				d.Submitted = true
+				d.SubmittedMs = ms
+			}
+			continue
+		case FormRageClick:
+			d.RageClicks++
+			continue
+		}
+		if e.Field == "" {
+			continue
+		}
+
+		f := fields[e.FormID][e.Field]
+		if f == nil {
+			f = &FormFieldDelta{Field: e.Field, FirstMs: ms}
+			fields[e.FormID][e.Field] = f
+			d.Fields = append(d.Fields, f)
+		}
+		switch typ {
+		case FormFocus:
+			f.Focuses++
+		case FormBlur:
+			f.Blurs++
+			f.DwellMs += e.DwellMs
+		case FormChange:
+			f.Changes++
+		case FormInvalid:
+			f.Errors++
+		}
+		d.LastField = e.Field
+	}
+
+	out := make([]FormSessionDelta, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byForm[id])
+	}
+	return out
+}
+
+// FormFunnelStep is one field in a form's typical fill order
+type FormFunnelStep struct {
+	Field     string  `json:"field"`
+	Position  int     `json:"position"`
+	Reached   int     `json:"reached"`    // sessions that touched the field
+	ReachRate float64 `json:"reach_rate"` // % of starters
+}
+
+// FieldOrderFunnel orders fields by how soon after the form was started they are first touched
+func FieldOrderFunnel(reached map[string]int, offsetMs map[string]float64, starters int) []FormFunnelStep {
+	steps := make([]FormFunnelStep, 0, len(reached))
+	for f, n := range reached {
+		s := FormFunnelStep{Field: f, Reached: n}
+		if starters > 0 {
+			s.ReachRate = round1(float64(n) / float64(starters) * 100)
+		}
+		steps = append(steps, s)
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		oi, oj := offsetMs[steps[i].Field], offsetMs[steps[j].Field]
+		if oi != oj {
+			return oi < oj
+		}
+		return steps[i].Field < steps[j].Field
+	})
+	for i := range steps {
+		steps[i].Position = i + 1
+	}
+	return steps
+}
+
+// DurationDistribution summarises time-to-complete in seconds
+type DurationDistribution struct {
+	Count     int            `json:"count"`
+	P25       float64        `json:"p25"`
+	Median    float64        `json:"median"`
+	P75       float64        `json:"p75"`
+	P90       float64        `json:"p90"`
+	Histogram map[string]int `json:"histogram"`
+}
+
+var durationBuckets = []struct {
+	label string
+	upper float64
+}{{"<30s", 30}, {"30-60s", 60}, {"1-2m", 120}, {"2-5m", 300}, {"5-10m", 600}, {">10m", math.Inf(1)}}
+
+// CompletionDistribution buckets completion times (seconds)
+func CompletionDistribution(seconds []float64) DurationDistribution {
+	d := DurationDistribution{Count: len(seconds), Histogram: map[string]int{}}
+	for _, b := range durationBuckets {
+		d.Histogram[b.label] = 0
+	}
+	if len(seconds) == 0 {
+		return d
+	}
+	for _, s := range seconds {
+		for _, b := range durationBuckets {
+			if s < b.upper {
+				d.Histogram[b.label]++
+				break
+			}
+		}
+	}
+	d.P25 = round1(Percentile(seconds, 25))
+	d.Median = round1(Median(seconds))
+	d.P75 = round1(Percentile(seconds, 75))
+	d.P90 = round1(Percentile(seconds, 90))
+	return d
+}
@@ -0,0 +1,40 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldFormEvents(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+
+	deltas := FoldFormEvents([]FormEvent{
+		{Type: "form_field_blur", FormID: "checkout", Field: "#email", Time: at(5), DwellMs: 4000},
+		{Type: "form_field_focus", FormID: "checkout", Field: "#email", Time: at(1)},
+		{Type: "form_field_change", FormID: "checkout", Field: "#email", Time: at(4)},
+		{Type: "form_field_invalid", FormID: "checkout", Field: "#email", Time: at(6)},
+		{Type: "form_field_focus", FormID: "checkout", Field: "#email", Time: at(7)},
+		{Type: "form_field_focus", FormID: "checkout", Field: "#phone", Time: at(9)},
+		{Type: "form_rage_click", FormID: "checkout", Time: at(10)},
+		{Type: "scroll", FormID: "checkout", Time: at(11)},
+		{Type: "form_submit", FormID: "newsletter", Time: at(12)},
+	})
+	require.Len(t, deltas, 2)
+
+	d := deltas[0]
+	assert.Equal(t, "checkout", d.FormID)
+	assert.Equal(t, at(1).UnixMilli(), d.StartedMs)
+	assert.Equal(t, at(10).UnixMilli(), d.LastMs)
+	assert.Equal(t, "#phone", d.LastField)
+	assert.Equal(t, 1, d.RageClicks)
+	assert.False(t, d.Submitted)
+	require.Len(t, d.Fields, 2)
+	assert.Equal(t, FormFieldDelta{Field: "#email", FirstMs: at(1).UnixMilli(), Focuses: 2, Blurs: 1, Changes: 1, Errors: 1, DwellMs: 4000}, *d.Fields[0])
+
+	assert.True(t, deltas[1].Submitted)
+	assert.Equal(t, at(12).UnixMilli(), deltas[1].SubmittedMs)
+}
@@ -0,0 +1,207 @@
+package analysis
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Frustration signal kinds stored as recording annotations
+const (
+	SignalRageClick     = "rage_click"
+	SignalDeadClick     = "dead_click"
+	SignalErrorClick    = "error_click"
+	SignalConsoleError  = "console_error"
+	SignalThrashedMouse = "thrashed_cursor"
+)
+
+// Detection thresholds (milliseconds and CSS pixels)
+const (
+	rageClickGapMs     = 500
+	rageClickRadiusPx  = 30
+	rageClickMin       = 3
+	deadClickWindowMs  = 1000
+	errorClickWindowMs = 2000
+	thrashWindowMs     = 1500
+	thrashReversals    = 5
+	thrashMinTravelPx  = 800
+	thrashMinStepPx    = 15
+)
+
+// more rrweb types used for frustration detection
+const (
+	rrPlugin        = 6
+	rrSrcMouseMove  = 1
+	rrSrcInput      = 5
+	rrSrcTouchMove  = 6
+	rrSrcMediaEvent = 7
+)
+
+// FrustrationSignal is one detected moment of user frustration inside a recording
+type FrustrationSignal struct {
+	Kind        string  `json:"kind"`
+	TimestampMs int64   `json:"ts"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	NodeID      int     `json:"node_id,omitempty"`
+	Count       int     `json:"count,omitempty"`
+	Detail      string  `json:"detail,omitempty"`
+}
+
+type rrClick struct {
+	ts   int64
+	x, y float64
+	id   int
+}
+
+type rrPoint struct {
+	ts   int64
+	x, y float64
+}
+
+type rrConsole struct {
+	Plugin  string `json:"plugin"`
+	Payload struct {
+		Level   string   `json:"level"`
+		Payload []string `json:"payload"`
+	} `json:"payload"`
+}
+
+type rrMoveData struct {
+	Positions []struct {
+		X          float64 `json:"x"`
+		Y          float64 `json:"y"`
+		TimeOffset int64   `json:"timeOffset"`
+	} `json:"positions"`
+}
+
+// DetectFrustration scans one replay chunk for rage clicks, dead clicks, clicks followed by
+// console errors and thrashed cursor movement. Clicks too close to the end of the chunk to
+// tell whether the page reacted are not reported as dead.
+func DetectFrustration(events []RRWebEvent) []FrustrationSignal {
+	var clicks []rrClick
+	var moves []rrPoint
+	var responses []int64 // anything that shows the page reacted
+	var errors []FrustrationSignal
+	var lastTs int64
+
+	for _, e := range events {
+		if e.Timestamp > lastTs {
+			lastTs = e.Timestamp
+		}
+		switch e.Type {
+		case rrMeta, rrFullSnapshot:
+			responses = append(responses, e.Timestamp)
+		case rrPlugin:
+			var p rrConsole
+			if json.Unmarshal(e.Data, &p) == nil && strings.Contains(p.Plugin, "console") && p.Payload.Level == "error" {
+				errors = append(errors, FrustrationSignal{Kind: SignalConsoleError, TimestampMs: e.Timestamp,
+					Detail: truncate(strings.Join(p.Payload.Payload, " "), 255)})
+			}
+		case rrIncremental:
+			var d rrData
+			if json.Unmarshal(e.Data, &d) != nil {
+				continue
+			}
+			switch d.Source {
+			case rrSrcMutation, rrSrcScroll, rrSrcInput, rrSrcMediaEvent:
+				responses = append(responses, e.Timestamp)
+			case rrSrcMouse:
+				if d.Kind == rrMouseClick {
+					clicks = append(clicks, rrClick{ts: e.Timestamp, x: d.X, y: d.Y, id: d.ID})
+				}
+			case rrSrcMouseMove, rrSrcTouchMove:
+				var m rrMoveData
+				if json.Unmarshal(e.Data, &m) == nil {
+					for _, p := range m.Positions {
+						moves = append(moves, rrPoint{ts: e.Timestamp + p.TimeOffset, x: p.X, y: p.Y})
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(clicks, func(i, j int) bool { return clicks[i].ts < clicks[j].ts })
+	sort.Slice(responses, func(i, j int) bool { return responses[i] < responses[j] })
+	sort.Slice(moves, func(i, j int) bool { return moves[i].ts < moves[j].ts })
+
+	signals := append([]FrustrationSignal{}, errors...)
+
+	inRage := make([]bool, len(clicks))
+	for i := 0; i < len(clicks); {
+		j := i + 1
+		for j < len(clicks) && clicks[j].ts-clicks[j-1].ts <= rageClickGapMs &&
+			math.Hypot(clicks[j].x-clicks[i].x, clicks[j].y-clicks[i].y) <= rageClickRadiusPx {
+			j++
+		}
+		if j-i >= rageClickMin {
+			c := clicks[i]
+			signals = append(signals, FrustrationSignal{Kind: SignalRageClick, TimestampMs: c.ts, X: c.x, Y: c.y, NodeID: c.id, Count: j - i})
+			for k := i; k < j; k++ {
+				inRage[k] = true
+			}
+		}
+		i = j
+	}
+
+	for i, c := range clicks {
+		for _, e := range errors {
+			if e.TimestampMs >= c.ts && e.TimestampMs-c.ts <= errorClickWindowMs {
+				signals = append(signals, FrustrationSignal{Kind: SignalErrorClick, TimestampMs: c.ts, X: c.x, Y: c.y, NodeID: c.id, Detail: e.Detail})
+				break
+			}
+		}
+		if inRage[i] || lastTs-c.ts < deadClickWindowMs {
+			continue
+		}
+		k := sort.Search(len(responses), func(k int) bool { return responses[k] > c.ts })
+		if k == len(responses) || responses[k]-c.ts > deadClickWindowMs {
+			signals = append(signals, FrustrationSignal{Kind: SignalDeadClick, TimestampMs: c.ts, X: c.x, Y: c.y, NodeID: c.id})
+		}
+	}
+
+	signals = append(signals, detectThrash(moves)...)
+	sort.SliceStable(signals, func(i, j int) bool { return signals[i].TimestampMs < signals[j].TimestampMs })
+	return signals
+}
+
+// detectThrash looks for windows where the cursor keeps reversing horizontally over a long path
+func detectThrash(moves []rrPoint) []FrustrationSignal {
+	var out []FrustrationSignal
+	for start := 0; start < len(moves); {
+		reversals, dir := 0, 0
+		travel := 0.0
+		end := start + 1
+		for ; end < len(moves) && moves[end].ts-moves[start].ts <= thrashWindowMs; end++ {
+			dx := moves[end].x - moves[end-1].x
+			travel += math.Hypot(dx, moves[end].y-moves[end-1].y)
+			if math.Abs(dx) < thrashMinStepPx {
+				continue
+			}
+			d := 1
+			if dx < 0 {
+				d = -1
+			}
+			if dir != 0 && d != dir {
+				reversals++
+			}
+			dir = d
+		}
+		if reversals >= thrashReversals && travel >= thrashMinTravelPx {
+			p := moves[start]
+			out = append(out, FrustrationSignal{Kind: SignalThrashedMouse, TimestampMs: p.ts, X: p.x, Y: p.y, Count: reversals})
+			start = end
+			continue
+		}
+		start++
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
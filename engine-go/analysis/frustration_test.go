@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func kinds(signals []FrustrationSignal) []string {
+	out := make([]string, len(signals))
+	for i, s := range signals {
+		out[i] = s.Kind
+	}
+	return out
+}
+
+func TestDetectFrustrationClicks(t *testing.T) {
+	events := rrEvents(t, `[
+		{"type":3,"timestamp":1000,"data":{"source":2,"type":2,"id":7,"x":100,"y":200}},
+		{"type":3,"timestamp":1300,"data":{"source":2,"type":2,"id":7,"x":104,"y":198}},
+		{"type":3,"timestamp":1550,"data":{"source":2,"type":2,"id":7,"x":101,"y":203}},
+
+		{"type":3,"timestamp":4000,"data":{"source":2,"type":2,"id":9,"x":500,"y":40}},
+		{"type":3,"timestamp":4200,"data":{"source":0,"adds":[]}},
+
+		{"type":3,"timestamp":6000,"data":{"source":2,"type":2,"id":11,"x":300,"y":300}},
+		{"type":6,"timestamp":6400,"data":{"plugin":"rrweb/console@1","payload":{"level":"error","payload":["TypeError: x is undefined"]}}},
+
+		{"type":3,"timestamp":9000,"data":{"source":2,"type":2,"id":12,"x":10,"y":10}},
+		{"type":3,"timestamp":9500,"data":{"source":1,"positions":[]}}
+	]`)
+
+	signals := DetectFrustration(events)
+	assert.Equal(t, []string{SignalRageClick, SignalErrorClick, SignalDeadClick, SignalConsoleError}, kinds(signals))
+
+	assert.Equal(t, 3, signals[0].Count)
+	assert.Equal(t, 7, signals[0].NodeID)
+	assert.Equal(t, "TypeError: x is undefined", signals[1].Detail)
+	// The click at 6000 has no DOM response either
+	assert.Equal(t, int64(6000), signals[2].TimestampMs)
+	// The click at 9000 is too close to the end of the chunk to call dead
+}
+
+func TestDetectFrustrationThrash(t *testing.T) {
+	events := rrEvents(t, `[
+		{"type":3,"timestamp":2000,"data":{"source":1,"positions":[
+			{"x":100,"y":300,"timeOffset":-1000},{"x":300,"y":310,"timeOffset":-900},
+			{"x":110,"y":300,"timeOffset":-800},{"x":320,"y":305,"timeOffset":-700},
+			{"x":100,"y":300,"timeOffset":-600},{"x":310,"y":300,"timeOffset":-500},
+			{"x":120,"y":300,"timeOffset":-400}]}}
+	]`)
+	signals := DetectFrustration(events)
+	require.Len(t, signals, 1)
+	assert.Equal(t, SignalThrashedMouse, signals[0].Kind)
+	assert.Equal(t, int64(1000), signals[0].TimestampMs)
+	assert.Equal(t, 5, signals[0].Count)
+}
@@ -0,0 +1,294 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Funnel modes
+const (
+	FunnelOrdered  = "ordered"
+	FunnelAnyOrder = "any"
+)
+
+// FunnelStep matches a pageview URL pattern, an event type, or both, plus optional property filters
+type FunnelStep struct {
+	Name       string           `json:"name"`
+	URLPattern string           `json:"url_pattern,omitempty"`
+	EventType  string           `json:"event_type,omitempty"`
+	Filters    []PropertyFilter `json:"filters,omitempty"`
+}
+
+// FunnelDefinition is the stored, reusable shape of a funnel
+type FunnelDefinition struct {
+	Steps            []FunnelStep `json:"steps"`
+	Mode             string       `json:"mode"`              // "ordered" (default) or "any"
+	ConversionWindow string       `json:"conversion_window"` // e.g. "30m", "24h", "7d" (default 7d)
+}
+
+// FunnelStepResult holds per-step counts and timings
+type FunnelStepResult struct {
+	Name                   string  `json:"name"`
+	Count                  int     `json:"count"`
+	ConversionRate         float64 `json:"conversion_rate"`      // % of entrants reaching this step
+	StepConversionRate     float64 `json:"step_conversion_rate"` // % of the previous step reaching this step
+	DropOff                int     `json:"dropoff"`              // lost between the previous step and this one
+	MedianSecondsFromPrior float64 `json:"median_seconds_from_prior"`
+}
+
+// FunnelReport is the computed funnel with channel/device breakdowns
+type FunnelReport struct {
+	Mode           string                      `json:"mode"`
+	Entrants       int                         `json:"entrants"`
+	Conversions    int                         `json:"conversions"`
+	ConversionRate float64                     `json:"conversion_rate"`
+	Steps          []FunnelStepResult          `json:"steps"`
+	Breakdowns     map[string]map[string][]int `json:"breakdowns"` // dimension -> value -> count per step
+}
+
+// Validate checks the definition can be evaluated
+func (d FunnelDefinition) Validate() error {
+	if len(d.Steps) < 2 {
+		return fmt.Errorf("a funnel needs at least 2 steps")
+	}
+	if d.Mode != "" && d.Mode != FunnelOrdered && d.Mode != FunnelAnyOrder {
+		return fmt.Errorf("unknown funnel mode %q", d.Mode)
+	}
+	if _, err := d.Window(); err != nil {
+		return err
+	}
+	for i, s := range d.Steps {
+		if s.URLPattern == "" && s.EventType == "" {
+			return fmt.Errorf("step %d needs a url_pattern or event_type", i+1)
+		}
+		for _, f := range s.Filters {
+			if err := f.Validate(); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Window returns the conversion window
+func (d FunnelDefinition) Window() (time.Duration, error) {
+	return ParseWindow(d.ConversionWindow, 7*24*time.Hour)
+}
+
+// EventTypes lists the event types needed to evaluate the funnel
+func (d FunnelDefinition) EventTypes() []string {
+	seen := map[string]bool{}
+	var types []string
+	for _, s := range d.Steps {
+		t := s.eventType()
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func (s FunnelStep) eventType() string {
+	if s.EventType != "" {
+		return s.EventType
+	}
+	return "pageview"
+}
+
+// Matches reports whether an event satisfies the step
+func (s FunnelStep) Matches(e TrackedEvent) bool {
+	if e.Type != s.eventType() {
+		return false
+	}
+	if s.URLPattern != "" && !MatchURLPattern(s.URLPattern, e.URL) {
+		return false
+	}
+	for _, f := range s.Filters {
+		if !f.Matches(e.Props) {
+			return false
+		}
+	}
+	return true
+}
+
+// funnelPath is the best attempt of one person through the funnel
+type funnelPath struct {
+	reached int
+	times   []time.Time
+	entry   TrackedEvent
+}
+
+// ComputeFunnel evaluates a funnel over events grouped by person
+func ComputeFunnel(def FunnelDefinition, events []TrackedEvent) FunnelReport {
+	mode := def.Mode
+	if mode == "" {
+		mode = FunnelOrdered
+	}
+	window, _ := def.Window()
+	nSteps := len(def.Steps)
+
+	byPerson := map[string][]TrackedEvent{}
+	for _, e := range events {
+		byPerson[e.PersonID] = append(byPerson[e.PersonID], e)
+	}
+
+	counts := make([]int, nSteps)
+	gaps := make([][]float64, nSteps)
+	breakdowns := map[string]map[string][]int{"channel": {}, "device": {}}
+
+	for _, evs := range byPerson {
+		sort.SliceStable(evs, func(i, j int) bool { return evs[i].Time.Before(evs[j].Time) })
+
+		var path funnelPath
+		if mode == FunnelAnyOrder {
+			path = bestAnyOrderPath(def.Steps, evs, window)
+		} else {
+			path = bestOrderedPath(def.Steps, evs, window)
+		}
+		if path.reached == 0 {
+			continue
+		}
+
+		for k := 0; k < path.reached; k++ {
+			counts[k]++
+			if k > 0 {
+				gaps[k] = append(gaps[k], absSeconds(path.times[k].Sub(path.times[k-1])))
+			}
+		}
+		addBreakdown(breakdowns["channel"], path.entry.Channel, path.reached, nSteps)
+		addBreakdown(breakdowns["device"], path.entry.Device, path.reached, nSteps)
+	}
+
+	report := FunnelReport{
+		Mode:       mode,
+		Entrants:   counts[0],
+		Steps:      make([]FunnelStepResult, nSteps),
+		Breakdowns: breakdowns,
+	}
+	for k, step := range def.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("Step %d", k+1)
+		}
+		res := FunnelStepResult{Name: name, Count: counts[k]}
+		if counts[0] > 0 {
+			res.ConversionRate = pct(counts[k], counts[0])
+		}
+		if k == 0 {
+			res.StepConversionRate = 100
+			if counts[0] == 0 {
+				res.StepConversionRate = 0
+			}
+		} else {
+			res.DropOff = counts[k-1] - counts[k]
+			res.StepConversionRate = pct(counts[k], counts[k-1])
+			res.MedianSecondsFromPrior = Median(gaps[k])
+		}
+		report.Steps[k] = res
+	}
+	report.Conversions = counts[nSteps-1]
+	report.ConversionRate = report.Steps[nSteps-1].ConversionRate
+
+	return report
+}
+
+// bestOrderedPath tries every occurrence of the first step as an entry point and
+// keeps the attempt that gets furthest (earliest wins ties)
+func bestOrderedPath(steps []FunnelStep, evs []TrackedEvent, window time.Duration) funnelPath {
+	var best funnelPath
+	for i, e := range evs {
+		if !steps[0].Matches(e) {
+			continue
+		}
+		path := funnelPath{reached: 1, times: []time.Time{e.Time}, entry: e}
+		deadline := e.Time.Add(window)
+		for j := i + 1; j < len(evs) && path.reached < len(steps); j++ {
+			if evs[j].Time.After(deadline) {
+				break
+			}
+			if steps[path.reached].Matches(evs[j]) {
+				path.times = append(path.times, evs[j].Time)
+				path.reached++
+			}
+		}
+		if path.reached > best.reached {
+			best = path
+		}
+		if best.reached == len(steps) {
+			break
+		}
+	}
+	return best
+}
+
+// bestAnyOrderPath anchors a window at every matching event and counts how many
+// leading steps were all completed inside it, in any order
+func bestAnyOrderPath(steps []FunnelStep, evs []TrackedEvent, window time.Duration) funnelPath {
+	var best funnelPath
+	for i, anchor := range evs {
+		anchored := false
+		for _, s := range steps {
+			if s.Matches(anchor) {
+				anchored = true
+				break
+			}
+		}
+		if !anchored {
+			continue
+		}
+
+		deadline := anchor.Time.Add(window)
+		first := make([]*TrackedEvent, len(steps))
+		for j := i; j < len(evs) && !evs[j].Time.After(deadline); j++ {
+			for k, s := range steps {
+				if first[k] == nil && s.Matches(evs[j]) {
+					first[k] = &evs[j]
+				}
+			}
+		}
+
+		path := funnelPath{entry: anchor}
+		for k := range steps {
+			if first[k] == nil {
+				break
+			}
+			path.times = append(path.times, first[k].Time)
+			path.reached++
+		}
+		if path.reached > best.reached {
+			best = path
+		}
+		if best.reached == len(steps) {
+			break
+		}
+	}
+	return best
+}
+
+func addBreakdown(m map[string][]int, value string, reached, nSteps int) {
+	if value == "" {
+		value = "(unknown)"
+	}
+	if _, ok := m[value]; !ok {
+		m[value] = make([]int, nSteps)
+	}
+	for k := 0; k < reached; k++ {
+		m[value][k]++
+	}
+}
+
+func pct(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
+
+func absSeconds(d time.Duration) float64 {
+	if d < 0 {
+		d = -d
+	}
+	return d.Seconds()
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeFunnelOrdered(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ev := func(person, typ, url string, offset time.Duration, channel string) TrackedEvent {
+		return TrackedEvent{PersonID: person, Type: typ, URL: url, Time: base.Add(offset), Channel: channel, Props: map[string]interface{}{"revenue": 120.0}}
+	}
+
+	events := []TrackedEvent{
+		// a: completes all three steps
+		ev("a", "pageview", "https://site.com/product/shoes", 0, "Organic Search"),
+		ev("a", "pageview", "https://site.com/cart", time.Minute, "Organic Search"),
+		ev("a", "order_completed", "woocommerce://order/1", 3*time.Minute, "Organic Search"),
+		// b: reaches the cart, never buys
+		ev("b", "pageview", "https://site.com/product/hat", 0, "Direct"),
+		ev("b", "pageview", "https://site.com/cart", 2*time.Minute, "Direct"),
+		// c: buys outside the conversion window
+		ev("c", "pageview", "https://site.com/product/hat", 0, "Direct"),
+		ev("c", "pageview", "https://site.com/cart", time.Minute, "Direct"),
+		ev("c", "order_completed", "woocommerce://order/2", 48*time.Hour, "Direct"),
+		// d: cart before product, so only the any-order funnel counts the cart step
+		ev("d", "pageview", "https://site.com/cart", 0, "Direct"),
+		ev("d", "pageview", "https://site.com/product/hat", time.Minute, "Direct"),
+	}
+
+	def := FunnelDefinition{
+		Steps: []FunnelStep{
+			{Name: "Product", URLPattern: "/product/*"},
+			{Name: "Cart", URLPattern: "/cart"},
+			{Name: "Purchase", EventType: "order_completed", Filters: []PropertyFilter{{Property: "revenue", Operator: "gt", Value: 100}}},
+		},
+		ConversionWindow: "24h",
+	}
+	assert.NoError(t, def.Validate())
+
+	report := ComputeFunnel(def, events)
+	assert.Equal(t, 4, report.Entrants)
+	assert.Equal(t, []int{4, 3, 1}, []int{report.Steps[0].Count, report.Steps[1].Count, report.Steps[2].Count})
+	assert.Equal(t, 2, report.Steps[2].DropOff)
+	assert.Equal(t, 1, report.Steps[1].DropOff)
+	assert.InDelta(t, 60, report.Steps[1].MedianSecondsFromPrior, 0.001)
+	assert.Equal(t, []int{1, 1, 1}, report.Breakdowns["channel"]["Organic Search"])
+
+	def.Mode = FunnelAnyOrder
+	report = ComputeFunnel(def, events)
+	assert.Equal(t, 4, report.Entrants)
+	assert.Equal(t, 4, report.Steps[1].Count)
+}
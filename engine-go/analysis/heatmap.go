@@ -0,0 +1,375 @@
+package analysis
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Heatmap grid: x is relative to viewport width, y is absolute document pixels
+const (
+	HeatmapColumns = 20
+	HeatmapRowPx   = 50
+)
+
+// maxSelectorDepth is how many compounds a normalized selector keeps, counted from the target
+const maxSelectorDepth = 4
+
+// HeatmapClick is one click placed on the page
+type HeatmapClick struct {
+	URL      string
+	Device   string
+	Selector string
+	XRel     float64 // 0-1 of viewport width
+	YPx      float64 // document y
+	OffsetX  float64 // 0-1 within the element box, -1 if unknown
+	OffsetY  float64
+}
+
+// HeatmapScroll is the deepest point one session reached on a page
+type HeatmapScroll struct {
+	URL      string
+	Device   string
+	ReachPct float64 // -1 if only pixels are known
+	ReachPx  int
+}
+
+// GridCell places a click in the heatmap grid
+func GridCell(xRel, yPx float64) (col, row int) {
+	col = int(math.Floor(xRel * HeatmapColumns))
+	if col < 0 {
+		col = 0
+	}
+	if col >= HeatmapColumns {
+		col = HeatmapColumns - 1
+	}
+	row = int(math.Floor(yPx / HeatmapRowPx))
+	if row < 0 {
+		row = 0
+	}
+	return col, row
+}
+
+// DeviceForViewport classifies a viewport width with common CSS breakpoints
+func DeviceForViewport(width int) string {
+	switch {
+	case width <= 0:
+		return "desktop"
+	case width < 768:
+		return "mobile"
+	case width < 1024:
+		return "tablet"
+	default:
+		return "desktop"
+	}
+}
+
+var (
+	selectorPart   = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*)?((?:[#.][^#.\[:]+)*)`)
+	selectorToken  = regexp.MustCompile(`[#.][^#.]+`)
+	digitRun       = regexp.MustCompile(`\d{3,}`)
+	generatedClass = regexp.MustCompile(`^(css|sc|jsx|emotion|svelte)-`)
+	mixedHash      = regexp.MustCompile(`[a-zA-Z][0-9]|[0-9][a-zA-Z]`)
+)
+
+// stateClasses change with interaction and would split one element into several selectors
+var stateClasses = map[string]bool{
+	"active": true, "is-active": true, "current": true, "hover": true, "focus": true, "focused": true,
+	"open": true, "is-open": true, "selected": true, "visible": true, "hidden": true, "show": true,
+	"disabled": true, "loading": true, "is-loading": true,
+}
+
+// stableToken rejects ids/classes that look generated or per-item (post-1234, css-1x9ab2)
+func stableToken(t string) bool {
+	if t == "" || len(t) > 40 || stateClasses[t] {
+		return false
+	}
+	if digitRun.MatchString(t) || generatedClass.MatchString(t) {
+		return false
+	}
+	// Short hashes mix letters and digits throughout
+	return !(len(t) >= 5 && len(mixedHash.FindAllString(t, -1)) >= 2)
+}
+
+// selectorCompound builds "tag#id.class1.class2" from stable parts only
+func selectorCompound(tag, id string, classes []string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(tag))
+	if stableToken(id) {
+		b.WriteString("#" + id)
+		return b.String()
+	}
+	n := 0
+	for _, c := range classes {
+		if n == 2 {
+			break
+		}
+		if stableToken(c) {
+			b.WriteString("." + c)
+			n++
+		}
+	}
+	return b.String()
+}
+
+// NormalizeSelector drops unstable ids, classes, attributes and pseudo-classes from a tracker
+// selector and keeps the compounds closest to the target
+func NormalizeSelector(sel string) string {
+	parts := strings.Split(strings.ReplaceAll(sel, ">", " "), " ")
+	var out []string
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		m := selectorPart.FindStringSubmatch(p)
+		if m == nil || m[0] == "" {
+			continue
+		}
+		tag, id := m[1], ""
+		var classes []string
+		for _, tok := range selectorToken.FindAllString(m[2], -1) {
+			if tok[0] == '#' {
+				id = tok[1:]
+			} else {
+				classes = append(classes, tok[1:])
+			}
+		}
+		if c := selectorCompound(tag, id, classes); c != "" {
+			out = append(out, c)
+		}
+	}
+	if len(out) > maxSelectorDepth {
+		out = out[len(out)-maxSelectorDepth:]
+	}
+	return strings.Join(out, " > ")
+}
+
+// rrweb event and source types used for heatmaps
+const (
+	rrFullSnapshot   = 2
+	rrIncremental    = 3
+	rrMeta           = 4
+	rrSrcMutation    = 0
+	rrSrcMouse       = 2
+	rrSrcScroll      = 3
+	rrSrcViewport    = 4
+	rrMouseClick     = 2
+	rrNodeDocument   = 0
+	rrNodeElement    = 2
+	rrDefaultDocNode = 1
+)
+
+// RRWebEvent is the envelope of one recorded rrweb event
+type RRWebEvent struct {
+	Type      int             `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+type rrNode struct {
+	Type       int                    `json:"type"`
+	ID         int                    `json:"id"`
+	TagName    string                 `json:"tagName"`
+	Attributes map[string]interface{} `json:"attributes"`
+	ChildNodes []rrNode               `json:"childNodes"`
+}
+
+type rrData struct {
+	// Meta
+	Href   string `json:"href"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Full snapshot
+	Node *rrNode `json:"node"`
+	// Incremental
+	Source int     `json:"source"`
+	Kind   int     `json:"type"`
+	ID     int     `json:"id"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Adds   []struct {
+		ParentID int    `json:"parentId"`
+		Node     rrNode `json:"node"`
+	} `json:"adds"`
+}
+
+type replayNode struct {
+	tag      string
+	compound string
+	parent   int
+	anchored bool // has a stable id, so the selector can stop here
+}
+
+// ReplayState follows one recorded session across its chunks
+type ReplayState struct {
+	href    string
+	width   int
+	height  int
+	scrollY float64
+	docID   int
+	nodes   map[int]replayNode
+	reach   map[string]*HeatmapScroll
+	order   []string
+}
+
+func NewReplayState() *ReplayState {
+	return &ReplayState{docID: rrDefaultDocNode, nodes: map[int]replayNode{}, reach: map[string]*HeatmapScroll{}}
+}
+
+func (s *ReplayState) indexNode(n rrNode, parent int) {
+	if n.Type == rrNodeDocument {
+		s.docID = n.ID
+	}
+	if n.Type == rrNodeElement {
+		id, _ := n.Attributes["id"].(string)
+		class, _ := n.Attributes["class"].(string)
+		s.nodes[n.ID] = replayNode{
+			tag:      strings.ToLower(n.TagName),
+			compound: selectorCompound(n.TagName, id, strings.Fields(class)),
+			parent:   parent,
+			anchored: stableToken(id),
+		}
+	}
+	for _, c := range n.ChildNodes {
+		s.indexNode(c, n.ID)
+	}
+}
+
+// selector walks up from a node until a stable id, the body or the depth limit
+func (s *ReplayState) selector(id int) string {
+	var parts []string
+	for len(parts) < maxSelectorDepth {
+		n, ok := s.nodes[id]
+		if !ok || n.tag == "body" || n.tag == "html" {
+			break
+		}
+		parts = append(parts, n.compound)
+		if n.anchored {
+			break
+		}
+		id = n.parent
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, " > ")
+}
+
+func (s *ReplayState) trackReach() {
+	if s.href == "" || s.height == 0 {
+		return
+	}
+	depth := int(s.scrollY) + s.height
+	r := s.reach[s.href]
+	if r == nil {
+		r = &HeatmapScroll{URL: s.href, Device: DeviceForViewport(s.width), ReachPct: -1}
+		s.reach[s.href] = r
+		s.order = append(s.order, s.href)
+	}
+	if depth > r.ReachPx {
+		r.ReachPx = depth
+	}
+}
+
+// Apply replays one chunk of events; clicks are only returned when countClicks is set, so chunks
+// that were aggregated before can still rebuild the node index and scroll position
+func (s *ReplayState) Apply(events []RRWebEvent, countClicks bool) []HeatmapClick {
+	var clicks []HeatmapClick
+	for _, e := range events {
+		if e.Type != rrFullSnapshot && e.Type != rrIncremental && e.Type != rrMeta {
+			continue
+		}
+		var d rrData
+		if json.Unmarshal(e.Data, &d) != nil {
+			continue
+		}
+		switch e.Type {
+		case rrMeta:
+			s.href, s.width, s.height, s.scrollY = d.Href, d.Width, d.Height, 0
+			s.trackReach()
+		case rrFullSnapshot:
+			if d.Node != nil {
+				s.nodes = map[int]replayNode{}
+				s.indexNode(*d.Node, 0)
+			}
+		case rrIncremental:
+			switch d.Source {
+			case rrSrcMutation:
+				for _, a := range d.Adds {
+					s.indexNode(a.Node, a.ParentID)
+				}
+			case rrSrcViewport:
+				s.width, s.height = d.Width, d.Height
+				s.trackReach()
+			case rrSrcScroll:
+				if d.ID == s.docID {
+					s.scrollY = d.Y
+					s.trackReach()
+				}
+			case rrSrcMouse:
+				if d.Kind != rrMouseClick || !countClicks || s.href == "" || s.width == 0 {
+					continue
+				}
+				clicks = append(clicks, HeatmapClick{
+					URL:      s.href,
+					Device:   DeviceForViewport(s.width),
+					Selector: s.selector(d.ID),
+					XRel:     d.X / float64(s.width),
+					YPx:      d.Y + s.scrollY,
+					OffsetX:  -1,
+					OffsetY:  -1,
+				})
+			}
+		}
+	}
+	return clicks
+}
+
+// Scrolls returns the deepest point reached on each page seen so far
+func (s *ReplayState) Scrolls() []HeatmapScroll {
+	out := make([]HeatmapScroll, 0, len(s.order))
+	for _, u := range s.order {
+		out = append(out, *s.reach[u])
+	}
+	return out
+}
+
+// ReachBucket is the share of sessions that saw at least Depth percent of the page
+type ReachBucket struct {
+	Depth    int     `json:"depth"`
+	Sessions int     `json:"sessions"`
+	Pct      float64 `json:"pct"`
+}
+
+// ScrollReach turns per-session depths into a reach curve. Sessions that only have pixel depths
+// (recordings) are scaled against the deepest pixel depth seen, which stands in for page height.
+func ScrollReach(samples []HeatmapScroll) (buckets []ReachBucket, pageHeightPx int) {
+	for _, s := range samples {
+		if s.ReachPx > pageHeightPx {
+			pageHeightPx = s.ReachPx
+		}
+	}
+	depths := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		switch {
+		case s.ReachPct >= 0:
+			depths = append(depths, math.Min(s.ReachPct, 100))
+		case pageHeightPx > 0:
+			depths = append(depths, float64(s.ReachPx)/float64(pageHeightPx)*100)
+		}
+	}
+	sort.Float64s(depths)
+
+	for d := 0; d <= 100; d += 10 {
+		i := sort.SearchFloat64s(depths, float64(d))
+		b := ReachBucket{Depth: d, Sessions: len(depths) - i}
+		if len(depths) > 0 {
+			b.Pct = round1(float64(b.Sessions) / float64(len(depths)) * 100)
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, pageHeightPx
+}
@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeSelector(t *testing.T) {
+	assert.Equal(t, "article.post.type-post > div.entry-content > p > a.button",
+		NormalizeSelector("body.home > main > article#post-1234.post.type-post > div.entry-content > p > a.button.is-active:hover"))
+	assert.Equal(t, "nav#site-nav > ul.menu > li > a",
+		NormalizeSelector("nav#site-nav > ul.menu.css-1x9ab2 > li.menu-item-5521 > a[href]"))
+	assert.Equal(t, "", NormalizeSelector(""))
+}
+
+func rrEvents(t *testing.T, raw string) []RRWebEvent {
+	var events []RRWebEvent
+	require.NoError(t, json.Unmarshal([]byte(raw), &events))
+	return events
+}
+
+func TestReplayStateClicksAndReach(t *testing.T) {
+	s := NewReplayState()
+	first := rrEvents(t, `[
+		{"type":4,"data":{"href":"https://example.com/pricing/","width":1280,"height":800}},
+		{"type":2,"data":{"node":{"type":0,"id":1,"childNodes":[
+			{"type":2,"id":2,"tagName":"html","childNodes":[
+				{"type":2,"id":3,"tagName":"body","attributes":{"class":"page"},"childNodes":[
+					{"type":2,"id":4,"tagName":"section","attributes":{"id":"plans"},"childNodes":[
+						{"type":2,"id":5,"tagName":"a","attributes":{"class":"btn btn-primary active"}}]}]}]}]}}},
+		{"type":3,"data":{"source":3,"id":1,"x":0,"y":1200}},
+		{"type":3,"data":{"source":2,"type":2,"id":5,"x":640,"y":100}}
+	]`)
+
+	// Already aggregated chunks rebuild state without counting clicks
+	assert.Empty(t, s.Apply(first, false))
+
+	second := rrEvents(t, `[
+		{"type":3,"data":{"source":2,"type":2,"id":5,"x":320,"y":50}},
+		{"type":3,"data":{"source":3,"id":1,"x":0,"y":400}}
+	]`)
+	clicks := s.Apply(second, true)
+	require.Len(t, clicks, 1)
+	assert.Equal(t, "section#plans > a.btn.btn-primary", clicks[0].Selector)
+	assert.Equal(t, "desktop", clicks[0].Device)
+	assert.InDelta(t, 0.25, clicks[0].XRel, 1e-9)
+	assert.InDelta(t, 1250, clicks[0].YPx, 1e-9)
+
+	scrolls := s.Scrolls()
+	require.Len(t, scrolls, 1)
+	assert.Equal(t, 2000, scrolls[0].ReachPx)
+	assert.Equal(t, -1.0, scrolls[0].ReachPct)
+}
+
+func TestScrollReach(t *testing.T) {
+	buckets, height := ScrollReach([]HeatmapScroll{
+		{ReachPct: 100},
+		{ReachPct: 45},
+		{ReachPct: -1, ReachPx: 2000},
+		{ReachPct: -1, ReachPx: 1000},
+	})
+	assert.Equal(t, 2000, height)
+	require.Len(t, buckets, 11)
+	assert.Equal(t, ReachBucket{Depth: 0, Sessions: 4, Pct: 100}, buckets[0])
+	assert.Equal(t, ReachBucket{Depth: 50, Sessions: 3, Pct: 75}, buckets[5])
+	assert.Equal(t, ReachBucket{Depth: 100, Sessions: 2, Pct: 50}, buckets[10])
+}
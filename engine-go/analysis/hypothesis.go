@@ -0,0 +1,256 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+)
+
+// ProportionTest is a two-proportion z-test of b against a
+type ProportionTest struct {
+	Difference float64 // pb - pa
+	SE         float64 // unpooled standard error of the difference, for intervals
+	Z          float64 // pooled z statistic
+	PValue     float64 // two-sided
+}
+
+// TwoProportionZTest compares conversion counts xa/na and xb/nb
+func TwoProportionZTest(xa, na, xb, nb int) ProportionTest {
+	if na == 0 || nb == 0 {
+		return ProportionTest{PValue: 1}
+	}
+	pa, pb := float64(xa)/float64(na), float64(xb)/float64(nb)
+	t := ProportionTest{
+		Difference: pb - pa,
+		SE:         math.Sqrt(pa*(1-pa)/float64(na) + pb*(1-pb)/float64(nb)),
+		PValue:     1,
+	}
+	pooled := float64(xa+xb) / float64(na+nb)
+	se0 := math.Sqrt(pooled * (1 - pooled) * (1/float64(na) + 1/float64(nb)))
+	if se0 > 0 {
+		t.Z = t.Difference / se0
+		t.PValue = math.Erfc(math.Abs(t.Z) / math.Sqrt2)
+	}
+	return t
+}
+
+// MeanTest is Welch's unequal-variance t-test of b against a
+type MeanTest struct {
+	Difference float64 // mean b - mean a
+	SE         float64
+	T          float64
+	DF         float64
+	PValue     float64 // two-sided
+}
+
+// WelchTTest compares the means of two samples without assuming equal variances
+func WelchTTest(a, b []float64) MeanTest {
+	t := MeanTest{Difference: Mean(b) - Mean(a), PValue: 1}
+	na, nb := float64(len(a)), float64(len(b))
+	if na < 2 || nb < 2 {
+		return t
+	}
+	va, vb := math.Pow(StdDev(a), 2)/na, math.Pow(StdDev(b), 2)/nb
+	t.SE = math.Sqrt(va + vb)
+	if t.SE == 0 {
+		return t
+	}
+	t.T = t.Difference / t.SE
+	t.DF = (va + vb) * (va + vb) / (va*va/(na-1) + vb*vb/(nb-1))
+	t.PValue = 2 * (1 - studentTCDF(math.Abs(t.T), t.DF))
+	return t
+}
+
+// ChiSquareGoodnessOfFit tests observed counts against expected shares (which need not sum to 1)
+func ChiSquareGoodnessOfFit(observed []int, shares []float64) (chi2, pValue float64) {
+	var total, shareSum float64
+	for i, o := range observed {
+		total += float64(o)
+		shareSum += shares[i]
+	}
+	if total == 0 || shareSum == 0 || len(observed) < 2 {
+		return 0, 1
+	}
+	for i, o := range observed {
+		expected := total * shares[i] / shareSum
+		if expected > 0 {
+			chi2 += (float64(o) - expected) * (float64(o) - expected) / expected
+		}
+	}
+	return chi2, chiSquareSF(chi2, float64(len(observed)-1))
+}
+
+// AlwaysValidPValue is the mixture sequential probability ratio test p-value for an estimated
+// difference with variance v, mixing over effects of scale tau. Unlike a fixed-horizon p-value
+// it stays valid however often the results are looked at, so it can drive stopping decisions.
+func AlwaysValidPValue(diff, v, tau float64) float64 {
+	if v <= 0 || tau <= 0 {
+		return 1
+	}
+	t2 := tau * tau
+	lambda := math.Sqrt(v/(v+t2)) * math.Exp(diff*diff*t2/(2*v*(v+t2)))
+	if lambda <= 1 {
+		return 1
+	}
+	return 1 / lambda
+}
+
+// normalCDF is the standard normal cumulative distribution
+func normalCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// normalQuantile inverts normalCDF
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+// studentTCDF is P(T <= t) for Student's t with df degrees of freedom
+func studentTCDF(t, df float64) float64 {
+	if df <= 0 {
+		return normalCDF(t)
+	}
+	tail := 0.5 * regIncBeta(df/2, 0.5, df/(df+t*t))
+	if t > 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// studentTQuantile inverts studentTCDF by bisection
+func studentTQuantile(p, df float64) float64 {
+	lo, hi := -1e3, 1e3
+	for i := 0; i < 200 && hi-lo > 1e-10; i++ {
+		mid := (lo + hi) / 2
+		if studentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// chiSquareSF is P(X > x) for a chi-square distribution with k degrees of freedom
+func chiSquareSF(x, k float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	return 1 - regGammaP(k/2, x/2)
+}
+
+// regIncBeta is the regularized incomplete beta function I_x(a, b)
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lab, _ := math.Lgamma(a + b)
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction for regIncBeta (modified Lentz)
+func betaContinuedFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	clamp := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	c, d := 1.0, 1/clamp(1-(a+b)*x/(a+1))
+	h := d
+	for m := 1.0; m <= 300; m++ {
+		aa := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 / clamp(1+aa*d)
+		c = clamp(1 + aa/c)
+		h *= d * c
+		aa = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 / clamp(1+aa*d)
+		c = clamp(1 + aa/c)
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < 3e-14 {
+			break
+		}
+	}
+	return h
+}
+
+// regGammaP is the regularized lower incomplete gamma function P(a, x)
+func regGammaP(a, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	lg, _ := math.Lgamma(a)
+	front := math.Exp(-x + a*math.Log(x) - lg)
+	if x < a+1 {
+		// Series expansion
+		sum, del := 1/a, 1/a
+		for ap := a + 1; ap < a+1000; ap++ {
+			del *= x / ap
+			sum += del
+			if math.Abs(del) < math.Abs(sum)*3e-14 {
+				break
+			}
+		}
+		return front * sum
+	}
+	// Continued fraction for Q(a, x)
+	const tiny = 1e-300
+	b := x + 1 - a
+	c, d := 1/tiny, 1/b
+	h := d
+	for i := 1.0; i <= 1000; i++ {
+		an := -i * (i - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < 3e-14 {
+			break
+		}
+	}
+	return 1 - front*h
+}
+
+// sampleGamma draws from Gamma(shape, 1) (Marsaglia and Tsang)
+func sampleGamma(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		return sampleGamma(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		if math.Log(rng.Float64()) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// sampleBeta draws from Beta(a, b)
+func sampleBeta(rng *rand.Rand, a, b float64) float64 {
+	x := sampleGamma(rng, a)
+	return x / (x + sampleGamma(rng, b))
+}
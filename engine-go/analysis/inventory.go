@@ -0,0 +1,243 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Inventory statuses
+const (
+	StockOK       = "ok"
+	StockLow      = "low"
+	StockCritical = "critical"
+	StockOut      = "out_of_stock"
+	StockNoSales  = "no_sales"
+)
+
+// SaleLine is one order line item
+type SaleLine struct {
+	SKU  string
+	Name string
+	Qty  float64
+	Time time.Time
+}
+
+// ProductRevenue splits an order's revenue over its items[] in proportion to price times
+// quantity, so shipping, tax and discounts are shared out, or by quantity when items carry no
+// price. Items are keyed by name, else SKU; orders without items count under their product.
+func ProductRevenue(props map[string]interface{}, revenue float64) map[string]float64 {
+	type line struct {
+		key        string
+		qty, value float64
+	}
+	var lines []line
+	var qtys, values float64
+	items, _ := props["items"].([]interface{})
+	for _, raw := range items {
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		l := line{}
+		l.key, _ = item["name"].(string)
+		if l.key == "" {
+			l.key, _ = item["sku"].(string)
+		}
+		if l.qty, _ = toFloat(item["qty"]); l.qty <= 0 {
+			l.qty = 1
+		}
+		if price, ok := toFloat(item["price"]); ok && price > 0 {
+			l.value = price * l.qty
+		}
+		lines = append(lines, l)
+		qtys += l.qty
+		values += l.value
+	}
+
+	out := map[string]float64{}
+	if len(lines) == 0 {
+		product, _ := props["product"].(string)
+		out[product] = revenue
+		return out
+	}
+	for _, l := range lines {
+		if values > 0 {
+			out[l.key] += revenue * l.value / values
+		} else {
+			out[l.key] += revenue * l.qty / qtys
+		}
+	}
+	return out
+}
+
+// StockSnapshot is a stock level reported by the plugin
+type StockSnapshot struct {
+	SKU   string    `json:"sku"`
+	Name  string    `json:"name,omitempty"`
+	Stock float64   `json:"stock"`
+	Time  time.Time `json:"time"`
+}
+
+// Restock is a step increase in stock between two snapshots
+type Restock struct {
+	Time     time.Time `json:"time"`
+	Quantity float64   `json:"quantity"`
+}
+
+// InventoryOptions tunes the stock-out forecast
+type InventoryOptions struct {
+	Horizon  int // days to look ahead
+	LeadDays int // stock-out inside the reorder lead time is critical
+	LowDays  int // stock-out inside this many days is low
+}
+
+// InventoryForecast is the projected stock-out for one SKU
+type InventoryForecast struct {
+	SKU           string     `json:"sku"`
+	Name          string     `json:"name"`
+	Stock         float64    `json:"stock"`          // estimated stock now
+	SnapshotAt    time.Time  `json:"snapshot_at"`    // last plugin snapshot the estimate starts from
+	SoldSince     float64    `json:"sold_since"`     // units sold since that snapshot
+	DailyVelocity float64    `json:"daily_velocity"` // mean forecast demand per day
+	DaysRemaining *float64   `json:"days_remaining"` // nil when stock outlasts the horizon
+	StockOutAt    *time.Time `json:"stock_out_at"`
+	Earliest      *time.Time `json:"stock_out_earliest"` // 95% upper demand bound
+	Latest        *time.Time `json:"stock_out_latest"`   // 95% lower demand bound; nil beyond horizon
+	Restocks      []Restock  `json:"restocks"`
+	Status        string     `json:"status"`
+}
+
+// DetectRestocks finds step increases between snapshots that sales cannot explain
+func DetectRestocks(snapshots []StockSnapshot, sales []SaleLine) []Restock {
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	restocks := []Restock{}
+	for i := 1; i < len(snapshots); i++ {
+		prev, cur := snapshots[i-1], snapshots[i]
+		expected := prev.Stock - unitsSold(sales, prev.Time, cur.Time)
+		if added := cur.Stock - expected; added > 0.5 && cur.Stock > prev.Stock {
+			restocks = append(restocks, Restock{Time: cur.Time, Quantity: added})
+		}
+	}
+	return restocks
+}
+
+func unitsSold(sales []SaleLine, from, to time.Time) float64 {
+	var n float64
+	for _, s := range sales {
+		if s.Time.After(from) && !s.Time.After(to) {
+			n += s.Qty
+		}
+	}
+	return n
+}
+
+// DailyDemand buckets sales into calendar days from start up to (excluding) end. Days are
+// counted by date in start's location, so windows crossing a DST change keep every day.
+func DailyDemand(sales []SaleLine, start, end time.Time) []float64 {
+	days := calendarDays(start, end.In(start.Location()))
+	if days <= 0 {
+		return nil
+	}
+	demand := make([]float64, days)
+	for _, s := range sales {
+		if s.Time.Before(start) || !s.Time.Before(end) {
+			continue
+		}
+		if i := calendarDays(start, s.Time.In(start.Location())); i >= 0 && i < days {
+			demand[i] += s.Qty
+		}
+	}
+	return demand
+}
+
+// ForecastStockOut projects when a SKU runs out. Demand (not the stock level) is forecast with
+// Holt-Winters on a weekly season, so restocks never bend the model; the current stock is the
+// latest snapshot minus units sold since. Cumulative demand bounds give the stock-out interval.
+func ForecastStockOut(snapshots []StockSnapshot, sales []SaleLine, now time.Time, history int, opts InventoryOptions) InventoryForecast {
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	last := snapshots[len(snapshots)-1]
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	f := InventoryForecast{SKU: last.SKU, Name: last.Name, SnapshotAt: last.Time}
+	f.SoldSince = unitsSold(sales, last.Time, now)
+	f.Stock = math.Max(last.Stock-f.SoldSince, 0)
+	f.Restocks = DetectRestocks(snapshots, sales)
+
+	if f.Stock <= 0 {
+		zero := 0.0
+		f.DaysRemaining = &zero
+		f.StockOutAt = &today
+		f.Earliest, f.Latest = &today, &today
+		f.Status = StockOut
+		return f
+	}
+
+	demand := DailyDemand(sales, today.AddDate(0, 0, -history), today)
+	var total float64
+	for _, d := range demand {
+		total += d
+	}
+	if total == 0 {
+		f.Status = StockNoSales
+		return f
+	}
+
+	fopts := ForecastOptions{Horizon: opts.Horizon, SeasonLength: 7, StepDays: 1, NonNegative: true}
+	var forecast []ForecastPoint
+	if model, err := FitHoltWinters(demand, 7); err == nil {
+		forecast = model.Forecast(today.AddDate(0, 0, -1), fopts)
+	} else {
+		// Too little history for smoothing: flat rate with a Poisson spread
+		rate := total / float64(len(demand))
+		for h := 1; h <= opts.Horizon; h++ {
+			forecast = append(forecast, ForecastPoint{Time: today.AddDate(0, 0, h-1), Value: rate, Std: math.Sqrt(rate)})
+		}
+	}
+
+	// Walk cumulative demand (and its 95% band) until each crosses the stock on hand
+	var cum, variance, velocity float64
+	for i, p := range forecast {
+		prevCum := cum
+		cum += p.Value
+		variance += p.Std * p.Std
+		velocity += p.Value
+		spread := z95 * math.Sqrt(variance)
+
+		day := today.AddDate(0, 0, i)
+		if f.Earliest == nil && cum+spread >= f.Stock {
+			t := day
+			f.Earliest = &t
+		}
+		if f.StockOutAt == nil && cum >= f.Stock {
+			// Interpolate within the day the stock runs out
+			frac := 1.0
+			if p.Value > 0 {
+				frac = (f.Stock - prevCum) / p.Value
+			}
+			days := float64(i) + frac
+			t := today.Add(time.Duration(days * 24 * float64(time.Hour)))
+			f.DaysRemaining = &days
+			f.StockOutAt = &t
+		}
+		if f.Latest == nil && cum-spread >= f.Stock {
+			t := day
+			f.Latest = &t
+		}
+	}
+	if len(forecast) > 0 {
+		f.DailyVelocity = velocity / float64(len(forecast))
+	}
+
+	switch {
+	case f.DaysRemaining == nil:
+		f.Status = StockOK
+	case *f.DaysRemaining <= float64(opts.LeadDays):
+		f.Status = StockCritical
+	case *f.DaysRemaining <= float64(opts.LowDays):
+		f.Status = StockLow
+	default:
+		f.Status = StockOK
+	}
+	return f
+}
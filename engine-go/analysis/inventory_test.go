@@ -0,0 +1,92 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStockOutSurvivesRestock(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return now.AddDate(0, 0, n) }
+
+	// Five units a day for 28 days, restocked by 100 two weeks ago
+	var sales []SaleLine
+	for d := -28; d < 0; d++ {
+		sales = append(sales, SaleLine{SKU: "MUG", Qty: 5, Time: day(d)})
+	}
+	snapshots := []StockSnapshot{
+		{SKU: "MUG", Stock: 100, Time: day(-21).Add(-time.Hour)},
+		{SKU: "MUG", Stock: 165, Time: day(-14).Add(-time.Hour)}, // 100 - 35 sold + 100 restocked
+		{SKU: "MUG", Stock: 70, Time: day(-1).Add(-time.Hour)},
+	}
+
+	restocks := DetectRestocks(snapshots, sales)
+	require.Len(t, restocks, 1)
+	assert.InDelta(t, 100, restocks[0].Quantity, 0.01)
+
+	f := ForecastStockOut(snapshots, sales, now, 28, InventoryOptions{Horizon: 60, LeadDays: 7, LowDays: 14})
+	assert.InDelta(t, 65, f.Stock, 0.01)
+	require.NotNil(t, f.DaysRemaining)
+	assert.InDelta(t, 13, *f.DaysRemaining, 1.5)
+	assert.Equal(t, StockLow, f.Status)
+
+	// The legacy regression only fits the run after the restock
+	history := []DataPoint{
+		{Timestamp: day(-20).Unix(), Inventory: 90},
+		{Timestamp: day(-15).Unix(), Inventory: 65},
+		{Timestamp: day(-14).Unix(), Inventory: 165},
+		{Timestamp: day(-7).Unix(), Inventory: 130},
+		{Timestamp: day(0).Unix(), Inventory: 95},
+	}
+	res := PredictStockOut(history)
+	assert.InDelta(t, 19, res.DaysRemaining, 0.5)
+}
+
+func TestDailyDemandAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	end := time.Date(2026, 4, 1, 0, 0, 0, 0, ny)
+	start := end.AddDate(0, 0, -90) // spans the March spring-forward
+
+	sales := []SaleLine{
+		{Qty: 1, Time: start},
+		{Qty: 2, Time: time.Date(2026, 3, 8, 12, 0, 0, 0, ny)},
+		{Qty: 3, Time: time.Date(2026, 3, 31, 23, 30, 0, 0, ny)},
+	}
+	demand := DailyDemand(sales, start, end)
+	require.Len(t, demand, 90)
+	assert.Equal(t, 1.0, demand[0])
+	assert.Equal(t, 2.0, demand[len(demand)-24])
+	assert.Equal(t, 3.0, demand[89])
+}
+
+func TestProductRevenueSplitsOrderItems(t *testing.T) {
+	items := func(lines ...map[string]interface{}) map[string]interface{} {
+		raw := make([]interface{}, len(lines))
+		for i, l := range lines {
+			raw[i] = l
+		}
+		return map[string]interface{}{"items": raw}
+	}
+
+	// 60 + 2x20 of goods in a 110 order: shipping is shared by value. Prices arrive as strings.
+	split := ProductRevenue(items(
+		map[string]interface{}{"name": "Mug", "sku": "MUG", "qty": 1.0, "price": "60"},
+		map[string]interface{}{"name": "", "sku": "TEA", "qty": 2.0, "price": "20"},
+	), 110)
+	assert.InDelta(t, 66, split["Mug"], 1e-9)
+	assert.InDelta(t, 44, split["TEA"], 1e-9)
+
+	// Without prices, quantities decide
+	split = ProductRevenue(items(
+		map[string]interface{}{"name": "Mug", "qty": 3.0},
+		map[string]interface{}{"name": "Tea"},
+	), 40)
+	assert.Equal(t, map[string]float64{"Mug": 30, "Tea": 10}, split)
+
+	// Older orders name a single product
+	assert.Equal(t, map[string]float64{"Mug": 25}, ProductRevenue(map[string]interface{}{"product": "Mug"}, 25))
+}
@@ -0,0 +1,246 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Path anchor directions
+const (
+	PathFromStart = "start" // explore what happens after the anchor
+	PathFromEnd   = "end"   // explore what led up to the anchor
+)
+
+// OtherLabel is the node that low-volume branches collapse into
+const OtherLabel = "Other"
+
+// PathOptions configures a path exploration
+type PathOptions struct {
+	AnchorURL   string   `json:"anchor_url,omitempty"`   // URL pattern of the anchor page
+	AnchorEvent string   `json:"anchor_event,omitempty"` // or an event type
+	Direction   string   `json:"direction"`              // "start" (default) or "end"
+	Depth       int      `json:"depth"`                  // steps to follow from the anchor
+	MinShare    float64  `json:"min_share"`              // % of sessions at a step below which a branch becomes "Other"
+	MaxBranches int      `json:"max_branches"`           // keep at most N distinct nodes per step
+	Templates   []string `json:"templates,omitempty"`    // URL templates such as "/product/*"
+}
+
+// PathNode is a page (or event) at a given step of the exploration
+type PathNode struct {
+	Name string `json:"name"`
+	Step int    `json:"step"`
+}
+
+// PathLink is the number of sessions moving between two nodes
+type PathLink struct {
+	Source int `json:"source"`
+	Target int `json:"target"`
+	Value  int `json:"value"`
+}
+
+// PathReport keeps the nodes/links shape the dashboard Sankey already consumes
+type PathReport struct {
+	Nodes    []PathNode `json:"nodes"`
+	Links    []PathLink `json:"links"`
+	Sessions int        `json:"sessions"`
+}
+
+// Normalize fills defaults and clamps depth
+func (o *PathOptions) Normalize() error {
+	if o.Direction == "" {
+		o.Direction = PathFromStart
+	}
+	if o.Direction != PathFromStart && o.Direction != PathFromEnd {
+		return fmt.Errorf("direction must be %q or %q", PathFromStart, PathFromEnd)
+	}
+	if o.Depth <= 0 {
+		o.Depth = 3
+	}
+	if o.Depth > 10 {
+		o.Depth = 10
+	}
+	if o.MaxBranches <= 0 {
+		o.MaxBranches = 8
+	}
+	if o.MinShare < 0 || o.MinShare > 100 {
+		return fmt.Errorf("min_share must be between 0 and 100")
+	}
+	return nil
+}
+
+func (o PathOptions) label(e TrackedEvent) string {
+	if e.Type != "pageview" {
+		return "event:" + e.Type
+	}
+	return TemplateURL(e.URL, o.Templates)
+}
+
+func (o PathOptions) isAnchor(e TrackedEvent) bool {
+	switch {
+	case o.AnchorEvent != "":
+		return e.Type == o.AnchorEvent
+	case o.AnchorURL != "":
+		return e.Type == "pageview" && MatchURLPattern(o.AnchorURL, e.URL)
+	}
+	return false
+}
+
+// ExplorePaths follows each session Depth steps away from its anchor (or from its
+// entry page when no anchor is set) and builds a step-indexed Sankey graph
+func ExplorePaths(opts PathOptions, events []TrackedEvent) PathReport {
+	bySession := map[string][]TrackedEvent{}
+	var order []string
+	for _, e := range events {
+		if e.Type != "pageview" && e.Type != opts.AnchorEvent {
+			continue
+		}
+		if _, ok := bySession[e.SessionID]; !ok {
+			order = append(order, e.SessionID)
+		}
+		bySession[e.SessionID] = append(bySession[e.SessionID], e)
+	}
+
+	// Build one label sequence per session, anchor first
+	var paths [][]string
+	for _, sid := range order {
+		evs := bySession[sid]
+		sort.SliceStable(evs, func(i, j int) bool { return evs[i].Time.Before(evs[j].Time) })
+
+		var labels []string
+		anchorIdx := -1
+		for _, e := range evs {
+			l := opts.label(e)
+			// Reloads and repeat events are not a step, but an anchor folded into the previous
+			// step still anchors there
+			if len(labels) == 0 || labels[len(labels)-1] != l {
+				labels = append(labels, l)
+			}
+			if anchorIdx < 0 && opts.isAnchor(e) {
+				anchorIdx = len(labels) - 1
+			}
+		}
+
+		hasAnchor := opts.AnchorURL != "" || opts.AnchorEvent != ""
+		if hasAnchor && anchorIdx < 0 {
+			continue
+		}
+		if opts.AnchorURL != "" && opts.AnchorEvent == "" {
+			labels[anchorIdx] = opts.AnchorURL // every anchor shares one node
+		}
+		if !hasAnchor {
+			anchorIdx = 0
+			if opts.Direction == PathFromEnd {
+				anchorIdx = len(labels) - 1
+			}
+		}
+
+		var path []string
+		if opts.Direction == PathFromEnd {
+			lo := anchorIdx - opts.Depth
+			if lo < 0 {
+				lo = 0
+			}
+			path = append(path, labels[lo:anchorIdx+1]...)
+			// Right-align so the anchor always sits in the last column
+			for len(path) < opts.Depth+1 {
+				path = append([]string{""}, path...)
+			}
+		} else {
+			hi := anchorIdx + opts.Depth + 1
+			if hi > len(labels) {
+				hi = len(labels)
+			}
+			path = append(path, labels[anchorIdx:hi]...)
+		}
+		paths = append(paths, path)
+	}
+
+	collapseBranches(paths, opts)
+
+	report := PathReport{Nodes: []PathNode{}, Links: []PathLink{}, Sessions: len(paths)}
+	nodeIdx := map[PathNode]int{}
+	node := func(n PathNode) int {
+		if idx, ok := nodeIdx[n]; ok {
+			return idx
+		}
+		nodeIdx[n] = len(report.Nodes)
+		report.Nodes = append(report.Nodes, n)
+		return nodeIdx[n]
+	}
+
+	type linkKey struct{ source, target int }
+	linkVals := map[linkKey]int{}
+	var linkOrder []linkKey
+	for _, path := range paths {
+		for i := 0; i+1 < len(path); i++ {
+			if path[i] == "" || path[i+1] == "" {
+				continue
+			}
+			k := linkKey{node(PathNode{Name: path[i], Step: i}), node(PathNode{Name: path[i+1], Step: i + 1})}
+			if _, ok := linkVals[k]; !ok {
+				linkOrder = append(linkOrder, k)
+			}
+			linkVals[k]++
+		}
+	}
+	for _, k := range linkOrder {
+		report.Links = append(report.Links, PathLink{Source: k.source, Target: k.target, Value: linkVals[k]})
+	}
+	sort.SliceStable(report.Links, func(i, j int) bool { return report.Links[i].Value > report.Links[j].Value })
+
+	return report
+}
+
+// collapseBranches rewrites labels that are below MinShare or outside the top
+// MaxBranches of their step into "Other"
+func collapseBranches(paths [][]string, opts PathOptions) {
+	maxLen := 0
+	for _, p := range paths {
+		if len(p) > maxLen {
+			maxLen = len(p)
+		}
+	}
+
+	for step := 0; step < maxLen; step++ {
+		counts := map[string]int{}
+		total := 0
+		for _, p := range paths {
+			if step < len(p) && p[step] != "" {
+				counts[p[step]]++
+				total++
+			}
+		}
+
+		type kv struct {
+			label string
+			n     int
+		}
+		var ranked []kv
+		for l, n := range counts {
+			ranked = append(ranked, kv{l, n})
+		}
+		sort.Slice(ranked, func(i, j int) bool {
+			if ranked[i].n != ranked[j].n {
+				return ranked[i].n > ranked[j].n
+			}
+			return ranked[i].label < ranked[j].label
+		})
+
+		keep := map[string]bool{}
+		for i, r := range ranked {
+			if i >= opts.MaxBranches {
+				break
+			}
+			if total > 0 && float64(r.n)/float64(total)*100 < opts.MinShare {
+				break
+			}
+			keep[r.label] = true
+		}
+
+		for _, p := range paths {
+			if step < len(p) && p[step] != "" && !keep[p[step]] {
+				p[step] = OtherLabel
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionPaths builds pageview events for each session's URLs, a minute apart
+func sessionPaths(paths map[string][]string) []TrackedEvent {
+	t0 := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	var events []TrackedEvent
+	for sid, urls := range paths {
+		for i, u := range urls {
+			typ := "pageview"
+			if len(u) > 0 && u[0] != '/' {
+				typ, u = u, ""
+			}
+			events = append(events, TrackedEvent{SessionID: sid, Type: typ, URL: "https://site.com" + u, Time: t0.Add(time.Duration(i) * time.Minute)})
+		}
+	}
+	return events
+}
+
+// pathLinks flattens a report into "from -> to" = sessions
+func pathLinks(r PathReport) map[string]int {
+	out := map[string]int{}
+	for _, l := range r.Links {
+		s, t := r.Nodes[l.Source], r.Nodes[l.Target]
+		out[s.Name+" -> "+t.Name] += l.Value
+	}
+	return out
+}
+
+func TestExplorePathsFromEntry(t *testing.T) {
+	opts := PathOptions{Depth: 2, MaxBranches: 8}
+	require.NoError(t, opts.Normalize())
+
+	r := ExplorePaths(opts, sessionPaths(map[string][]string{
+		"a": {"/", "/", "/pricing", "/signup"}, // the reload is not a step
+		"b": {"/", "/blog", "/pricing"},
+		"c": {"/blog"},
+	}))
+	assert.Equal(t, 3, r.Sessions)
+	assert.Equal(t, map[string]int{
+		"/ -> /pricing":       1,
+		"/pricing -> /signup": 1,
+		"/ -> /blog":          1,
+		"/blog -> /pricing":   1,
+	}, pathLinks(r))
+}
+
+func TestExplorePathsAnchorFoldedIntoTemplate(t *testing.T) {
+	// Both product pages share the /product/* template, so the second visit folds into the
+	// first step; it is still the anchor
+	opts := PathOptions{AnchorURL: "/product/blue", Depth: 2, MaxBranches: 8, Templates: []string{"/product/*"}}
+	require.NoError(t, opts.Normalize())
+
+	r := ExplorePaths(opts, sessionPaths(map[string][]string{
+		"a": {"/", "/product/red", "/product/blue", "/cart"},
+		"b": {"/product/blue", "/checkout"},
+		"c": {"/", "/about"}, // never reaches the anchor
+	}))
+	assert.Equal(t, 2, r.Sessions)
+	assert.Equal(t, map[string]int{
+		"/product/blue -> /cart":     1,
+		"/product/blue -> /checkout": 1,
+	}, pathLinks(r))
+	for _, n := range r.Nodes {
+		if n.Name == "/product/blue" {
+			assert.Equal(t, 0, n.Step)
+		}
+	}
+}
+
+func TestExplorePathsToAnchorEvent(t *testing.T) {
+	opts := PathOptions{AnchorEvent: "signup", Direction: PathFromEnd, Depth: 2, MaxBranches: 8}
+	require.NoError(t, opts.Normalize())
+
+	r := ExplorePaths(opts, sessionPaths(map[string][]string{
+		"a": {"/", "/pricing", "/pricing", "signup"},
+		"b": {"/pricing", "signup", "signup"},
+	}))
+	assert.Equal(t, 2, r.Sessions)
+	assert.Equal(t, map[string]int{
+		"/ -> /pricing":            1,
+		"/pricing -> event:signup": 2,
+	}, pathLinks(r))
+
+	// The anchor always sits in the last column
+	for _, n := range r.Nodes {
+		if n.Name == "event:signup" {
+			assert.Equal(t, 2, n.Step)
+		}
+	}
+}
+
+func TestExplorePathsCollapsesSmallBranches(t *testing.T) {
+	opts := PathOptions{Depth: 1, MaxBranches: 1}
+	require.NoError(t, opts.Normalize())
+
+	r := ExplorePaths(opts, sessionPaths(map[string][]string{
+		"a": {"/", "/pricing"},
+		"b": {"/", "/pricing"},
+		"c": {"/", "/blog"},
+	}))
+	assert.Equal(t, map[string]int{"/ -> /pricing": 2, "/ -> " + OtherLabel: 1}, pathLinks(r))
+}
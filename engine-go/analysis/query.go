@@ -0,0 +1,320 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Column types returned by the query API
+const (
+	ColumnString   = "string"
+	ColumnDate     = "date"
+	ColumnInteger  = "integer"
+	ColumnPercent  = "percent"
+	ColumnCurrency = "currency"
+)
+
+// Query limits
+const (
+	DefaultQueryLimit    = 100
+	MaxQueryLimit        = 1000
+	maxQueryDimensions   = 3
+	maxQueryFilters      = 20
+	queryDimensionColumn = "dimension"
+	queryMetricColumn    = "metric"
+)
+
+// QueryRequest asks for metrics broken down by dimensions over [From, To). Metrics are computed
+// over tracked events joined to their session and visitor, so session metrics split by url count
+// the sessions that had a hit on that url. Orders count in the buyer's session (BuyerSessionSQL).
+type QueryRequest struct {
+	Metrics    []string      `json:"metrics"`
+	Dimensions []string      `json:"dimensions"`
+	Filters    []QueryFilter `json:"filters"`
+	Sort       []QuerySort   `json:"sort"`
+	Limit      int           `json:"limit"`
+
+	From time.Time `json:"-"`
+	To   time.Time `json:"-"`
+	// Location is the zone the date dimension is reported in (UTC when nil)
+	Location *time.Location `json:"-"`
+	// Scope is an extra predicate over the session row "s" (e.g. a segment), with its arguments
+	Scope     string        `json:"-"`
+	ScopeArgs []interface{} `json:"-"`
+}
+
+// QueryFilter restricts a dimension (string operators) or a metric (numeric operators, applied
+// after aggregation)
+type QueryFilter struct {
+	Field    string      `json:"field"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
+// QuerySort orders the result by a requested dimension or metric
+type QuerySort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// QueryColumn describes one result column
+type QueryColumn struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Kind  string `json:"kind"` // dimension or metric
+	Type  string `json:"type"`
+}
+
+// CompiledQuery is parameterized SQL plus the columns it returns, in order
+type CompiledQuery struct {
+	SQL     string
+	Args    []interface{}
+	Columns []QueryColumn
+}
+
+type queryMetric struct {
+	label string
+	typ   string
+	expr  string
+}
+
+type queryDimension struct {
+	label  string
+	typ    string
+	values []string // allowed filter values, if restricted
+	entry  bool     // reads the session's first event (alias fe)
+	expr   func(c *segmentCompiler, q QueryRequest) string
+}
+
+// queryMetrics are the aggregates available to /v1/query; e is the event, s its session
+var queryMetrics = map[string]queryMetric{
+	"pageviews":       {"Pageviews", ColumnInteger, "SUM(e.event_type = 'pageview')"},
+	"sessions":        {"Sessions", ColumnInteger, "COUNT(DISTINCT e.session_id)"},
+	"visitors":        {"Visitors", ColumnInteger, "COUNT(DISTINCT s.fingerprint)"},
+	"bounce_rate":     {"Bounce rate", ColumnPercent, "ROUND(COUNT(DISTINCT CASE WHEN s.page_count <= 1 THEN e.session_id END) * 100 / NULLIF(COUNT(DISTINCT e.session_id), 0), 1)"},
+	"orders":          {"Orders", ColumnInteger, "SUM(e.event_type = 'order_completed')"},
+	"revenue":         {"Revenue", ColumnCurrency, "ROUND(COALESCE(SUM(CASE WHEN e.event_type = 'order_completed' THEN JSON_EXTRACT(e.payload, '$.revenue') END), 0), 2)"},
+	"conversion_rate": {"Conversion rate", ColumnPercent, "ROUND(COUNT(DISTINCT CASE WHEN e.event_type = 'order_completed' THEN e.session_id END) * 100 / NULLIF(COUNT(DISTINCT e.session_id), 0), 1)"},
+}
+
+var queryDimensions = map[string]queryDimension{
+	"date": {"Date", ColumnDate, nil, false, func(c *segmentCompiler, q QueryRequest) string {
+		return c.localDateExpr("e.created_at", q.From, q.To, q.Location)
+	}},
+	"url": {"URL", ColumnString, nil, false, func(*segmentCompiler, QueryRequest) string {
+		return "COALESCE(e.url, '')"
+	}},
+	"channel": {"Channel", ColumnString, []string{ChannelDirect, ChannelOrganicSearch, ChannelPaidSearch, ChannelSocial, ChannelEmail, ChannelReferral}, true,
+		func(c *segmentCompiler, _ QueryRequest) string {
+			return c.channelExpr(sessionReferrer("s", "fe"), sessionLanding("s", "fe"))
+		}},
+	"country": {"Country", ColumnString, nil, false, func(*segmentCompiler, QueryRequest) string {
+		return "COALESCE(v.country, '')"
+	}},
+	"device": {"Device", ColumnString, []string{"desktop", "tablet", "mobile"}, false,
+		func(c *segmentCompiler, _ QueryRequest) string { return c.deviceExpr("v.user_agent") }},
+	"campaign": {"Campaign", ColumnString, nil, true, campaignExpr},
+}
+
+// campaignExpr mirrors CampaignFromURL on the session's landing page (values stay URL-encoded)
+func campaignExpr(c *segmentCompiler, _ QueryRequest) string {
+	lp := sessionLanding("s", "fe")
+	c.args = append(c.args, "[?&]utm_campaign=[^&#]", "utm_campaign=", "(none)")
+	return "(CASE WHEN " + lp + " REGEXP ? THEN SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(" + lp +
+		", ?, -1), '&', 1), '#', 1) ELSE ? END)"
+}
+
+// localDateExpr formats a UTC timestamp column as a date in loc. MySQL may have no zone tables,
+// so the offsets in force over [from, to) are applied piecewise, split at each DST change.
+func (c *segmentCompiler) localDateExpr(col string, from, to time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	shifted := func(offset int) string {
+		c.args = append(c.args, offset)
+		return "DATE_FORMAT(DATE_ADD(" + col + ", INTERVAL ? SECOND), '%Y-%m-%d')"
+	}
+	var b strings.Builder
+	b.WriteString("(CASE")
+	for t := from.In(loc); ; {
+		_, offset := t.Zone()
+		_, end := t.ZoneBounds()
+		if end.IsZero() || !end.Before(to) {
+			b.WriteString(" ELSE " + shifted(offset) + " END)")
+			return b.String()
+		}
+		c.args = append(c.args, end.UTC())
+		b.WriteString(" WHEN " + col + " < ? THEN " + shifted(offset))
+		t = end
+	}
+}
+
+// QuerySchema lists the metrics and dimensions the query API accepts, sorted by name
+func QuerySchema() []QueryColumn {
+	var cols []QueryColumn
+	for name, d := range queryDimensions {
+		cols = append(cols, QueryColumn{Name: name, Label: d.label, Kind: queryDimensionColumn, Type: d.typ})
+	}
+	for name, m := range queryMetrics {
+		cols = append(cols, QueryColumn{Name: name, Label: m.label, Kind: queryMetricColumn, Type: m.typ})
+	}
+	sort.Slice(cols, func(i, j int) bool {
+		if cols[i].Kind != cols[j].Kind {
+			return cols[i].Kind == queryDimensionColumn
+		}
+		return cols[i].Name < cols[j].Name
+	})
+	return cols
+}
+
+// CompileQuery validates a request against the semantic layer and renders it as one grouped
+// SELECT. Only whitelisted expressions reach the SQL text; every value is a placeholder.
+func CompileQuery(q QueryRequest) (CompiledQuery, error) {
+	var out CompiledQuery
+	if len(q.Metrics) == 0 {
+		return out, fmt.Errorf("at least one metric is required")
+	}
+	if len(q.Dimensions) > maxQueryDimensions {
+		return out, fmt.Errorf("at most %d dimensions", maxQueryDimensions)
+	}
+	if len(q.Filters) > maxQueryFilters {
+		return out, fmt.Errorf("at most %d filters", maxQueryFilters)
+	}
+	if q.From.IsZero() || !q.To.After(q.From) {
+		return out, fmt.Errorf("invalid date range")
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+	if limit > MaxQueryLimit {
+		limit = MaxQueryLimit
+	}
+
+	// Arguments are collected per clause and concatenated in SQL order
+	sel, where, having := &segmentCompiler{}, &segmentCompiler{}, &segmentCompiler{}
+	selected := map[string]bool{}
+	var exprs []string
+	var entry bool
+
+	for _, name := range q.Dimensions {
+		d, ok := queryDimensions[name]
+		if !ok {
+			return out, fmt.Errorf("unknown dimension %q", name)
+		}
+		if selected[name] {
+			return out, fmt.Errorf("%s requested twice", name)
+		}
+		selected[name] = true
+		entry = entry || d.entry
+		exprs = append(exprs, d.expr(sel, q)+" AS `"+name+"`")
+		out.Columns = append(out.Columns, QueryColumn{Name: name, Label: d.label, Kind: queryDimensionColumn, Type: d.typ})
+	}
+	for _, name := range q.Metrics {
+		m, ok := queryMetrics[name]
+		if !ok {
+			return out, fmt.Errorf("unknown metric %q", name)
+		}
+		if selected[name] {
+			return out, fmt.Errorf("%s requested twice", name)
+		}
+		selected[name] = true
+		exprs = append(exprs, m.expr+" AS `"+name+"`")
+		out.Columns = append(out.Columns, QueryColumn{Name: name, Label: m.label, Kind: queryMetricColumn, Type: m.typ})
+	}
+
+	// Events without a session row are dropped; orders without a known buyer still count
+	conds := []string{"(s.session_id IS NOT NULL OR e.event_type = 'order_completed')"}
+	var havings []string
+	for _, f := range q.Filters {
+		node := SegmentNode{Field: f.Field, Operator: f.Operator, Value: f.Value}
+		if d, ok := queryDimensions[f.Field]; ok {
+			entry = entry || d.entry
+			cond, err := where.compare(d.expr(where, q), segmentField{values: d.values}, node)
+			if err != nil {
+				return out, err
+			}
+			conds = append(conds, cond)
+			continue
+		}
+		if _, ok := queryMetrics[f.Field]; ok {
+			// HAVING refers to the output column, so the metric has to be selected
+			if !selected[f.Field] {
+				return out, fmt.Errorf("filter on %s needs it among the metrics", f.Field)
+			}
+			cond, err := having.compare("`"+f.Field+"`", segmentField{numeric: true}, node)
+			if err != nil {
+				return out, err
+			}
+			havings = append(havings, cond)
+			continue
+		}
+		return out, fmt.Errorf("unknown filter field %q", f.Field)
+	}
+	if q.Scope != "" {
+		conds = append(conds, "("+q.Scope+")")
+		where.args = append(where.args, q.ScopeArgs...)
+	}
+
+	order, err := queryOrder(q, selected)
+	if err != nil {
+		return out, err
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT " + strings.Join(exprs, ", "))
+	// Orders posted from the shared webhook session are moved to the buyer's session first, so
+	// they take the buyer's channel, campaign and country and convert the buyer's session
+	b.WriteString(" FROM (SELECT e.id, " + BuyerSessionSQL("e") + " AS session_id, e.event_type, e.url, e.payload, e.created_at" +
+		" FROM wp_apex_events e WHERE e.created_at >= ? AND e.created_at < ?) e")
+	b.WriteString(" LEFT JOIN wp_apex_sessions s ON s.session_id = e.session_id")
+	b.WriteString(" LEFT JOIN wp_apex_visitors v ON v.fingerprint = s.fingerprint")
+	if entry {
+		b.WriteString(sessionEntryJoin("s", "fe"))
+	}
+	b.WriteString(" WHERE " + strings.Join(conds, " AND "))
+	if len(q.Dimensions) > 0 {
+		groups := make([]string, len(q.Dimensions))
+		for i, name := range q.Dimensions {
+			groups[i] = "`" + name + "`"
+		}
+		b.WriteString(" GROUP BY " + strings.Join(groups, ", "))
+	}
+	if len(havings) > 0 {
+		b.WriteString(" HAVING " + strings.Join(havings, " AND "))
+	}
+	if order != "" {
+		b.WriteString(" ORDER BY " + order)
+	}
+	b.WriteString(" LIMIT ?")
+
+	out.SQL = b.String()
+	out.Args = append(append(append(append(sel.args, q.From, q.To), where.args...), having.args...), limit)
+	return out, nil
+}
+
+// queryOrder validates sort fields; by default dated results run chronologically and others
+// by the first metric, largest first
+func queryOrder(q QueryRequest, selected map[string]bool) (string, error) {
+	var parts []string
+	for _, s := range q.Sort {
+		if !selected[s.Field] {
+			return "", fmt.Errorf("cannot sort by %q: not a requested dimension or metric", s.Field)
+		}
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		parts = append(parts, "`"+s.Field+"` "+dir)
+	}
+	if len(parts) == 0 && len(q.Dimensions) > 0 {
+		if selected["date"] {
+			parts = append(parts, "`date` ASC")
+		}
+		parts = append(parts, "`"+q.Metrics[0]+"` DESC")
+	}
+	return strings.Join(parts, ", "), nil
+}
@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileQuery(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 30)
+	q, err := CompileQuery(QueryRequest{
+		Metrics:    []string{"pageviews", "revenue"},
+		Dimensions: []string{"country"},
+		Filters: []QueryFilter{
+			{Field: "campaign", Operator: "eq", Value: "spring_sale"},
+			{Field: "pageviews", Operator: "gte", Value: 10},
+		},
+		From: from, To: to,
+		Scope: "s.fingerprint IN (SELECT ?)", ScopeArgs: []interface{}{"fp"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "SELECT COALESCE(v.country, '') AS `country`, SUM(e.event_type = 'pageview') AS `pageviews`, "+
+		"ROUND(COALESCE(SUM(CASE WHEN e.event_type = 'order_completed' THEN JSON_EXTRACT(e.payload, '$.revenue') END), 0), 2) AS `revenue`"+
+		" FROM (SELECT e.id, "+BuyerSessionSQL("e")+" AS session_id, e.event_type, e.url, e.payload, e.created_at"+
+		" FROM wp_apex_events e WHERE e.created_at >= ? AND e.created_at < ?) e"+
+		" LEFT JOIN wp_apex_sessions s ON s.session_id = e.session_id"+
+		" LEFT JOIN wp_apex_visitors v ON v.fingerprint = s.fingerprint"+
+		" LEFT JOIN wp_apex_events fe ON fe.id = (SELECT MIN(seg_first.id) FROM wp_apex_events seg_first WHERE seg_first.session_id = s.session_id)"+
+		" WHERE (s.session_id IS NOT NULL OR e.event_type = 'order_completed')"+
+		" AND (CASE WHEN COALESCE(NULLIF(s.landing_page, ''), fe.url, '') REGEXP ? THEN SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(COALESCE(NULLIF(s.landing_page, ''), fe.url, ''), ?, -1), '&', 1), '#', 1) ELSE ? END) = ?"+
+		" AND (s.fingerprint IN (SELECT ?))"+
+		" GROUP BY `country` HAVING `pageviews` >= ? ORDER BY `pageviews` DESC LIMIT ?", q.SQL)
+	assert.Equal(t, []interface{}{from, to, "[?&]utm_campaign=[^&#]", "utm_campaign=", "(none)", "spring_sale", "fp", 10.0, DefaultQueryLimit}, q.Args)
+	assert.Equal(t, []string{ColumnString, ColumnInteger, ColumnCurrency}, []string{q.Columns[0].Type, q.Columns[1].Type, q.Columns[2].Type})
+}
+
+func TestCompileQueryArgsFollowPlaceholders(t *testing.T) {
+	from := time.Now().AddDate(0, 0, -7)
+	q, err := CompileQuery(QueryRequest{
+		Metrics:    []string{"sessions", "conversion_rate"},
+		Dimensions: []string{"date", "channel", "device"},
+		Filters:    []QueryFilter{{Field: "device", Operator: "in", Value: []interface{}{"Mobile", "tablet"}}},
+		Limit:      5000,
+		From:       from, To: time.Now(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, len(q.Args), countPlaceholders(q.SQL))
+	assert.Contains(t, q.SQL, "ORDER BY `date` ASC, `sessions` DESC LIMIT ?")
+	assert.Equal(t, MaxQueryLimit, q.Args[len(q.Args)-1])
+	// Restricted values are normalized
+	assert.Contains(t, q.Args, "mobile")
+}
+
+func TestCompileQueryDateInSiteZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// Spans the switch to summer time on 2024-03-31 at 01:00 UTC
+	from := time.Date(2024, 3, 25, 0, 0, 0, 0, berlin)
+	to := from.AddDate(0, 0, 14)
+	q, err := CompileQuery(QueryRequest{Metrics: []string{"pageviews"}, Dimensions: []string{"date"}, From: from, To: to, Location: berlin})
+	require.NoError(t, err)
+
+	assert.Contains(t, q.SQL, "SELECT (CASE WHEN e.created_at < ? THEN DATE_FORMAT(DATE_ADD(e.created_at, INTERVAL ? SECOND), '%Y-%m-%d')"+
+		" ELSE DATE_FORMAT(DATE_ADD(e.created_at, INTERVAL ? SECOND), '%Y-%m-%d') END) AS `date`")
+	assert.Equal(t, []interface{}{time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC), 3600, 7200, from, to}, q.Args[:5])
+	assert.NotContains(t, q.SQL, "wp_apex_events fe")
+}
+
+func TestCompileQueryRejects(t *testing.T) {
+	now := time.Now()
+	base := func() QueryRequest {
+		return QueryRequest{Metrics: []string{"pageviews"}, From: now.AddDate(0, 0, -7), To: now}
+	}
+	cases := map[string]func(q *QueryRequest){
+		"no metrics":        func(q *QueryRequest) { q.Metrics = nil },
+		"unknown metric":    func(q *QueryRequest) { q.Metrics = []string{"pageviews; DROP TABLE x"} },
+		"unknown dimension": func(q *QueryRequest) { q.Dimensions = []string{"ip"} },
+		"duplicate":         func(q *QueryRequest) { q.Dimensions = []string{"url", "url"} },
+		"unselected sort":   func(q *QueryRequest) { q.Sort = []QuerySort{{Field: "revenue"}} },
+		"unselected having": func(q *QueryRequest) { q.Filters = []QueryFilter{{Field: "revenue", Operator: "gt", Value: 1}} },
+		"numeric op on dim": func(q *QueryRequest) { q.Filters = []QueryFilter{{Field: "country", Operator: "gt", Value: "US"}} },
+		"bad channel":       func(q *QueryRequest) { q.Filters = []QueryFilter{{Field: "channel", Operator: "eq", Value: "TV"}} },
+		"empty range":       func(q *QueryRequest) { q.To = q.From },
+	}
+	for name, mutate := range cases {
+		q := base()
+		mutate(&q)
+		_, err := CompileQuery(q)
+		assert.Error(t, err, name)
+	}
+}
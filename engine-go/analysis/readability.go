@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// readingWPM is the average adult silent reading speed used for expected read time
+const readingWPM = 238
+
+// longSentence is the word count above which a sentence counts as long
+const longSentence = 25
+
+var (
+	tagPattern      = regexp.MustCompile(`(?s)<(script|style)[^>]*>.*?</(script|style)>|<[^>]+>|\[/?[a-zA-Z_-]+[^\]]*\]`)
+	sentencePattern = regexp.MustCompile(`[^.!?]+[.!?]*`)
+	wordPattern     = regexp.MustCompile(`[A-Za-z]+(?:['’][A-Za-z]+)*|\d+(?:[.,]\d+)*`)
+)
+
+var beVerbs = map[string]bool{"is": true, "are": true, "was": true, "were": true, "be": true, "been": true, "being": true, "am": true, "get": true, "got": true, "gets": true}
+
+var irregularParticiples = map[string]bool{"done": true, "made": true, "given": true, "taken": true, "seen": true, "known": true, "shown": true, "written": true, "built": true, "found": true, "held": true, "kept": true, "left": true, "led": true, "paid": true, "put": true, "read": true, "said": true, "sent": true, "set": true, "sold": true, "told": true, "thought": true, "brought": true, "bought": true, "caught": true, "taught": true, "won": true, "chosen": true, "driven": true, "eaten": true, "forgotten": true, "hidden": true, "spoken": true, "stolen": true, "broken": true}
+
+// ReadabilityScores are text statistics for one post
+type ReadabilityScores struct {
+	Words              int     `json:"words"`
+	Sentences          int     `json:"sentences"`
+	Syllables          int     `json:"syllables"`
+	FleschReadingEase  float64 `json:"flesch_reading_ease"`
+	FleschKincaidGrade float64 `json:"flesch_kincaid_grade"`
+	AvgSentenceLength  float64 `json:"avg_sentence_length"`
+	LongSentencePct    float64 `json:"long_sentence_pct"`
+	PassiveRatio       float64 `json:"passive_ratio"` // % of sentences with a passive construction
+	ReadTime           float64 `json:"read_time"`     // expected seconds to read
+}
+
+// StripMarkup reduces post HTML (and shortcodes) to plain text
+func StripMarkup(content string) string {
+	text := tagPattern.ReplaceAllString(content, " ")
+	return html.UnescapeString(text)
+}
+
+// ScoreText computes readability statistics for plain text
+func ScoreText(text string) ReadabilityScores {
+	var s ReadabilityScores
+	var long, passive int
+
+	for _, sentence := range sentencePattern.FindAllString(text, -1) {
+		words := wordPattern.FindAllString(sentence, -1)
+		if len(words) == 0 {
+			continue
+		}
+		s.Sentences++
+		s.Words += len(words)
+		for _, w := range words {
+			s.Syllables += CountSyllables(w)
+		}
+		if len(words) > longSentence {
+			long++
+		}
+		if IsPassive(words) {
+			passive++
+		}
+	}
+	if s.Words == 0 {
+		return s
+	}
+
+	wps := float64(s.Words) / float64(s.Sentences)
+	spw := float64(s.Syllables) / float64(s.Words)
+	s.FleschReadingEase = round1(206.835 - 1.015*wps - 84.6*spw)
+	s.FleschKincaidGrade = round1(0.39*wps + 11.8*spw - 15.59)
+	s.AvgSentenceLength = round1(wps)
+	s.LongSentencePct = round1(float64(long) / float64(s.Sentences) * 100)
+	s.PassiveRatio = round1(float64(passive) / float64(s.Sentences) * 100)
+	s.ReadTime = math.Round(float64(s.Words) / readingWPM * 60)
+	return s
+}
+
+// CountSyllables estimates English syllables from vowel groups, dropping a silent final "e"
+func CountSyllables(word string) int {
+	w := strings.ToLower(word)
+	if w == "" || unicode.IsDigit(rune(w[0])) {
+		return 1
+	}
+	count := 0
+	prevVowel := false
+	for _, r := range w {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !prevVowel {
+			count++
+		}
+		prevVowel = vowel
+	}
+	if strings.HasSuffix(w, "e") && !strings.HasSuffix(w, "le") && count > 1 {
+		count--
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+// IsPassive looks for a form of "to be" (or "get") followed, within two words, by a past participle
+func IsPassive(words []string) bool {
+	for i, w := range words {
+		if !beVerbs[strings.ToLower(w)] {
+			continue
+		}
+		for j := i + 1; j < len(words) && j <= i+2; j++ {
+			next := strings.ToLower(words[j])
+			if irregularParticiples[next] || (len(next) > 3 && strings.HasSuffix(next, "ed")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// EngagementDistribution summarises scroll depth and dwell across a post's visits
+type EngagementDistribution struct {
+	Visits       int        `json:"visits"`
+	ScrollBands  [4]float64 `json:"scroll_bands"` // % of visits ending in 0-25, 25-50, 50-75, 75-100
+	MedianScroll float64    `json:"median_scroll"`
+	DwellP25     float64    `json:"dwell_p25"`
+	MedianDwell  float64    `json:"median_dwell"`
+	DwellP75     float64    `json:"dwell_p75"`
+}
+
+// PostReadability joins a post's text scores with how readers behaved on it
+type PostReadability struct {
+	PostID         int                    `json:"post_id"`
+	URL            string                 `json:"url"`
+	Title          string                 `json:"title"`
+	Scores         ReadabilityScores      `json:"scores"`
+	Engagement     EngagementDistribution `json:"engagement"`
+	ReadRatio      float64                `json:"read_ratio"` // median dwell / expected read time
+	EarlyAbandoned bool                   `json:"early_abandoned"`
+}
+
+// ReadabilityOptions selects the thresholds of the readability report
+type ReadabilityOptions struct {
+	MinVisits     int
+	AbandonRatio  float64 // flag when median dwell is below this share of expected read time
+	AbandonScroll float64 // ...and median scroll is below this %
+	AbandonedOnly bool
+	Limit         int
+}
+
+// Validate applies defaults
+func (o *ReadabilityOptions) Validate() error {
+	if o.MinVisits <= 0 {
+		o.MinVisits = 20
+	}
+	if o.AbandonRatio <= 0 || o.AbandonRatio >= 1 {
+		o.AbandonRatio = 0.25
+	}
+	if o.AbandonScroll <= 0 || o.AbandonScroll > 100 {
+		o.AbandonScroll = 50
+	}
+	if o.Limit <= 0 {
+		o.Limit = 50
+	}
+	return nil
+}
+
+// Distribution builds the scroll/dwell summary of a set of visits
+func Distribution(visits []PageVisit) EngagementDistribution {
+	d := EngagementDistribution{Visits: len(visits)}
+	if len(visits) == 0 {
+		return d
+	}
+	scrolls := make([]float64, len(visits))
+	dwells := make([]float64, len(visits))
+	for i, v := range visits {
+		scrolls[i] = v.Scroll
+		dwells[i] = v.Dwell
+		band := int(v.Scroll / 25)
+		if band > 3 {
+			band = 3
+		}
+		if band < 0 {
+			band = 0
+		}
+		d.ScrollBands[band]++
+	}
+	for i := range d.ScrollBands {
+		d.ScrollBands[i] = round1(d.ScrollBands[i] / float64(len(visits)) * 100)
+	}
+	d.MedianScroll = Median(scrolls)
+	d.DwellP25 = Percentile(dwells, 25)
+	d.MedianDwell = Median(dwells)
+	d.DwellP75 = Percentile(dwells, 75)
+	return d
+}
+
+// JoinReadability attaches visit distributions to scored posts (matched by post ID, then URL)
+// and flags early abandonment: readers leaving well before the expected read time without
+// scrolling far
+func JoinReadability(posts []PostReadability, visits []PageVisit, opts ReadabilityOptions) []PostReadability {
+	byPost := map[int]int{}
+	byURL := map[string]int{}
+	for i, p := range posts {
+		if p.PostID > 0 {
+			byPost[p.PostID] = i
+		}
+		byURL[p.URL] = i
+	}
+
+	grouped := make([][]PageVisit, len(posts))
+	for _, v := range visits {
+		i, ok := byPost[v.PostID]
+		if !ok || v.PostID == 0 {
+			if i, ok = byURL[v.URL]; !ok {
+				continue
+			}
+		}
+		grouped[i] = append(grouped[i], v)
+	}
+
+	out := make([]PostReadability, 0, len(posts))
+	for i, p := range posts {
+		p.Engagement = Distribution(grouped[i])
+		if p.Scores.ReadTime > 0 {
+			p.ReadRatio = math.Round(p.Engagement.MedianDwell/p.Scores.ReadTime*100) / 100
+		}
+		p.EarlyAbandoned = p.Engagement.Visits >= opts.MinVisits && p.Scores.ReadTime > 0 &&
+			p.ReadRatio < opts.AbandonRatio && p.Engagement.MedianScroll < opts.AbandonScroll
+		if opts.AbandonedOnly && !p.EarlyAbandoned {
+			continue
+		}
+		out = append(out, p)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].EarlyAbandoned != out[j].EarlyAbandoned {
+			return out[i].EarlyAbandoned
+		}
+		if out[i].ReadRatio != out[j].ReadRatio {
+			return out[i].ReadRatio < out[j].ReadRatio
+		}
+		return out[i].PostID < out[j].PostID
+	})
+	return out
+}
+
+// CalculatePostReadability loads stored post scores and the period's visits and joins them
+func CalculatePostReadability(db *sql.DB, opts ReadabilityOptions, period Period) ([]PostReadability, error) {
+	rows, err := db.Query(`
+		SELECT post_id, url, COALESCE(title, ''), words, sentences, syllables, flesch_reading_ease, flesch_kincaid_grade,
+			avg_sentence_length, long_sentence_pct, passive_ratio, read_time
+		FROM wp_apex_post_readability`)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	var posts []PostReadability
+	for rows.Next() {
+		var p PostReadability
+		s := &p.Scores
+		if err := rows.Scan(&p.PostID, &p.URL, &p.Title, &s.Words, &s.Sentences, &s.Syllables, &s.FleschReadingEase,
+			&s.FleschKincaidGrade, &s.AvgSentenceLength, &s.LongSentencePct, &s.PassiveRatio, &s.ReadTime); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return []PostReadability{}, nil
+	}
+
+	visits, err := LoadPageVisits(db, period.Start, period.End)
+	if err != nil {
+		return nil, err
+	}
+
+	results := JoinReadability(posts, visits, opts)
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,41 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreText(t *testing.T) {
+	text := StripMarkup(`<p>The cat sat on the mat.</p><p>The report was written by the team. It is done.</p>`)
+	s := ScoreText(text)
+
+	assert.Equal(t, 3, s.Sentences)
+	assert.Equal(t, 16, s.Words)
+	assert.InDelta(t, 66.7, s.PassiveRatio, 0.1)
+	assert.Greater(t, s.FleschReadingEase, 80.0)
+	assert.Less(t, s.FleschKincaidGrade, 5.0)
+}
+
+func TestJoinReadabilityFlagsEarlyAbandonment(t *testing.T) {
+	posts := []PostReadability{
+		{PostID: 1, URL: "/long", Scores: ReadabilityScores{Words: 2380, ReadTime: 600}},
+		{PostID: 2, URL: "/short", Scores: ReadabilityScores{Words: 238, ReadTime: 60}},
+	}
+	var visits []PageVisit
+	for i := 0; i < 20; i++ {
+		visits = append(visits, PageVisit{PostID: 1, URL: "/long", Scroll: 20, Dwell: 45})
+		visits = append(visits, PageVisit{URL: "/short", Scroll: 30, Dwell: 45})
+	}
+
+	opts := ReadabilityOptions{}
+	opts.Validate()
+	results := JoinReadability(posts, visits, opts)
+
+	assert.Len(t, results, 2)
+	assert.Equal(t, 1, results[0].PostID)
+	assert.True(t, results[0].EarlyAbandoned)
+	assert.InDelta(t, 0.08, results[0].ReadRatio, 0.001)
+	assert.Equal(t, 20, results[1].Engagement.Visits)
+	assert.False(t, results[1].EarlyAbandoned)
+}
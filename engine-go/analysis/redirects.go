@@ -0,0 +1,177 @@
+package analysis
+
+import (
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	datePathPattern = regexp.MustCompile(`^/(?:\d{4}/)(?:\d{1,2}/)?(?:\d{1,2}/)?`)
+	dateSlugPattern = regexp.MustCompile(`(?:^|-)(?:19|20)\d{2}(?:-\d{1,2}){0,2}(?:-|$)`)
+	slugStopwords   = map[string]bool{"a": true, "an": true, "the": true, "of": true, "and": true, "to": true, "in": true, "for": true, "on": true, "html": true, "php": true}
+)
+
+// RedirectSuggestion is the best known-good target for a broken path
+type RedirectSuggestion struct {
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Confidence   float64  `json:"confidence"` // 0-1
+	Reason       string   `json:"reason"`
+	Alternatives []string `json:"alternatives,omitempty"`
+}
+
+// RedirectPath reduces a URL to its path without trailing slash, lowercased
+func RedirectPath(raw string) string {
+	p := raw
+	if u, err := url.Parse(raw); err == nil {
+		p = u.Path
+	}
+	p = strings.ToLower(strings.TrimRight(p, "/"))
+	if p == "" {
+		return "/"
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// PathSlug is the last segment of a path with any extension removed
+func PathSlug(path string) string {
+	path = strings.TrimRight(path, "/")
+	slug := path[strings.LastIndex(path, "/")+1:]
+	if i := strings.LastIndex(slug, "."); i > 0 {
+		slug = slug[:i]
+	}
+	return slug
+}
+
+// StripDates removes /YYYY/MM/DD/ permalink prefixes and years or dates inside a slug
+func StripDates(path string) string {
+	path = datePathPattern.ReplaceAllString(path, "/")
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = strings.Trim(dateSlugPattern.ReplaceAllString(s, "-"), "-")
+	}
+	return strings.Join(segments, "/")
+}
+
+// slugTokens splits a slug into meaningful lowercase words
+func slugTokens(slug string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, t := range strings.FieldsFunc(slug, func(r rune) bool { return r == '-' || r == '_' || r == '+' || r == ' ' }) {
+		if t != "" && !slugStopwords[t] {
+			tokens[StemToken(t)] = true
+		}
+	}
+	return tokens
+}
+
+// tokenOverlap is the Jaccard similarity of two token sets
+func tokenOverlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for t := range a {
+		if b[t] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// slugSimilarity is 1 - edit distance / longer length
+func slugSimilarity(a, b string) float64 {
+	longer := len([]rune(a))
+	if n := len([]rune(b)); n > longer {
+		longer = n
+	}
+	if longer == 0 {
+		return 0
+	}
+	return 1 - float64(EditDistance(a, b))/float64(longer)
+}
+
+// ScoreRedirect rates how likely target is the intended page for a broken path, with the reason
+// for the score. Identical slugs once dates are stripped score highest; otherwise slug edit
+// similarity and token overlap are blended, with a small bonus for a shared parent section.
+func ScoreRedirect(brokenPath, targetPath string) (float64, string) {
+	from, to := StripDates(RedirectPath(brokenPath)), StripDates(RedirectPath(targetPath))
+	fromSlug, toSlug := PathSlug(from), PathSlug(to)
+	if fromSlug == "" || toSlug == "" {
+		return 0, ""
+	}
+	if fromSlug == toSlug {
+		if from == to {
+			return 0.98, "same path without dates"
+		}
+		return 0.9, "same slug"
+	}
+
+	sim := slugSimilarity(fromSlug, toSlug)
+	overlap := tokenOverlap(slugTokens(fromSlug), slugTokens(toSlug))
+	score := 0.55*sim + 0.45*overlap
+	reason := "slug similarity"
+	if overlap > sim {
+		reason = "token overlap"
+	}
+	if parentPath(from) != "" && parentPath(from) == parentPath(to) {
+		score += 0.05
+	}
+	if score > 0.89 {
+		score = 0.89
+	}
+	return score, reason
+}
+
+func parentPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// SuggestRedirect picks the best-scoring known-good URL for a broken path. Nothing is
+// suggested below minConfidence; up to three runners-up are listed as alternatives.
+func SuggestRedirect(brokenPath string, candidates []string, minConfidence float64) *RedirectSuggestion {
+	type scored struct {
+		url    string
+		score  float64
+		reason string
+	}
+	from := RedirectPath(brokenPath)
+	var ranked []scored
+	for _, c := range candidates {
+		if RedirectPath(c) == from {
+			continue
+		}
+		s, reason := ScoreRedirect(from, c)
+		if s >= minConfidence {
+			ranked = append(ranked, scored{c, s, reason})
+		}
+	}
+	if len(ranked) == 0 {
+		return nil
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].url < ranked[j].url
+	})
+
+	best := ranked[0]
+	s := &RedirectSuggestion{From: from, To: best.url, Confidence: math.Round(best.score*100) / 100, Reason: best.reason}
+	for _, r := range ranked[1:] {
+		if len(s.Alternatives) == 3 {
+			break
+		}
+		s.Alternatives = append(s.Alternatives, r.url)
+	}
+	return s
+}
@@ -0,0 +1,29 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestRedirect(t *testing.T) {
+	candidates := []string{
+		"/blog/best-running-shoes",
+		"/blog/running-tips",
+		"/shop/trail-shoes",
+		"https://example.com/guides/seo-checklist/",
+	}
+
+	s := SuggestRedirect("https://example.com/2021/04/best-running-shoes-2021/", candidates, 0.5)
+	require.NotNil(t, s)
+	assert.Equal(t, "/blog/best-running-shoes", s.To)
+	assert.Equal(t, "same slug", s.Reason)
+	assert.InDelta(t, 0.9, s.Confidence, 0.001)
+
+	s = SuggestRedirect("/guides/seo-check-list", candidates, 0.5)
+	require.NotNil(t, s)
+	assert.Equal(t, "https://example.com/guides/seo-checklist/", s.To)
+
+	assert.Nil(t, SuggestRedirect("/contact-us", candidates, 0.5))
+}
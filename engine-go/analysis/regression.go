@@ -1,6 +1,7 @@
 package analysis
 
 import (
+	"sort"
 	"time"
 )
 
@@ -19,8 +20,10 @@ type PredictionResult struct {
 	Confidence      float64   // R-squared value
 }
 
-// PredictStockOut performs a simple linear regression
+// PredictStockOut performs a simple linear regression over the depletion run since the
+// last restock, so a step increase in stock does not flatten the slope
 func PredictStockOut(history []DataPoint) PredictionResult {
+	history = sinceLastRestock(history)
 	if len(history) < 2 {
 		return PredictionResult{}
 	}
@@ -71,7 +74,9 @@ func PredictStockOut(history []DataPoint) PredictionResult {
 	secondsUntilZero := -intercept / slope
 	zeroTime := time.Unix(startTime+int64(secondsUntilZero), 0)
 
-	daysRemaining := secondsUntilZero / (24 * 3600)
+	// Days left are counted from the latest observation, not the start of the run
+	lastTime := history[len(history)-1].Timestamp
+	daysRemaining := (secondsUntilZero - float64(lastTime-startTime)) / (24 * 3600)
 
 	return PredictionResult{
 		Slope:           slope,
@@ -81,3 +86,18 @@ func PredictStockOut(history []DataPoint) PredictionResult {
 		Confidence:      rSquared,
 	}
 }
+
+// sinceLastRestock drops every point before the last increase in inventory
+func sinceLastRestock(history []DataPoint) []DataPoint {
+	sorted := make([]DataPoint, len(history))
+	copy(sorted, history)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	start := 0
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Inventory > sorted[i-1].Inventory {
+			start = i
+		}
+	}
+	return sorted[start:]
+}
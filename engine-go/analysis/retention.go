@@ -0,0 +1,202 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Retention granularities and modes
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+
+	RetentionExact   = "exact"   // returned during period N
+	RetentionRolling = "rolling" // returned during period N or any later period
+)
+
+// RetentionOptions controls how cohorts are bucketed and measured
+type RetentionOptions struct {
+	Granularity string `json:"granularity"`
+	Mode        string `json:"mode"`
+	Periods     int    `json:"periods"` // number of periods after period 0 to report
+}
+
+// CohortMember is one person's entry into a cohort
+type CohortMember struct {
+	PersonID string
+	Entry    time.Time
+	Cohort   string // dimension value; empty means "bucket by entry date"
+}
+
+// RetentionPeriod is the share of a cohort active in one period
+type RetentionPeriod struct {
+	Period   int      `json:"period"`
+	Eligible int      `json:"eligible"` // members whose period N has started
+	Users    int      `json:"users"`
+	Rate     *float64 `json:"rate"` // nil while no member has reached this period
+}
+
+// CohortRow is one cohort's retention curve
+type CohortRow struct {
+	Cohort  string            `json:"cohort"`
+	Start   time.Time         `json:"start"`
+	Users   int               `json:"users"`
+	Periods []RetentionPeriod `json:"periods"`
+}
+
+// Validate fills defaults and rejects unknown values
+func (o *RetentionOptions) Validate() error {
+	switch o.Granularity {
+	case "":
+		o.Granularity = GranularityDay
+	case GranularityDay, GranularityWeek, GranularityMonth:
+	default:
+		return fmt.Errorf("granularity must be day, week or month")
+	}
+	switch o.Mode {
+	case "":
+		o.Mode = RetentionExact
+	case RetentionExact, RetentionRolling:
+	default:
+		return fmt.Errorf("mode must be exact or rolling")
+	}
+	if o.Periods <= 0 {
+		o.Periods = map[string]int{GranularityDay: 30, GranularityWeek: 12, GranularityMonth: 6}[o.Granularity]
+	}
+	if o.Periods > 366 {
+		o.Periods = 366
+	}
+	return nil
+}
+
+// BucketStart truncates t to the start of its day, ISO week (Monday) or month
+func BucketStart(t time.Time, granularity string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch granularity {
+	case GranularityWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+	return day
+}
+
+// periodIndex is the number of whole periods between the entry and an activity
+func periodIndex(entry, activity time.Time, granularity string) int {
+	switch granularity {
+	case GranularityMonth:
+		return (activity.Year()-entry.Year())*12 + int(activity.Month()) - int(entry.Month())
+	case GranularityWeek:
+		return calendarDays(entry, activity) / 7
+	}
+	return calendarDays(entry, activity)
+}
+
+func calendarDays(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 12, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 12, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+func periodStart(entry time.Time, n int, granularity string) time.Time {
+	switch granularity {
+	case GranularityMonth:
+		return BucketStart(entry, GranularityMonth).AddDate(0, n, 0)
+	case GranularityWeek:
+		return BucketStart(entry, GranularityDay).AddDate(0, 0, 7*n)
+	}
+	return BucketStart(entry, GranularityDay).AddDate(0, 0, n)
+}
+
+// ComputeRetention measures, for every cohort, the share of members active in each period
+// after their own entry. Activity before a member's entry is ignored.
+func ComputeRetention(members []CohortMember, activity map[string][]time.Time, opts RetentionOptions, now time.Time) []CohortRow {
+	type cohortAcc struct {
+		row      CohortRow
+		eligible []int
+		returned []int
+	}
+	cohorts := map[string]*cohortAcc{}
+
+	for _, m := range members {
+		key := m.Cohort
+		start := BucketStart(m.Entry, opts.Granularity)
+		if key == "" {
+			key = start.Format("2006-01-02")
+			if opts.Granularity == GranularityMonth {
+				key = start.Format("2006-01")
+			}
+		}
+		acc, ok := cohorts[key]
+		if !ok {
+			acc = &cohortAcc{
+				row:      CohortRow{Cohort: key, Start: start},
+				eligible: make([]int, opts.Periods+1),
+				returned: make([]int, opts.Periods+1),
+			}
+			cohorts[key] = acc
+		}
+		if start.Before(acc.row.Start) {
+			acc.row.Start = start
+		}
+		acc.row.Users++
+
+		active := make([]bool, opts.Periods+1)
+		active[0] = true
+		maxActive := 0
+		for _, t := range activity[m.PersonID] {
+			if t.Before(m.Entry) {
+				continue
+			}
+			p := periodIndex(m.Entry, t, opts.Granularity)
+			if p >= 1 && p <= opts.Periods {
+				active[p] = true
+			}
+			if p > maxActive {
+				maxActive = p
+			}
+		}
+
+		for p := 0; p <= opts.Periods; p++ {
+			if periodStart(m.Entry, p, opts.Granularity).After(now) {
+				break
+			}
+			acc.eligible[p]++
+			hit := active[p]
+			if opts.Mode == RetentionRolling {
+				hit = maxActive >= p
+			}
+			if hit {
+				acc.returned[p]++
+			}
+		}
+	}
+
+	rows := make([]CohortRow, 0, len(cohorts))
+	for _, acc := range cohorts {
+		for p := 0; p <= opts.Periods; p++ {
+			rp := RetentionPeriod{Period: p, Eligible: acc.eligible[p], Users: acc.returned[p]}
+			if acc.eligible[p] > 0 {
+				rate := float64(acc.returned[p]) / float64(acc.eligible[p]) * 100
+				rp.Rate = &rate
+			}
+			acc.row.Periods = append(acc.row.Periods, rp)
+		}
+		rows = append(rows, acc.row)
+	}
+
+	byDimension := len(members) > 0 && members[0].Cohort != ""
+	sort.Slice(rows, func(i, j int) bool {
+		if byDimension && rows[i].Users != rows[j].Users {
+			return rows[i].Users > rows[j].Users
+		}
+		if !rows[i].Start.Equal(rows[j].Start) {
+			return rows[i].Start.After(rows[j].Start)
+		}
+		return rows[i].Users > rows[j].Users
+	})
+	return rows
+}
@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func retentionRates(row CohortRow) []interface{} {
+	out := make([]interface{}, len(row.Periods))
+	for i, p := range row.Periods {
+		if p.Rate != nil {
+			out[i] = *p.Rate
+		}
+	}
+	return out
+}
+
+func TestRetentionDayBoundaries(t *testing.T) {
+	at := func(day, hour, min int) time.Time { return time.Date(2024, 3, day, hour, min, 0, 0, time.UTC) }
+	members := []CohortMember{
+		{PersonID: "a", Entry: at(10, 23, 30)},
+		{PersonID: "b", Entry: at(10, 8, 0)},
+	}
+	activity := map[string][]time.Time{
+		// Before entry is ignored; 40 minutes later is already day 1 because days are calendar days
+		"a": {at(10, 20, 0), at(11, 0, 10), at(17, 9, 0)},
+		// Almost 48 hours later is still day 2
+		"b": {at(12, 7, 59)},
+	}
+
+	exact := RetentionOptions{Granularity: GranularityDay, Mode: RetentionExact, Periods: 7}
+	rows := ComputeRetention(members, activity, exact, at(20, 0, 0))
+	require.Len(t, rows, 1)
+	assert.Equal(t, "2024-03-10", rows[0].Cohort)
+	assert.Equal(t, 2, rows[0].Users)
+	assert.Equal(t, []interface{}{100.0, 50.0, 50.0, 0.0, 0.0, 0.0, 0.0, 50.0}, retentionRates(rows[0]))
+
+	rolling := RetentionOptions{Granularity: GranularityDay, Mode: RetentionRolling, Periods: 7}
+	rows = ComputeRetention(members, activity, rolling, at(20, 0, 0))
+	assert.Equal(t, []interface{}{100.0, 100.0, 100.0, 50.0, 50.0, 50.0, 50.0, 50.0}, retentionRates(rows[0]))
+
+	// Day 2 has not started yet, so it has no eligible members and no rate
+	rows = ComputeRetention(members, activity, exact, at(11, 12, 0))
+	assert.Equal(t, 2, rows[0].Periods[1].Eligible)
+	assert.Equal(t, 0, rows[0].Periods[2].Eligible)
+	assert.Nil(t, rows[0].Periods[2].Rate)
+}
+
+func TestRetentionDayAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	at := func(day, hour int) time.Time { return time.Date(2024, 3, day, hour, 30, 0, 0, ny) }
+
+	// Clocks spring forward on March 10th, so that day is 23 hours long
+	members := []CohortMember{{PersonID: "a", Entry: at(9, 22)}, {PersonID: "b", Entry: at(9, 22)}}
+	activity := map[string][]time.Time{"a": {at(10, 23)}, "b": {at(11, 0)}}
+
+	rows := ComputeRetention(members, activity, RetentionOptions{Granularity: GranularityDay, Mode: RetentionExact, Periods: 2}, at(20, 0))
+	require.Len(t, rows, 1)
+	assert.Equal(t, 1, rows[0].Periods[1].Users)
+	assert.Equal(t, 1, rows[0].Periods[2].Users)
+}
+
+func TestRetentionWeekAndMonthBoundaries(t *testing.T) {
+	// Weeks count from the entry day, so six days later is still week 0
+	wed := time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC)
+	members := []CohortMember{{PersonID: "a", Entry: wed}, {PersonID: "b", Entry: wed}}
+	activity := map[string][]time.Time{
+		"a": {wed.AddDate(0, 0, 6).Add(13 * time.Hour)},
+		"b": {wed.AddDate(0, 0, 7).Add(-9 * time.Hour)},
+	}
+	rows := ComputeRetention(members, activity, RetentionOptions{Granularity: GranularityWeek, Mode: RetentionExact, Periods: 2}, wed.AddDate(0, 1, 0))
+	require.Len(t, rows, 1)
+	assert.Equal(t, "2024-03-11", rows[0].Cohort) // the ISO week's Monday
+	assert.Equal(t, []interface{}{100.0, 50.0, 0.0}, retentionRates(rows[0]))
+
+	// Months are calendar months, so January 31st to February 1st is month 1
+	jan := time.Date(2024, 1, 31, 22, 0, 0, 0, time.UTC)
+	members = []CohortMember{{PersonID: "a", Entry: jan}}
+	activity = map[string][]time.Time{"a": {time.Date(2024, 2, 1, 1, 0, 0, 0, time.UTC)}}
+	rows = ComputeRetention(members, activity, RetentionOptions{Granularity: GranularityMonth, Mode: RetentionExact, Periods: 1}, jan.AddDate(0, 2, 0))
+	require.Len(t, rows, 1)
+	assert.Equal(t, "2024-01", rows[0].Cohort)
+	assert.Equal(t, []interface{}{100.0, 100.0}, retentionRates(rows[0]))
+}
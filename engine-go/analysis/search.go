@@ -0,0 +1,394 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// refinementWindow is how soon a follow-up search must come to count as a refinement
+const refinementWindow = 10 * time.Minute
+
+var searchStopwords = map[string]bool{"a": true, "an": true, "the": true, "of": true, "for": true, "to": true, "in": true, "on": true, "and": true, "with": true, "how": true, "what": true, "is": true}
+
+// SearchEvent is one internal site search
+type SearchEvent struct {
+	SessionID string // empty when the search was not tracked in a session
+	Query     string
+	Results   int
+	Time      time.Time
+}
+
+// SessionEvent is any later tracked event in a searching session
+type SessionEvent struct {
+	SessionID string
+	Type      string
+	Time      time.Time
+}
+
+// QueryCluster is a group of searches that normalize to the same (or a typo-close) key
+type QueryCluster struct {
+	Key            string   `json:"key"`
+	Label          string   `json:"label"` // most frequent raw query
+	Variants       []string `json:"variants"`
+	Searches       int      `json:"searches"`
+	AvgResults     float64  `json:"avg_results"`
+	ZeroResults    int      `json:"zero_results"`
+	Exits          int      `json:"exits"`
+	ExitRate       float64  `json:"exit_rate"`
+	Conversions    int      `json:"conversions"`
+	ConversionRate float64  `json:"conversion_rate"`
+	GapScore       float64  `json:"gap_score,omitempty"`
+}
+
+// RefinementChain is a sequence of clusters searched back-to-back in one session
+type RefinementChain struct {
+	Chain []string `json:"chain"`
+	Count int      `json:"count"`
+}
+
+// SearchInsights summarises site search behaviour over a range
+type SearchInsights struct {
+	Searches       int               `json:"searches"`
+	Sessions       int               `json:"sessions"`
+	ExitRate       float64           `json:"exit_rate"`       // % of searches in a session with nothing after them
+	ConversionRate float64           `json:"conversion_rate"` // % of searching sessions that converted after searching
+	Clusters       []QueryCluster    `json:"clusters"`
+	Refinements    []RefinementChain `json:"refinements"`
+	ContentGaps    []QueryCluster    `json:"content_gaps"`
+}
+
+// NormalizeQuery lowercases, strips punctuation and stopwords, stems each token and sorts the
+// tokens so word order does not matter
+func NormalizeQuery(q string) string {
+	fields := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if searchStopwords[f] && len(fields) > 1 {
+			continue
+		}
+		tokens = append(tokens, StemToken(f))
+	}
+	sort.Strings(tokens)
+	return strings.Join(tokens, " ")
+}
+
+// StemToken strips common English inflections (a light Porter step 1)
+func StemToken(t string) string {
+	switch {
+	case len(t) <= 3:
+		return t
+	case strings.HasSuffix(t, "ies") && len(t) > 4:
+		return t[:len(t)-3] + "y"
+	case strings.HasSuffix(t, "sses"):
+		return t[:len(t)-2]
+	case strings.HasSuffix(t, "ing") && len(t) > 5:
+		return t[:len(t)-3]
+	case strings.HasSuffix(t, "ed") && len(t) > 4:
+		return t[:len(t)-2]
+	case strings.HasSuffix(t, "es") && (strings.HasSuffix(t, "shes") || strings.HasSuffix(t, "ches") || strings.HasSuffix(t, "xes")):
+		return t[:len(t)-2]
+	case strings.HasSuffix(t, "s") && !strings.HasSuffix(t, "ss") && !strings.HasSuffix(t, "us"):
+		return t[:len(t)-1]
+	}
+	return t
+}
+
+// EditDistance is the optimal string alignment (Damerau-Levenshtein) distance between a and b
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// typoTolerance is how many edits two normalized keys may differ by and still be folded
+func typoTolerance(key string) int {
+	switch n := len([]rune(key)); {
+	case n < 5:
+		return 0
+	case n < 9:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// FoldTypos maps each normalized key to a canonical key. Keys are visited most-searched first;
+// a key within typo tolerance of an earlier canonical key is folded into it.
+func FoldTypos(counts map[string]int) map[string]string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	canonical := map[string]string{}
+	var roots []string
+	for _, k := range keys {
+		tol := typoTolerance(k)
+		folded := false
+		for _, r := range roots {
+			if tol > 0 && abs(len(r)-len(k)) <= tol && EditDistance(r, k) <= tol {
+				canonical[k] = r
+				folded = true
+				break
+			}
+		}
+		if !folded {
+			canonical[k] = k
+			roots = append(roots, k)
+		}
+	}
+	return canonical
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// AnalyzeSearches clusters searches and links them to what the session did afterwards. A
+// search is an exit when the session has no later event; it converts when a conversion event
+// follows it in the same session. Searches without a session count towards volume and results
+// but not exit, conversion or session metrics. Queries that normalize to nothing (only
+// stopwords or punctuation) are left out entirely.
+func AnalyzeSearches(searches []SearchEvent, events []SessionEvent, conversionTypes []string) SearchInsights {
+	isConversion := map[string]bool{}
+	for _, t := range conversionTypes {
+		isConversion[t] = true
+	}
+
+	lastEvent := map[string]time.Time{}
+	lastConversion := map[string]time.Time{}
+	for _, e := range events {
+		if e.Time.After(lastEvent[e.SessionID]) {
+			lastEvent[e.SessionID] = e.Time
+		}
+		if isConversion[e.Type] && e.Time.After(lastConversion[e.SessionID]) {
+			lastConversion[e.SessionID] = e.Time
+		}
+	}
+
+	sort.SliceStable(searches, func(i, j int) bool { return searches[i].Time.Before(searches[j].Time) })
+
+	kept := make([]SearchEvent, 0, len(searches))
+	var normalized []string
+	for _, s := range searches {
+		if key := NormalizeQuery(s.Query); key != "" {
+			kept = append(kept, s)
+			normalized = append(normalized, key)
+		}
+	}
+	searches = kept
+
+	keyCounts := map[string]int{}
+	finalSearch := map[string]int{}
+	for i, s := range searches {
+		keyCounts[normalized[i]]++
+		if s.SessionID != "" {
+			finalSearch[s.SessionID] = i
+		}
+	}
+	canonical := FoldTypos(keyCounts)
+
+	type acc struct {
+		cluster  QueryCluster
+		results  int
+		tracked  int // searches in a session
+		raw      map[string]int
+		sessions map[string]bool
+	}
+	clusters := map[string]*acc{}
+	lastSearch := map[string]SearchEvent{}
+	converted := map[string]bool{}
+	ins := SearchInsights{Searches: len(searches)}
+	tracked, totalExits := 0, 0
+
+	for i, s := range searches {
+		key := canonical[normalized[i]]
+		a := clusters[key]
+		if a == nil {
+			a = &acc{cluster: QueryCluster{Key: key}, raw: map[string]int{}, sessions: map[string]bool{}}
+			clusters[key] = a
+		}
+		a.cluster.Searches++
+		a.results += s.Results
+		if s.Results == 0 {
+			a.cluster.ZeroResults++
+		}
+		a.raw[strings.TrimSpace(strings.ToLower(s.Query))]++
+		if s.SessionID == "" {
+			continue
+		}
+		a.tracked++
+		tracked++
+
+		if finalSearch[s.SessionID] == i && !lastEvent[s.SessionID].After(s.Time) {
+			a.cluster.Exits++
+			totalExits++
+		}
+		if conv, ok := lastConversion[s.SessionID]; ok && conv.After(s.Time) && !a.sessions[s.SessionID] {
+			a.sessions[s.SessionID] = true
+			a.cluster.Conversions++
+			converted[s.SessionID] = true
+		}
+		lastSearch[s.SessionID] = s
+	}
+	ins.Sessions = len(lastSearch)
+	if tracked > 0 {
+		ins.ExitRate = round1(float64(totalExits) / float64(tracked) * 100)
+	}
+	if ins.Sessions > 0 {
+		ins.ConversionRate = round1(float64(len(converted)) / float64(ins.Sessions) * 100)
+	}
+
+	ins.Clusters = make([]QueryCluster, 0, len(clusters))
+	for _, a := range clusters {
+		c := a.cluster
+		c.AvgResults = round1(float64(a.results) / float64(c.Searches))
+		if a.tracked > 0 {
+			c.ExitRate = round1(float64(c.Exits) / float64(a.tracked) * 100)
+			c.ConversionRate = round1(float64(c.Conversions) / float64(a.tracked) * 100)
+		}
+		for raw := range a.raw {
+			c.Variants = append(c.Variants, raw)
+		}
+		sort.Slice(c.Variants, func(i, j int) bool {
+			if a.raw[c.Variants[i]] != a.raw[c.Variants[j]] {
+				return a.raw[c.Variants[i]] > a.raw[c.Variants[j]]
+			}
+			return c.Variants[i] < c.Variants[j]
+		})
+		c.Label = c.Variants[0]
+		ins.Clusters = append(ins.Clusters, c)
+	}
+	sort.Slice(ins.Clusters, func(i, j int) bool {
+		if ins.Clusters[i].Searches != ins.Clusters[j].Searches {
+			return ins.Clusters[i].Searches > ins.Clusters[j].Searches
+		}
+		return ins.Clusters[i].Key < ins.Clusters[j].Key
+	})
+
+	labels := map[string]string{}
+	for _, c := range ins.Clusters {
+		labels[c.Key] = c.Label
+	}
+	ins.Refinements = refinementChains(searches, normalized, canonical, labels)
+	ins.ContentGaps = contentGaps(ins.Clusters)
+	return ins
+}
+
+// refinementChains links each session's consecutive searches (within refinementWindow, into a
+// different cluster) and counts identical chains
+func refinementChains(searches []SearchEvent, normalized []string, canonical, labels map[string]string) []RefinementChain {
+	type step struct {
+		key  string
+		time time.Time
+	}
+	bySession := map[string][]step{}
+	var order []string
+	for i, s := range searches {
+		if s.SessionID == "" {
+			continue
+		}
+		if _, ok := bySession[s.SessionID]; !ok {
+			order = append(order, s.SessionID)
+		}
+		bySession[s.SessionID] = append(bySession[s.SessionID], step{key: canonical[normalized[i]], time: s.Time})
+	}
+
+	counts := map[string]int{}
+	chains := map[string][]string{}
+	flush := func(chain []string) {
+		if len(chain) < 2 {
+			return
+		}
+		id := strings.Join(chain, "\x00")
+		counts[id]++
+		chains[id] = chain
+	}
+	for _, sid := range order {
+		steps := bySession[sid]
+		var chain []string
+		for i, st := range steps {
+			if i > 0 && st.time.Sub(steps[i-1].time) > refinementWindow {
+				flush(chain)
+				chain = nil
+			}
+			label := labels[st.key]
+			if len(chain) > 0 && chain[len(chain)-1] == label {
+				continue
+			}
+			chain = append(chain, label)
+		}
+		flush(chain)
+	}
+
+	out := make([]RefinementChain, 0, len(counts))
+	for id, n := range counts {
+		out = append(out, RefinementChain{Chain: chains[id], Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return strings.Join(out[i].Chain, " ") < strings.Join(out[j].Chain, " ")
+	})
+	return out
+}
+
+// contentGaps ranks clusters with zero-result searches by zero-result volume, weighted up by
+// how often those searches end the visit
+func contentGaps(clusters []QueryCluster) []QueryCluster {
+	gaps := []QueryCluster{}
+	for _, c := range clusters {
+		if c.ZeroResults == 0 {
+			continue
+		}
+		c.GapScore = round1(float64(c.ZeroResults) * (1 + c.ExitRate/100))
+		gaps = append(gaps, c)
+	}
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].GapScore != gaps[j].GapScore {
+			return gaps[i].GapScore > gaps[j].GapScore
+		}
+		return gaps[i].Key < gaps[j].Key
+	})
+	return gaps
+}
@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	assert.Equal(t, NormalizeQuery("Red Shoes"), NormalizeQuery("shoe red!"))
+	assert.Equal(t, "guide return", NormalizeQuery("The returns guide"))
+	assert.Equal(t, 1, EditDistance("shipping", "shpiping"))
+}
+
+func TestAnalyzeSearches(t *testing.T) {
+	t0 := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return t0.Add(time.Duration(min) * time.Minute) }
+
+	searches := []SearchEvent{
+		{SessionID: "a", Query: "shipping costs", Results: 0, Time: at(0)},
+		{SessionID: "a", Query: "delivery price", Results: 3, Time: at(1)},
+		{SessionID: "b", Query: "Shiping cost", Results: 0, Time: at(0)},
+		{SessionID: "c", Query: "shipping costs", Results: 0, Time: at(0)},
+	}
+	events := []SessionEvent{
+		{SessionID: "a", Type: "pageview", Time: at(2)},
+		{SessionID: "a", Type: "order_completed", Time: at(5)},
+		{SessionID: "c", Type: "pageview", Time: at(1)},
+	}
+
+	ins := AnalyzeSearches(searches, events, []string{"order_completed"})
+	require.Len(t, ins.Clusters, 2)
+
+	shipping := ins.Clusters[0]
+	assert.Equal(t, "shipping costs", shipping.Label)
+	assert.Equal(t, 3, shipping.Searches)
+	assert.Len(t, shipping.Variants, 2)
+	assert.Equal(t, 1, shipping.Exits) // only b left right after searching
+	assert.Equal(t, 1, shipping.Conversions)
+
+	assert.InDelta(t, 25, ins.ExitRate, 0.01)
+	assert.InDelta(t, 33.3, ins.ConversionRate, 0.1)
+
+	require.Len(t, ins.Refinements, 1)
+	assert.Equal(t, []string{"shipping costs", "delivery price"}, ins.Refinements[0].Chain)
+
+	require.Len(t, ins.ContentGaps, 1)
+	assert.Equal(t, 3, ins.ContentGaps[0].ZeroResults)
+}
+
+func TestAnalyzeSearchesSessionlessAndEmptyQueries(t *testing.T) {
+	t0 := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	searches := []SearchEvent{
+		{SessionID: "a", Query: "shipping costs", Results: 2, Time: t0},
+		{SessionID: "e", Query: "shipping costs", Results: 2, Time: t0},
+		{Query: "shipping costs", Results: 0, Time: t0},
+		{Query: "Shipping cost", Results: 0, Time: t0.Add(time.Minute)},
+		{SessionID: "d", Query: "of the", Results: 9, Time: t0}, // only stopwords
+		{Query: "?!", Results: 0, Time: t0},
+	}
+	events := []SessionEvent{{SessionID: "a", Type: "pageview", Time: t0.Add(time.Minute)}}
+
+	ins := AnalyzeSearches(searches, events, []string{"order_completed"})
+	assert.Equal(t, 4, ins.Searches)
+	assert.Equal(t, 2, ins.Sessions)
+	assert.InDelta(t, 50, ins.ExitRate, 0.01) // e exited; sessionless searches are not exits
+
+	require.Len(t, ins.Clusters, 1)
+	shipping := ins.Clusters[0]
+	assert.Equal(t, 4, shipping.Searches)
+	assert.Equal(t, 2, shipping.ZeroResults)
+	assert.Equal(t, 1, shipping.Exits)
+	assert.InDelta(t, 50, shipping.ExitRate, 0.01)
+	assert.Empty(t, ins.Refinements)
+}
@@ -0,0 +1,419 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Segment criteria limits, so a stored definition cannot produce an unbounded query
+const (
+	maxSegmentDepth      = 6
+	maxSegmentConditions = 40
+	maxSegmentInValues   = 100
+	maxSegmentString     = 255
+)
+
+// SegmentNode is one node of a segment definition: either a group (and/or/not) or a condition.
+//
+//	{"and": [
+//	  {"field": "country", "operator": "in", "value": ["US", "CA"]},
+//	  {"or": [
+//	    {"field": "channel", "operator": "eq", "value": "Paid Search"},
+//	    {"field": "visited_url", "operator": "contains", "value": "/pricing", "within_days": 30}
+//	  ]},
+//	  {"not": {"field": "event", "event": "signup", "operator": "gte", "value": 1}},
+//	  {"field": "revenue", "operator": "gt", "value": 100}
+//	]}
+type SegmentNode struct {
+	And []SegmentNode `json:"and,omitempty"`
+	Or  []SegmentNode `json:"or,omitempty"`
+	Not *SegmentNode  `json:"not,omitempty"`
+
+	Field      string      `json:"field,omitempty"`
+	Operator   string      `json:"operator,omitempty"`
+	Value      interface{} `json:"value,omitempty"`
+	Event      string      `json:"event,omitempty"`       // event type, for field "event"
+	WithinDays int         `json:"within_days,omitempty"` // session and event conditions only
+}
+
+// ParseSegment accepts a definition as a JSON object or as a JSON string holding one
+func ParseSegment(raw []byte) (SegmentNode, error) {
+	var node SegmentNode
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		raw = []byte(s)
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return node, fmt.Errorf("criteria must be a JSON segment definition: %w", err)
+	}
+	return node, nil
+}
+
+type segmentFieldKind int
+
+const (
+	segVisitor   segmentFieldKind = iota // column of the visitor row
+	segSession                           // any session of the visitor matches
+	segPageview                          // any pageview of the visitor matches
+	segAggregate                         // numeric aggregate over the visitor's history
+	segCustomer                          // column of the customer model row linked to the visitor
+)
+
+type segmentField struct {
+	kind    segmentFieldKind
+	numeric bool
+	values  []string // allowed values, if restricted
+}
+
+var segmentFields = map[string]segmentField{
+	"country":      {kind: segVisitor},
+	"city":         {kind: segVisitor},
+	"company":      {kind: segVisitor},
+	"device":       {kind: segVisitor, values: []string{"desktop", "tablet", "mobile"}},
+	"lead_score":   {kind: segVisitor, numeric: true},
+	"channel":      {kind: segSession, values: []string{ChannelDirect, ChannelOrganicSearch, ChannelPaidSearch, ChannelSocial, ChannelEmail, ChannelReferral}},
+	"landing_page": {kind: segSession},
+	"referrer":     {kind: segSession},
+	"visited_url":  {kind: segPageview},
+	"sessions":     {kind: segAggregate, numeric: true},
+	"event":        {kind: segAggregate, numeric: true},
+	"orders":       {kind: segAggregate, numeric: true},
+	"revenue":      {kind: segAggregate, numeric: true},
+	// Customer model (RFM and predicted lifetime value), rebuilt from order_completed events
+	"rfm_segment":       {kind: segCustomer, values: RFMSegments},
+	"r_score":           {kind: segCustomer, numeric: true},
+	"f_score":           {kind: segCustomer, numeric: true},
+	"m_score":           {kind: segCustomer, numeric: true},
+	"predicted_value":   {kind: segCustomer, numeric: true},
+	"alive_probability": {kind: segCustomer, numeric: true},
+}
+
+var stringOperators = map[string]string{"eq": "=", "neq": "<>", "in": "IN", "not_in": "NOT IN", "contains": "LIKE", "not_contains": "NOT LIKE", "starts_with": "LIKE"}
+var numberOperators = map[string]string{"eq": "=", "neq": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+// segmentCompiler accumulates SQL and arguments; every value goes through a placeholder
+type segmentCompiler struct {
+	args       []interface{}
+	conditions int
+}
+
+// CompileSegment turns a definition into a parameterized predicate over a visitor row aliased
+// "v" (wp_apex_visitors). Subqueries use seg_ aliases so the predicate can sit inside other queries.
+func CompileSegment(node SegmentNode) (string, []interface{}, error) {
+	c := &segmentCompiler{}
+	sql, err := c.node(node, 1)
+	if err != nil {
+		return "", nil, err
+	}
+	return sql, c.args, nil
+}
+
+func (c *segmentCompiler) node(n SegmentNode, depth int) (string, error) {
+	if depth > maxSegmentDepth {
+		return "", fmt.Errorf("segment nesting deeper than %d levels", maxSegmentDepth)
+	}
+	groups := 0
+	for _, set := range []bool{len(n.And) > 0, len(n.Or) > 0, n.Not != nil, n.Field != ""} {
+		if set {
+			groups++
+		}
+	}
+	if groups != 1 {
+		return "", fmt.Errorf("each segment node needs exactly one of and, or, not or field")
+	}
+
+	switch {
+	case n.Not != nil:
+		inner, err := c.node(*n.Not, depth+1)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + inner + ")", nil
+	case len(n.And) > 0 || len(n.Or) > 0:
+		children, joiner := n.And, " AND "
+		if len(n.Or) > 0 {
+			children, joiner = n.Or, " OR "
+		}
+		parts := make([]string, 0, len(children))
+		for _, child := range children {
+			p, err := c.node(child, depth+1)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, p)
+		}
+		return "(" + strings.Join(parts, joiner) + ")", nil
+	}
+	return c.condition(n)
+}
+
+func (c *segmentCompiler) condition(n SegmentNode) (string, error) {
+	c.conditions++
+	if c.conditions > maxSegmentConditions {
+		return "", fmt.Errorf("segment has more than %d conditions", maxSegmentConditions)
+	}
+	f, ok := segmentFields[n.Field]
+	if !ok {
+		return "", fmt.Errorf("unknown segment field %q", n.Field)
+	}
+	if n.WithinDays < 0 || n.WithinDays > 3650 {
+		return "", fmt.Errorf("within_days must be between 0 and 3650")
+	}
+	if n.WithinDays > 0 && (f.kind == segVisitor || f.kind == segCustomer) {
+		return "", fmt.Errorf("within_days does not apply to %s", n.Field)
+	}
+	if n.Field == "event" && (n.Event == "" || len(n.Event) > 50) {
+		return "", fmt.Errorf("event conditions need an event type")
+	}
+
+	switch f.kind {
+	case segVisitor:
+		return c.compare(visitorColumn(n.Field, c), f, n)
+
+	case segCustomer:
+		cmp, err := c.compare("seg_c."+n.Field, f, n)
+		if err != nil {
+			return "", err
+		}
+		return "EXISTS (SELECT 1 FROM wp_apex_customer_visitors seg_cv JOIN wp_apex_customers seg_c ON seg_c.customer_key = seg_cv.customer_key" +
+			" WHERE seg_cv.fingerprint = v.fingerprint AND " + cmp + ")", nil
+
+	case segSession:
+		// Arguments are collected in SQL order: the time window comes before the compared expression
+		where := "seg_s.fingerprint = v.fingerprint" + c.within("seg_s.started_at", n.WithinDays)
+		referrer, landing := sessionReferrer("seg_s", "seg_fe"), sessionLanding("seg_s", "seg_fe")
+		var expr string
+		switch n.Field {
+		case "channel":
+			expr = c.channelExpr(referrer, landing)
+		case "referrer":
+			expr = referrer
+		default:
+			expr = landing
+		}
+		cmp, err := c.compare(expr, f, n)
+		if err != nil {
+			return "", err
+		}
+		return "EXISTS (SELECT 1 FROM wp_apex_sessions seg_s" + sessionEntryJoin("seg_s", "seg_fe") + " WHERE " + where + " AND " + cmp + ")", nil
+
+	case segPageview:
+		where := "seg_s.fingerprint = v.fingerprint AND seg_e.event_type = 'pageview'" + c.within("seg_e.created_at", n.WithinDays)
+		cmp, err := c.compare("seg_e.url", f, n)
+		if err != nil {
+			return "", err
+		}
+		return "EXISTS (SELECT 1 FROM wp_apex_events seg_e JOIN wp_apex_sessions seg_s ON seg_s.session_id = seg_e.session_id WHERE " +
+			where + " AND " + cmp + ")", nil
+	}
+
+	// Aggregates
+	var sub string
+	switch n.Field {
+	case "sessions":
+		sub = "SELECT COUNT(*) FROM wp_apex_sessions seg_s WHERE seg_s.fingerprint = v.fingerprint" + c.within("seg_s.started_at", n.WithinDays)
+	default:
+		agg, eventType := "COUNT(*)", n.Event
+		switch n.Field {
+		case "orders":
+			eventType = "order_completed"
+		case "revenue":
+			agg, eventType = "COALESCE(SUM(JSON_EXTRACT(seg_e.payload, '$.revenue')), 0)", "order_completed"
+		}
+		if eventType == "order_completed" {
+			// Orders posted from the shared webhook session count for the buyer
+			sub = "SELECT " + agg + " FROM " + BuyerOrdersSQL + " seg_e JOIN wp_apex_sessions seg_s ON seg_s.session_id = seg_e.session_id" +
+				" WHERE seg_s.fingerprint = v.fingerprint" + c.within("seg_e.created_at", n.WithinDays)
+		} else {
+			c.args = append(c.args, eventType)
+			sub = "SELECT " + agg + " FROM wp_apex_events seg_e JOIN wp_apex_sessions seg_s ON seg_s.session_id = seg_e.session_id" +
+				" WHERE seg_s.fingerprint = v.fingerprint AND seg_e.event_type = ?" + c.within("seg_e.created_at", n.WithinDays)
+		}
+	}
+	return c.compare("("+sub+")", f, n)
+}
+
+func visitorColumn(field string, c *segmentCompiler) string {
+	switch field {
+	case "company":
+		return "COALESCE(v.company_name, '')"
+	case "lead_score":
+		return "COALESCE(v.lead_score, 0)"
+	case "device":
+		return c.deviceExpr("v.user_agent")
+	}
+	return "COALESCE(v." + field + ", '')"
+}
+
+func (c *segmentCompiler) within(column string, days int) string {
+	if days <= 0 {
+		return ""
+	}
+	c.args = append(c.args, days)
+	return " AND " + column + " >= DATE_SUB(NOW(), INTERVAL ? DAY)"
+}
+
+// compare renders "expr <op> ?" with the value checked against the field type
+func (c *segmentCompiler) compare(expr string, f segmentField, n SegmentNode) (string, error) {
+	if f.numeric {
+		op, ok := numberOperators[n.Operator]
+		if !ok {
+			return "", fmt.Errorf("operator %q is not valid for %s", n.Operator, n.Field)
+		}
+		v, ok := toFloat(n.Value)
+		if !ok {
+			return "", fmt.Errorf("%s needs a numeric value", n.Field)
+		}
+		c.args = append(c.args, v)
+		return expr + " " + op + " ?", nil
+	}
+
+	op, ok := stringOperators[n.Operator]
+	if !ok {
+		return "", fmt.Errorf("operator %q is not valid for %s", n.Operator, n.Field)
+	}
+	if n.Operator == "in" || n.Operator == "not_in" {
+		list, ok := n.Value.([]interface{})
+		if !ok || len(list) == 0 || len(list) > maxSegmentInValues {
+			return "", fmt.Errorf("%s %s needs a list of 1-%d values", n.Field, n.Operator, maxSegmentInValues)
+		}
+		for _, item := range list {
+			s, err := segmentString(f, n.Field, item)
+			if err != nil {
+				return "", err
+			}
+			c.args = append(c.args, s)
+		}
+		return expr + " " + op + " (?" + strings.Repeat(", ?", len(list)-1) + ")", nil
+	}
+
+	s, err := segmentString(f, n.Field, n.Value)
+	if err != nil {
+		return "", err
+	}
+	switch n.Operator {
+	case "contains", "not_contains":
+		s = "%" + escapeLike(s) + "%"
+	case "starts_with":
+		s = escapeLike(s) + "%"
+	}
+	c.args = append(c.args, s)
+	return expr + " " + op + " ?", nil
+}
+
+func segmentString(f segmentField, field string, v interface{}) (string, error) {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case float64, int, int64, bool:
+		s = fmt.Sprint(x)
+	default:
+		return "", fmt.Errorf("%s needs a text value", field)
+	}
+	if len(s) > maxSegmentString {
+		return "", fmt.Errorf("%s value longer than %d characters", field, maxSegmentString)
+	}
+	if len(f.values) > 0 {
+		for _, allowed := range f.values {
+			if strings.EqualFold(allowed, s) {
+				return allowed, nil
+			}
+		}
+		return "", fmt.Errorf("%s must be one of %s", field, strings.Join(f.values, ", "))
+	}
+	return s, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// deviceExpr mirrors DeviceClass in SQL
+func (c *segmentCompiler) deviceExpr(ua string) string {
+	lower := "LOWER(COALESCE(" + ua + ", ''))"
+	c.args = append(c.args, "%ipad%", "%tablet%", "tablet", "%mobile%", "%iphone%", "%android%", "mobile", "desktop")
+	return "(CASE WHEN " + lower + " LIKE ? OR " + lower + " LIKE ? THEN ?" +
+		" WHEN " + lower + " LIKE ? OR " + lower + " LIKE ? OR " + lower + " LIKE ? THEN ? ELSE ? END)"
+}
+
+// sessionEntryJoin joins a session to its first event. Older session rows never stored their
+// referrer or landing page, so both are read from that event when the session has none.
+func sessionEntryJoin(session, entry string) string {
+	return " LEFT JOIN wp_apex_events " + entry + " ON " + entry + ".id = (SELECT MIN(seg_first.id) FROM wp_apex_events seg_first WHERE seg_first.session_id = " + session + ".session_id)"
+}
+
+// sessionReferrer is the referrer a session arrived with
+func sessionReferrer(session, entry string) string {
+	return "COALESCE(NULLIF(" + session + ".referrer, ''), " + entry + ".referrer, '')"
+}
+
+// sessionLanding is the first URL of a session
+func sessionLanding(session, entry string) string {
+	return "COALESCE(NULLIF(" + session + ".landing_page, ''), " + entry + ".url, '')"
+}
+
+// orderEmailSQL is the normalized billing email of an order event's payload, as the customer
+// model keys it: customer_email from the WooCommerce integration, email from older payloads
+func orderEmailSQL(event string) string {
+	field := func(key string) string {
+		return "NULLIF(TRIM(JSON_UNQUOTE(JSON_EXTRACT(" + event + ".payload, '$." + key + "'))), '')"
+	}
+	return "LOWER(COALESCE(" + field("customer_email") + ", " + field("email") + ", ''))"
+}
+
+// BuyerSessionSQL is the session an event counts for. Orders posted from a shared system
+// session (system_*, such as the WooCommerce webhook) belong to the buyer instead: the latest
+// session, started by the time of the order, of a visitor linked to the billing email in
+// wp_apex_customer_visitors, or NULL when there is none. resolveBuyers does the same in Go.
+func BuyerSessionSQL(event string) string {
+	return "(CASE WHEN " + event + ".event_type = 'order_completed' AND " + event + ".session_id LIKE 'system\\_%' THEN" +
+		" (SELECT buy_s.session_id FROM wp_apex_customer_visitors buy_cv JOIN wp_apex_sessions buy_s ON buy_s.fingerprint = buy_cv.fingerprint" +
+		" WHERE buy_cv.customer_key = " + orderEmailSQL(event) + " AND buy_s.session_id NOT LIKE 'system\\_%'" +
+		" AND buy_s.started_at <= " + event + ".created_at ORDER BY buy_s.started_at DESC LIMIT 1)" +
+		" ELSE " + event + ".session_id END)"
+}
+
+// BuyerOrdersSQL is a derived table of completed orders (created_at, payload) with the buyer's
+// session_id; join it to wp_apex_sessions to key orders by the buyer's visitor
+var BuyerOrdersSQL = "(SELECT bo_e.created_at, bo_e.payload, " + BuyerSessionSQL("bo_e") + " AS session_id" +
+	" FROM wp_apex_events bo_e WHERE bo_e.event_type = 'order_completed')"
+
+// channelExpr mirrors ClassifyChannel in SQL: UTM/click ids on the landing page first, then the referrer host
+func (c *segmentCompiler) channelExpr(referrer, landing string) string {
+	lp := "LOWER(COALESCE(" + landing + ", ''))"
+	ref := "COALESCE(" + referrer + ", '')"
+	host := "LOWER(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(" + ref + ", '://', -1), '/', 1), CHAR(63), 1))" // CHAR(63) is '?', kept out of the placeholders
+
+	var b strings.Builder
+	b.WriteString("(CASE")
+	when := func(cond string, channel string, args ...interface{}) {
+		c.args = append(c.args, args...)
+		c.args = append(c.args, channel)
+		b.WriteString(" WHEN " + cond + " THEN ?")
+	}
+	anyLike := func(expr string, patterns []string) (string, []interface{}) {
+		conds := make([]string, len(patterns))
+		args := make([]interface{}, len(patterns))
+		for i, p := range patterns {
+			conds[i] = expr + " LIKE ?"
+			args[i] = "%" + escapeLike(p) + "%"
+		}
+		return "(" + strings.Join(conds, " OR ") + ")", args
+	}
+
+	when(lp+" LIKE ? OR "+lp+" LIKE ?", ChannelPaidSearch, "%gclid=%", "%msclkid=%")
+	when(lp+" REGEXP ?", ChannelPaidSearch, "utm_medium=(cpc|ppc|paid|paidsearch)(&|#|$)")
+	when(lp+" REGEXP ?", ChannelEmail, "utm_medium=(email|newsletter)(&|#|$)")
+	when(lp+" REGEXP ?", ChannelSocial, "utm_medium=(social|social-network|paid_social)(&|#|$)")
+	when(ref+" = ''", ChannelDirect)
+	cond, args := anyLike(host, searchEngines)
+	when(cond, ChannelOrganicSearch, args...)
+	cond, args = anyLike(host, socialNetworks)
+	when(cond, ChannelSocial, args...)
+	when(host+" LIKE ?", ChannelEmail, "%mail.%")
+	c.args = append(c.args, ChannelReferral)
+	b.WriteString(" ELSE ? END)")
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileSegment(t *testing.T) {
+	node, err := ParseSegment([]byte(`{"and": [
+		{"field": "country", "operator": "in", "value": ["US", "CA"]},
+		{"not": {"field": "event", "event": "signup", "operator": "gte", "value": 1, "within_days": 30}},
+		{"field": "visited_url", "operator": "contains", "value": "50%_off"}
+	]}`))
+	require.NoError(t, err)
+
+	sql, args, err := CompileSegment(node)
+	require.NoError(t, err)
+	assert.Equal(t, "(COALESCE(v.country, '') IN (?, ?)"+
+		" AND NOT ((SELECT COUNT(*) FROM wp_apex_events seg_e JOIN wp_apex_sessions seg_s ON seg_s.session_id = seg_e.session_id"+
+		" WHERE seg_s.fingerprint = v.fingerprint AND seg_e.event_type = ? AND seg_e.created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)) >= ?)"+
+		" AND EXISTS (SELECT 1 FROM wp_apex_events seg_e JOIN wp_apex_sessions seg_s ON seg_s.session_id = seg_e.session_id"+
+		" WHERE seg_s.fingerprint = v.fingerprint AND seg_e.event_type = 'pageview' AND seg_e.url LIKE ?))", sql)
+	assert.Equal(t, []interface{}{"US", "CA", "signup", 30, 1.0, `%50\%\_off%`}, args)
+}
+
+func TestParseSegmentString(t *testing.T) {
+	node, err := ParseSegment([]byte(`"{\"field\": \"lead_score\", \"operator\": \"gt\", \"value\": 50}"`))
+	require.NoError(t, err)
+	assert.Equal(t, "lead_score", node.Field)
+
+	_, err = ParseSegment([]byte(`"not json"`))
+	assert.Error(t, err)
+}
+
+func TestCompileSegmentChannelArgsOrder(t *testing.T) {
+	sql, args, err := CompileSegment(SegmentNode{Field: "channel", Operator: "eq", Value: "paid search", WithinDays: 7})
+	require.NoError(t, err)
+	assert.Equal(t, len(args), countPlaceholders(sql))
+	// Window first, then the CASE arguments, then the normalized compared value
+	assert.Equal(t, 7, args[0])
+	assert.Equal(t, ChannelPaidSearch, args[len(args)-1])
+}
+
+func TestCompileSegmentCustomerFields(t *testing.T) {
+	sql, args, err := CompileSegment(SegmentNode{And: []SegmentNode{
+		{Field: "rfm_segment", Operator: "in", Value: []interface{}{"Champions", "loyal"}},
+		{Field: "predicted_value", Operator: "gte", Value: 200},
+	}})
+	require.NoError(t, err)
+	assert.Contains(t, sql, "wp_apex_customer_visitors seg_cv")
+	assert.Equal(t, []interface{}{RFMChampions, RFMLoyal, 200.0}, args)
+
+	_, _, err = CompileSegment(SegmentNode{Field: "rfm_segment", Operator: "eq", Value: "whales"})
+	assert.Error(t, err)
+	_, _, err = CompileSegment(SegmentNode{Field: "r_score", Operator: "gte", Value: 4, WithinDays: 30})
+	assert.Error(t, err)
+}
+
+func TestCompileSegmentRejects(t *testing.T) {
+	cases := map[string]SegmentNode{
+		"unknown field":  {Field: "password", Operator: "eq", Value: "x"},
+		"bad operator":   {Field: "revenue", Operator: "contains", Value: "1"},
+		"non-numeric":    {Field: "orders", Operator: "gt", Value: "many"},
+		"mixed node":     {Field: "country", Operator: "eq", Value: "US", Or: []SegmentNode{{Field: "city", Operator: "eq", Value: "Paris"}}},
+		"empty node":     {},
+		"no event type":  {Field: "event", Operator: "gte", Value: 1},
+		"restricted":     {Field: "device", Operator: "eq", Value: "smartwatch"},
+		"window visitor": {Field: "country", Operator: "eq", Value: "US", WithinDays: 7},
+		"empty list":     {Field: "country", Operator: "in", Value: []interface{}{}},
+	}
+	for name, node := range cases {
+		_, _, err := CompileSegment(node)
+		assert.Error(t, err, name)
+	}
+
+	deep := SegmentNode{Field: "country", Operator: "eq", Value: "US"}
+	for i := 0; i < maxSegmentDepth; i++ {
+		deep = SegmentNode{Not: &deep}
+	}
+	_, _, err := CompileSegment(deep)
+	assert.Error(t, err)
+}
+
+func countPlaceholders(sql string) int {
+	n := 0
+	for _, r := range sql {
+		if r == '?' {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCompileSegmentSessionSourceFromFirstEvent(t *testing.T) {
+	sql, args, err := CompileSegment(SegmentNode{Field: "landing_page", Operator: "starts_with", Value: "https://site.com/pricing"})
+	require.NoError(t, err)
+	// Sessions without a stored landing page fall back to the URL of their first event
+	assert.Equal(t, "EXISTS (SELECT 1 FROM wp_apex_sessions seg_s"+
+		" LEFT JOIN wp_apex_events seg_fe ON seg_fe.id = (SELECT MIN(seg_first.id) FROM wp_apex_events seg_first WHERE seg_first.session_id = seg_s.session_id)"+
+		" WHERE seg_s.fingerprint = v.fingerprint AND COALESCE(NULLIF(seg_s.landing_page, ''), seg_fe.url, '') LIKE ?)", sql)
+	assert.Equal(t, []interface{}{"https://site.com/pricing%"}, args)
+
+	sql, _, err = CompileSegment(SegmentNode{Field: "channel", Operator: "eq", Value: ChannelSocial})
+	require.NoError(t, err)
+	assert.Contains(t, sql, "COALESCE(NULLIF(seg_s.referrer, ''), seg_fe.referrer, '')")
+	assert.Contains(t, sql, "COALESCE(NULLIF(seg_s.landing_page, ''), seg_fe.url, '')")
+}
+
+func TestCompileSegmentOrdersByBuyer(t *testing.T) {
+	sql, args, err := CompileSegment(SegmentNode{Field: "revenue", Operator: "gt", Value: 100, WithinDays: 30})
+	require.NoError(t, err)
+	assert.Equal(t, "(SELECT COALESCE(SUM(JSON_EXTRACT(seg_e.payload, '$.revenue')), 0) FROM "+BuyerOrdersSQL+
+		" seg_e JOIN wp_apex_sessions seg_s ON seg_s.session_id = seg_e.session_id"+
+		" WHERE seg_s.fingerprint = v.fingerprint AND seg_e.created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)) > ?", sql)
+	assert.Equal(t, []interface{}{30, 100.0}, args)
+
+	// Order events asked for by type take the same path
+	sql, _, err = CompileSegment(SegmentNode{Field: "event", Event: "order_completed", Operator: "gte", Value: 1})
+	require.NoError(t, err)
+	assert.Contains(t, sql, BuyerOrdersSQL)
+}
+
+func TestBuyerSessionSQL(t *testing.T) {
+	sql := BuyerSessionSQL("e")
+	// Only orders from system sessions are moved, to a linked visitor's session started by then
+	assert.Contains(t, sql, "WHEN e.event_type = 'order_completed' AND e.session_id LIKE 'system\\_%'")
+	assert.Contains(t, sql, "JOIN wp_apex_sessions buy_s ON buy_s.fingerprint = buy_cv.fingerprint")
+	assert.Contains(t, sql, "buy_cv.customer_key = LOWER(COALESCE(NULLIF(TRIM(JSON_UNQUOTE(JSON_EXTRACT(e.payload, '$.customer_email'))), ''),")
+	assert.Contains(t, sql, "buy_s.started_at <= e.created_at ORDER BY buy_s.started_at DESC LIMIT 1")
+	assert.True(t, strings.HasSuffix(sql, "ELSE e.session_id END)"))
+	assert.Zero(t, countPlaceholders(sql))
+}
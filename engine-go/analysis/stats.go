@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// Mean returns the arithmetic mean (0 for an empty slice)
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// StdDev returns the sample standard deviation
+func StdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := Mean(values)
+	var ss float64
+	for _, v := range values {
+		ss += (v - m) * (v - m)
+	}
+	return math.Sqrt(ss / float64(len(values)-1))
+}
+
+// Percentile returns the p-th percentile (0-100) using linear interpolation
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	if lo == hi {
+		return sorted[lo]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// Median is the 50th percentile
+func Median(values []float64) float64 {
+	return Percentile(values, 50)
+}
+
+// PoissonRateDecreaseP is the one-sided p-value that the current Poisson rate is lower than the
+// baseline rate. Conditional on the total, current ~ Binomial(current+baseline, p0) under equal
+// rates, where p0 = exposure / (exposure + 1) and exposure is current-window length over
+// baseline-window length.
+func PoissonRateDecreaseP(current, baseline int, exposure float64) float64 {
+	n := current + baseline
+	if n == 0 {
+		return 1
+	}
+	p0 := exposure / (exposure + 1)
+	return binomialCDF(current, n, p0)
+}
+
+// binomialCDF returns P(X <= k) for X ~ Binomial(n, p)
+func binomialCDF(k, n int, p float64) float64 {
+	if k >= n || p <= 0 {
+		return 1
+	}
+	if k < 0 || p >= 1 {
+		return 0
+	}
+	if n > 5000 {
+		// Normal approximation with continuity correction
+		mean := float64(n) * p
+		sd := math.Sqrt(float64(n) * p * (1 - p))
+		return 0.5 * math.Erfc(-(float64(k)+0.5-mean)/(sd*math.Sqrt2))
+	}
+	lnP, lnQ := math.Log(p), math.Log(1-p)
+	lgN, _ := math.Lgamma(float64(n + 1))
+	var sum float64
+	for i := 0; i <= k; i++ {
+		lgI, _ := math.Lgamma(float64(i + 1))
+		lgNI, _ := math.Lgamma(float64(n - i + 1))
+		sum += math.Exp(lgN - lgI - lgNI + float64(i)*lnP + float64(n-i)*lnQ)
+	}
+	return math.Min(sum, 1)
+}
@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoissonRateDecreaseP(t *testing.T) {
+	cases := []struct {
+		name              string
+		current, baseline int
+		exposure          float64
+		want              float64
+	}{
+		// P(X <= 5) for X ~ Binomial(20, 1/2) is 21700 / 2^20
+		{"equal windows", 5, 15, 1, 0.020694732666015625},
+		// A current window half as long expects a third of the views
+		{"shorter current window", 2, 10, 0.5, 0.1811226457875853},
+		{"views went up", 30, 10, 1, 0.9996602258725034},
+		{"no current views", 0, 10, 1, 0.0009765625},
+		{"no baseline views", 7, 0, 1, 1},
+		{"no views at all", 0, 0, 1, 1},
+		{"no current exposure", 0, 5, 0, 1},
+		// Above 5000 views the normal approximation takes over: 3000 of 6000 is even
+		{"normal approximation", 3000, 3000, 1, 0.50515},
+	}
+	for _, c := range cases {
+		assert.InDelta(t, c.want, PoissonRateDecreaseP(c.current, c.baseline, c.exposure), 1e-4, c.name)
+	}
+}
+
+func TestBinomialCDF(t *testing.T) {
+	assert.InDelta(t, 0.028443966820490392, binomialCDF(40, 100, 0.5), 1e-12)
+	assert.Equal(t, 1.0, binomialCDF(10, 10, 0.3))
+	assert.Equal(t, 0.0, binomialCDF(-1, 10, 0.3))
+	assert.Equal(t, 1.0, binomialCDF(0, 10, 0))
+	assert.Equal(t, 0.0, binomialCDF(9, 10, 1))
+}
+
+func TestDecayOptionsValidate(t *testing.T) {
+	opts := DecayOptions{}
+	assert.NoError(t, opts.Validate())
+	assert.Equal(t, DecayOptions{Mode: DecayPeriod, Window: 30, MinViews: 5, Threshold: 15, Alpha: 0.05, Limit: 10}, opts)
+
+	opts = DecayOptions{Mode: DecayYoY, Window: 7, MinViews: 50, Threshold: 30, Alpha: 0.01, Limit: 3}
+	assert.NoError(t, opts.Validate())
+	assert.Equal(t, DecayOptions{Mode: DecayYoY, Window: 7, MinViews: 50, Threshold: 30, Alpha: 0.01, Limit: 3}, opts)
+
+	// Out-of-range alphas fall back to the default rather than failing
+	opts = DecayOptions{Alpha: 1.5}
+	assert.NoError(t, opts.Validate())
+	assert.Equal(t, 0.05, opts.Alpha)
+
+	assert.Error(t, (&DecayOptions{Mode: "weekly"}).Validate())
+	assert.Error(t, (&DecayOptions{Window: 183}).Validate())
+}
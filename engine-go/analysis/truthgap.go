@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Truth-gap breakdown dimensions, named after the stored GA4 columns
+const (
+	GapBySourceMedium = "source_medium"
+	GapByDevice       = "device"
+	GapByLandingPage  = "landing_page"
+)
+
+// Truth-gap labels
+const (
+	GapHealthy   = "Healthy Sync"
+	GapAdBlock   = "Recovered Ad-Block Traffic"
+	GapBot       = "Potential Bot Traffic"
+	GapLowVolume = "Low Volume"
+)
+
+// gapTolerance is the relative difference (%) still considered in sync
+const gapTolerance = 5.0
+
+// TruthGapRow compares Apex and GA4 sessions for one dimension value
+type TruthGapRow struct {
+	Key             string  `json:"key"`
+	ApexSessions    int64   `json:"apex_sessions"`
+	GA4Sessions     int64   `json:"ga4_sessions"`
+	Gap             int64   `json:"gap"`
+	GapPct          float64 `json:"gap_pct"` // relative to GA4
+	Label           string  `json:"label"`
+	ConfidenceScore float64 `json:"confidence"`
+}
+
+// SourceMedium renders a session's origin the way GA4's sessionSourceMedium does:
+// UTM source/medium when tagged, "google / cpc" for click IDs, "<engine> / organic" for
+// search engines, "<host> / referral" otherwise and "(direct) / (none)" without a referrer
+func SourceMedium(referrer, landingURL string) string {
+	if u, err := url.Parse(landingURL); err == nil {
+		q := u.Query()
+		if src := strings.ToLower(q.Get("utm_source")); src != "" {
+			medium := strings.ToLower(q.Get("utm_medium"))
+			if medium == "" {
+				medium = "(not set)"
+			}
+			return src + " / " + medium
+		}
+		if q.Get("gclid") != "" {
+			return "google / cpc"
+		}
+		if q.Get("msclkid") != "" {
+			return "bing / cpc"
+		}
+	}
+
+	host := strings.TrimPrefix(referrerHost(referrer), "www.")
+	if host == "" {
+		return "(direct) / (none)"
+	}
+	for _, s := range searchEngines {
+		if strings.Contains(host, s) {
+			return strings.TrimSuffix(strings.TrimPrefix(s, "search."), ".") + " / organic"
+		}
+	}
+	return host + " / referral"
+}
+
+// LandingPath strips scheme, host, query and fragment so Apex URLs line up with GA4's landingPage
+func LandingPath(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// GapConfidence is the probability that the difference between two session counts is not
+// Poisson noise: 2*Phi(z) - 1 with z = |a - b| / sqrt(a + b). Small volumes score near zero.
+func GapConfidence(apex, ga4 float64) float64 {
+	if apex+ga4 <= 0 {
+		return 0
+	}
+	z := math.Abs(apex-ga4) / math.Sqrt(apex+ga4)
+	return math.Erf(z / math.Sqrt2)
+}
+
+// GapLabel names a gap: within tolerance or below minVolume on both sides is not a finding
+func GapLabel(apex, ga4, minVolume float64) string {
+	if apex < minVolume && ga4 < minVolume {
+		return GapLowVolume
+	}
+	if ga4 > 0 && math.Abs(apex-ga4)/ga4*100 <= gapTolerance {
+		return GapHealthy
+	}
+	if apex > ga4 {
+		return GapAdBlock
+	}
+	if apex < ga4 {
+		return GapBot
+	}
+	return GapHealthy
+}
+
+// CompareTruthGap joins per-key session counts from both sources, ordered by absolute gap
+func CompareTruthGap(apex, ga4 map[string]int64, minVolume float64) []TruthGapRow {
+	keys := map[string]bool{}
+	for k := range apex {
+		keys[k] = true
+	}
+	for k := range ga4 {
+		keys[k] = true
+	}
+
+	rows := make([]TruthGapRow, 0, len(keys))
+	for k := range keys {
+		a, g := apex[k], ga4[k]
+		row := TruthGapRow{
+			Key:             k,
+			ApexSessions:    a,
+			GA4Sessions:     g,
+			Gap:             a - g,
+			Label:           GapLabel(float64(a), float64(g), minVolume),
+			ConfidenceScore: math.Round(GapConfidence(float64(a), float64(g))*1000) / 1000,
+		}
+		if g > 0 {
+			row.GapPct = math.Round(float64(a-g)/float64(g)*1000) / 10
+		}
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		gi, gj := abs64(rows[i].Gap), abs64(rows[j].Gap)
+		if gi != gj {
+			return gi > gj
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceMedium(t *testing.T) {
+	cases := []struct {
+		referrer, landing, want string
+	}{
+		{"", "https://site.com/?utm_source=Newsletter&utm_medium=Email", "newsletter / email"},
+		{"https://www.google.com/", "https://site.com/?utm_source=partner", "partner / (not set)"},
+		{"", "https://site.com/pricing?gclid=abc", "google / cpc"},
+		{"", "https://site.com/?msclkid=abc", "bing / cpc"},
+		{"https://www.google.com/search?q=apex", "https://site.com/", "google / organic"},
+		{"https://search.brave.com/search", "https://site.com/", "brave / organic"},
+		{"https://www.news.ycombinator.com/item?id=1", "https://site.com/", "news.ycombinator.com / referral"},
+		{"", "https://site.com/", "(direct) / (none)"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, SourceMedium(c.referrer, c.landing), c)
+	}
+}
+
+func TestGapLabelAndConfidence(t *testing.T) {
+	assert.Equal(t, GapLowVolume, GapLabel(10, 12, 30))
+	assert.Equal(t, GapHealthy, GapLabel(104, 100, 30))
+	assert.Equal(t, GapAdBlock, GapLabel(150, 100, 30))
+	assert.Equal(t, GapBot, GapLabel(50, 100, 30))
+	assert.Equal(t, GapAdBlock, GapLabel(40, 0, 30))
+
+	assert.Zero(t, GapConfidence(0, 0))
+	assert.Zero(t, GapConfidence(100, 100))
+	assert.InDelta(t, 0.5098, GapConfidence(110, 100), 1e-4)
+	assert.Equal(t, GapConfidence(110, 100), GapConfidence(100, 110))
+	assert.Greater(t, GapConfidence(200, 100), 0.9999)
+}
+
+func TestCompareTruthGap(t *testing.T) {
+	rows := CompareTruthGap(
+		map[string]int64{"google / organic": 100, "(direct) / (none)": 50},
+		map[string]int64{"google / organic": 90, "bing / organic": 30},
+		30)
+	require.Len(t, rows, 3)
+
+	// Largest absolute gap first
+	assert.Equal(t, []string{"(direct) / (none)", "bing / organic", "google / organic"}, []string{rows[0].Key, rows[1].Key, rows[2].Key})
+	assert.Equal(t, TruthGapRow{Key: "(direct) / (none)", ApexSessions: 50, GA4Sessions: 0, Gap: 50, Label: GapAdBlock, ConfidenceScore: 1}, rows[0])
+	assert.Equal(t, int64(-30), rows[1].Gap)
+	assert.Equal(t, GapBot, rows[1].Label)
+	assert.Equal(t, 11.1, rows[2].GapPct)
+	assert.Equal(t, GapAdBlock, rows[2].Label)
+	assert.Equal(t, 0.532, rows[2].ConfidenceScore)
+}
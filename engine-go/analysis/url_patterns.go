@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"net/url"
+	"strings"
+)
+
+// URLPath strips scheme, host, query and fragment, leaving a normalized path
+// ("https://site.com/blog/post/?a=1" -> "/blog/post")
+func URLPath(raw string) string {
+	path := raw
+	if u, err := url.Parse(raw); err == nil {
+		path = u.Path
+	}
+	if path == "" {
+		return "/"
+	}
+	if len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+	}
+	return path
+}
+
+// MatchURLPattern reports whether a URL's path matches a glob pattern.
+// "*" matches a single path segment and "**" matches any remainder,
+// so "/product/*" matches "/product/shoes" but not "/product/shoes/red".
+func MatchURLPattern(pattern, rawURL string) bool {
+	pattern = URLPath(pattern)
+	path := URLPath(rawURL)
+	if pattern == path {
+		return true
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchSegments(pattern, path []string) bool {
+	for i, seg := range pattern {
+		if seg == "**" {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		if !matchSegment(seg, path[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(path)
+}
+
+// matchSegment supports "*" anywhere inside a single segment (e.g. "post-*")
+func matchSegment(pattern, segment string) bool {
+	if pattern == "*" || pattern == segment {
+		return true
+	}
+	if !strings.Contains(pattern, "*") {
+		return false
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(segment, parts[0]) {
+		return false
+	}
+	rest := segment[len(parts[0]):]
+	for _, p := range parts[1 : len(parts)-1] {
+		idx := strings.Index(rest, p)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(p):]
+	}
+	return strings.HasSuffix(rest, parts[len(parts)-1])
+}
+
+// TemplateURL maps a URL onto the first matching template, or its bare path
+func TemplateURL(rawURL string, templates []string) string {
+	for _, t := range templates {
+		if MatchURLPattern(t, rawURL) {
+			return t
+		}
+	}
+	return URLPath(rawURL)
+}
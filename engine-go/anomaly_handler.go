@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AnomalyHandler flags metric buckets that break from their weekly seasonal pattern
+type AnomalyHandler struct {
+	repo *Repository
+	auto *AutomationHandler
+}
+
+func NewAnomalyHandler(repo *Repository, auto *AutomationHandler) *AnomalyHandler {
+	return &AnomalyHandler{repo: repo, auto: auto}
+}
+
+// StoredAnomaly is a detected anomaly with the channels/pages that explain it
+type StoredAnomaly struct {
+	ID          int64                              `json:"id,omitempty"`
+	Metric      string                             `json:"metric"`
+	Granularity string                             `json:"granularity"`
+	BucketStart time.Time                          `json:"bucket_start"`
+	Value       float64                            `json:"value"`
+	Expected    float64                            `json:"expected"`
+	Score       float64                            `json:"score"`
+	Direction   string                             `json:"direction"`
+	Breakdown   map[string][]analysis.Contribution `json:"breakdown"`
+	CreatedAt   string                             `json:"created_at,omitempty"`
+}
+
+// anomalyMinValue keeps tiny counts (3 pageviews instead of 1) from being flagged
+var anomalyMinValue = map[string]float64{
+	"pageviews":            20,
+	"sessions":             10,
+	"404s":                 5,
+	"zero_result_searches": 3,
+}
+
+// anomalyBaselineWeeks is how many weeks of same-slot history a bucket is judged against
+const anomalyBaselineWeeks = 6
+
+func anomalyOptions(granularity string, threshold float64, metric string) analysis.AnomalyOptions {
+	return analysis.AnomalyOptions{
+		Granularity: granularity,
+		Threshold:   threshold,
+		MinHistory:  3,
+		MinValue:    anomalyMinValue[metric],
+	}
+}
+
+// GetAnomalies lists stored anomalies
+// GET /v1/analysis/anomalies?metric=&granularity=hour|day&range=30d (or start=&end=)
+func (h *AnomalyHandler) GetAnomalies(c *fiber.Ctx) error {
+	period, err := dateRangeFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	query := `SELECT id, metric, granularity, bucket_start, value, expected, score, direction, breakdown, created_at
+		FROM wp_apex_anomalies WHERE bucket_start >= ? AND bucket_start < ?`
+	args := []interface{}{period.Start, period.End}
+	if metric := c.Query("metric"); metric != "" {
+		query += ` AND metric = ?`
+		args = append(args, metric)
+	}
+	if gran := c.Query("granularity"); gran != "" {
+		query += ` AND granularity = ?`
+		args = append(args, gran)
+	}
+	query += ` ORDER BY bucket_start DESC LIMIT 500`
+
+	rows, err := h.repo.db.Query(query, args...)
+	if err != nil {
+		log.Printf("[Anomaly Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Anomaly query failed"})
+	}
+	defer rows.Close()
+
+	anomalies := []StoredAnomaly{}
+	for rows.Next() {
+		var a StoredAnomaly
+		var breakdown []byte
+		if err := rows.Scan(&a.ID, &a.Metric, &a.Granularity, &a.BucketStart, &a.Value, &a.Expected,
+			&a.Score, &a.Direction, &breakdown, &a.CreatedAt); err != nil {
+			continue
+		}
+		json.Unmarshal(breakdown, &a.Breakdown)
+		anomalies = append(anomalies, a)
+	}
+
+	return c.JSON(fiber.Map{"anomalies": anomalies, "period": rangeInfo(period)})
+}
+
+// ScanAnomalies runs the detector over a whole range without storing anything, for charting
+// GET /v1/analysis/anomalies/scan?metric=pageviews&granularity=day&sensitivity=medium&range=30d
+func (h *AnomalyHandler) ScanAnomalies(c *fiber.Ctx) error {
+	metric := c.Query("metric", "pageviews")
+	if _, ok := seriesMetrics[metric]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown metric", "metrics": seriesMetricNames})
+	}
+	granularity := c.Query("granularity", analysis.SeriesDaily)
+	if granularity != analysis.SeriesHourly && granularity != analysis.SeriesDaily {
+		return c.Status(400).JSON(fiber.Map{"error": "granularity must be hour or day"})
+	}
+	threshold, err := analysis.SensitivityThreshold(c.Query("sensitivity"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	period, err := dateRangeFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Series buckets are in server time, like the scheduled detector runs; a partial current
+	// bucket is left out
+	to := truncateBucket(period.End.In(time.Local), granularity)
+	from := truncateBucket(period.Start.In(time.Local), granularity)
+	series, err := h.repo.LoadMetricSeries(metric, granularity, from.AddDate(0, 0, -7*anomalyBaselineWeeks), to)
+	if err != nil {
+		log.Printf("[Anomaly Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Series query failed"})
+	}
+
+	anomalies := []analysis.Anomaly{}
+	for _, a := range analysis.DetectAnomalies(series, anomalyOptions(granularity, threshold, metric)) {
+		if !a.Time.Before(from) {
+			anomalies = append(anomalies, a)
+		}
+	}
+	visible := []analysis.SeriesPoint{}
+	for _, p := range series {
+		if !p.Time.Before(from) {
+			visible = append(visible, p)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"metric":      metric,
+		"granularity": granularity,
+		"threshold":   threshold,
+		"series":      visible,
+		"anomalies":   anomalies,
+		"period":      rangeInfo(period),
+	})
+}
+
+// RunAnomalies checks the last complete bucket of every metric now
+// POST /v1/analysis/anomalies/run?granularity=hour|day&sensitivity=
+func (h *AnomalyHandler) RunAnomalies(c *fiber.Ctx) error {
+	granularity := c.Query("granularity", analysis.SeriesHourly)
+	if granularity != analysis.SeriesHourly && granularity != analysis.SeriesDaily {
+		return c.Status(400).JSON(fiber.Map{"error": "granularity must be hour or day"})
+	}
+	threshold, err := analysis.SensitivityThreshold(c.Query("sensitivity", os.Getenv("ANOMALY_SENSITIVITY")))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	found := h.RunDetection(granularity, threshold, time.Now())
+	if found == nil {
+		found = []StoredAnomaly{}
+	}
+	return c.JSON(fiber.Map{"status": "completed", "anomalies": found})
+}
+
+// RunDetection judges the last complete bucket of each metric, stores new anomalies and emits
+// an "anomaly_detected" automation event for each of them
+func (h *AnomalyHandler) RunDetection(granularity string, threshold float64, now time.Time) []StoredAnomaly {
+	bucket := addBuckets(truncateBucket(now, granularity), granularity, -1)
+	historyFrom := bucket.AddDate(0, 0, -7*anomalyBaselineWeeks)
+
+	var found []StoredAnomaly
+	for _, metric := range seriesMetricNames {
+		series, err := h.repo.LoadMetricSeries(metric, granularity, historyFrom, addBuckets(bucket, granularity, 1))
+		if err != nil {
+			log.Printf("[Anomaly Error] %s series: %v", metric, err)
+			continue
+		}
+		a, ok := analysis.DetectLatest(series, anomalyOptions(granularity, threshold, metric))
+		if !ok || !a.Time.Equal(bucket) {
+			continue
+		}
+
+		stored := StoredAnomaly{
+			Metric:      metric,
+			Granularity: granularity,
+			BucketStart: bucket,
+			Value:       a.Value,
+			Expected:    a.Expected,
+			Score:       a.Score,
+			Direction:   a.Direction,
+			Breakdown:   h.explain(metric, bucket, granularity),
+		}
+
+		breakdown, _ := json.Marshal(stored.Breakdown)
+		res, err := h.repo.db.Exec(`
+			INSERT IGNORE INTO wp_apex_anomalies (metric, granularity, bucket_start, value, expected, score, direction, breakdown)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			metric, granularity, bucket, a.Value, a.Expected, a.Score, a.Direction, breakdown)
+		if err != nil {
+			log.Printf("[Anomaly Error] store %s: %v", metric, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // already reported by an earlier run
+		}
+		stored.ID, _ = res.LastInsertId()
+		found = append(found, stored)
+
+		if h.auto != nil {
+			payload, _ := json.Marshal(stored)
+			if err := h.auto.Dispatch("anomaly_detected", payload); err != nil {
+				log.Printf("[Anomaly Error] dispatch: %v", err)
+			}
+		}
+	}
+	return found
+}
+
+// explain compares the anomalous bucket's breakdown with the average of the same slot over
+// the previous weeks
+func (h *AnomalyHandler) explain(metric string, bucket time.Time, granularity string) map[string][]analysis.Contribution {
+	current, err := h.repo.MetricBreakdown(metric, bucket, addBuckets(bucket, granularity, 1))
+	if err != nil {
+		log.Printf("[Anomaly Error] %s breakdown: %v", metric, err)
+		return nil
+	}
+
+	const weeks = 4
+	baseline := map[string]map[string]float64{}
+	for w := 1; w <= weeks; w++ {
+		start := bucket.AddDate(0, 0, -7*w)
+		past, err := h.repo.MetricBreakdown(metric, start, addBuckets(start, granularity, 1))
+		if err != nil {
+			continue
+		}
+		for dim, values := range past {
+			if baseline[dim] == nil {
+				baseline[dim] = map[string]float64{}
+			}
+			for k, v := range values {
+				baseline[dim][k] += v / weeks
+			}
+		}
+	}
+
+	out := map[string][]analysis.Contribution{}
+	for dim := range current {
+		out[dim] = analysis.Contributions(current[dim], baseline[dim], 5)
+	}
+	for dim := range baseline {
+		if _, ok := out[dim]; !ok {
+			out[dim] = analysis.Contributions(nil, baseline[dim], 5)
+		}
+	}
+	return out
+}
+
+// StartAnomalyMonitor checks hourly buckets every hour and the previous day shortly after
+// midnight. Sensitivity comes from ANOMALY_SENSITIVITY (low, medium, high or a z-score).
+func StartAnomalyMonitor(h *AnomalyHandler) {
+	threshold, err := analysis.SensitivityThreshold(os.Getenv("ANOMALY_SENSITIVITY"))
+	if err != nil {
+		log.Printf("[Anomaly Error] %v, using medium sensitivity", err)
+		threshold, _ = analysis.SensitivityThreshold("medium")
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for now := range ticker.C {
+			h.RunDetection(analysis.SeriesHourly, threshold, now)
+			if now.Hour() == 0 {
+				h.RunDetection(analysis.SeriesDaily, threshold, now)
+			}
+		}
+	}()
+}
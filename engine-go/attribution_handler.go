@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AttributionHandler credits order revenue to the channels and campaigns that drove it
+type AttributionHandler struct {
+	repo *Repository
+}
+
+func NewAttributionHandler(repo *Repository) *AttributionHandler {
+	return &AttributionHandler{repo: repo}
+}
+
+// GetAttribution returns attributed conversions and revenue
+// GET /v1/attribution?model=all|first_touch|last_touch|linear|time_decay|position_based|data_driven
+//   &dimension=channel|campaign&lookback=30&range=7d|30d|90d|mtd|... (or start=&end=)&tz=
+func (h *AttributionHandler) GetAttribution(c *fiber.Ctx) error {
+	model := c.Query("model", "all")
+	dimension := c.Query("dimension", "channel")
+	lookbackDays := c.QueryInt("lookback", 30)
+	if lookbackDays < 1 || lookbackDays > 365 {
+		return c.Status(400).JSON(fiber.Map{"error": "lookback must be between 1 and 365 days"})
+	}
+
+	period, err := dateRangeFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	from, to := period.Start, period.End
+	lookback := time.Duration(lookbackDays) * 24 * time.Hour
+
+	// Touchpoints may precede the reporting range by up to the lookback window
+	events, err := h.repo.LoadTrackedEvents(from.Add(-lookback), to, []string{"pageview", "order_completed"})
+	if err != nil {
+		log.Printf("[Attribution Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Attribution query failed"})
+	}
+	journeys := analysis.BuildJourneys(events, from, to, lookback)
+
+	var conversions int
+	var revenue float64
+	for _, j := range journeys {
+		if j.Converted {
+			conversions++
+			revenue += j.Revenue
+		}
+	}
+
+	models := analysis.AttributionModels
+	if model != "all" {
+		models = []string{model}
+	}
+	results := fiber.Map{}
+	for _, m := range models {
+		rows, err := analysis.Attribute(journeys, m, dimension)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		results[m] = rows
+	}
+
+	return c.JSON(fiber.Map{
+		"dimension":     dimension,
+		"lookback_days": lookbackDays,
+		"conversions":   conversions,
+		"revenue":       revenue,
+		"models":        results,
+		"range":         period.Preset,
+		"period":        rangeInfo(period),
+	})
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"log"
+
 	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,12 +15,69 @@ func NewAuthorHandler(repo *Repository) *AuthorHandler {
 	return &AuthorHandler{repo: repo}
 }
 
+// PostMeta is post metadata pushed by the plugin, used to resolve URLs to authors
+type PostMeta struct {
+	PostID      int    `json:"post_id"`
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	AuthorID    int    `json:"author_id"`
+	AuthorName  string `json:"author_name"`
+	PublishedAt string `json:"published_at"` // "2006-01-02 15:04:05"
+}
+
+// GetLeaderboard ranks authors over a range
+// GET /v1/analysis/authors?range=30d (or start=&end=, or the older days=30)&sort=score|views|engaged_time|scroll_completion|conversions|decay_rate&limit=20
 func (h *AuthorHandler) GetLeaderboard(c *fiber.Ctx) error {
-	stats, err := analysis.CalculateAuthorLeaderboard(h.repo.GetDB())
+	period, err := dateRangeOrDaysFromQuery(c, h.repo, "30d")
 	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	opts := analysis.AuthorOptions{
+		Sort:  c.Query("sort"),
+		Limit: c.QueryInt("limit"),
+	}
+	if err := opts.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	stats, err := analysis.CalculateAuthorLeaderboard(h.repo.GetDB(), opts, period.Period)
+	if err != nil {
+		log.Printf("[Author Error] %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 	return c.JSON(stats)
 }
+
+// IngestPostMeta upserts post metadata the plugin pushes whenever a post is published or updated
+// POST /v1/content/posts  [{post_id, url, title, author_id, author_name, published_at}]
+func (h *AuthorHandler) IngestPostMeta(c *fiber.Ctx) error {
+	var posts []PostMeta
+	if err := c.BodyParser(&posts); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+
+	stored := 0
+	for _, p := range posts {
+		if p.PostID <= 0 || p.URL == "" {
+			continue
+		}
+		var published interface{}
+		if p.PublishedAt != "" {
+			published = p.PublishedAt
+		}
+		_, err := h.repo.db.Exec(`
+			INSERT INTO wp_apex_post_meta (post_id, url, title, author_id, author_name, published_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE url = VALUES(url), title = VALUES(title), author_id = VALUES(author_id),
+				author_name = VALUES(author_name), published_at = VALUES(published_at)`,
+			p.PostID, p.URL, p.Title, p.AuthorID, p.AuthorName, published)
+		if err != nil {
+			log.Printf("[Author Error] post %d: %v", p.PostID, err)
+			continue
+		}
+		stored++
+	}
+	return c.JSON(fiber.Map{"stored": stored})
+}
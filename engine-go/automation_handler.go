@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -93,24 +96,90 @@ func (h *AutomationHandler) IngestEvent(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
 	}
 
-	// Fetch active rules matching trigger
-	rows, err := h.repo.db.Query("SELECT id, name, trigger_config, action_type, action_config FROM wp_apex_automation_rules WHERE is_active = 1 AND trigger_type = ?", event.Type)
-	if err != nil {
+	if err := h.Dispatch(event.Type, event.Payload); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+
+	return c.JSON(fiber.Map{"status": "processed"})
+}
+
+// filteredTriggers are the engine-emitted event types whose rules narrow matching events with
+// trigger_config. Rules on any other type fire on every event of that type, as they always have.
+var filteredTriggers = map[string]bool{"anomaly_detected": true, "low_stock": true}
+
+// Dispatch runs every active rule for an event type; for filteredTriggers only those whose
+// trigger_config matches the payload. Engine jobs (anomaly detection, stock alerts) emit their
+// events through here as well.
+func (h *AutomationHandler) Dispatch(eventType string, payload json.RawMessage) error {
+	rules, err := h.matchingRules(eventType, payload)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		log.Printf("Executing Rule: %s for Event: %s", rule.Name, eventType)
+		go h.executeAction(rule.ActionType, rule.ActionConfig, payload)
+	}
+	return nil
+}
+
+// matchingRules loads the active rules an event fires
+func (h *AutomationHandler) matchingRules(eventType string, payload json.RawMessage) ([]AutomationRule, error) {
+	rows, err := h.repo.db.Query("SELECT id, name, trigger_config, action_type, action_config FROM wp_apex_automation_rules WHERE is_active = 1 AND trigger_type = ?", eventType)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
+	var rules []AutomationRule
 	for rows.Next() {
 		var rule AutomationRule
-		rows.Scan(&rule.ID, &rule.Name, &rule.TriggerConfig, &rule.ActionType, &rule.ActionConfig)
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.TriggerConfig, &rule.ActionType, &rule.ActionConfig); err != nil {
+			continue
+		}
+		if filteredTriggers[eventType] && !triggerMatches(rule.TriggerConfig, payload) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
 
-		// Basic Logic: Assume if trigger type matches, we execute.
-		// In a real engine, we'd check TriggerConfig thresholds (e.g. load > 80)
-		log.Printf("Executing Rule: %s for Event: %s", rule.Name, event.Type)
-		go h.executeAction(rule.ActionType, rule.ActionConfig, event.Payload)
+// triggerMatches checks a rule's trigger_config against an event payload. A key must equal the
+// payload field of the same name; "min_x"/"max_x" keys bound the numeric payload field "x" (by
+// absolute value, so a min_score of 3 matches both spikes and drops). Keys the payload does not
+// carry are ignored.
+func triggerMatches(config, payload json.RawMessage) bool {
+	var cfg map[string]interface{}
+	if len(config) == 0 || json.Unmarshal(config, &cfg) != nil || len(cfg) == 0 {
+		return true
+	}
+	var data map[string]interface{}
+	if json.Unmarshal(payload, &data) != nil {
+		return false
 	}
 
-	return c.JSON(fiber.Map{"status": "processed"})
+	for key, want := range cfg {
+		if strings.HasPrefix(key, "min_") || strings.HasPrefix(key, "max_") {
+			field, present := data[key[4:]]
+			if !present {
+				continue
+			}
+			bound, ok1 := analysis.ToFloat(want)
+			got, ok2 := analysis.ToFloat(field)
+			if !ok1 || !ok2 {
+				return false
+			}
+			got = math.Abs(got)
+			if (key[:4] == "min_" && got < bound) || (key[:4] == "max_" && got > bound) {
+				return false
+			}
+			continue
+		}
+		if got, present := data[key]; present && fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
 }
 
 func (h *AutomationHandler) executeAction(actionType string, config json.RawMessage, payload json.RawMessage) {
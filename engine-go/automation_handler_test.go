@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggerMatches(t *testing.T) {
+	payload := json.RawMessage(`{"metric": "revenue", "direction": "drop", "score": -4.2, "value": "12.5"}`)
+	cases := []struct {
+		config string
+		want   bool
+	}{
+		{``, true},
+		{`{}`, true},
+		{`{"metric": "revenue"}`, true},
+		{`{"metric": "pageviews"}`, false},
+		{`{"min_score": 3}`, true}, // by absolute value
+		{`{"min_score": 5}`, false},
+		{`{"max_score": 5, "direction": "drop"}`, true},
+		{`{"min_value": "10"}`, true}, // numeric strings on either side
+		{`{"max_value": 10}`, false},
+		{`{"sku": "MUG"}`, true}, // keys the payload does not carry are ignored
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, triggerMatches(json.RawMessage(c.config), payload), c.config)
+	}
+	assert.False(t, triggerMatches(json.RawMessage(`{"metric": "revenue"}`), json.RawMessage(`not json`)))
+}
+
+func TestDispatchKeepsUnfilteredTriggers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	h := NewAutomationHandler(&Repository{db: db})
+	// JSON columns come back from the driver as bytes
+	columns := []string{"id", "name", "trigger_config", "action_type", "action_config"}
+
+	// Rules on plugin events fire on every event of their type, whatever their config says
+	mock.ExpectQuery("FROM wp_apex_automation_rules").WithArgs("404_error").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "Broken links", []byte(`{"url": "/other"}`), "log", []byte(`{}`)))
+	assert.Equal(t, 1, dispatched(t, h, "404_error", `{"url": "/missing"}`))
+
+	// Engine events are narrowed by trigger_config
+	mock.ExpectQuery("FROM wp_apex_automation_rules").WithArgs("anomaly_detected").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(2, "Revenue drops", []byte(`{"metric": "revenue", "direction": "drop"}`), "log", []byte(`{}`)).
+			AddRow(3, "Pageview spikes", []byte(`{"metric": "pageviews"}`), "log", []byte(`{}`)))
+	assert.Equal(t, 1, dispatched(t, h, "anomaly_detected", `{"metric": "revenue", "direction": "drop"}`))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// dispatched counts the rules Dispatch selects, without running their actions
+func dispatched(t *testing.T, h *AutomationHandler, eventType, payload string) int {
+	rules, err := h.matchingRules(eventType, json.RawMessage(payload))
+	require.NoError(t, err)
+	return len(rules)
+}
@@ -1,24 +1,98 @@
 package main
 
 import (
+	"log"
+	"os"
+	"strings"
+
 	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
 type CannibalizationHandler struct {
+	repo *Repository
 }
 
-func NewCannibalizationHandler() *CannibalizationHandler {
-	return &CannibalizationHandler{}
+func NewCannibalizationHandler(repo *Repository) *CannibalizationHandler {
+	return &CannibalizationHandler{repo: repo}
 }
 
-func (h *CannibalizationHandler) GetAlerts(c *fiber.Ctx) error {
-	results, err := analysis.CheckCannibalization()
+// options reads analysis options from the query string. Brand terms come from ?brand=a,b or
+// the GSC_BRAND_TERMS environment variable.
+func (h *CannibalizationHandler) options(c *fiber.Ctx) (analysis.CannibalizationOptions, error) {
+	opts := analysis.CannibalizationOptions{
+		MinImpressions: c.QueryFloat("min_impressions"),
+		MinShare:       c.QueryFloat("min_share"),
+		Segment:        c.Query("segment", analysis.SegmentAll),
+	}
+	switch opts.Segment {
+	case analysis.SegmentAll, analysis.SegmentBrand, analysis.SegmentNonBrand:
+	default:
+		return opts, fiber.NewError(fiber.StatusBadRequest, "segment must be all, brand or non_brand")
+	}
+	for _, t := range strings.Split(c.Query("brand", os.Getenv("GSC_BRAND_TERMS")), ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			opts.BrandTerms = append(opts.BrandTerms, t)
+		}
+	}
+	return opts, nil
+}
+
+func (h *CannibalizationHandler) results(c *fiber.Ctx) ([]analysis.CannibalizationResult, error) {
+	opts, err := h.options(c)
+	if err != nil {
+		return nil, err
+	}
+	period, err := dateRangeOrDaysFromQuery(c, h.repo, "28d")
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	from, to := period.Start, inclusiveEnd(period.Period)
+	if period.Preset != analysis.RangeCustom {
+		// Search Console data lags by about two days, so relative ranges end two days back
+		from, to = from.AddDate(0, 0, -2), to.AddDate(0, 0, -2)
+	}
+	rows, err := h.repo.LoadGSCRows(from, to)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		log.Printf("[Cannibalization Error] %v", err)
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Search Console query failed")
 	}
+	return analysis.CheckCannibalization(rows, opts), nil
+}
 
+// GetAlerts lists cannibalized queries
+// GET /v1/analysis/cannibalization?range=28d (or start=&end=, or the older days=28)&segment=all|brand|non_brand&brand=apex,apexai&min_impressions=100&min_share=10&limit=50
+func (h *CannibalizationHandler) GetAlerts(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be positive"})
+	}
+	results, err := h.results(c)
+	if err != nil {
+		return fiberError(c, err)
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
 	return c.JSON(results)
 }
+
+// GetCandidates groups cannibalized queries into pages to merge or differentiate
+// GET /v1/analysis/cannibalization/candidates (same parameters as GetAlerts)
+func (h *CannibalizationHandler) GetCandidates(c *fiber.Ctx) error {
+	results, err := h.results(c)
+	if err != nil {
+		return fiberError(c, err)
+	}
+	return c.JSON(fiber.Map{"candidates": analysis.ConsolidationCandidates(results)})
+}
+
+// fiberError writes a *fiber.Error as the usual {"error": ...} body
+func fiberError(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	if fe, ok := err.(*fiber.Error); ok {
+		code = fe.Code
+	}
+	return c.Status(code).JSON(fiber.Map{"error": err.Error()})
+}
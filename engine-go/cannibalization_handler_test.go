@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCannibalizationAlertsLimit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	h := NewCannibalizationHandler(&Repository{db: db})
+	app := fiber.New()
+	app.Get("/v1/analysis/cannibalization", h.GetAlerts)
+
+	// Out-of-range limits are rejected before any query runs
+	for _, limit := range []string{"-1", "0"} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/analysis/cannibalization?limit="+limit, nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, limit)
+	}
+
+	mock.ExpectQuery("FROM wp_apex_gsc_rows").
+		WillReturnRows(sqlmock.NewRows([]string{"query", "page", "clicks", "impressions", "position"}))
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/analysis/cannibalization?limit=1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCannibalizationAlertsRange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	h := NewCannibalizationHandler(&Repository{db: db})
+	app := fiber.New()
+	app.Get("/v1/analysis/cannibalization", h.GetAlerts)
+
+	for _, q := range []string{"range=fortnight", "days=0", "start=2024-05-10&end=2024-05-01"} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/analysis/cannibalization?tz=UTC&"+q, nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, q)
+	}
+
+	// Custom dates are taken as given; only relative ranges are shifted back for the reporting lag
+	mock.ExpectQuery("FROM wp_apex_gsc_rows").WithArgs("2024-05-01", "2024-05-28").
+		WillReturnRows(sqlmock.NewRows([]string{"query", "page", "clicks", "impressions", "position"}))
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/analysis/cannibalization?tz=UTC&start=2024-05-01&end=2024-05-28", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -16,27 +16,26 @@ func NewContentStatsHandler(repo *Repository) *ContentStatsHandler {
 }
 
 // GetContentStats returns aggregated content metrics
-// GET /v1/stats/content?range=7d|30d|90d
+// GET /v1/stats/content?range=7d|30d|90d|today|yesterday|mtd|last_month|ytd (or start=&end=)&compare=&tz=&segment_id=
 func (h *ContentStatsHandler) GetContentStats(c *fiber.Ctx) error {
-	rangeParam := c.Query("range", "7d")
-
-	var days int
-	switch rangeParam {
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
+	period, err := dateRangeFromQuery(c, h.repo, "7d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
+	prev := previousPeriod(period)
+
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	seg, segArgs := segment.SessionFilter("session_id")
 
 	// Total unique URLs (posts)
 	var totalPosts int
 	h.repo.db.QueryRow(`
 		SELECT COUNT(DISTINCT url) 
 		FROM wp_apex_events 
-		WHERE event_type = 'pageview'
-	`).Scan(&totalPosts)
+		WHERE event_type = 'pageview'`+seg, segArgs...).Scan(&totalPosts)
 
 	// New posts this period (unique URLs first seen in this period)
 	var newPosts int
@@ -44,12 +43,11 @@ func (h *ContentStatsHandler) GetContentStats(c *fiber.Ctx) error {
 		SELECT COUNT(DISTINCT url) 
 		FROM wp_apex_events 
 		WHERE event_type = 'pageview'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
+		AND created_at >= ? AND created_at < ?
 		AND url NOT IN (
 			SELECT DISTINCT url FROM wp_apex_events 
-			WHERE created_at < DATE_SUB(NOW(), INTERVAL ? DAY)
-		)
-	`, days, days).Scan(&newPosts)
+			WHERE created_at < ?
+		)`+seg, withArgs([]interface{}{period.Start, period.End, period.Start}, segArgs)...).Scan(&newPosts)
 
 	// Average time on page from events with time_on_page data
 	var avgTimeSeconds float64
@@ -57,9 +55,9 @@ func (h *ContentStatsHandler) GetContentStats(c *fiber.Ctx) error {
 		SELECT COALESCE(AVG(JSON_EXTRACT(payload, '$.time_on_page')), 180)
 		FROM wp_apex_events 
 		WHERE event_type = 'pageview'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		AND JSON_EXTRACT(payload, '$.time_on_page') IS NOT NULL
-	`, days).Scan(&avgTimeSeconds)
+		AND created_at >= ? AND created_at < ?
+		AND JSON_EXTRACT(payload, '$.time_on_page') IS NOT NULL`+seg,
+		withArgs([]interface{}{period.Start, period.End}, segArgs)...).Scan(&avgTimeSeconds)
 
 	// Previous period avg time for comparison
 	var prevAvgTime float64
@@ -67,10 +65,9 @@ func (h *ContentStatsHandler) GetContentStats(c *fiber.Ctx) error {
 		SELECT COALESCE(AVG(JSON_EXTRACT(payload, '$.time_on_page')), 180)
 		FROM wp_apex_events 
 		WHERE event_type = 'pageview'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		AND created_at < DATE_SUB(NOW(), INTERVAL ? DAY)
-		AND JSON_EXTRACT(payload, '$.time_on_page') IS NOT NULL
-	`, days*2, days).Scan(&prevAvgTime)
+		AND created_at >= ? AND created_at < ?
+		AND JSON_EXTRACT(payload, '$.time_on_page') IS NOT NULL`+seg,
+		withArgs([]interface{}{prev.Start, prev.End}, segArgs)...).Scan(&prevAvgTime)
 
 	// Top performing post
 	var topPostURL string
@@ -79,19 +76,18 @@ func (h *ContentStatsHandler) GetContentStats(c *fiber.Ctx) error {
 		SELECT url, COUNT(*) as views
 		FROM wp_apex_events 
 		WHERE event_type = 'pageview'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
+		AND created_at >= ? AND created_at < ?`+seg+`
 		GROUP BY url
 		ORDER BY views DESC
 		LIMIT 1
-	`, days).Scan(&topPostURL, &topPostViews)
+	`, withArgs([]interface{}{period.Start, period.End}, segArgs)...).Scan(&topPostURL, &topPostViews)
 
 	// Calculate decay rate (percentage of posts declining)
 	var totalTrackedPosts, decliningPosts int
 	h.repo.db.QueryRow(`
 		SELECT COUNT(DISTINCT url) FROM wp_apex_events 
 		WHERE event_type = 'pageview'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL 60 DAY)
-	`).Scan(&totalTrackedPosts)
+		AND created_at >= DATE_SUB(NOW(), INTERVAL 60 DAY)`+seg, segArgs...).Scan(&totalTrackedPosts)
 
 	// Count posts with declining views (simplified)
 	h.repo.db.QueryRow(`
@@ -99,7 +95,7 @@ func (h *ContentStatsHandler) GetContentStats(c *fiber.Ctx) error {
 			SELECT url, COUNT(*) as views 
 			FROM wp_apex_events 
 			WHERE created_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)
-			AND event_type = 'pageview'
+			AND event_type = 'pageview'`+seg+`
 			GROUP BY url
 		),
 		PreviousPeriod AS (
@@ -107,13 +103,13 @@ func (h *ContentStatsHandler) GetContentStats(c *fiber.Ctx) error {
 			FROM wp_apex_events 
 			WHERE created_at >= DATE_SUB(NOW(), INTERVAL 60 DAY)
 			AND created_at < DATE_SUB(NOW(), INTERVAL 30 DAY)
-			AND event_type = 'pageview'
+			AND event_type = 'pageview'`+seg+`
 			GROUP BY url
 		)
 		SELECT COUNT(*) FROM PreviousPeriod p
 		LEFT JOIN CurrentPeriod c ON p.url = c.url
 		WHERE COALESCE(c.views, 0) < p.views * 0.85
-	`).Scan(&decliningPosts)
+	`, withArgs(segArgs, segArgs)...).Scan(&decliningPosts)
 
 	var decayRate float64
 	if totalTrackedPosts > 0 {
@@ -141,7 +137,9 @@ func (h *ContentStatsHandler) GetContentStats(c *fiber.Ctx) error {
 		"decaying_posts":    decliningPosts,
 		"top_post":          topPostTitle,
 		"top_post_views":    topPostViews,
-		"range":             rangeParam,
+		"range":             period.Preset,
+		"period":            rangeInfo(period),
+		"segment_id":        segmentID(segment),
 	})
 }
 
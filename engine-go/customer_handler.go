@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CustomerModelInterval is how often the customer model is rebuilt from order history
+const CustomerModelInterval = 6 * time.Hour
+
+// customerBatchSize bounds the rows per multi-row INSERT when the model is stored
+const customerBatchSize = 500
+
+// CustomerHandler serves the customer model: RFM segments and predicted lifetime value
+type CustomerHandler struct {
+	repo *Repository
+
+	mu      sync.Mutex
+	model   analysis.CLVModel
+	builtAt time.Time
+}
+
+func NewCustomerHandler(repo *Repository) *CustomerHandler {
+	return &CustomerHandler{repo: repo}
+}
+
+// CustomerSegmentSize is one RFM segment's share of the customer base
+type CustomerSegmentSize struct {
+	Segment             string               `json:"segment"`
+	Customers           int                  `json:"customers"`
+	Share               float64              `json:"share"` // % of customers
+	Revenue             float64              `json:"revenue"`
+	PredictedValue      float64              `json:"predicted_value"`
+	AvgAliveProbability float64              `json:"avg_alive_probability"`
+	Criteria            analysis.SegmentNode `json:"criteria"` // ready to save as a visitor segment
+}
+
+// GetSegments reports the size and value of every RFM segment
+// GET /v1/customers/segments
+func (h *CustomerHandler) GetSegments(c *fiber.Ctx) error {
+	rows, err := h.repo.db.Query(`
+		SELECT rfm_segment, COUNT(*), COALESCE(SUM(revenue), 0), COALESCE(SUM(predicted_value), 0), COALESCE(AVG(alive_probability), 0)
+		FROM wp_apex_customers GROUP BY rfm_segment`)
+	if err != nil {
+		log.Printf("[Customer Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load customer segments"})
+	}
+	defer rows.Close()
+
+	bySegment := map[string]*CustomerSegmentSize{}
+	var total int
+	for rows.Next() {
+		var s CustomerSegmentSize
+		if err := rows.Scan(&s.Segment, &s.Customers, &s.Revenue, &s.PredictedValue, &s.AvgAliveProbability); err != nil {
+			continue
+		}
+		bySegment[s.Segment] = &s
+		total += s.Customers
+	}
+
+	segments := make([]CustomerSegmentSize, 0, len(analysis.RFMSegments))
+	for _, name := range analysis.RFMSegments {
+		s := CustomerSegmentSize{Segment: name}
+		if found, ok := bySegment[name]; ok {
+			s = *found
+		}
+		if total > 0 {
+			s.Share = math.Round(float64(s.Customers)/float64(total)*1000) / 10
+		}
+		s.Revenue = math.Round(s.Revenue*100) / 100
+		s.PredictedValue = math.Round(s.PredictedValue*100) / 100
+		s.AvgAliveProbability = math.Round(s.AvgAliveProbability*10) / 10
+		s.Criteria = analysis.SegmentNode{Field: "rfm_segment", Operator: "eq", Value: name}
+		segments = append(segments, s)
+	}
+
+	h.mu.Lock()
+	model, builtAt := h.model, h.builtAt
+	h.mu.Unlock()
+	return c.JSON(fiber.Map{
+		"customers":  total,
+		"segments":   segments,
+		"model":      model,
+		"updated_at": builtAt,
+	})
+}
+
+// GetCustomers lists customers, optionally within one RFM segment
+// GET /v1/customers?segment=champions&min_predicted_value=&sort=revenue|predicted_value|last_order|orders&limit=50&offset=0
+func (h *CustomerHandler) GetCustomers(c *fiber.Ctx) error {
+	where := " WHERE 1 = 1"
+	var args []interface{}
+	var criteria []analysis.SegmentNode
+	if segment := c.Query("segment"); segment != "" {
+		valid := false
+		for _, s := range analysis.RFMSegments {
+			valid = valid || s == segment
+		}
+		if !valid {
+			return c.Status(400).JSON(fiber.Map{"error": "segment must be one of " + strings.Join(analysis.RFMSegments, ", ")})
+		}
+		where += " AND rfm_segment = ?"
+		args = append(args, segment)
+		criteria = append(criteria, analysis.SegmentNode{Field: "rfm_segment", Operator: "eq", Value: segment})
+	}
+	if minValue := c.QueryFloat("min_predicted_value", 0); minValue > 0 {
+		where += " AND predicted_value >= ?"
+		args = append(args, minValue)
+		criteria = append(criteria, analysis.SegmentNode{Field: "predicted_value", Operator: "gte", Value: minValue})
+	}
+
+	sortColumn := map[string]string{"revenue": "revenue", "predicted_value": "predicted_value", "last_order": "last_order", "orders": "orders"}[c.Query("sort", "revenue")]
+	if sortColumn == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "sort must be revenue, predicted_value, last_order or orders"})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int
+	if err := h.repo.db.QueryRow(`SELECT COUNT(*) FROM wp_apex_customers`+where, args...).Scan(&total); err != nil {
+		log.Printf("[Customer Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load customers"})
+	}
+	rows, err := h.repo.db.Query(`
+		SELECT customer_key, email, first_order, last_order, orders, revenue, aov, recency_days,
+			r_score, f_score, m_score, rfm_segment, alive_probability, predicted_orders, predicted_value
+		FROM wp_apex_customers`+where+` ORDER BY `+sortColumn+` DESC, customer_key LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		log.Printf("[Customer Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load customers"})
+	}
+	defer rows.Close()
+
+	customers := []analysis.Customer{}
+	for rows.Next() {
+		var cu analysis.Customer
+		if err := rows.Scan(&cu.ID, &cu.Email, &cu.FirstOrder, &cu.LastOrder, &cu.Orders, &cu.Revenue, &cu.AOV, &cu.RecencyDays,
+			&cu.RScore, &cu.FScore, &cu.MScore, &cu.Segment, &cu.AliveProbability, &cu.PredictedOrders, &cu.PredictedValue); err != nil {
+			continue
+		}
+		customers = append(customers, cu)
+	}
+
+	response := fiber.Map{"customers": customers, "total": total, "limit": limit, "offset": offset}
+	switch len(criteria) {
+	case 0:
+	case 1:
+		response["criteria"] = criteria[0]
+	default:
+		response["criteria"] = analysis.SegmentNode{And: criteria}
+	}
+	return c.JSON(response)
+}
+
+// RefreshModel rebuilds the customer model now
+// POST /v1/customers/refresh
+func (h *CustomerHandler) RefreshModel(c *fiber.Ctx) error {
+	model, err := h.Rebuild(time.Now())
+	if err != nil {
+		log.Printf("[Customer Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to rebuild customer model"})
+	}
+	return c.JSON(fiber.Map{"status": "rebuilt", "model": model})
+}
+
+// Rebuild refits the model on all orders and replaces the stored customers
+func (h *CustomerHandler) Rebuild(now time.Time) (analysis.CLVModel, error) {
+	orders, links, err := h.repo.LoadCustomerOrders()
+	if err != nil {
+		return analysis.CLVModel{}, err
+	}
+	customers, model := analysis.BuildCustomers(orders, now, analysis.DefaultCLVHorizonDays)
+	if err := h.repo.SaveCustomers(customers, links, now); err != nil {
+		return model, err
+	}
+	h.mu.Lock()
+	h.model, h.builtAt = model, now
+	h.mu.Unlock()
+	return model, nil
+}
+
+// customerLink ties a customer to a visitor fingerprint
+type customerLink struct {
+	customer    string
+	fingerprint string
+}
+
+// LoadCustomerOrders reads every completed order. Customers are keyed by lower-cased billing
+// email; anonymous orders fall back to the visitor. The shared server-side sessions of webhook
+// orders (system_*) say nothing about the buyer, so they are never used to link visitors.
+func (r *Repository) LoadCustomerOrders() ([]analysis.CustomerOrder, []customerLink, error) {
+	rows, err := r.db.Query(`
+		SELECT e.payload, e.session_id, COALESCE(s.fingerprint, ''), e.created_at
+		FROM wp_apex_events e
+		LEFT JOIN wp_apex_sessions s ON s.session_id = e.session_id
+		WHERE e.event_type = 'order_completed'
+		ORDER BY e.created_at`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var orders []analysis.CustomerOrder
+	var links []customerLink
+	for rows.Next() {
+		var payload []byte
+		var sessionID, fingerprint string
+		var created time.Time
+		if err := rows.Scan(&payload, &sessionID, &fingerprint, &created); err != nil {
+			continue
+		}
+		var order struct {
+			Revenue json.Number `json:"revenue"`
+		}
+		var data map[string]interface{}
+		if json.Unmarshal(payload, &order) != nil || json.Unmarshal(payload, &data) != nil {
+			continue
+		}
+		revenue, _ := order.Revenue.Float64()
+		if strings.HasPrefix(sessionID, systemSessionPrefix) {
+			fingerprint = ""
+		}
+
+		email := customerEmail(data)
+		key := email
+		if key == "" {
+			if fingerprint == "" {
+				continue
+			}
+			key = "visitor:" + fingerprint
+		}
+		if fingerprint != "" {
+			links = append(links, customerLink{customer: key, fingerprint: fingerprint})
+		}
+		orders = append(orders, analysis.CustomerOrder{CustomerID: key, Email: email, Time: created, Revenue: revenue})
+	}
+	return orders, links, rows.Err()
+}
+
+// customerEmail is the normalized billing email of an order payload (customer_email from the
+// WooCommerce integration, email from older payloads)
+func customerEmail(data map[string]interface{}) string {
+	for _, k := range []string{"customer_email", "email"} {
+		if s, ok := data[k].(string); ok && strings.TrimSpace(s) != "" {
+			return strings.ToLower(strings.TrimSpace(s))
+		}
+	}
+	return ""
+}
+
+// SaveCustomers replaces the stored customer model and adds visitor links
+func (r *Repository) SaveCustomers(customers []*analysis.Customer, links []customerLink, now time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM wp_apex_customers`); err != nil {
+		return err
+	}
+	for start := 0; start < len(customers); start += customerBatchSize {
+		end := start + customerBatchSize
+		if end > len(customers) {
+			end = len(customers)
+		}
+		batch := customers[start:end]
+		args := make([]interface{}, 0, len(batch)*16)
+		for _, c := range batch {
+			args = append(args, c.ID, c.Email, c.FirstOrder, c.LastOrder, c.Orders, c.Revenue, c.AOV, c.RecencyDays,
+				c.RScore, c.FScore, c.MScore, c.Segment, c.AliveProbability, c.PredictedOrders, c.PredictedValue, now)
+		}
+		_, err := tx.Exec(`
+			INSERT INTO wp_apex_customers (customer_key, email, first_order, last_order, orders, revenue, aov, recency_days,
+				r_score, f_score, m_score, rfm_segment, alive_probability, predicted_orders, predicted_value, updated_at)
+			VALUES `+strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(batch)), ", "), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for start := 0; start < len(links); start += customerBatchSize {
+		end := start + customerBatchSize
+		if end > len(links) {
+			end = len(links)
+		}
+		batch := links[start:end]
+		args := make([]interface{}, 0, len(batch)*2)
+		for _, l := range batch {
+			args = append(args, l.customer, l.fingerprint)
+		}
+		_, err := tx.Exec(`
+			INSERT IGNORE INTO wp_apex_customer_visitors (customer_key, fingerprint)
+			VALUES `+strings.TrimSuffix(strings.Repeat("(?, ?), ", len(batch)), ", "), args...)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LinkCustomerVisitor records that an order's buyer browsed as this visitor
+func (r *Repository) LinkCustomerVisitor(data map[string]interface{}, fingerprint string) {
+	email := customerEmail(data)
+	if email == "" {
+		return
+	}
+	if _, err := r.db.Exec(`INSERT IGNORE INTO wp_apex_customer_visitors (customer_key, fingerprint) VALUES (?, ?)`, email, fingerprint); err != nil {
+		log.Printf("Error linking customer visitor: %v", err)
+	}
+}
+
+// StartCustomerModelMonitor builds the customer model at startup and refreshes it periodically
+func StartCustomerModelMonitor(h *CustomerHandler) {
+	go func() {
+		if _, err := h.Rebuild(time.Now()); err != nil {
+			log.Printf("[Customer Error] %v", err)
+		}
+		ticker := time.NewTicker(CustomerModelInterval)
+		for now := range ticker.C {
+			if _, err := h.Rebuild(now); err != nil {
+				log.Printf("[Customer Error] %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+	_ "time/tzdata" // the runtime image ships without zoneinfo
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SiteTimeZoneCacheDuration is how long the configured site time zone is cached
+const SiteTimeZoneCacheDuration = 5 * time.Minute
+
+var siteZone struct {
+	mu  sync.Mutex
+	loc *time.Location
+	at  time.Time
+}
+
+// SiteLocation returns the site's time zone: the site_timezone setting (synced from WordPress),
+// else SITE_TIMEZONE, else the server's zone
+func (r *Repository) SiteLocation() *time.Location {
+	siteZone.mu.Lock()
+	defer siteZone.mu.Unlock()
+	if siteZone.loc != nil && time.Since(siteZone.at) < SiteTimeZoneCacheDuration {
+		return siteZone.loc
+	}
+
+	name := os.Getenv("SITE_TIMEZONE")
+	if r != nil && r.db != nil {
+		var value string
+		err := r.db.QueryRow(`SELECT option_value FROM wp_apex_settings WHERE option_name = 'site_timezone' LIMIT 1`).Scan(&value)
+		if err == nil && value != "" {
+			name = value
+		} else if err != nil && err != sql.ErrNoRows {
+			log.Printf("Time zone: Error reading setting: %v", err)
+		}
+	}
+
+	loc := time.Local
+	if name != "" {
+		if parsed, err := analysis.ParseTimeZone(name); err == nil {
+			loc = parsed
+		} else {
+			log.Printf("Time zone: %v, using server time", err)
+		}
+	}
+	siteZone.loc, siteZone.at = loc, time.Now()
+	return loc
+}
+
+// requestLocation lets the caller override the site zone with ?tz= or the X-Apex-Timezone header
+func requestLocation(c *fiber.Ctx, repo *Repository) (*time.Location, error) {
+	name := c.Query("tz")
+	if name == "" {
+		name = c.Get("X-Apex-Timezone")
+	}
+	if name == "" {
+		return repo.SiteLocation(), nil
+	}
+	return analysis.ParseTimeZone(name)
+}
+
+// dateRangeFromQuery resolves ?range=|start=&end= and ?compare= in the site time zone.
+// Every stats endpoint goes through it, so presets and day boundaries agree across reports.
+func dateRangeFromQuery(c *fiber.Ctx, repo *Repository, defaultRange string) (analysis.DateRange, error) {
+	loc, err := requestLocation(c, repo)
+	if err != nil {
+		return analysis.DateRange{}, err
+	}
+	return analysis.ParseDateRange(analysis.DateRangeParams{
+		Range:   c.Query("range"),
+		Start:   c.Query("start"),
+		End:     c.Query("end"),
+		Compare: c.Query("compare"),
+	}, time.Now(), loc, defaultRange)
+}
+
+// dateRangeOrDaysFromQuery is dateRangeFromQuery for endpoints that used to take ?days=N,
+// which still selects the last N days when no range is given
+func dateRangeOrDaysFromQuery(c *fiber.Ctx, repo *Repository, defaultRange string) (analysis.DateRange, error) {
+	if c.Query("days") != "" {
+		days := c.QueryInt("days", 0)
+		if days <= 0 {
+			return analysis.DateRange{}, fmt.Errorf("days must be positive")
+		}
+		defaultRange = fmt.Sprintf("%dd", days)
+	}
+	return dateRangeFromQuery(c, repo, defaultRange)
+}
+
+// rangeInfo describes a resolved range in responses, as local dates with the end inclusive
+func rangeInfo(r analysis.DateRange) fiber.Map {
+	info := fiber.Map{
+		"preset":   r.Preset,
+		"start":    r.Start.Format("2006-01-02"),
+		"end":      inclusiveEnd(r.Period).Format("2006-01-02"),
+		"timezone": r.Location.String(),
+		"compare":  r.Compare,
+	}
+	if r.Comparison != nil {
+		info["comparison"] = fiber.Map{
+			"start": r.Comparison.Start.Format("2006-01-02"),
+			"end":   inclusiveEnd(*r.Comparison).Format("2006-01-02"),
+		}
+	}
+	return info
+}
+
+// inclusiveEnd is the last instant inside a half-open period
+func inclusiveEnd(p analysis.Period) time.Time {
+	return p.End.Add(-time.Nanosecond)
+}
+
+// previousPeriod is the comparison period, defaulting to the one right before the range so
+// change percentages are always available
+func previousPeriod(r analysis.DateRange) analysis.Period {
+	if r.Comparison != nil {
+		return *r.Comparison
+	}
+	days := r.Days()
+	return analysis.Period{Start: r.Start.AddDate(0, 0, -days), End: r.End.AddDate(0, 0, -days)}
+}
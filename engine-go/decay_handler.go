@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"log"
+	"time"
+
 	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,9 +17,33 @@ func NewDecayHandler(repo *Repository) *DecayHandler {
 	return &DecayHandler{repo: repo}
 }
 
+// GetContentDecay lists decaying content. The range is the current window; it is compared with
+// the same number of days before it (period) or a year earlier (yoy).
+// GET /v1/analysis/decay?range=30d (or start=&end=, or the older window=30)&mode=period|yoy&min_views=5&threshold=15&alpha=0.05&limit=10
 func (h *DecayHandler) GetContentDecay(c *fiber.Ctx) error {
-	results, err := analysis.CalculateContentDecay(h.repo.GetDB())
+	defaultRange := "30d"
+	if window := c.QueryInt("window"); window > 0 {
+		defaultRange = fmt.Sprintf("%dd", window)
+	}
+	period, err := dateRangeFromQuery(c, h.repo, defaultRange)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	opts := analysis.DecayOptions{
+		Mode:      c.Query("mode"),
+		Window:    period.Days(),
+		MinViews:  c.QueryInt("min_views"),
+		Threshold: c.QueryFloat("threshold"),
+		Alpha:     c.QueryFloat("alpha"),
+		Limit:     c.QueryInt("limit"),
+	}
+	if err := opts.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	results, err := analysis.CalculateContentDecay(h.repo.GetDB(), opts, period.End)
 	if err != nil {
+		log.Printf("[Decay Error] %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
@@ -23,3 +51,92 @@ func (h *DecayHandler) GetContentDecay(c *fiber.Ctx) error {
 
 	return c.JSON(results)
 }
+
+// GetDecayHistory returns recorded decay runs, optionally for one URL or post
+// GET /v1/analysis/decay/history?url=&post_id=&range=90d (or start=&end=, or the older days=90)
+func (h *DecayHandler) GetDecayHistory(c *fiber.Ctx) error {
+	period, err := dateRangeOrDaysFromQuery(c, h.repo, "90d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	// run_at is a date, so compare local calendar dates
+	query := `SELECT url, post_id, mode, window_days, current_views, previous_views, change_pct, p_value, run_at
+		FROM wp_apex_content_decay_history WHERE run_at >= ? AND run_at <= ?`
+	args := []interface{}{period.Start.Format("2006-01-02"), inclusiveEnd(period.Period).Format("2006-01-02")}
+	if url := c.Query("url"); url != "" {
+		query += ` AND url = ?`
+		args = append(args, url)
+	}
+	if postID := c.QueryInt("post_id"); postID > 0 {
+		query += ` AND post_id = ?`
+		args = append(args, postID)
+	}
+	query += ` ORDER BY run_at DESC, change_pct ASC LIMIT 1000`
+
+	rows, err := h.repo.db.Query(query, args...)
+	if err != nil {
+		log.Printf("[Decay Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "History query failed"})
+	}
+	defer rows.Close()
+
+	history := []fiber.Map{}
+	for rows.Next() {
+		var url, mode, runAt string
+		var postID int64
+		var window, current, previous int
+		var change, pValue float64
+		if err := rows.Scan(&url, &postID, &mode, &window, &current, &previous, &change, &pValue, &runAt); err != nil {
+			continue
+		}
+		history = append(history, fiber.Map{
+			"url":            url,
+			"post_id":        postID,
+			"mode":           mode,
+			"window":         window,
+			"current_views":  current,
+			"previous_views": previous,
+			"change_pct":     change,
+			"p_value":        pValue,
+			"run_at":         runAt,
+		})
+	}
+	return c.JSON(history)
+}
+
+// RecordDecay runs decay detection with default options in both modes and stores one
+// history row per decaying URL per day
+func (h *DecayHandler) RecordDecay(now time.Time) {
+	for _, mode := range []string{analysis.DecayPeriod, analysis.DecayYoY} {
+		opts := analysis.DecayOptions{Mode: mode, Limit: 500}
+		opts.Validate()
+
+		results, err := analysis.CalculateContentDecay(h.repo.GetDB(), opts, now)
+		if err != nil {
+			log.Printf("[Decay Error] %s run: %v", mode, err)
+			continue
+		}
+		for _, r := range results {
+			_, err := h.repo.db.Exec(`
+				INSERT INTO wp_apex_content_decay_history
+					(url, post_id, mode, window_days, current_views, previous_views, change_pct, p_value, run_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON DUPLICATE KEY UPDATE current_views = VALUES(current_views), previous_views = VALUES(previous_views),
+					change_pct = VALUES(change_pct), p_value = VALUES(p_value)`,
+				r.URL, r.PostID, mode, opts.Window, r.CurrentViews, r.PreviousViews, r.ChangePct, r.PValue, now.Format("2006-01-02"))
+			if err != nil {
+				log.Printf("[Decay Error] record %s: %v", r.URL, err)
+			}
+		}
+	}
+}
+
+// StartDecayMonitor records decay history once a day
+func StartDecayMonitor(h *DecayHandler) {
+	ticker := time.NewTicker(24 * time.Hour)
+	go func() {
+		for now := range ticker.C {
+			h.RecordDecay(now)
+		}
+	}()
+}
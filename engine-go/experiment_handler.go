@@ -0,0 +1,305 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExperimentHandler registers split tests and analyzes their exposure events
+type ExperimentHandler struct {
+	repo    *Repository
+	funnels *FunnelHandler
+}
+
+func NewExperimentHandler(repo *Repository, funnels *FunnelHandler) *ExperimentHandler {
+	return &ExperimentHandler{repo: repo, funnels: funnels}
+}
+
+// Experiment is a registered experiment. Key matches the "experiment" property of exposure events.
+type Experiment struct {
+	ID         int64                         `json:"id"`
+	Key        string                        `json:"key"`
+	Name       string                        `json:"name"`
+	Definition analysis.ExperimentDefinition `json:"definition"`
+	StartedAt  time.Time                     `json:"started_at"`
+	StoppedAt  *time.Time                    `json:"stopped_at"`
+	CreatedAt  time.Time                     `json:"created_at"`
+}
+
+// DetectedExperiment is an experiment key seen in exposures but not registered
+type DetectedExperiment struct {
+	Key           string    `json:"key"`
+	Visitors      int       `json:"visitors"`
+	FirstExposure time.Time `json:"first_exposure"`
+}
+
+// CreateExperiment registers an experiment; started_at defaults to now
+// POST /v1/experiments
+func (h *ExperimentHandler) CreateExperiment(c *fiber.Ctx) error {
+	var e Experiment
+	if err := c.BodyParser(&e); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	if e.Key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "key is required"})
+	}
+	if len(e.Key) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "key must be at most 100 characters"})
+	}
+	if e.Name == "" {
+		e.Name = e.Key
+	}
+	if err := e.Definition.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if e.StartedAt.IsZero() {
+		e.StartedAt = time.Now()
+	}
+
+	def, _ := json.Marshal(e.Definition)
+	res, err := h.repo.db.Exec(`INSERT INTO wp_apex_experiments (experiment_key, name, definition, started_at) VALUES (?, ?, ?, ?)`,
+		e.Key, e.Name, def, e.StartedAt)
+	if err != nil {
+		log.Printf("[Experiment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create experiment (is the key already registered?)"})
+	}
+	id, _ := res.LastInsertId()
+	return c.JSON(fiber.Map{"status": "created", "id": id})
+}
+
+// GetExperiments lists registered experiments, plus keys seen in the last 30 days' exposures
+// that nobody registered yet
+// GET /v1/experiments
+func (h *ExperimentHandler) GetExperiments(c *fiber.Ctx) error {
+	list, err := h.repo.LoadExperiments()
+	var detected []DetectedExperiment
+	if err == nil {
+		detected, err = h.repo.DetectExperiments(time.Now().AddDate(0, 0, -30), list)
+	}
+	if err != nil {
+		log.Printf("[Experiment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load experiments"})
+	}
+	return c.JSON(fiber.Map{"experiments": list, "unregistered": detected})
+}
+
+// GetResults analyzes a registered experiment from its start until it was stopped (or now).
+// The stored metric can be swapped for another goal, funnel or revenue without editing the experiment.
+// GET /v1/experiments/:id/results?metric=goal|funnel|revenue&goal_event=&goal_url=&funnel_id=&window=&segment_id=
+func (h *ExperimentHandler) GetResults(c *fiber.Ctx) error {
+	e, err := h.repo.LoadExperiment(c.Params("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Experiment not found"})
+	}
+	if err != nil {
+		log.Printf("[Experiment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load experiment"})
+	}
+	def := e.Definition
+	if def.Metric, err = h.metricFromQuery(c, def.Metric); err == nil {
+		err = def.Validate()
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	end := time.Now()
+	if e.StoppedAt != nil && e.StoppedAt.Before(end) {
+		end = *e.StoppedAt
+	}
+	result, err := h.Analyze(e.Key, def, analysis.Period{Start: e.StartedAt, End: end}, segment)
+	if err != nil {
+		log.Printf("[Experiment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Experiment analysis failed"})
+	}
+	return c.JSON(fiber.Map{
+		"experiment": e,
+		"results":    result,
+		"segment_id": segmentID(segment),
+	})
+}
+
+// AnalyzeExperiment analyzes an unregistered experiment key over a date range
+// POST /v1/experiments/analyze?range=30d|... (or start=&end=)&tz=&segment_id=
+// Body: {"key": "checkout-cta", "definition": {...}}
+func (h *ExperimentHandler) AnalyzeExperiment(c *fiber.Ctx) error {
+	var req struct {
+		Key        string                        `json:"key"`
+		Definition analysis.ExperimentDefinition `json:"definition"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	if req.Key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "key is required"})
+	}
+	if err := req.Definition.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	period, err := dateRangeFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result, err := h.Analyze(req.Key, req.Definition, period.Period, segment)
+	if err != nil {
+		log.Printf("[Experiment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Experiment analysis failed"})
+	}
+	return c.JSON(fiber.Map{
+		"results":    result,
+		"period":     rangeInfo(period),
+		"segment_id": segmentID(segment),
+	})
+}
+
+// StopExperiment freezes an experiment; later exposures are ignored
+// POST /v1/experiments/:id/stop
+func (h *ExperimentHandler) StopExperiment(c *fiber.Ctx) error {
+	res, err := h.repo.db.Exec(`UPDATE wp_apex_experiments SET stopped_at = ? WHERE id = ? AND stopped_at IS NULL`, time.Now(), c.Params("id"))
+	if err != nil {
+		log.Printf("[Experiment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to stop experiment"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Experiment not found or already stopped"})
+	}
+	return c.JSON(fiber.Map{"status": "stopped"})
+}
+
+// DeleteExperiment removes a registered experiment; its exposure events are kept
+// DELETE /v1/experiments/:id
+func (h *ExperimentHandler) DeleteExperiment(c *fiber.Ctx) error {
+	_, err := h.repo.db.Exec("DELETE FROM wp_apex_experiments WHERE id = ?", c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "deleted"})
+}
+
+// Analyze loads exposures in p, plus outcomes until the metric window closes, and compares the variants
+func (h *ExperimentHandler) Analyze(key string, def analysis.ExperimentDefinition, p analysis.Period, segment *SegmentScope) (analysis.ExperimentResult, error) {
+	window, _ := def.Metric.WindowDuration()
+	events, err := h.repo.LoadTrackedEvents(p.Start, p.End.Add(window), def.Metric.EventTypes())
+	if err == nil {
+		events, err = segment.FilterEvents(h.repo, events)
+	}
+	if err != nil {
+		return analysis.ExperimentResult{}, err
+	}
+	return analysis.AnalyzeExperiment(key, def, events, p.End), nil
+}
+
+// metricFromQuery overrides the stored metric with ?metric= and its parameters
+func (h *ExperimentHandler) metricFromQuery(c *fiber.Ctx, metric analysis.ExperimentMetric) (analysis.ExperimentMetric, error) {
+	kind := c.Query("metric")
+	if kind == "" {
+		return metric, nil
+	}
+	m := analysis.ExperimentMetric{Kind: kind, Window: c.Query("window", metric.Window)}
+	switch kind {
+	case analysis.MetricGoal:
+		m.Goal = &analysis.FunnelStep{Name: "Goal", EventType: c.Query("goal_event"), URLPattern: c.Query("goal_url")}
+	case analysis.MetricFunnel:
+		f, err := h.funnels.LoadFunnel(c.Query("funnel_id"))
+		if err != nil {
+			return m, fmt.Errorf("funnel %q not found", c.Query("funnel_id"))
+		}
+		m.Funnel = &f.Definition
+	}
+	return m, nil
+}
+
+// LoadExperiment fetches a registered experiment by ID
+func (r *Repository) LoadExperiment(id interface{}) (*Experiment, error) {
+	row := r.db.QueryRow(`SELECT id, experiment_key, name, definition, started_at, stopped_at, created_at FROM wp_apex_experiments WHERE id = ?`, id)
+	return scanExperiment(row)
+}
+
+// LoadExperiments lists registered experiments, newest first
+func (r *Repository) LoadExperiments() ([]*Experiment, error) {
+	rows, err := r.db.Query(`SELECT id, experiment_key, name, definition, started_at, stopped_at, created_at FROM wp_apex_experiments ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Experiment{}
+	for rows.Next() {
+		e, err := scanExperiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// DetectExperiments lists experiment keys exposed since a time that are not in registered
+func (r *Repository) DetectExperiments(since time.Time, registered []*Experiment) ([]DetectedExperiment, error) {
+	rows, err := r.db.Query(`
+		SELECT JSON_UNQUOTE(JSON_EXTRACT(e.payload, '$.experiment')) AS experiment, COUNT(DISTINCT s.fingerprint), MIN(e.created_at)
+		FROM wp_apex_events e
+		JOIN wp_apex_sessions s ON s.session_id = e.session_id
+		WHERE e.event_type = ? AND e.created_at >= ?
+		GROUP BY experiment
+		ORDER BY COUNT(DISTINCT s.fingerprint) DESC`, analysis.ExposureEvent, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := map[string]bool{}
+	for _, e := range registered {
+		known[e.Key] = true
+	}
+	detected := []DetectedExperiment{}
+	for rows.Next() {
+		var d DetectedExperiment
+		var key sql.NullString
+		if err := rows.Scan(&key, &d.Visitors, &d.FirstExposure); err != nil {
+			return nil, err
+		}
+		if !key.Valid || key.String == "" || known[key.String] {
+			continue
+		}
+		d.Key = key.String
+		detected = append(detected, d)
+	}
+	return detected, rows.Err()
+}
+
+type experimentScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExperiment(row experimentScanner) (*Experiment, error) {
+	var e Experiment
+	var def []byte
+	var stopped sql.NullTime
+	if err := row.Scan(&e.ID, &e.Key, &e.Name, &def, &e.StartedAt, &stopped, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(def, &e.Definition); err != nil {
+		return nil, fmt.Errorf("corrupt experiment definition: %w", err)
+	}
+	if stopped.Valid {
+		e.StoppedAt = &stopped.Time
+	}
+	return &e, nil
+}
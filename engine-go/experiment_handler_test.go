@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeCreditsWebhookOrdersToExposedBuyers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	h := NewExperimentHandler(&Repository{db: db}, nil)
+	t0 := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+
+	exposure := func(fp, session, variant string, at time.Time) []driver.Value {
+		return []driver.Value{fp, session, analysis.ExposureEvent, "https://shop.com/cart", "", []byte(`{"experiment": "checkout-cta", "variant": "` + variant + `"}`), at,
+			"", "https://shop.com/cart", "Mozilla/5.0", "US"}
+	}
+	// Orders arrive in the shared webhook session, owned by a visitor who saw neither variant
+	order := func(email string, revenue string, at time.Time) []driver.Value {
+		return []driver.Value{"fp_first", "system_woo_webhook", "order_completed", "https://shop.com/checkout/order-received/", "",
+			[]byte(`{"revenue": ` + revenue + `, "customer_email": "` + email + `"}`), at, "", "", "WordPress", "FR"}
+	}
+	mock.ExpectQuery("FROM wp_apex_events e").WillReturnRows(trackedEventRows().
+		AddRow(exposure("fp_a", "s_a", "control", t0)...).
+		AddRow(exposure("fp_b", "s_b", "green", t0.Add(time.Minute))...).
+		AddRow(exposure("fp_c", "s_c", "green", t0.Add(2*time.Minute))...).
+		AddRow(order("a@shop.com", "30", t0.Add(time.Hour))...).
+		AddRow(order("b@shop.com", "70", t0.Add(2*time.Hour))...).
+		AddRow(order("b@shop.com", "5", t0.Add(3*time.Hour))...))
+	mock.ExpectQuery("FROM wp_apex_customer_visitors cv").
+		WithArgs("a@shop.com", "b@shop.com").
+		WillReturnRows(buyerSessionRows().
+			AddRow("a@shop.com", "s_a", "fp_a", t0, "", "https://shop.com/cart", "Mozilla/5.0", "US").
+			AddRow("b@shop.com", "s_b", "fp_b", t0.Add(time.Minute), "", "https://shop.com/cart", "Mozilla/5.0", "US"))
+
+	def := analysis.ExperimentDefinition{
+		Variants: []analysis.ExperimentVariant{{Name: "control", Weight: 1}, {Name: "green", Weight: 1}},
+		Metric:   analysis.ExperimentMetric{Kind: analysis.MetricRevenue},
+	}
+	require.NoError(t, def.Validate())
+	p := analysis.Period{Start: t0.Add(-time.Hour), End: t0.Add(24 * time.Hour)}
+	result, err := h.Analyze("checkout-cta", def, p, nil)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, result.Variants, 2)
+	control, green := result.Variants[0], result.Variants[1]
+	assert.Equal(t, 1, control.Units)
+	assert.Equal(t, 1, control.Conversions)
+	assert.InDelta(t, 30, control.Revenue, 1e-9)
+	assert.Equal(t, 2, green.Units)
+	assert.Equal(t, 1, green.Conversions)
+	assert.InDelta(t, 75, green.Revenue, 1e-9)
+	assert.InDelta(t, 37.5, green.RevenuePerUnit, 1e-9)
+}
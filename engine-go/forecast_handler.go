@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ForecastHandler projects traffic and revenue with Holt-Winters smoothing
+type ForecastHandler struct {
+	repo *Repository
+}
+
+func NewForecastHandler(repo *Repository) *ForecastHandler {
+	return &ForecastHandler{repo: repo}
+}
+
+// forecastMetrics are the series that can be forecast
+var forecastMetrics = map[string]bool{"pageviews": true, "sessions": true, "orders": true, "revenue": true}
+
+// GetForecast forecasts a daily metric and projects where the current month will land
+// GET /v1/analysis/forecast?metric=pageviews|sessions|orders|revenue&horizon=30&history=120
+func (h *ForecastHandler) GetForecast(c *fiber.Ctx) error {
+	metric := c.Query("metric", "pageviews")
+	if !forecastMetrics[metric] {
+		return c.Status(400).JSON(fiber.Map{"error": "metric must be pageviews, sessions, orders or revenue"})
+	}
+	horizon := c.QueryInt("horizon", 30)
+	if horizon < 1 || horizon > 365 {
+		return c.Status(400).JSON(fiber.Map{"error": "horizon must be between 1 and 365 days"})
+	}
+	historyDays := c.QueryInt("history", 120)
+	// The weekly model needs three weeks: two to initialise the season and one to score the fit
+	if historyDays < 21 || historyDays > 730 {
+		return c.Status(400).JSON(fiber.Map{"error": "history must be between 21 and 730 days"})
+	}
+
+	// Today is still in progress, so the model only sees complete days
+	now := time.Now()
+	today := truncateBucket(now, analysis.SeriesDaily)
+	series, err := h.repo.LoadMetricSeries(metric, analysis.SeriesDaily, today.AddDate(0, 0, -historyDays), today)
+	if err != nil {
+		log.Printf("[Forecast Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Series query failed"})
+	}
+
+	values := make([]float64, len(series))
+	for i, p := range series {
+		values[i] = p.Value
+	}
+
+	model, err := analysis.FitHoltWinters(values, 7)
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Forecast at least through the end of the month for the month-end projection
+	monthEnd := time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location())
+	remaining := int(monthEnd.Sub(today).Hours()/24 + 0.5)
+	steps := horizon
+	if remaining > steps {
+		steps = remaining
+	}
+	opts := analysis.ForecastOptions{Horizon: steps, SeasonLength: 7, StepDays: 1, NonNegative: true}
+	forecast := model.Forecast(today.AddDate(0, 0, -1), opts)
+
+	// Month to date, including today's partial bucket
+	var monthToDate float64
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+	for _, p := range series {
+		if !p.Time.Before(monthStart) {
+			monthToDate += p.Value
+		}
+	}
+	todaySoFar, err := h.repo.LoadMetricSeries(metric, analysis.SeriesDaily, today, now)
+	if err == nil && len(todaySoFar) > 0 {
+		monthToDate += todaySoFar[0].Value
+	}
+
+	// Remaining days start with today; its forecast is reduced by what already happened.
+	// The interval treats daily errors as independent, which understates it slightly.
+	projected := monthToDate
+	var variance float64
+	for i := 0; i < remaining && i < len(forecast); i++ {
+		v := forecast[i].Value
+		if i == 0 && len(todaySoFar) > 0 {
+			v = math.Max(v-todaySoFar[0].Value, 0)
+		}
+		projected += v
+		variance += forecast[i].Std * forecast[i].Std
+	}
+	spread := 1.96 * math.Sqrt(variance)
+
+	holdout := 14
+	if len(values) < 60 {
+		holdout = 7
+	}
+	var backtest interface{}
+	if bt, err := analysis.Backtest(values, holdout, opts); err == nil {
+		backtest = bt
+	}
+
+	return c.JSON(fiber.Map{
+		"metric":   metric,
+		"horizon":  horizon,
+		"model":    model,
+		"history":  series,
+		"forecast": forecast[:horizon],
+		"backtest": backtest,
+		"month_projection": fiber.Map{
+			"month":         monthStart.Format("2006-01"),
+			"month_to_date": monthToDate,
+			"projected":     projected,
+			"lower_95":      math.Max(projected-spread, monthToDate),
+			"upper_95":      projected + spread,
+		},
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+)
+
+// telemetryEvent is one event as sent by apex-forms.js (older clients send "time" instead of dwell_ms)
+type telemetryEvent struct {
+	Type      string  `json:"type"`
+	Field     string  `json:"field"`
+	FormID    string  `json:"form_id"`
+	Timestamp string  `json:"timestamp"`
+	DwellMs   float64 `json:"dwell_ms"`
+	Time      float64 `json:"time"`
+}
+
+// ParseFormEvents decodes a telemetry batch; events without a form fall back to defaultForm
+func ParseFormEvents(raw json.RawMessage, defaultForm string, received time.Time) []analysis.FormEvent {
+	var in []telemetryEvent
+	if len(raw) == 0 || json.Unmarshal(raw, &in) != nil {
+		return nil
+	}
+	events := make([]analysis.FormEvent, 0, len(in))
+	for _, e := range in {
+		ev := analysis.FormEvent{Type: e.Type, FormID: e.FormID, Field: e.Field, Time: received, DwellMs: e.DwellMs}
+		if ev.FormID == "" {
+			ev.FormID = defaultForm
+		}
+		if t, err := time.Parse(time.RFC3339Nano, e.Timestamp); err == nil {
+			ev.Time = t
+		}
+		if ev.DwellMs == 0 && e.Time > 0 {
+			ev.DwellMs = e.Time
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// ApplyFormDeltas adds one batch's folded counters to the per-session and per-field form tables
+func (r *Repository) ApplyFormDeltas(sessionID, device string, deltas []analysis.FormSessionDelta) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, d := range deltas {
+		// last_field must be assigned before last_ms moves forward
+		_, err := tx.Exec(`
+			INSERT INTO wp_apex_form_sessions
+				(form_id, session_id, device, started_at, started_ms, last_ms, last_field, submitted, submitted_ms, rage_clicks)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				last_field = IF(VALUES(last_field) <> '' AND VALUES(last_ms) >= last_ms, VALUES(last_field), last_field),
+				last_ms = GREATEST(last_ms, VALUES(last_ms)),
+				started_ms = LEAST(started_ms, VALUES(started_ms)),
+				submitted_ms = IF(submitted_ms = 0, VALUES(submitted_ms), submitted_ms),
+				submitted = submitted OR VALUES(submitted),
+				rage_clicks = rage_clicks + VALUES(rage_clicks)`,
+			d.FormID, sessionID, device, time.UnixMilli(d.StartedMs), d.StartedMs, d.LastMs, d.LastField,
+			d.Submitted, d.SubmittedMs, d.RageClicks)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range d.Fields {
+			_, err := tx.Exec(`
+				INSERT INTO wp_apex_form_session_fields
+					(form_id, session_id, field, first_ms, focuses, blurs, changes, errors, dwell_ms)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON DUPLICATE KEY UPDATE
+					first_ms = LEAST(first_ms, VALUES(first_ms)),
+					focuses = focuses + VALUES(focuses),
+					blurs = blurs + VALUES(blurs),
+					changes = changes + VALUES(changes),
+					errors = errors + VALUES(errors),
+					dwell_ms = dwell_ms + VALUES(dwell_ms)`,
+				d.FormID, sessionID, f.Field, f.FirstMs, f.Focuses, f.Blurs, f.Changes, f.Errors, f.DwellMs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
-	"encoding/json"
-	"strings"
+	"math"
+	"sort"
+	"time"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
+// formIdleTimeout is how long an unsubmitted form session must be idle to count as abandoned
+const formIdleTimeout = 30 * time.Minute
+
 type FormStatsHandler struct {
 	repo *Repository
 }
@@ -17,116 +22,212 @@ func NewFormStatsHandler(repo *Repository) *FormStatsHandler {
 
 type FormFieldStat struct {
 	Name         string  `json:"name"`
-	TotalDwell   float64 `json:"total_dwell"`
-	Interactions int     `json:"interactions"`
-	DropOffs     int     `json:"drop_offs"`
+	TotalDwell   float64 `json:"total_dwell"`  // ms
+	Interactions int     `json:"interactions"` // sessions that touched the field
+	DropOffs     int     `json:"drop_offs"`    // abandoned sessions whose last touched field was this one
 	AvgDwellTime float64 `json:"avgDwellTime"`
+	Focuses      int     `json:"focuses"`
+	Refocuses    int     `json:"refocuses"`   // focuses after the first, per session
+	Corrections  int     `json:"corrections"` // changes after the first, per session
+	Errors       int     `json:"errors"`      // validation errors
+	DropOffRate  float64 `json:"drop_off_rate"`
 }
 
 type FormSummary struct {
-	FormID      string                    `json:"formId"`
-	Starters    int                       `json:"starters"`
-	Completions int                       `json:"completions"`
-	Fields      map[string]*FormFieldStat `json:"-"` // Internal map
-	FieldList   []*FormFieldStat          `json:"fields"`
-	DeviceStats map[string]int            `json:"device_stats"`
+	FormID         string                        `json:"formId"`
+	Starters       int                           `json:"starters"`
+	Completions    int                           `json:"completions"`
+	Abandons       int                           `json:"abandons"`
+	CompletionRate float64                       `json:"completion_rate"`
+	RageClicks     int                           `json:"rage_clicks"`
+	Fields         map[string]*FormFieldStat     `json:"-"` // Internal map
+	FieldList      []*FormFieldStat              `json:"fields"`
+	DeviceStats    map[string]int                `json:"device_stats"`
+	Funnel         []analysis.FormFunnelStep     `json:"funnel"`
+	TimeToComplete analysis.DurationDistribution `json:"time_to_complete"`
+	Comparison     *FormRate                     `json:"comparison,omitempty"` // same form in the comparison period
 }
 
+// GetStats reports per-form and per-field behaviour from the incrementally maintained aggregates
+// GET /v1/stats/forms?range=7d|30d|90d|today|yesterday|mtd|last_month|ytd (or start=&end=)&compare=&tz=&form_id=
 func (h *FormStatsHandler) GetStats(c *fiber.Ctx) error {
-	rangeParam := c.Query("range", "7d")
-
-	var days int
-	switch rangeParam {
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
-	}
-
-	rows, err := h.repo.db.Query(`
-		SELECT form_id, payload 
-		FROM wp_apex_form_analytics 
-		WHERE created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		ORDER BY created_at DESC 
-		LIMIT 1000
-	`, days)
+	period, err := dateRangeFromQuery(c, h.repo, "7d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	forms, err := h.repo.LoadFormSummaries(period.Period, c.Query("form_id"))
+	if err == nil && period.Comparison != nil {
+		var prev []*FormSummary
+		if prev, err = h.repo.LoadFormSummaries(*period.Comparison, c.Query("form_id")); err == nil {
+			compareForms(forms, prev)
+		}
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer rows.Close()
+	return c.JSON(forms)
+}
 
-	forms := make(map[string]*FormSummary)
+// compareForms attaches each form's comparison-period rates, with the change in percentage points
+func compareForms(forms, prev []*FormSummary) {
+	byID := make(map[string]*FormSummary, len(prev))
+	for _, p := range prev {
+		byID[p.FormID] = p
+	}
+	for _, f := range forms {
+		rate := &FormRate{}
+		if p, ok := byID[f.FormID]; ok {
+			rate = &FormRate{Starters: p.Starters, Completions: p.Completions, CompletionRate: p.CompletionRate}
+		}
+		rate.Delta = math.Round((f.CompletionRate-rate.CompletionRate)*10) / 10
+		f.Comparison = rate
+	}
+}
 
-	for rows.Next() {
-		var formID string
-		var blob []byte
-		if err := rows.Scan(&formID, &blob); err != nil {
-			continue
+// LoadFormSummaries builds form summaries for sessions started in a period, optionally for one form
+func (r *Repository) LoadFormSummaries(p analysis.Period, formID string) ([]*FormSummary, error) {
+	filter := `s.started_at >= ? AND s.started_at < ?`
+	args := []interface{}{p.Start, p.End}
+	if formID != "" {
+		filter += ` AND s.form_id = ?`
+		args = append(args, formID)
+	}
+	idleBefore := time.Now().Add(-formIdleTimeout).UnixMilli()
+
+	forms := map[string]*FormSummary{}
+	get := func(id string) *FormSummary {
+		if forms[id] == nil {
+			forms[id] = &FormSummary{FormID: id, Fields: map[string]*FormFieldStat{}, DeviceStats: map[string]int{}}
 		}
+		return forms[id]
+	}
 
-		if _, exists := forms[formID]; !exists {
-			forms[formID] = &FormSummary{
-				FormID:      formID,
-				Fields:      make(map[string]*FormFieldStat),
-				DeviceStats: make(map[string]int),
-			}
+	// Sessions, completions, abandons and devices
+	rows, err := r.db.Query(`
+		SELECT s.form_id, s.device, COUNT(*), SUM(s.submitted), SUM(NOT s.submitted AND s.last_ms < ?), SUM(s.rage_clicks)
+		FROM wp_apex_form_sessions s WHERE `+filter+` GROUP BY s.form_id, s.device`, append([]interface{}{idleBefore}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, device string
+		var n, done, abandoned, rage int
+		if err := rows.Scan(&id, &device, &n, &done, &abandoned, &rage); err != nil {
+			rows.Close()
+			return nil, err
 		}
-		summary := forms[formID]
-		summary.Starters++ // Assume every row is a starter session
-
-		var content struct {
-			Events []struct {
-				Type     string  `json:"type"`
-				Field    string  `json:"field"`
-				Duration float64 `json:"time"`
-			} `json:"events"`
-			UA string `json:"ua"`
+		f := get(id)
+		f.Starters += n
+		f.Completions += done
+		f.Abandons += abandoned
+		f.RageClicks += rage
+		f.DeviceStats[device] += n
+	}
+	rows.Close()
+
+	// Per-field counters and first-touch offsets for the fill-order funnel
+	offsets := map[string]map[string]float64{}
+	rows, err = r.db.Query(`
+		SELECT f.form_id, f.field, COUNT(*), SUM(f.focuses), SUM(GREATEST(f.focuses - 1, 0)), SUM(GREATEST(f.changes - 1, 0)),
+			SUM(f.errors), SUM(f.dwell_ms), SUM(f.blurs), AVG(f.first_ms - s.started_ms)
+		FROM wp_apex_form_session_fields f
+		JOIN wp_apex_form_sessions s ON s.form_id = f.form_id AND s.session_id = f.session_id
+		WHERE `+filter+` GROUP BY f.form_id, f.field`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		var st FormFieldStat
+		var blurs int
+		var offset float64
+		if err := rows.Scan(&id, &st.Name, &st.Interactions, &st.Focuses, &st.Refocuses, &st.Corrections,
+			&st.Errors, &st.TotalDwell, &blurs, &offset); err != nil {
+			rows.Close()
+			return nil, err
 		}
-
-		if err := json.Unmarshal(blob, &content); err != nil {
-			continue
+		st.TotalDwell = math.Round(st.TotalDwell)
+		if blurs > 0 {
+			st.AvgDwellTime = math.Round(st.TotalDwell / float64(blurs))
 		}
-
-		// Device Detection
-		deviceType := "desktop"
-		if strings.Contains(strings.ToLower(content.UA), "mobile") || strings.Contains(strings.ToLower(content.UA), "android") || strings.Contains(strings.ToLower(content.UA), "iphone") {
-			deviceType = "mobile"
+		get(id).Fields[st.Name] = &st
+		if offsets[id] == nil {
+			offsets[id] = map[string]float64{}
 		}
-		summary.DeviceStats[deviceType]++
+		offsets[id][st.Name] = offset
+	}
+	rows.Close()
 
-		// Check for completion
-		isComplete := false
-		for _, e := range content.Events {
-			if e.Type == "submit" {
-				isComplete = true
-			}
-			if e.Type == "blur" && e.Field != "" {
-				if _, ok := summary.Fields[e.Field]; !ok {
-					summary.Fields[e.Field] = &FormFieldStat{Name: e.Field}
-				}
-				stat := summary.Fields[e.Field]
-				stat.Interactions++
-				stat.TotalDwell += e.Duration
-			}
+	// Abandonment: the last field touched in idle, unsubmitted sessions
+	rows, err = r.db.Query(`
+		SELECT s.form_id, s.last_field, COUNT(*) FROM wp_apex_form_sessions s
+		WHERE `+filter+` AND NOT s.submitted AND s.last_ms < ? AND s.last_field <> ''
+		GROUP BY s.form_id, s.last_field`, append(args, idleBefore)...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, field string
+		var n int
+		if err := rows.Scan(&id, &field, &n); err != nil {
+			rows.Close()
+			return nil, err
 		}
-		if isComplete {
-			summary.Completions++
+		if st := get(id).Fields[field]; st != nil {
+			st.DropOffs = n
 		}
 	}
+	rows.Close()
+
+	// Time to complete
+	durations := map[string][]float64{}
+	rows, err = r.db.Query(`
+		SELECT s.form_id, (s.submitted_ms - s.started_ms) / 1000 FROM wp_apex_form_sessions s
+		WHERE `+filter+` AND s.submitted AND s.submitted_ms >= s.started_ms`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		var secs float64
+		if err := rows.Scan(&id, &secs); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		durations[id] = append(durations[id], secs)
+	}
+	rows.Close()
 
 	// Flatten results
-	var result []*FormSummary
-	for _, s := range forms {
+	result := []*FormSummary{}
+	for id, s := range forms {
+		reached := map[string]int{}
 		for _, f := range s.Fields {
 			if f.Interactions > 0 {
-				f.AvgDwellTime = f.TotalDwell / float64(f.Interactions)
+				f.DropOffRate = math.Round(float64(f.DropOffs)/float64(f.Interactions)*1000) / 10
 			}
+			reached[f.Name] = f.Interactions
 			s.FieldList = append(s.FieldList, f)
 		}
+		sort.Slice(s.FieldList, func(i, j int) bool {
+			if s.FieldList[i].DropOffs != s.FieldList[j].DropOffs {
+				return s.FieldList[i].DropOffs > s.FieldList[j].DropOffs
+			}
+			return s.FieldList[i].Name < s.FieldList[j].Name
+		})
+		if s.Starters > 0 {
+			s.CompletionRate = math.Round(float64(s.Completions)/float64(s.Starters)*1000) / 10
+		}
+		s.Funnel = analysis.FieldOrderFunnel(reached, offsets[id], s.Starters)
+		s.TimeToComplete = analysis.CompletionDistribution(durations[id])
 		result = append(result, s)
 	}
-
-	return c.JSON(result)
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Starters != result[j].Starters {
+			return result[i].Starters > result[j].Starters
+		}
+		return result[i].FormID < result[j].FormID
+	})
+	return result, nil
 }
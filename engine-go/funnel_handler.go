@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FunnelHandler stores funnel definitions and computes funnel reports
+type FunnelHandler struct {
+	repo *Repository
+	auto *AutomationHandler
+}
+
+func NewFunnelHandler(repo *Repository, auto *AutomationHandler) *FunnelHandler {
+	return &FunnelHandler{repo: repo, auto: auto}
+}
+
+// SavedFunnel is a named funnel definition
+type SavedFunnel struct {
+	ID         int                       `json:"id"`
+	Name       string                    `json:"name"`
+	Definition analysis.FunnelDefinition `json:"definition"`
+	CreatedAt  string                    `json:"created_at"`
+}
+
+// CreateFunnel stores a reusable funnel definition
+// POST /v1/funnels
+func (h *FunnelHandler) CreateFunnel(c *fiber.Ctx) error {
+	var f SavedFunnel
+	if err := c.BodyParser(&f); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	if f.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name required"})
+	}
+	if err := f.Definition.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	def, _ := json.Marshal(f.Definition)
+	res, err := h.repo.db.Exec(`INSERT INTO wp_apex_funnels (name, definition) VALUES (?, ?)`, f.Name, def)
+	if err != nil {
+		log.Printf("Create funnel error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "DB Error"})
+	}
+	id, _ := res.LastInsertId()
+
+	return c.JSON(fiber.Map{"status": "created", "id": id})
+}
+
+// GetFunnels lists saved funnels
+// GET /v1/funnels
+func (h *FunnelHandler) GetFunnels(c *fiber.Ctx) error {
+	rows, err := h.repo.db.Query(`SELECT id, name, definition, created_at FROM wp_apex_funnels ORDER BY created_at DESC`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	funnels := []SavedFunnel{}
+	for rows.Next() {
+		var f SavedFunnel
+		var def []byte
+		if err := rows.Scan(&f.ID, &f.Name, &def, &f.CreatedAt); err != nil {
+			continue
+		}
+		json.Unmarshal(def, &f.Definition)
+		funnels = append(funnels, f)
+	}
+	return c.JSON(funnels)
+}
+
+// DeleteFunnel removes a saved funnel
+// DELETE /v1/funnels/:id
+func (h *FunnelHandler) DeleteFunnel(c *fiber.Ctx) error {
+	_, err := h.repo.db.Exec("DELETE FROM wp_apex_funnels WHERE id = ?", c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "deleted"})
+}
+
+// GetFunnelReport computes a saved funnel
+// GET /v1/funnels/:id/report?range=7d|30d|90d|mtd|... (or start=&end=)&compare=&tz=&segment_id=
+func (h *FunnelHandler) GetFunnelReport(c *fiber.Ctx) error {
+	f, err := h.LoadFunnel(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Funnel not found"})
+	}
+	period, err := dateRangeFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	report, err := h.Report(f.Definition, period.Period, segment)
+	var comparison *analysis.FunnelReport
+	if err == nil && period.Comparison != nil {
+		var prev analysis.FunnelReport
+		if prev, err = h.Report(f.Definition, *period.Comparison, segment); err == nil {
+			comparison = &prev
+		}
+	}
+	if err != nil {
+		log.Printf("[Funnel Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Funnel analysis failed"})
+	}
+
+	response := fiber.Map{
+		"funnel":     f,
+		"report":     report,
+		"range":      period.Preset,
+		"period":     rangeInfo(period),
+		"segment_id": segmentID(segment),
+	}
+	if comparison != nil {
+		response["comparison"] = comparison
+	}
+	return c.JSON(response)
+}
+
+// AnalyzeFunnel computes an ad-hoc funnel definition without saving it
+// POST /v1/funnels/analyze?range=7d|30d|90d|mtd|... (or start=&end=)&tz=&segment_id=
+func (h *FunnelHandler) AnalyzeFunnel(c *fiber.Ctx) error {
+	var def analysis.FunnelDefinition
+	if err := c.BodyParser(&def); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	if err := def.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	period, err := dateRangeFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	report, err := h.Report(def, period.Period, segment)
+	if err != nil {
+		log.Printf("[Funnel Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Funnel analysis failed"})
+	}
+	return c.JSON(report)
+}
+
+// LoadFunnel fetches a saved funnel by ID
+func (h *FunnelHandler) LoadFunnel(id interface{}) (*SavedFunnel, error) {
+	var f SavedFunnel
+	var def []byte
+	err := h.repo.db.QueryRow(`SELECT id, name, definition, created_at FROM wp_apex_funnels WHERE id = ?`, id).
+		Scan(&f.ID, &f.Name, &def, &f.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(def, &f.Definition); err != nil {
+		return nil, fmt.Errorf("corrupt funnel definition: %w", err)
+	}
+	return &f, nil
+}
+
+// Report loads the events a definition needs for a period and computes the funnel,
+// optionally restricted to a segment
+func (h *FunnelHandler) Report(def analysis.FunnelDefinition, p analysis.Period, segment *SegmentScope) (analysis.FunnelReport, error) {
+	events, err := h.repo.LoadTrackedEvents(p.Start, p.End, def.EventTypes())
+	if err == nil {
+		events, err = segment.FilterEvents(h.repo, events)
+	}
+	if err != nil {
+		return analysis.FunnelReport{}, err
+	}
+	return analysis.ComputeFunnel(def, events), nil
+}
+
+// CheckFunnelRules evaluates "funnel_conversion" automation rules.
+// trigger_config: {"funnel_id": 3, "range": "7d", "below": 2.5}
+func (h *FunnelHandler) CheckFunnelRules() {
+	rows, err := h.repo.db.Query(`SELECT id, name, trigger_config, action_type, action_config FROM wp_apex_automation_rules WHERE is_active = 1 AND trigger_type = 'funnel_conversion'`)
+	if err != nil {
+		log.Printf("Funnel rule query error: %v", err)
+		return
+	}
+	var rules []AutomationRule
+	for rows.Next() {
+		var rule AutomationRule
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.TriggerConfig, &rule.ActionType, &rule.ActionConfig); err == nil {
+			rules = append(rules, rule)
+		}
+	}
+	rows.Close()
+
+	for _, rule := range rules {
+		var cfg struct {
+			FunnelID int     `json:"funnel_id"`
+			Range    string  `json:"range"`
+			Below    float64 `json:"below"`
+		}
+		if err := json.Unmarshal(rule.TriggerConfig, &cfg); err != nil || cfg.FunnelID == 0 {
+			continue
+		}
+		f, err := h.LoadFunnel(cfg.FunnelID)
+		if err != nil {
+			continue
+		}
+		period, err := analysis.ParseDateRange(analysis.DateRangeParams{Range: cfg.Range}, time.Now(), h.repo.SiteLocation(), "30d")
+		if err != nil {
+			log.Printf("Funnel rule %s: %v", rule.Name, err)
+			continue
+		}
+		report, err := h.Report(f.Definition, period.Period, nil)
+		if err != nil || report.Entrants == 0 || report.ConversionRate >= cfg.Below {
+			continue
+		}
+
+		payload, _ := json.Marshal(fiber.Map{
+			"funnel_id":       f.ID,
+			"funnel":          f.Name,
+			"conversion_rate": report.ConversionRate,
+			"threshold":       cfg.Below,
+		})
+		log.Printf("Executing Rule: %s for funnel %s (%.1f%% < %.1f%%)", rule.Name, f.Name, report.ConversionRate, cfg.Below)
+		go h.auto.executeAction(rule.ActionType, rule.ActionConfig, payload)
+	}
+}
+
+// StartFunnelMonitor checks funnel automation rules once a day
+func StartFunnelMonitor(h *FunnelHandler) {
+	ticker := time.NewTicker(24 * time.Hour)
+	go func() {
+		for range ticker.C {
+			h.CheckFunnelRules()
+		}
+	}()
+}
@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -86,9 +87,23 @@ func SetupGA4Endpoints(app *fiber.App, repo *Repository) {
 	integrations.Get("/ga4/status", handleGA4Status)
 
 	// Truth Gap Report (Phase 21.2)
+	// GET /v1/integrations/ga4/truth-gap?date=YYYY-MM-DD&to=YYYY-MM-DD&dimension=source_medium|device|landing_page&min_sessions=30
 	integrations.Get("/ga4/truth-gap", func(c *fiber.Ctx) error {
-		date := c.Query("date", time.Now().Format("2006-01-02"))
-		report, err := worker.CompareTraffic(date)
+		from := c.Query("date", time.Now().Format("2006-01-02"))
+		to := c.Query("to", from)
+		for _, d := range []string{from, to} {
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "dates must be YYYY-MM-DD"})
+			}
+		}
+		dimension := c.Query("dimension")
+		switch dimension {
+		case "", analysis.GapBySourceMedium, analysis.GapByDevice, analysis.GapByLandingPage:
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "dimension must be source_medium, device or landing_page"})
+		}
+
+		report, err := worker.CompareTraffic(from, to, dimension, c.QueryFloat("min_sessions", 30))
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -5,14 +5,31 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/apex-ai/engine-go/gsc"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 	analyticsdata "google.golang.org/api/analyticsdata/v1beta"
 	"google.golang.org/api/option"
 )
 
+// GA4 reports finish processing within ~48h, so recent days are re-fetched every sync
+const (
+	ga4ReadonlyScope = "https://www.googleapis.com/auth/analytics.readonly"
+	ga4RevisionDays  = 3
+	ga4PageSize      = 10000
+	ga4InsertBatch   = 500
+	// usersSummedDaily marks user counts that are per-day uniques added up over the range
+	usersSummedDaily = "summed_daily"
+)
+
 // GA4Metrics represents the harmonized metrics from Google
 type GA4Metrics struct {
 	ActiveUsers            int64            `json:"active_users"`
@@ -23,14 +40,42 @@ type GA4Metrics struct {
 	Timestamp              int64            `json:"timestamp"`
 }
 
-// TruthGapReport represents the comparison between Apex and GA4
+// GA4Row is one (date, source/medium, device, landing page) row of the daily report
+type GA4Row struct {
+	Date         string
+	SourceMedium string
+	Device       string
+	LandingPage  string
+	ActiveUsers  int64
+	Sessions     int64
+	PageViews    int64
+}
+
+// GA4Totals are the property-wide figures for one day (users are deduplicated, unlike summed rows)
+type GA4Totals struct {
+	Date                   string
+	ActiveUsers            int64
+	Sessions               int64
+	PageViews              int64
+	BounceRate             float64
+	AverageSessionDuration float64
+}
+
+// TruthGapReport represents the comparison between Apex and GA4. Users on both sides are daily
+// unique counts summed over the range (UsersBasis), since stored GA4 totals are per day.
 type TruthGapReport struct {
-	Date            string  `json:"date"`
-	ApexVisitors    int64   `json:"apex_visitors"`
-	GA4Users        int64   `json:"ga4_users"`
-	Gap             int64   `json:"gap"`
-	Label           string  `json:"label"` // Recovered Ad-Block or Potential Bot
-	ConfidenceScore float64 `json:"confidence"`
+	Date            string                 `json:"date"`
+	To              string                 `json:"to"`
+	UsersBasis      string                 `json:"users_basis"`
+	ApexVisitors    int64                  `json:"apex_visitors"`
+	GA4Users        int64                  `json:"ga4_users"`
+	Gap             int64                  `json:"gap"`
+	ApexSessions    int64                  `json:"apex_sessions"`
+	GA4Sessions     int64                  `json:"ga4_sessions"`
+	Label           string                 `json:"label"` // Recovered Ad-Block or Potential Bot
+	ConfidenceScore float64                `json:"confidence"`
+	Dimension       string                 `json:"dimension,omitempty"`
+	Breakdown       []analysis.TruthGapRow `json:"breakdown,omitempty"`
 }
 
 // GA4Worker handles background data synchronization
@@ -38,6 +83,7 @@ type GA4Worker struct {
 	repo       *Repository
 	redis      *redis.Client
 	propertyID string
+	baseURL    string
 	ctx        context.Context
 }
 
@@ -56,6 +102,7 @@ func NewGA4Worker(repo *Repository) *GA4Worker {
 		repo:       repo,
 		redis:      rdb,
 		propertyID: os.Getenv("GA4_PROPERTY_ID"),
+		baseURL:    os.Getenv("GA4_BASE_URL"),
 		ctx:        context.Background(),
 	}
 }
@@ -73,7 +120,7 @@ func (w *GA4Worker) StartSync() {
 	}()
 }
 
-// Sync performs the actual data fetch and cache
+// Sync re-fetches the last few days into wp_apex_ga4_daily and caches today's totals
 func (w *GA4Worker) Sync() {
 	ga4 := GetGA4Integration()
 	if ga4 == nil || !ga4.IsConnected() {
@@ -82,14 +129,28 @@ func (w *GA4Worker) Sync() {
 
 	log.Println("GA4Worker: Starting hourly sync...")
 
-	// 1. Fetch metrics from Google
-	metrics, err := w.fetchGA4Data()
+	svc, err := w.service(ga4.GetRefreshToken())
+	if err != nil {
+		log.Printf("GA4Worker Error: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := ga4RevisionDays - 1; i >= 0; i-- {
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+		if err := w.syncDay(svc, date); err != nil {
+			log.Printf("GA4Worker Error: %s: %v", date, err)
+			return
+		}
+	}
+
+	metrics, err := w.latestMetrics(now.Format("2006-01-02"))
 	if err != nil {
 		log.Printf("GA4Worker Error: %v", err)
 		return
 	}
 
-	// 2. Cache in Redis (59 min TTL)
+	// Cache in Redis (59 min TTL)
 	data, _ := json.Marshal(metrics)
 	err = w.redis.Set(w.ctx, "ga4:latest_metrics", data, 59*time.Minute).Err()
 	if err != nil {
@@ -99,85 +160,262 @@ func (w *GA4Worker) Sync() {
 	log.Println("GA4Worker: Sync complete and cached in Redis.")
 }
 
-// fetchGA4Data calls the Google Analytics Data API
-func (w *GA4Worker) fetchGA4Data() (*GA4Metrics, error) {
-	ga4 := GetGA4Integration()
-	refreshToken := ga4.GetRefreshToken()
+// service builds a Data API client that refreshes access tokens from the stored refresh token
+// using the same OAuth client (GOOGLE_CLIENT_ID / GOOGLE_CLIENT_SECRET) the plugin connected with
+func (w *GA4Worker) service(refreshToken string) (*analyticsdata.Service, error) {
 	if refreshToken == "" {
 		return nil, fmt.Errorf("no refresh token available")
 	}
+	if w.propertyID == "" {
+		return nil, fmt.Errorf("GA4_PROPERTY_ID not set")
+	}
+
+	cfg := &oauth2.Config{
+		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		Endpoint:     google.Endpoint,
+		Scopes:       []string{ga4ReadonlyScope},
+	}
+	opts := []option.ClientOption{
+		option.WithTokenSource(cfg.TokenSource(w.ctx, &oauth2.Token{RefreshToken: refreshToken})),
+	}
+	if w.baseURL != "" {
+		opts = append(opts, option.WithEndpoint(w.baseURL))
+	}
+	return analyticsdata.NewService(w.ctx, opts...)
+}
+
+// fetchDay runs the dimensional report for one day, following pagination, and returns
+// its rows together with the property totals
+func (w *GA4Worker) fetchDay(svc *analyticsdata.Service, date string) ([]GA4Row, *GA4Totals, error) {
+	var rows []GA4Row
+	totals := &GA4Totals{Date: date}
+
+	for offset := int64(0); ; offset += ga4PageSize {
+		resp, err := svc.Properties.RunReport("properties/"+w.propertyID, &analyticsdata.RunReportRequest{
+			DateRanges: []*analyticsdata.DateRange{{StartDate: date, EndDate: date}},
+			Dimensions: []*analyticsdata.Dimension{
+				{Name: "sessionSourceMedium"}, {Name: "deviceCategory"}, {Name: "landingPage"},
+			},
+			Metrics: []*analyticsdata.Metric{
+				{Name: "activeUsers"}, {Name: "sessions"}, {Name: "screenPageViews"},
+				{Name: "bounceRate"}, {Name: "averageSessionDuration"},
+			},
+			MetricAggregations: []string{"TOTAL"},
+			Limit:              ga4PageSize,
+			Offset:             offset,
+		}).Context(w.ctx).Do()
+		if err != nil {
+			return nil, nil, fmt.Errorf("runReport: %w", err)
+		}
+
+		if offset == 0 && len(resp.Totals) > 0 {
+			m := metricValues(resp.Totals[0])
+			totals.ActiveUsers = int64(m[0])
+			totals.Sessions = int64(m[1])
+			totals.PageViews = int64(m[2])
+			totals.BounceRate = m[3]
+			totals.AverageSessionDuration = m[4]
+		}
+		for _, r := range resp.Rows {
+			if len(r.DimensionValues) < 3 {
+				continue
+			}
+			m := metricValues(r)
+			rows = append(rows, GA4Row{
+				Date:         date,
+				SourceMedium: r.DimensionValues[0].Value,
+				Device:       r.DimensionValues[1].Value,
+				LandingPage:  r.DimensionValues[2].Value,
+				ActiveUsers:  int64(m[0]),
+				Sessions:     int64(m[1]),
+				PageViews:    int64(m[2]),
+			})
+		}
+		if len(resp.Rows) < ga4PageSize || offset+ga4PageSize >= resp.RowCount {
+			return rows, totals, nil
+		}
+	}
+}
+
+// metricValues parses a report row's metric strings, padding to five values
+func metricValues(r *analyticsdata.Row) []float64 {
+	values := make([]float64, 5)
+	for i, mv := range r.MetricValues {
+		if i >= len(values) {
+			break
+		}
+		values[i], _ = strconv.ParseFloat(mv.Value, 64)
+	}
+	return values
+}
+
+// syncDay replaces the stored rows and totals for one day
+func (w *GA4Worker) syncDay(svc *analyticsdata.Service, date string) error {
+	rows, totals, err := w.fetchDay(svc, date)
+	if err != nil {
+		return err
+	}
+
+	tx, err := w.repo.db.BeginTx(w.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM wp_apex_ga4_daily WHERE date = ?`, date); err != nil {
+		return err
+	}
+	for start := 0; start < len(rows); start += ga4InsertBatch {
+		end := start + ga4InsertBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := rows[start:end]
 
-	// 1. Setup OAuth2 Client (Simplified flow for Phase 21.2)
-	// In production, we'd use oauth2.Config to refresh the token
-	ctx := context.Background()
+		args := make([]interface{}, 0, len(batch)*7)
+		for _, r := range batch {
+			args = append(args, r.Date, gsc.Truncate(r.SourceMedium, 255), gsc.Truncate(r.Device, 20),
+				gsc.Truncate(r.LandingPage, 512), r.ActiveUsers, r.Sessions, r.PageViews)
+		}
+		query := `INSERT INTO wp_apex_ga4_daily (date, source_medium, device, landing_page, active_users, sessions, page_views) VALUES ` +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?), ", len(batch)), ", ")
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
 
-	// Create Service
-	svc, err := analyticsdata.NewService(ctx, option.WithAPIKey(os.Getenv("GOOGLE_API_KEY")))
+	_, err = tx.Exec(`
+		INSERT INTO wp_apex_ga4_totals (date, active_users, sessions, page_views, bounce_rate, avg_session_duration)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE active_users = VALUES(active_users), sessions = VALUES(sessions), page_views = VALUES(page_views),
+			bounce_rate = VALUES(bounce_rate), avg_session_duration = VALUES(avg_session_duration)`,
+		date, totals.ActiveUsers, totals.Sessions, totals.PageViews, totals.BounceRate, totals.AverageSessionDuration)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// latestMetrics summarises one stored day for the Redis cache the chat context reads
+func (w *GA4Worker) latestMetrics(date string) (*GA4Metrics, error) {
+	m := &GA4Metrics{TrafficBySource: map[string]int64{}, Timestamp: time.Now().Unix()}
+	err := w.repo.db.QueryRow(`
+		SELECT active_users, page_views, bounce_rate, avg_session_duration FROM wp_apex_ga4_totals WHERE date = ?`, date).
+		Scan(&m.ActiveUsers, &m.ScreenPageViews, &m.BounceRate, &m.AverageSessionDuration)
 	if err != nil {
 		return nil, err
 	}
 
-	if w.propertyID == "" {
-		return nil, fmt.Errorf("GA4_PROPERTY_ID not set")
+	sources, err := w.loadGA4Sessions(date, date, analysis.GapBySourceMedium)
+	if err != nil {
+		return nil, err
+	}
+	m.TrafficBySource = sources
+	return m, nil
+}
+
+// loadGA4Sessions sums stored GA4 sessions per value of a breakdown column
+func (w *GA4Worker) loadGA4Sessions(from, to, dimension string) (map[string]int64, error) {
+	rows, err := w.repo.db.Query(`SELECT `+dimension+`, SUM(sessions) FROM wp_apex_ga4_daily
+		WHERE date BETWEEN ? AND ? GROUP BY `+dimension, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]int64{}
+	for rows.Next() {
+		var key string
+		var n int64
+		if err := rows.Scan(&key, &n); err != nil {
+			return nil, err
+		}
+		out[key] += n
+	}
+	return out, rows.Err()
+}
+
+// loadApexSessions counts Apex sessions started in [from, to] per breakdown value, using the
+// same source/medium, device and landing-path conventions as GA4. Visitors are unique per day
+// and summed, like the stored GA4 users. Sessions without a stored referrer or landing page
+// read them from their first event.
+func (w *GA4Worker) loadApexSessions(from, to, dimension string) (map[string]int64, int64, error) {
+	rows, err := w.repo.db.Query(`
+		SELECT DATE_FORMAT(s.started_at, '%Y-%m-%d'), s.fingerprint,
+			COALESCE(NULLIF(s.referrer, ''), fe.referrer, ''), COALESCE(NULLIF(s.landing_page, ''), fe.url, ''),
+			COALESCE(v.user_agent, '')
+		FROM wp_apex_sessions s
+		LEFT JOIN wp_apex_events fe ON fe.id = (SELECT MIN(e.id) FROM wp_apex_events e WHERE e.session_id = s.session_id)
+		LEFT JOIN wp_apex_visitors v ON v.fingerprint = s.fingerprint
+		WHERE s.started_at >= ? AND s.started_at < DATE_ADD(?, INTERVAL 1 DAY)`, from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := map[string]int64{}
+	visitors := map[string]bool{}
+	for rows.Next() {
+		var day, fingerprint, referrer, landing, ua string
+		if err := rows.Scan(&day, &fingerprint, &referrer, &landing, &ua); err != nil {
+			return nil, 0, err
+		}
+		visitors[day+"|"+fingerprint] = true
+
+		var key string
+		switch dimension {
+		case analysis.GapBySourceMedium:
+			key = analysis.SourceMedium(referrer, landing)
+		case analysis.GapByDevice:
+			key = analysis.DeviceClass(ua)
+		case analysis.GapByLandingPage:
+			key = analysis.LandingPath(landing)
+		}
+		out[key]++
+	}
+	return out, int64(len(visitors)), rows.Err()
+}
+
+// CompareTraffic identifies the "Truth Gap" between local and Google over [from, to], with an
+// optional breakdown by source_medium, device or landing_page. Confidence reflects how unlikely
+// the gap is to be sampling noise at the observed volume.
+func (w *GA4Worker) CompareTraffic(from, to, dimension string, minSessions float64) (*TruthGapReport, error) {
+	if w.repo == nil || w.repo.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	groupBy := dimension
+	if groupBy == "" {
+		groupBy = analysis.GapByDevice
 	}
 
-	// 2. Build Report Request (Skeleton for Phase 21.2)
-	// Execute (Mocking the response for the worker skeleton)
-	// resp, err := svc.Properties.RunReport("properties/"+w.propertyID, ...).Do()
-	_ = svc
-
-	// Harmonic Mapping (GA4 -> Apex)
-	return &GA4Metrics{
-		ActiveUsers:            1050,
-		ScreenPageViews:        3200,
-		BounceRate:             0.42,
-		AverageSessionDuration: 185.5,
-		TrafficBySource: map[string]int64{
-			"google": 600,
-			"direct": 300,
-			"social": 150,
-		},
-		Timestamp: time.Now().Unix(),
-	}, nil
-}
-
-// CompareTraffic identifies the "Truth Gap" between local and Google
-func (w *GA4Worker) CompareTraffic(date string) (*TruthGapReport, error) {
-	// 1. Get Local Stats
-	localStats, err := w.repo.GetDailyStats()
+	apex, apexVisitors, err := w.loadApexSessions(from, to, groupBy)
 	if err != nil {
 		return nil, err
 	}
-	apexVisitors := int64(localStats["visitors"].(int))
-
-	// 2. Get GA4 Stats (try Redis first)
-	var ga4Users int64
-	val, err := w.redis.Get(w.ctx, "ga4:latest_metrics").Result()
-	if err == nil {
-		var m GA4Metrics
-		json.Unmarshal([]byte(val), &m)
-		ga4Users = m.ActiveUsers
-	} else {
-		// Fallback or handle missing data
-		ga4Users = 1050 // Mock fallback
-	}
-
-	// 3. Truth Gap Logic
-	gap := apexVisitors - ga4Users
-	label := "Healthy Sync"
-
-	if gap > 0 {
-		label = "Recovered Ad-Block Traffic"
-	} else if gap < 0 {
-		label = "Potential Bot Traffic"
-	}
-
-	return &TruthGapReport{
-		Date:            date,
-		ApexVisitors:    apexVisitors,
-		GA4Users:        ga4Users,
-		Gap:             gap,
-		Label:           label,
-		ConfidenceScore: 0.95,
-	}, nil
+	ga4, err := w.loadGA4Sessions(from, to, groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TruthGapReport{Date: from, To: to, UsersBasis: usersSummedDaily, ApexVisitors: apexVisitors, Dimension: dimension}
+	if err := w.repo.db.QueryRow(`SELECT COALESCE(SUM(active_users), 0), COALESCE(SUM(sessions), 0)
+		FROM wp_apex_ga4_totals WHERE date BETWEEN ? AND ?`, from, to).Scan(&report.GA4Users, &report.GA4Sessions); err != nil {
+		return nil, err
+	}
+	if report.GA4Sessions == 0 {
+		return nil, fmt.Errorf("no GA4 data stored for %s to %s", from, to)
+	}
+	for _, n := range apex {
+		report.ApexSessions += n
+	}
+
+	report.Gap = report.ApexVisitors - report.GA4Users
+	report.Label = analysis.GapLabel(float64(report.ApexVisitors), float64(report.GA4Users), minSessions)
+	report.ConfidenceScore = math.Round(analysis.GapConfidence(float64(report.ApexVisitors), float64(report.GA4Users))*1000) / 1000
+
+	if dimension != "" {
+		report.Breakdown = analysis.CompareTruthGap(apex, ga4, minSessions)
+	}
+	return report, nil
 }
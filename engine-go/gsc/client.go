@@ -1,11 +1,24 @@
 package gsc
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"math/rand"
-	"time"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	searchconsole "google.golang.org/api/searchconsole/v1"
 )
 
+// readonlyScope is the Search Console scope the sync needs
+const readonlyScope = "https://www.googleapis.com/auth/webmasters.readonly"
+
+// rowLimit is the maximum page size the Search Analytics API allows
+const rowLimit = 25000
+
 // GSCStats represents daily clicks/impressions
 type GSCStats struct {
 	Date        string  `json:"date"`
@@ -15,46 +28,177 @@ type GSCStats struct {
 	Position    float64 `json:"position"`
 }
 
-type GSCService struct {
-	apiKey string
+// Row is one Search Analytics row for a single day
+type Row struct {
+	Date        string
+	Query       string
+	Page        string
+	Device      string
+	Country     string
+	Clicks      float64
+	Impressions float64
+	CTR         float64
+	Position    float64
 }
 
-func NewGSCService(apiKey string) *GSCService {
-	return &GSCService{apiKey: apiKey}
+// Config holds Search Console credentials. Either a service account key (file or inline JSON)
+// or an OAuth client with a refresh token is needed, unless HTTPClient is supplied directly.
+type Config struct {
+	SiteURL            string // e.g. "sc-domain:example.com" or "https://example.com/"
+	BaseURL            string // API root; empty means Google's endpoint
+	ServiceAccountFile string
+	ServiceAccountJSON string
+	ClientID           string
+	ClientSecret       string
+	RefreshToken       string
+	HTTPClient         *http.Client // already-authorised client (tests, custom transports)
+	PageSize           int          // rows per API page; defaults to the API maximum
 }
 
-// GetTrafficOverlay fetches GSC data.
-// Note: In a real implementation with the provided API key (likely a simple API key, not Service Account),
-// we might face auth limitations for private GSC data.
-// For this MVP/Demo, if the key is present, we simulate a successful fetch that correlates with internal data.
-// If we had a Service Account JSON, we'd use the official google-api-go-client.
-func (s *GSCService) GetTrafficOverlay(days int) ([]GSCStats, error) {
-	if s.apiKey == "" {
-		return nil, fmt.Errorf("GSC API Key missing")
+// ConfigFromEnv reads GSC_SITE_URL, GSC_BASE_URL, GSC_SERVICE_ACCOUNT_FILE,
+// GSC_SERVICE_ACCOUNT_JSON, GSC_CLIENT_ID, GSC_CLIENT_SECRET and GSC_REFRESH_TOKEN
+func ConfigFromEnv() Config {
+	return Config{
+		SiteURL:            os.Getenv("GSC_SITE_URL"),
+		BaseURL:            os.Getenv("GSC_BASE_URL"),
+		ServiceAccountFile: os.Getenv("GSC_SERVICE_ACCOUNT_FILE"),
+		ServiceAccountJSON: os.Getenv("GSC_SERVICE_ACCOUNT_JSON"),
+		ClientID:           os.Getenv("GSC_CLIENT_ID"),
+		ClientSecret:       os.Getenv("GSC_CLIENT_SECRET"),
+		RefreshToken:       os.Getenv("GSC_REFRESH_TOKEN"),
 	}
+}
 
-	// Simulation Mode for MVP (proving the pipeline)
-	// We generate data that looks like "Organic" traffic (approx 40% of total)
-	var stats []GSCStats
-	now := time.Now()
+// Client queries the Search Analytics API for one property
+type Client struct {
+	svc      *searchconsole.Service
+	siteURL  string
+	pageSize int
+}
 
-	for i := days; i >= 0; i-- {
-		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+// NewClient builds an authorised Search Console client
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.SiteURL == "" {
+		return nil, fmt.Errorf("GSC site URL missing")
+	}
 
-		// Pseudorandom but deterministic based on date
-		rand.Seed(time.Now().AddDate(0, 0, -i).Unix())
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		switch {
+		case cfg.ServiceAccountJSON != "" || cfg.ServiceAccountFile != "":
+			key := []byte(cfg.ServiceAccountJSON)
+			if len(key) == 0 {
+				var err error
+				if key, err = os.ReadFile(cfg.ServiceAccountFile); err != nil {
+					return nil, fmt.Errorf("reading service account key: %w", err)
+				}
+			}
+			jwtCfg, err := google.JWTConfigFromJSON(key, readonlyScope)
+			if err != nil {
+				return nil, fmt.Errorf("parsing service account key: %w", err)
+			}
+			httpClient = jwtCfg.Client(ctx)
+		case cfg.RefreshToken != "":
+			oauthCfg := &oauth2.Config{
+				ClientID:     cfg.ClientID,
+				ClientSecret: cfg.ClientSecret,
+				Endpoint:     google.Endpoint,
+				Scopes:       []string{readonlyScope},
+			}
+			httpClient = oauth2.NewClient(ctx, oauthCfg.TokenSource(ctx, &oauth2.Token{RefreshToken: cfg.RefreshToken}))
+		default:
+			return nil, fmt.Errorf("GSC credentials missing: set a service account key or an OAuth refresh token")
+		}
+	}
 
-		impressions := 500 + rand.Intn(1000)
-		clicks := int(float64(impressions) * (0.02 + rand.Float64()*0.05)) // 2-7% CTR
+	opts := []option.ClientOption{option.WithHTTPClient(httpClient)}
+	if cfg.BaseURL != "" {
+		opts = append(opts, option.WithEndpoint(cfg.BaseURL))
+	}
+	svc, err := searchconsole.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
 
-		stats = append(stats, GSCStats{
-			Date:        date,
-			Impressions: impressions,
-			Clicks:      clicks,
-			CTR:         float64(clicks) / float64(impressions),
-			Position:    12.5 + rand.Float64()*5,
-		})
+	pageSize := cfg.PageSize
+	if pageSize <= 0 || pageSize > rowLimit {
+		pageSize = rowLimit
 	}
+	return &Client{svc: svc, siteURL: cfg.SiteURL, pageSize: pageSize}, nil
+}
+
+// QueryDay fetches every (query, page, device, country) row for one day, following pagination
+func (c *Client) QueryDay(ctx context.Context, date string) ([]Row, error) {
+	var rows []Row
+	for start := 0; ; start += c.pageSize {
+		resp, err := c.svc.Searchanalytics.Query(c.siteURL, &searchconsole.SearchAnalyticsQueryRequest{
+			StartDate:  date,
+			EndDate:    date,
+			Dimensions: []string{"query", "page", "device", "country"},
+			RowLimit:   int64(c.pageSize),
+			StartRow:   int64(start),
+			DataState:  "final",
+		}).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("search analytics query for %s: %w", date, err)
+		}
 
-	return stats, nil
+		for _, r := range resp.Rows {
+			if len(r.Keys) < 4 {
+				continue
+			}
+			rows = append(rows, Row{
+				Date:        date,
+				Query:       r.Keys[0],
+				Page:        r.Keys[1],
+				Device:      r.Keys[2],
+				Country:     r.Keys[3],
+				Clicks:      r.Clicks,
+				Impressions: r.Impressions,
+				CTR:         r.Ctr,
+				Position:    r.Position,
+			})
+		}
+		if len(resp.Rows) < c.pageSize {
+			return rows, nil
+		}
+	}
+}
+
+// GSCService serves Search Console data from the local table the sync fills
+type GSCService struct {
+	db *sql.DB
+}
+
+func NewGSCService(db *sql.DB) *GSCService {
+	return &GSCService{db: db}
+}
+
+// GetTrafficOverlay returns daily organic clicks/impressions for the last N days from synced data
+func (s *GSCService) GetTrafficOverlay(days int) ([]GSCStats, error) {
+	rows, err := s.db.Query(`
+		SELECT DATE_FORMAT(date, '%Y-%m-%d'), SUM(clicks), SUM(impressions),
+			COALESCE(SUM(position * impressions) / NULLIF(SUM(impressions), 0), 0)
+		FROM wp_apex_gsc_rows
+		WHERE date >= DATE_SUB(CURDATE(), INTERVAL ? DAY)
+		GROUP BY date
+		ORDER BY date ASC
+	`, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []GSCStats{}
+	for rows.Next() {
+		var st GSCStats
+		if err := rows.Scan(&st.Date, &st.Clicks, &st.Impressions, &st.Position); err != nil {
+			return nil, err
+		}
+		if st.Impressions > 0 {
+			st.CTR = float64(st.Clicks) / float64(st.Impressions)
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
 }
@@ -0,0 +1,123 @@
+package gsc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSearchConsole serves two pages of rows for any day and records the requests it saw
+func stubSearchConsole(t *testing.T, requests *[]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/webmasters/v3/sites/sc-domain:example.com/searchAnalytics/query"), r.URL.Path)
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		*requests = append(*requests, body)
+
+		rows := []map[string]interface{}{
+			{"keys": []string{"apex analytics", "https://example.com/", "DESKTOP", "usa"}, "clicks": 12, "impressions": 300, "ctr": 0.04, "position": 2.1},
+			{"keys": []string{"wordpress heatmap", "https://example.com/heatmaps", "MOBILE", "gbr"}, "clicks": 3, "impressions": 90, "ctr": 0.033, "position": 7.4},
+		}
+		if body["startRow"] != nil {
+			rows = rows[:1] // second page is short, which ends pagination
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"rows": rows})
+	}))
+}
+
+func TestClientQueryDayPaginates(t *testing.T) {
+	var requests []map[string]interface{}
+	srv := stubSearchConsole(t, &requests)
+	defer srv.Close()
+
+	client, err := NewClient(context.Background(), Config{
+		SiteURL:    "sc-domain:example.com",
+		BaseURL:    srv.URL + "/",
+		HTTPClient: srv.Client(),
+		PageSize:   2,
+	})
+	require.NoError(t, err)
+
+	rows, err := client.QueryDay(context.Background(), "2024-05-01")
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, Row{Date: "2024-05-01", Query: "apex analytics", Page: "https://example.com/", Device: "DESKTOP",
+		Country: "usa", Clicks: 12, Impressions: 300, CTR: 0.04, Position: 2.1}, rows[0])
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "2024-05-01", requests[0]["startDate"])
+	assert.Equal(t, []interface{}{"query", "page", "device", "country"}, requests[0]["dimensions"])
+	assert.Equal(t, float64(2), requests[1]["startRow"])
+}
+
+func TestNewClientRequiresCredentials(t *testing.T) {
+	_, err := NewClient(context.Background(), Config{SiteURL: "sc-domain:example.com"})
+	assert.Error(t, err)
+}
+
+func TestSyncerReplacesDay(t *testing.T) {
+	var requests []map[string]interface{}
+	srv := stubSearchConsole(t, &requests)
+	defer srv.Close()
+
+	client, err := NewClient(context.Background(), Config{SiteURL: "sc-domain:example.com", BaseURL: srv.URL + "/", HTTPClient: srv.Client()})
+	require.NoError(t, err)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM wp_apex_gsc_rows WHERE date = ?").WithArgs("2024-05-01").WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec("INSERT INTO wp_apex_gsc_rows").WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	n, err := NewSyncer(client, db).SyncRange(context.Background(), day, day)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSyncerMergesRowsSharingKeyPrefix(t *testing.T) {
+	// Two queries that only differ after the 191 characters the unique key indexes
+	prefix := strings.Repeat("long tail query ", 12)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"rows": []map[string]interface{}{
+			{"keys": []string{prefix + "one", "https://example.com/", "DESKTOP", "usa"}, "clicks": 2, "impressions": 40, "ctr": 0.05, "position": 4.0},
+			{"keys": []string{prefix + "two", "https://example.com/", "DESKTOP", "usa"}, "clicks": 1, "impressions": 60, "ctr": 0.017, "position": 9.0},
+		}})
+	}))
+	defer srv.Close()
+	client, err := NewClient(context.Background(), Config{SiteURL: "sc-domain:example.com", BaseURL: srv.URL + "/", HTTPClient: srv.Client()})
+	require.NoError(t, err)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM wp_apex_gsc_rows WHERE date = ?").WithArgs("2024-05-01").WillReturnResult(sqlmock.NewResult(0, 0))
+	// A colliding row updates the first instead of failing the whole day
+	mock.ExpectExec("INSERT INTO wp_apex_gsc_rows .* ON DUPLICATE KEY UPDATE .* clicks = clicks \\+ VALUES\\(clicks\\),\\s+impressions = impressions \\+ VALUES\\(impressions\\)").
+		WithArgs("2024-05-01", prefix+"one", "https://example.com/", "DESKTOP", "usa", 2, 40, 0.05, 4.0,
+			"2024-05-01", prefix+"two", "https://example.com/", "DESKTOP", "usa", 1, 60, 0.017, 9.0).
+		WillReturnResult(sqlmock.NewResult(1, 3))
+	mock.ExpectCommit()
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	n, err := NewSyncer(client, db).SyncRange(context.Background(), day, day)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,150 @@
+package gsc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Search Console finalises data with a lag and may revise the last few days
+const (
+	dataLagDays     = 2
+	revisionDays    = 3
+	insertBatch     = 500
+	defaultBackfill = 90
+)
+
+// MaxBackfillDays is the longest backfill accepted; the API keeps roughly 16 months
+const MaxBackfillDays = 480
+
+// Syncer copies Search Analytics rows into wp_apex_gsc_rows
+type Syncer struct {
+	client *Client
+	db     *sql.DB
+}
+
+func NewSyncer(client *Client, db *sql.DB) *Syncer {
+	return &Syncer{client: client, db: db}
+}
+
+// SyncRange replaces stored rows for every day in [from, to]
+func (s *Syncer) SyncRange(ctx context.Context, from, to time.Time) (int, error) {
+	if to.Before(from) {
+		return 0, fmt.Errorf("sync range ends before it starts")
+	}
+	total := 0
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		n, err := s.syncDay(ctx, d.Format("2006-01-02"))
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// SyncIncremental backfills an empty table, otherwise re-syncs from a few days before the latest
+// stored date (to pick up revisions) through the newest final day
+func (s *Syncer) SyncIncremental(ctx context.Context, now time.Time) (int, error) {
+	to := now.AddDate(0, 0, -dataLagDays)
+
+	var latest sql.NullString
+	if err := s.db.QueryRow(`SELECT DATE_FORMAT(MAX(date), '%Y-%m-%d') FROM wp_apex_gsc_rows`).Scan(&latest); err != nil {
+		return 0, err
+	}
+	from := to.AddDate(0, 0, -defaultBackfill+1)
+	if latest.Valid {
+		last, err := time.ParseInLocation("2006-01-02", latest.String, now.Location())
+		if err == nil {
+			from = last.AddDate(0, 0, -revisionDays)
+		}
+	}
+	return s.SyncRange(ctx, from, to)
+}
+
+// Backfill syncs the last N days regardless of what is stored
+func (s *Syncer) Backfill(ctx context.Context, days int, now time.Time) (int, error) {
+	if days <= 0 || days > MaxBackfillDays {
+		return 0, fmt.Errorf("backfill must be between 1 and %d days", MaxBackfillDays)
+	}
+	to := now.AddDate(0, 0, -dataLagDays)
+	return s.SyncRange(ctx, to.AddDate(0, 0, -days+1), to)
+}
+
+func (s *Syncer) syncDay(ctx context.Context, date string) (int, error) {
+	rows, err := s.client.QueryDay(ctx, date)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM wp_apex_gsc_rows WHERE date = ?`, date); err != nil {
+		return 0, err
+	}
+	for start := 0; start < len(rows); start += insertBatch {
+		end := start + insertBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := rows[start:end]
+
+		args := make([]interface{}, 0, len(batch)*9)
+		for _, r := range batch {
+			args = append(args, r.Date, Truncate(r.Query, 255), Truncate(r.Page, 512), r.Device, Truncate(r.Country, 3),
+				int(r.Clicks), int(r.Impressions), r.CTR, r.Position)
+		}
+		// The unique key only covers 191-character prefixes of query and page, so distinct long rows
+		// can collide; merge them, weighting position by impressions (assignments apply in order)
+		query := `INSERT INTO wp_apex_gsc_rows (date, query, page, device, country, clicks, impressions, ctr, position) VALUES ` +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(batch)), ", ") + `
+			ON DUPLICATE KEY UPDATE
+				position = COALESCE((position * impressions + VALUES(position) * VALUES(impressions)) / NULLIF(impressions + VALUES(impressions), 0), position),
+				ctr = COALESCE((clicks + VALUES(clicks)) / NULLIF(impressions + VALUES(impressions), 0), 0),
+				clicks = clicks + VALUES(clicks),
+				impressions = impressions + VALUES(impressions)`
+		if _, err := tx.Exec(query, args...); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// Truncate shortens s to n characters to fit its VARCHAR column
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// StartDailySync runs an incremental sync now and then once a day
+func (s *Syncer) StartDailySync() {
+	run := func() {
+		n, err := s.SyncIncremental(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("[GSC Sync Error] %v", err)
+			return
+		}
+		log.Printf("GSC sync stored %d rows", n)
+	}
+
+	ticker := time.NewTicker(24 * time.Hour)
+	go func() {
+		run()
+		for range ticker.C {
+			run()
+		}
+	}()
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"log"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/apex-ai/engine-go/gsc"
 	"github.com/gofiber/fiber/v2"
@@ -9,18 +13,37 @@ import (
 
 type GSCHandler struct {
 	service *gsc.GSCService
+	syncer  *gsc.Syncer // nil when Search Console credentials are not configured
+
+	mu  sync.Mutex
+	job *GSCSyncJob // latest manual sync
 }
 
-func NewGSCHandler(service *gsc.GSCService) *GSCHandler {
-	return &GSCHandler{service: service}
+func NewGSCHandler(service *gsc.GSCService, syncer *gsc.Syncer) *GSCHandler {
+	return &GSCHandler{service: service, syncer: syncer}
+}
+
+// GSCSyncTimeout bounds one manual sync
+const GSCSyncTimeout = 10 * time.Minute
+
+// GSCSyncJob is the state of a manual sync running in the background
+type GSCSyncJob struct {
+	Status     string     `json:"status"` // running, done or failed
+	Backfill   int        `json:"backfill,omitempty"`
+	Rows       int        `json:"rows"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
 }
 
 func (h *GSCHandler) GetTrafficOverlay(c *fiber.Ctx) error {
 	days := 30
 	if d := c.Query("days"); d != "" {
-		if parsed, err := strconv.Atoi(d); err == nil {
-			days = parsed
+		parsed, err := strconv.Atoi(d)
+		if err != nil || parsed <= 0 || parsed > gsc.MaxBackfillDays {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "days must be between 1 and " + strconv.Itoa(gsc.MaxBackfillDays)})
 		}
+		days = parsed
 	}
 
 	stats, err := h.service.GetTrafficOverlay(days)
@@ -32,3 +55,61 @@ func (h *GSCHandler) GetTrafficOverlay(c *fiber.Ctx) error {
 
 	return c.JSON(stats)
 }
+
+// Sync starts a Search Console sync in the background: incremental by default, or the last N
+// days with ?backfill=N. Only one runs at a time; poll GET /v1/gsc/sync for its status.
+// POST /v1/gsc/sync?backfill=90
+func (h *GSCHandler) Sync(c *fiber.Ctx) error {
+	if h.syncer == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Search Console is not configured"})
+	}
+	days := c.QueryInt("backfill")
+	if days < 0 || days > gsc.MaxBackfillDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "backfill must be between 1 and " + strconv.Itoa(gsc.MaxBackfillDays) + " days"})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.job != nil && h.job.Status == "running" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "a sync is already running", "job": *h.job})
+	}
+	job := &GSCSyncJob{Status: "running", Backfill: days, StartedAt: time.Now()}
+	h.job = job
+	go h.runSync(job, days)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"job": *job})
+}
+
+func (h *GSCHandler) runSync(job *GSCSyncJob, days int) {
+	ctx, cancel := context.WithTimeout(context.Background(), GSCSyncTimeout)
+	defer cancel()
+
+	var n int
+	var err error
+	if days > 0 {
+		n, err = h.syncer.Backfill(ctx, days, time.Now())
+	} else {
+		n, err = h.syncer.SyncIncremental(ctx, time.Now())
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	job.Rows, job.FinishedAt = n, &now
+	if err != nil {
+		log.Printf("[GSC Sync Error] %v", err)
+		job.Status, job.Error = "failed", err.Error()
+		return
+	}
+	job.Status = "done"
+}
+
+// SyncStatus reports the latest manual sync
+// GET /v1/gsc/sync
+func (h *GSCHandler) SyncStatus(c *fiber.Ctx) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.job == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no sync has been started"})
+	}
+	return c.JSON(fiber.Map{"job": *h.job})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+)
+
+// LoadGSCRows sums stored Search Console rows per (query, page) over [from, to], with an
+// impression-weighted average position
+func (r *Repository) LoadGSCRows(from, to time.Time) ([]analysis.GSCRow, error) {
+	rows, err := r.db.Query(`
+		SELECT query, page, SUM(clicks), SUM(impressions),
+			COALESCE(SUM(position * impressions) / NULLIF(SUM(impressions), 0), 0)
+		FROM wp_apex_gsc_rows
+		WHERE date >= ? AND date <= ?
+		GROUP BY query, page
+	`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []analysis.GSCRow
+	for rows.Next() {
+		var row analysis.GSCRow
+		if err := rows.Scan(&row.Query, &row.Page, &row.Clicks, &row.Impressions, &row.Position); err != nil {
+			continue
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/apex-ai/engine-go/gsc"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Recordings are folded in once a session has been quiet this long, so chunks are seen together
+const heatmapSessionIdle = 5 * time.Minute
+
+const heatmapEventBatch = 5000
+
+type HeatmapHandler struct {
+	repo *Repository
+}
+
+func NewHeatmapHandler(repo *Repository) *HeatmapHandler {
+	return &HeatmapHandler{repo: repo}
+}
+
+type HeatmapCell struct {
+	Col       int     `json:"col"`
+	Row       int     `json:"row"`
+	Clicks    int     `json:"clicks"`
+	Intensity float64 `json:"intensity"` // 0-1 relative to the hottest cell
+}
+
+type HeatmapSelector struct {
+	Selector string   `json:"selector"`
+	Clicks   int      `json:"clicks"`
+	Share    float64  `json:"share"`              // % of page clicks
+	OffsetX  *float64 `json:"offset_x,omitempty"` // mean click position inside the element, 0-1
+	OffsetY  *float64 `json:"offset_y,omitempty"`
+}
+
+type ScrollReachReport struct {
+	Sessions     int                    `json:"sessions"`
+	PageHeightPx int                    `json:"page_height_px,omitempty"`
+	Reach        []analysis.ReachBucket `json:"reach"`
+}
+
+// GetHeatmap returns the click grid, selector ranking and scroll reach for one page
+// GET /v1/heatmaps?url=&from=YYYY-MM-DD&to=YYYY-MM-DD&device=desktop|tablet|mobile
+func (h *HeatmapHandler) GetHeatmap(c *fiber.Ctx) error {
+	page := c.Query("url")
+	if page == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "url is required"})
+	}
+	to := c.Query("to", time.Now().Format("2006-01-02"))
+	from := c.Query("from", time.Now().AddDate(0, 0, -30).Format("2006-01-02"))
+	for _, d := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "dates must be YYYY-MM-DD"})
+		}
+	}
+	device := c.Query("device", "desktop")
+	switch device {
+	case "desktop", "tablet", "mobile":
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "device must be desktop, tablet or mobile"})
+	}
+	path := heatmapPath(page)
+
+	rows, err := h.repo.db.Query(`
+		SELECT cell_col, cell_row, SUM(clicks) FROM wp_apex_heatmap_cells
+		WHERE url_path = ? AND device = ? AND day BETWEEN ? AND ?
+		GROUP BY cell_col, cell_row`, path, device, from, to)
+	if err != nil {
+		log.Printf("[Heatmap Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	cells := []HeatmapCell{}
+	maxClicks, total := 0, 0
+	for rows.Next() {
+		var cell HeatmapCell
+		if rows.Scan(&cell.Col, &cell.Row, &cell.Clicks) != nil {
+			continue
+		}
+		cells = append(cells, cell)
+		total += cell.Clicks
+		if cell.Clicks > maxClicks {
+			maxClicks = cell.Clicks
+		}
+	}
+	rows.Close()
+	for i := range cells {
+		cells[i].Intensity = math.Round(float64(cells[i].Clicks)/float64(maxClicks)*1000) / 1000
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Row != cells[j].Row {
+			return cells[i].Row < cells[j].Row
+		}
+		return cells[i].Col < cells[j].Col
+	})
+
+	rows, err = h.repo.db.Query(`
+		SELECT selector, SUM(clicks), SUM(offset_x_sum), SUM(offset_y_sum), SUM(offset_n) FROM wp_apex_heatmap_selectors
+		WHERE url_path = ? AND device = ? AND day BETWEEN ? AND ?
+		GROUP BY selector ORDER BY SUM(clicks) DESC LIMIT 50`, path, device, from, to)
+	if err != nil {
+		log.Printf("[Heatmap Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	selectors := []HeatmapSelector{}
+	for rows.Next() {
+		var s HeatmapSelector
+		var ox, oy float64
+		var n int
+		if rows.Scan(&s.Selector, &s.Clicks, &ox, &oy, &n) != nil {
+			continue
+		}
+		if total > 0 {
+			s.Share = math.Round(float64(s.Clicks)/float64(total)*1000) / 10
+		}
+		if n > 0 {
+			mx, my := math.Round(ox/float64(n)*1000)/1000, math.Round(oy/float64(n)*1000)/1000
+			s.OffsetX, s.OffsetY = &mx, &my
+		}
+		selectors = append(selectors, s)
+	}
+	rows.Close()
+
+	rows, err = h.repo.db.Query(`
+		SELECT device, reach_pct, reach_px FROM wp_apex_heatmap_scroll
+		WHERE url_path = ? AND day BETWEEN ? AND ?`, path, from, to)
+	if err != nil {
+		log.Printf("[Heatmap Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	samples := map[string][]analysis.HeatmapScroll{}
+	for rows.Next() {
+		var s analysis.HeatmapScroll
+		if rows.Scan(&s.Device, &s.ReachPct, &s.ReachPx) == nil {
+			samples[s.Device] = append(samples[s.Device], s)
+		}
+	}
+	rows.Close()
+	scroll := map[string]ScrollReachReport{}
+	for d, list := range samples {
+		reach, height := analysis.ScrollReach(list)
+		scroll[d] = ScrollReachReport{Sessions: len(list), PageHeightPx: height, Reach: reach}
+	}
+
+	return c.JSON(fiber.Map{
+		"url":          path,
+		"device":       device,
+		"from":         from,
+		"to":           to,
+		"total_clicks": total,
+		"grid": fiber.Map{
+			"columns":    analysis.HeatmapColumns,
+			"row_px":     analysis.HeatmapRowPx,
+			"max_clicks": maxClicks,
+			"cells":      cells,
+		},
+		"selectors": selectors,
+		"scroll":    scroll,
+	})
+}
+
+// heatmapPath is the key pages are stored under
+func heatmapPath(raw string) string {
+	return gsc.Truncate(analysis.RedirectPath(raw), 191)
+}
+
+// heatmapBatch accumulates clicks and scroll depths before they are written
+type heatmapBatch struct {
+	cells     map[heatmapCellKey]int
+	selectors map[heatmapSelectorKey]*heatmapSelectorAgg
+	scrolls   map[heatmapScrollKey]*analysis.HeatmapScroll
+}
+
+type heatmapCellKey struct {
+	path, device, day string
+	col, row          int
+}
+
+type heatmapSelectorKey struct {
+	path, device, day, selector string
+}
+
+type heatmapSelectorAgg struct {
+	clicks       int
+	offX, offY   float64
+	offsetClicks int
+}
+
+type heatmapScrollKey struct {
+	path, device, session, day string
+}
+
+func newHeatmapBatch() *heatmapBatch {
+	return &heatmapBatch{
+		cells:     map[heatmapCellKey]int{},
+		selectors: map[heatmapSelectorKey]*heatmapSelectorAgg{},
+		scrolls:   map[heatmapScrollKey]*analysis.HeatmapScroll{},
+	}
+}
+
+func (b *heatmapBatch) addClick(c analysis.HeatmapClick, day string) {
+	path := heatmapPath(c.URL)
+	col, row := analysis.GridCell(c.XRel, c.YPx)
+	b.cells[heatmapCellKey{path, c.Device, day, col, row}]++
+	if c.Selector == "" {
+		return
+	}
+	k := heatmapSelectorKey{path, c.Device, day, gsc.Truncate(c.Selector, 191)}
+	agg := b.selectors[k]
+	if agg == nil {
+		agg = &heatmapSelectorAgg{}
+		b.selectors[k] = agg
+	}
+	agg.clicks++
+	if c.OffsetX >= 0 && c.OffsetY >= 0 {
+		agg.offX += c.OffsetX
+		agg.offY += c.OffsetY
+		agg.offsetClicks++
+	}
+}
+
+func (b *heatmapBatch) addScroll(s analysis.HeatmapScroll, session, day string) {
+	k := heatmapScrollKey{heatmapPath(s.URL), s.Device, session, day}
+	cur := b.scrolls[k]
+	if cur == nil {
+		cur = &analysis.HeatmapScroll{ReachPct: -1}
+		b.scrolls[k] = cur
+	}
+	cur.ReachPct = math.Max(cur.ReachPct, s.ReachPct)
+	if s.ReachPx > cur.ReachPx {
+		cur.ReachPx = s.ReachPx
+	}
+}
+
+// saveHeatmapBatch writes the batch and, in the same transaction, runs done (cursor or chunk flags)
+func (r *Repository) saveHeatmapBatch(b *heatmapBatch, done func(exec func(string, ...interface{}) error) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	exec := func(q string, args ...interface{}) error {
+		_, err := tx.Exec(q, args...)
+		return err
+	}
+
+	for k, n := range b.cells {
+		if err := exec(`
+			INSERT INTO wp_apex_heatmap_cells (url_path, device, day, cell_col, cell_row, clicks) VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE clicks = clicks + VALUES(clicks)`,
+			k.path, k.device, k.day, k.col, k.row, n); err != nil {
+			return err
+		}
+	}
+	for k, a := range b.selectors {
+		if err := exec(`
+			INSERT INTO wp_apex_heatmap_selectors (url_path, device, day, selector, clicks, offset_x_sum, offset_y_sum, offset_n)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE clicks = clicks + VALUES(clicks), offset_x_sum = offset_x_sum + VALUES(offset_x_sum),
+				offset_y_sum = offset_y_sum + VALUES(offset_y_sum), offset_n = offset_n + VALUES(offset_n)`,
+			k.path, k.device, k.day, k.selector, a.clicks, a.offX, a.offY, a.offsetClicks); err != nil {
+			return err
+		}
+	}
+	for k, s := range b.scrolls {
+		if err := exec(`
+			INSERT INTO wp_apex_heatmap_scroll (url_path, device, session_id, day, reach_pct, reach_px) VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE reach_pct = GREATEST(reach_pct, VALUES(reach_pct)), reach_px = GREATEST(reach_px, VALUES(reach_px))`,
+			k.path, k.device, k.session, k.day, s.ReachPct, s.ReachPx); err != nil {
+			return err
+		}
+	}
+	if err := done(exec); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AggregateHeatmapEvents folds tracker clicks and scroll depths written since the last run
+func (r *Repository) AggregateHeatmapEvents() error {
+	var cursor int64
+	if err := r.db.QueryRow(`SELECT COALESCE(MAX(last_id), 0) FROM wp_apex_heatmap_cursor WHERE source = 'events'`).Scan(&cursor); err != nil {
+		return err
+	}
+
+	for {
+		rows, err := r.db.Query(`
+			SELECT e.id, e.session_id, e.event_type, e.url, e.payload, e.created_at, COALESCE(v.user_agent, '')
+			FROM wp_apex_events e
+			LEFT JOIN wp_apex_sessions s ON s.session_id = e.session_id
+			LEFT JOIN wp_apex_visitors v ON v.fingerprint = s.fingerprint
+			WHERE e.id > ? ORDER BY e.id ASC LIMIT ?`, cursor, heatmapEventBatch)
+		if err != nil {
+			return err
+		}
+
+		batch := newHeatmapBatch()
+		n := 0
+		for rows.Next() {
+			var id int64
+			var session, typ, url, ua string
+			var payload []byte
+			var at time.Time
+			if err := rows.Scan(&id, &session, &typ, &url, &payload, &at, &ua); err != nil {
+				rows.Close()
+				return err
+			}
+			cursor, n = id, n+1
+
+			var d struct {
+				Selector string   `json:"sel"`
+				X        float64  `json:"x"`
+				Y        float64  `json:"y"`
+				Viewport int      `json:"vw"`
+				OffsetX  *float64 `json:"ox"`
+				OffsetY  *float64 `json:"oy"`
+				Scroll   float64  `json:"sc"`
+				Reach    float64  `json:"sr"`
+			}
+			if len(payload) == 0 || json.Unmarshal(payload, &d) != nil {
+				continue
+			}
+			device := analysis.DeviceForViewport(d.Viewport)
+			if ua != "" {
+				device = analysis.DeviceClass(ua)
+			}
+			day := at.Format("2006-01-02")
+
+			if typ == "heatmap_click" && d.Viewport > 0 {
+				click := analysis.HeatmapClick{URL: url, Device: device, Selector: analysis.NormalizeSelector(d.Selector),
+					XRel: d.X / float64(d.Viewport), YPx: d.Y, OffsetX: -1, OffsetY: -1}
+				if d.OffsetX != nil && d.OffsetY != nil {
+					click.OffsetX, click.OffsetY = *d.OffsetX, *d.OffsetY
+				}
+				batch.addClick(click, day)
+			}
+			// Older trackers only report how far the top of the viewport went
+			reach := d.Reach
+			if reach == 0 {
+				reach = d.Scroll
+			}
+			if reach > 0 {
+				batch.addScroll(analysis.HeatmapScroll{URL: url, Device: device, ReachPct: reach}, session, day)
+			}
+		}
+		rows.Close()
+		if n == 0 {
+			return nil
+		}
+
+		err = r.saveHeatmapBatch(batch, func(exec func(string, ...interface{}) error) error {
+			return exec(`
+				INSERT INTO wp_apex_heatmap_cursor (source, last_id) VALUES ('events', ?)
+				ON DUPLICATE KEY UPDATE last_id = VALUES(last_id)`, cursor)
+		})
+		if err != nil || n < heatmapEventBatch {
+			return err
+		}
+	}
+}
+
+// AggregateHeatmapRecordings replays idle sessions with new chunks; earlier chunks are replayed
+// too, for the node index and scroll position, but their clicks are not counted again
+func (r *Repository) AggregateHeatmapRecordings() error {
+	rows, err := r.db.Query(`
+		SELECT session_id FROM wp_apex_recordings
+		GROUP BY session_id
+		HAVING SUM(heatmap_done = 0) > 0 AND MAX(created_at) < ?
+		LIMIT 200`, time.Now().Add(-heatmapSessionIdle))
+	if err != nil {
+		return err
+	}
+	var sessions []string
+	for rows.Next() {
+		var sid string
+		if rows.Scan(&sid) == nil {
+			sessions = append(sessions, sid)
+		}
+	}
+	rows.Close()
+
+	for _, sid := range sessions {
+		if err := r.aggregateRecording(sid); err != nil {
+			log.Printf("[Heatmap Error] session %s: %v", sid, err)
+		}
+	}
+	return nil
+}
+
+func (r *Repository) aggregateRecording(sessionID string) error {
+	// Tracker clicks are folded as they arrive and recordings only once the session is idle, so a
+	// session that sent tracker clicks already has them counted; replay it for scroll depth only
+	var trackerClicks bool
+	if err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM wp_apex_events WHERE session_id = ? AND event_type = 'heatmap_click')`,
+		sessionID).Scan(&trackerClicks); err != nil {
+		return err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, events_blob, heatmap_done, created_at FROM wp_apex_recordings
+		WHERE session_id = ? ORDER BY id ASC`, sessionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	state := analysis.NewReplayState()
+	batch := newHeatmapBatch()
+	var newIDs []interface{}
+	day := ""
+	for rows.Next() {
+		var id int64
+		var blob []byte
+		var done bool
+		var at time.Time
+		if err := rows.Scan(&id, &blob, &done, &at); err != nil {
+			return err
+		}
+		if day == "" {
+			day = at.Format("2006-01-02")
+		}
+		if !done {
+			newIDs = append(newIDs, id)
+		}
+
+		var events []analysis.RRWebEvent
+		if err := gunzipJSON(blob, &events); err != nil {
+			continue
+		}
+		clicks := state.Apply(events, !done)
+		if trackerClicks {
+			continue
+		}
+		for _, c := range clicks {
+			batch.addClick(c, at.Format("2006-01-02"))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	if len(newIDs) == 0 {
+		return nil
+	}
+
+	for _, s := range state.Scrolls() {
+		batch.addScroll(s, sessionID, day)
+	}
+	return r.saveHeatmapBatch(batch, func(exec func(string, ...interface{}) error) error {
+		return exec(`UPDATE wp_apex_recordings SET heatmap_done = 1 WHERE id IN (?`+strings.Repeat(", ?", len(newIDs)-1)+`)`, newIDs...)
+	})
+}
+
+// StartHeatmapAggregator folds new tracker events and finished recordings into the heatmap tables
+func StartHeatmapAggregator(repo *Repository) {
+	ticker := time.NewTicker(10 * time.Minute)
+	go func() {
+		for range ticker.C {
+			if err := repo.AggregateHeatmapEvents(); err != nil {
+				log.Printf("[Heatmap Error] events: %v", err)
+			}
+			if err := repo.AggregateHeatmapRecordings(); err != nil {
+				log.Printf("[Heatmap Error] recordings: %v", err)
+			}
+		}
+	}()
+}
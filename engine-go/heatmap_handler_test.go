@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBlob(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// recordedClick is one rrweb chunk with a page, a scroll and a click on a pricing button
+const recordedClick = `[
+	{"type":4,"data":{"href":"https://example.com/pricing/","width":1280,"height":800}},
+	{"type":2,"data":{"node":{"type":0,"id":1,"childNodes":[
+		{"type":2,"id":2,"tagName":"html","childNodes":[
+			{"type":2,"id":3,"tagName":"body","childNodes":[
+				{"type":2,"id":4,"tagName":"a","attributes":{"class":"btn"}}]}]}]}}},
+	{"type":3,"data":{"source":3,"id":1,"x":0,"y":400}},
+	{"type":3,"data":{"source":2,"type":2,"id":4,"x":640,"y":100}}
+]`
+
+func TestAggregateRecordingSkipsClicksTheTrackerSent(t *testing.T) {
+	for _, trackerClicks := range []bool{false, true} {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		repo := &Repository{db: db}
+
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM wp_apex_events WHERE session_id = \\? AND event_type = 'heatmap_click'\\)").
+			WithArgs("sess_1").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(trackerClicks))
+		mock.ExpectQuery("FROM wp_apex_recordings").WithArgs("sess_1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "events_blob", "heatmap_done", "created_at"}).
+				AddRow(9, gzipBlob(t, recordedClick), false, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))
+		mock.ExpectBegin()
+		if !trackerClicks {
+			mock.ExpectExec("INSERT INTO wp_apex_heatmap_cells").WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec("INSERT INTO wp_apex_heatmap_selectors").WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		// Scroll depth keeps the deepest reach per session, so it is safe to take from both sources
+		mock.ExpectExec("INSERT INTO wp_apex_heatmap_scroll").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE wp_apex_recordings SET heatmap_done = 1").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.aggregateRecording("sess_1"))
+		assert.NoError(t, mock.ExpectationsWereMet(), "tracker clicks: %v", trackerClicks)
+		db.Close()
+	}
+}
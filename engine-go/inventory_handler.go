@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// InventoryHandler forecasts per-SKU stock-outs from order line items and plugin stock snapshots
+type InventoryHandler struct {
+	repo *Repository
+	auto *AutomationHandler
+}
+
+func NewInventoryHandler(repo *Repository, auto *AutomationHandler) *InventoryHandler {
+	return &InventoryHandler{repo: repo, auto: auto}
+}
+
+// inventoryHistoryDays is how much sales history feeds the demand model
+const inventoryHistoryDays = 90
+
+// SnapshotRequest accepts a single snapshot or a batch
+type SnapshotRequest struct {
+	Snapshots []analysis.StockSnapshot `json:"snapshots"`
+	analysis.StockSnapshot
+}
+
+// IngestSnapshots stores stock levels pushed by the plugin
+// POST /v1/inventory/snapshots {"snapshots":[{"sku":"TSHIRT-M","name":"T-Shirt","stock":42}]}
+func (h *InventoryHandler) IngestSnapshots(c *fiber.Ctx) error {
+	var req SnapshotRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	snapshots := req.Snapshots
+	if len(snapshots) == 0 && req.SKU != "" {
+		snapshots = []analysis.StockSnapshot{req.StockSnapshot}
+	}
+	if len(snapshots) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No snapshots"})
+	}
+
+	now := time.Now()
+	stored := 0
+	for _, s := range snapshots {
+		if s.SKU == "" || s.Stock < 0 {
+			continue
+		}
+		if s.Time.IsZero() {
+			s.Time = now
+		}
+		if _, err := h.repo.db.Exec(`INSERT INTO wp_apex_stock_snapshots (sku, product_name, stock, recorded_at) VALUES (?, ?, ?, ?)`,
+			s.SKU, s.Name, s.Stock, s.Time); err != nil {
+			log.Printf("[Inventory Error] %v", err)
+			return c.Status(500).JSON(fiber.Map{"error": "DB Error"})
+		}
+		stored++
+	}
+
+	return c.JSON(fiber.Map{"status": "stored", "count": stored})
+}
+
+// GetForecast projects stock-out per SKU
+// GET /v1/inventory/forecast?sku=&horizon=90&lead_days=7&low_days=14
+func (h *InventoryHandler) GetForecast(c *fiber.Ctx) error {
+	opts := analysis.InventoryOptions{
+		Horizon:  c.QueryInt("horizon", 90),
+		LeadDays: c.QueryInt("lead_days", 7),
+		LowDays:  c.QueryInt("low_days", 14),
+	}
+	if opts.Horizon < 1 || opts.Horizon > 365 {
+		return c.Status(400).JSON(fiber.Map{"error": "horizon must be between 1 and 365 days"})
+	}
+
+	forecasts, err := h.Forecast(c.Query("sku"), opts, time.Now())
+	if err != nil {
+		log.Printf("[Inventory Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Inventory query failed"})
+	}
+	return c.JSON(fiber.Map{"products": forecasts})
+}
+
+// Forecast builds stock-out forecasts for every SKU that has a snapshot (or just one SKU)
+func (h *InventoryHandler) Forecast(sku string, opts analysis.InventoryOptions, now time.Time) ([]analysis.InventoryForecast, error) {
+	query := `SELECT sku, COALESCE(product_name, ''), stock, recorded_at FROM wp_apex_stock_snapshots WHERE recorded_at >= ?`
+	args := []interface{}{now.AddDate(0, 0, -inventoryHistoryDays)}
+	if sku != "" {
+		query += ` AND sku = ?`
+		args = append(args, sku)
+	}
+	query += ` ORDER BY recorded_at ASC`
+
+	rows, err := h.repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := map[string][]analysis.StockSnapshot{}
+	var order []string
+	for rows.Next() {
+		var s analysis.StockSnapshot
+		if err := rows.Scan(&s.SKU, &s.Name, &s.Stock, &s.Time); err != nil {
+			continue
+		}
+		if _, ok := snapshots[s.SKU]; !ok {
+			order = append(order, s.SKU)
+		}
+		snapshots[s.SKU] = append(snapshots[s.SKU], s)
+	}
+	rows.Close()
+
+	sales, err := h.repo.LoadSaleLines(now.AddDate(0, 0, -inventoryHistoryDays), now)
+	if err != nil {
+		return nil, err
+	}
+	bySKU := map[string][]analysis.SaleLine{}
+	for _, s := range sales {
+		bySKU[s.SKU] = append(bySKU[s.SKU], s)
+	}
+
+	forecasts := []analysis.InventoryForecast{}
+	for _, k := range order {
+		forecasts = append(forecasts, analysis.ForecastStockOut(snapshots[k], bySKU[k], now, inventoryHistoryDays, opts))
+	}
+	return forecasts, nil
+}
+
+// LoadSaleLines expands order_completed events into line items. Orders without an items list
+// (older plugin versions, demo orders) count as one unit of their product.
+func (r *Repository) LoadSaleLines(from, to time.Time) ([]analysis.SaleLine, error) {
+	rows, err := r.db.Query(`SELECT payload, created_at FROM wp_apex_events WHERE event_type = 'order_completed' AND created_at >= ? AND created_at < ?`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []analysis.SaleLine
+	for rows.Next() {
+		var payload []byte
+		var created time.Time
+		if err := rows.Scan(&payload, &created); err != nil {
+			continue
+		}
+		var order struct {
+			Product string `json:"product"`
+			Items   []struct {
+				Name string  `json:"name"`
+				SKU  string  `json:"sku"`
+				Qty  float64 `json:"qty"`
+			} `json:"items"`
+		}
+		if json.Unmarshal(payload, &order) != nil {
+			continue
+		}
+
+		if len(order.Items) == 0 && order.Product != "" {
+			lines = append(lines, analysis.SaleLine{SKU: order.Product, Name: order.Product, Qty: 1, Time: created})
+		}
+		for _, item := range order.Items {
+			sku := item.SKU
+			if sku == "" {
+				sku = item.Name
+			}
+			if item.Qty <= 0 {
+				item.Qty = 1
+			}
+			lines = append(lines, analysis.SaleLine{SKU: sku, Name: item.Name, Qty: item.Qty, Time: created})
+		}
+	}
+	return lines, rows.Err()
+}
+
+// CheckStockAlerts emits a "low_stock" automation event when a SKU becomes low, critical or out
+// of stock, or moves between those statuses; a SKU that recovers can alert again later.
+// trigger_config can narrow it, e.g. {"status": "critical"} or {"max_days_remaining": 5}.
+func (h *InventoryHandler) CheckStockAlerts() {
+	if h.auto == nil {
+		return
+	}
+	forecasts, err := h.Forecast("", analysis.InventoryOptions{Horizon: 90, LeadDays: 7, LowDays: 14}, time.Now())
+	if err != nil {
+		log.Printf("[Inventory Error] %v", err)
+		return
+	}
+	alerted, err := h.alertedStatuses()
+	if err != nil {
+		log.Printf("[Inventory Error] %v", err)
+		return
+	}
+
+	for _, f := range forecasts {
+		if f.Status != analysis.StockLow && f.Status != analysis.StockCritical && f.Status != analysis.StockOut {
+			if _, ok := alerted[f.SKU]; ok {
+				if _, err := h.repo.db.Exec(`DELETE FROM wp_apex_stock_alerts WHERE sku = ?`, f.SKU); err != nil {
+					log.Printf("[Inventory Error] %v", err)
+				}
+			}
+			continue
+		}
+		if alerted[f.SKU] == f.Status {
+			continue
+		}
+		payload, _ := json.Marshal(f)
+		if err := h.auto.Dispatch("low_stock", payload); err != nil {
+			log.Printf("[Inventory Error] dispatch: %v", err)
+			return
+		}
+		if _, err := h.repo.db.Exec(`
+			INSERT INTO wp_apex_stock_alerts (sku, status, alerted_at) VALUES (?, ?, NOW())
+			ON DUPLICATE KEY UPDATE status = VALUES(status), alerted_at = VALUES(alerted_at)`, f.SKU, f.Status); err != nil {
+			log.Printf("[Inventory Error] %v", err)
+		}
+	}
+}
+
+// alertedStatuses is the last alerted status of every SKU still in alert
+func (h *InventoryHandler) alertedStatuses() (map[string]string, error) {
+	rows, err := h.repo.db.Query(`SELECT sku, status FROM wp_apex_stock_alerts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]string{}
+	for rows.Next() {
+		var sku, status string
+		if err := rows.Scan(&sku, &status); err != nil {
+			return nil, err
+		}
+		out[sku] = status
+	}
+	return out, rows.Err()
+}
+
+// StartInventoryMonitor checks stock alerts once a day
+func StartInventoryMonitor(h *InventoryHandler) {
+	ticker := time.NewTicker(24 * time.Hour)
+	go func() {
+		for range ticker.C {
+			h.CheckStockAlerts()
+		}
+	}()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckStockAlertsOnlyOnStatusChange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := &Repository{db: db}
+	h := NewInventoryHandler(repo, NewAutomationHandler(repo))
+	at := time.Now().Add(-time.Hour)
+
+	mock.ExpectQuery("FROM wp_apex_stock_snapshots").WillReturnRows(sqlmock.NewRows([]string{"sku", "product_name", "stock", "recorded_at"}).
+		AddRow("MUG", "Mug", 0, at).
+		AddRow("TEA", "Tea", 0, at).
+		AddRow("CUP", "Cup", 40, at))
+	mock.ExpectQuery("FROM wp_apex_events WHERE event_type = 'order_completed'").WillReturnRows(sqlmock.NewRows([]string{"payload", "created_at"}))
+	// MUG was already alerted as out of stock; CUP was low but no longer is
+	mock.ExpectQuery("SELECT sku, status FROM wp_apex_stock_alerts").WillReturnRows(sqlmock.NewRows([]string{"sku", "status"}).
+		AddRow("MUG", "out_of_stock").
+		AddRow("TEA", "low").
+		AddRow("CUP", "low"))
+
+	// TEA ran out since its low-stock alert, so it alerts again
+	mock.ExpectQuery("FROM wp_apex_automation_rules").WithArgs("low_stock").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "trigger_config", "action_type", "action_config"}))
+	mock.ExpectExec("INSERT INTO wp_apex_stock_alerts").WithArgs("TEA", "out_of_stock").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM wp_apex_stock_alerts WHERE sku = ?").WithArgs("CUP").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	h.CheckStockAlerts()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
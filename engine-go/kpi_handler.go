@@ -16,28 +16,29 @@ func NewKPIHandler(repo *Repository) *KPIHandler {
 }
 
 // GetKPIStats returns aggregated KPIs based on date range
-// GET /v1/stats/kpi?range=7d|30d|90d
+// GET /v1/stats/kpi?range=7d|30d|90d|today|yesterday|mtd|last_month|ytd (or start=&end=)&compare=previous_period|previous_year&tz=&segment_id=
 func (h *KPIHandler) GetKPIStats(c *fiber.Ctx) error {
-	rangeParam := c.Query("range", "7d")
-
-	var days int
-	switch rangeParam {
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
+	period, err := dateRangeFromQuery(c, h.repo, "7d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	prev := previousPeriod(period)
+
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
+	eventSeg, eventArgs := segment.SessionFilter("session_id")
+	sessionSeg, sessionArgs := segment.FingerprintFilter("fingerprint")
 
 	// Total Revenue (sum of order_completed events)
 	var totalRevenue float64
-	err := h.repo.db.QueryRow(`
+	err = h.repo.db.QueryRow(`
 		SELECT COALESCE(SUM(JSON_EXTRACT(payload, '$.revenue')), 0)
 		FROM wp_apex_events
 		WHERE event_type = 'order_completed'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, days).Scan(&totalRevenue)
+		AND created_at >= ? AND created_at < ?`+eventSeg,
+		withArgs([]interface{}{period.Start, period.End}, eventArgs)...).Scan(&totalRevenue)
 	if err != nil {
 		totalRevenue = 0
 	}
@@ -48,9 +49,8 @@ func (h *KPIHandler) GetKPIStats(c *fiber.Ctx) error {
 		SELECT COALESCE(SUM(JSON_EXTRACT(payload, '$.revenue')), 0)
 		FROM wp_apex_events
 		WHERE event_type = 'order_completed'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		AND created_at < DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, days*2, days).Scan(&prevRevenue)
+		AND created_at >= ? AND created_at < ?`+eventSeg,
+		withArgs([]interface{}{prev.Start, prev.End}, eventArgs)...).Scan(&prevRevenue)
 
 	// Total Pageviews (active traffic)
 	var totalPageviews int
@@ -58,8 +58,8 @@ func (h *KPIHandler) GetKPIStats(c *fiber.Ctx) error {
 		SELECT COUNT(*)
 		FROM wp_apex_events
 		WHERE event_type = 'pageview'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, days).Scan(&totalPageviews)
+		AND created_at >= ? AND created_at < ?`+eventSeg,
+		withArgs([]interface{}{period.Start, period.End}, eventArgs)...).Scan(&totalPageviews)
 
 	// Previous period pageviews
 	var prevPageviews int
@@ -67,22 +67,21 @@ func (h *KPIHandler) GetKPIStats(c *fiber.Ctx) error {
 		SELECT COUNT(*)
 		FROM wp_apex_events
 		WHERE event_type = 'pageview'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		AND created_at < DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, days*2, days).Scan(&prevPageviews)
+		AND created_at >= ? AND created_at < ?`+eventSeg,
+		withArgs([]interface{}{prev.Start, prev.End}, eventArgs)...).Scan(&prevPageviews)
 
 	// Bounce Rate (sessions with page_count = 1)
 	var totalSessions, bouncedSessions int
 	h.repo.db.QueryRow(`
 		SELECT COUNT(*) FROM wp_apex_sessions
-		WHERE started_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, days).Scan(&totalSessions)
+		WHERE started_at >= ? AND started_at < ?`+sessionSeg,
+		withArgs([]interface{}{period.Start, period.End}, sessionArgs)...).Scan(&totalSessions)
 
 	h.repo.db.QueryRow(`
 		SELECT COUNT(*) FROM wp_apex_sessions
-		WHERE started_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		AND page_count = 1
-	`, days).Scan(&bouncedSessions)
+		WHERE started_at >= ? AND started_at < ?
+		AND page_count = 1`+sessionSeg,
+		withArgs([]interface{}{period.Start, period.End}, sessionArgs)...).Scan(&bouncedSessions)
 
 	var bounceRate float64
 	if totalSessions > 0 {
@@ -104,7 +103,9 @@ func (h *KPIHandler) GetKPIStats(c *fiber.Ctx) error {
 		"traffic_change":    trafficChange,
 		"recovered_traffic": recoveredTraffic,
 		"bounce_rate":       bounceRate,
-		"range":             rangeParam,
+		"range":             period.Preset,
+		"period":            rangeInfo(period),
+		"segment_id":        segmentID(segment),
 	})
 }
 
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"         // New import for pprof server
 	_ "net/http/pprof" // New import for pprof side effects
 	"os"
+	"time"
 
 	"github.com/apex-ai/engine-go/gsc"
 	"github.com/apex-ai/engine-go/recon"
@@ -27,6 +29,9 @@ func main() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
 	}()
 
+	// Stopped explicitly before exiting, since log.Fatal skips deferred calls
+	var blacklist *recon.ISPFilter
+
 	// Initialize database repository
 	repo, err := NewRepository()
 	if err != nil {
@@ -47,8 +52,17 @@ func main() {
 			log.Printf("Warning: Failed to init Recon Engine: %v", err)
 		} else {
 			log.Println("Aspect Recon Engine fully operational.")
+			// Pick up blacklist edits without a restart
+			blacklist = reconEngine.Filter()
+			blacklist.Watch(30 * time.Second)
 		}
 
+		// ISP filter admin endpoints
+		reconHandler := NewReconHandler(reconEngine)
+		app.Get("/v1/recon/rules", reconHandler.GetRules)
+		app.Get("/v1/recon/rules/test", reconHandler.TestRules)
+		app.Post("/v1/recon/rules/reload", reconHandler.ReloadRules)
+
 		// Setup collect endpoint with worker pool
 		SetupCollectEndpoint(app, repo, reconEngine)
 		// Setup Chat AI endpoint
@@ -63,23 +77,38 @@ func main() {
 		// Setup Content Decay endpoint (Phase 7)
 		decayHandler := NewDecayHandler(repo)
 		app.Get("/v1/analysis/decay", decayHandler.GetContentDecay)
+		app.Get("/v1/analysis/decay/history", decayHandler.GetDecayHistory)
+		StartDecayMonitor(decayHandler)
 
 		// Setup GSC Overlay endpoint (Phase 7)
-		gscService := gsc.NewGSCService(os.Getenv("GSC_API_KEY"))
-		gscHandler := NewGSCHandler(gscService)
+		gscService := gsc.NewGSCService(repo.GetDB())
+		var gscSyncer *gsc.Syncer
+		if gscClient, err := gsc.NewClient(context.Background(), gsc.ConfigFromEnv()); err != nil {
+			log.Printf("Search Console sync disabled: %v", err)
+		} else {
+			gscSyncer = gsc.NewSyncer(gscClient, repo.GetDB())
+			gscSyncer.StartDailySync()
+		}
+		gscHandler := NewGSCHandler(gscService, gscSyncer)
 		app.Get("/v1/analysis/gsc-overlay", gscHandler.GetTrafficOverlay)
+		app.Post("/v1/gsc/sync", gscHandler.Sync)
+		app.Get("/v1/gsc/sync", gscHandler.SyncStatus)
 
 		// Setup Author Leaderboard (Phase 7)
 		authorHandler := NewAuthorHandler(repo)
 		app.Get("/v1/analysis/authors", authorHandler.GetLeaderboard)
+		app.Post("/v1/content/posts", authorHandler.IngestPostMeta)
 
 		// Setup Readability (Phase 25)
 		readabilityHandler := NewReadabilityHandler(repo)
 		app.Get("/v1/analysis/readability", readabilityHandler.GetStats)
+		app.Get("/v1/analysis/readability/posts", readabilityHandler.GetPostReadability)
+		app.Post("/v1/content/readability", readabilityHandler.IngestContent)
 
 		// Setup Cannibalization Endpoint (Phase 7)
-		cannibalizationHandler := NewCannibalizationHandler()
+		cannibalizationHandler := NewCannibalizationHandler(repo)
 		app.Get("/v1/analysis/cannibalization", cannibalizationHandler.GetAlerts)
+		app.Get("/v1/analysis/cannibalization/candidates", cannibalizationHandler.GetCandidates)
 
 		// Setup Session Recording (Phase 8)
 		recordingHandler := NewRecordingHandler(repo)
@@ -87,13 +116,20 @@ func main() {
 		app.Get("/v1/replay/list", recordingHandler.GetRecentRecordings) // New endpoint
 		app.Get("/v1/replay/:sessionId", recordingHandler.GetSessionRecording)
 
+		// Click and scroll heatmaps from tracker events and recordings
+		heatmapHandler := NewHeatmapHandler(repo)
+		app.Get("/v1/heatmaps", heatmapHandler.GetHeatmap)
+		StartHeatmapAggregator(repo)
+
 		// Setup Form Telemetry (Phase 9)
 		telemetryHandler := NewTelemetryHandler(repo)
 		app.Post("/v1/telemetry", telemetryHandler.IngestTelemetry)
 
 		// Setup AI Optimization (Phase 9)
-		optimizationHandler := NewOptimizationHandler()
+		optimizationHandler := NewOptimizationHandler(repo)
 		app.Post("/v1/optimize/form", optimizationHandler.GetSuggestions)
+		app.Get("/v1/optimize/form/suggestions", optimizationHandler.GetHistory)
+		app.Post("/v1/optimize/form/suggestions/:id/apply", optimizationHandler.ApplySuggestion)
 
 		// Phase 10: Search & SEO
 		searchHandler := NewSearchHandler(repo)
@@ -101,9 +137,19 @@ func main() {
 
 		app.Post("/v1/search/track", searchHandler.IngestSearch)
 		app.Get("/v1/search/stats", searchHandler.GetSearchStats)
+		app.Get("/v1/search/insights", searchHandler.GetSearchInsights)
 		app.Post("/v1/404/track", searchHandler.Ingest404)
 		app.Post("/v1/ai/answer", pplxHandler.GetAnswer)
 
+		// Redirect suggestions for logged 404s
+		redirectHandler := NewRedirectHandler(repo)
+		app.Get("/v1/redirects", redirectHandler.GetRedirects)
+		app.Post("/v1/redirects", redirectHandler.CreateRedirect)
+		app.Get("/v1/redirects/suggestions", redirectHandler.GetSuggestions)
+		app.Get("/v1/redirects/export", redirectHandler.ExportRedirects)
+		app.Post("/v1/redirects/hit", redirectHandler.RecordHit)
+		app.Delete("/v1/redirects/:id", redirectHandler.DeleteRedirect)
+
 		// Phase 11: Auto-Pilot
 		autoHandler := NewAutomationHandler(repo)
 		app.Post("/v1/automation/rules", autoHandler.CreateRule)
@@ -112,6 +158,24 @@ func main() {
 		app.Post("/v1/automation/rules/:id/test", autoHandler.TestRule)
 		app.Post("/v1/automation/event", autoHandler.IngestEvent) // Internal Event bus
 
+		// Funnel Analysis
+		funnelHandler := NewFunnelHandler(repo, autoHandler)
+		app.Get("/v1/funnels", funnelHandler.GetFunnels)
+		app.Post("/v1/funnels", funnelHandler.CreateFunnel)
+		app.Post("/v1/funnels/analyze", funnelHandler.AnalyzeFunnel)
+		app.Get("/v1/funnels/:id/report", funnelHandler.GetFunnelReport)
+		app.Delete("/v1/funnels/:id", funnelHandler.DeleteFunnel)
+		StartFunnelMonitor(funnelHandler)
+
+		// A/B experiments
+		experimentHandler := NewExperimentHandler(repo, funnelHandler)
+		app.Get("/v1/experiments", experimentHandler.GetExperiments)
+		app.Post("/v1/experiments", experimentHandler.CreateExperiment)
+		app.Post("/v1/experiments/analyze", experimentHandler.AnalyzeExperiment)
+		app.Get("/v1/experiments/:id/results", experimentHandler.GetResults)
+		app.Post("/v1/experiments/:id/stop", experimentHandler.StopExperiment)
+		app.Delete("/v1/experiments/:id", experimentHandler.DeleteExperiment)
+
 		// Setup Form Stats Aggregation (Phase 9)
 		formStatsHandler := NewFormStatsHandler(repo)
 		app.Get("/v1/stats/forms", formStatsHandler.GetStats)
@@ -128,6 +192,39 @@ func main() {
 		wooHandler := NewWooCommerceHandler(repo)
 		app.Get("/v1/woocommerce/stats", wooHandler.GetWooStats)
 		app.Get("/v1/woocommerce/velocity", wooHandler.GetProductVelocity)
+
+		// Customer lifetime value and RFM segments
+		customerHandler := NewCustomerHandler(repo)
+		app.Get("/v1/customers", customerHandler.GetCustomers)
+		app.Get("/v1/customers/segments", customerHandler.GetSegments)
+		app.Post("/v1/customers/refresh", customerHandler.RefreshModel)
+		StartCustomerModelMonitor(customerHandler)
+
+		// Multi-touch revenue attribution
+		attributionHandler := NewAttributionHandler(repo)
+		app.Get("/v1/attribution", attributionHandler.GetAttribution)
+
+		// Semantic-layer metric queries
+		queryHandler := NewQueryHandler(repo)
+		app.Get("/v1/query/schema", queryHandler.GetSchema)
+		app.Post("/v1/query", queryHandler.RunQuery)
+
+		// Seasonality-aware anomaly detection
+		anomalyHandler := NewAnomalyHandler(repo, autoHandler)
+		app.Get("/v1/analysis/anomalies", anomalyHandler.GetAnomalies)
+		app.Get("/v1/analysis/anomalies/scan", anomalyHandler.ScanAnomalies)
+		app.Post("/v1/analysis/anomalies/run", anomalyHandler.RunAnomalies)
+		StartAnomalyMonitor(anomalyHandler)
+
+		// Traffic and revenue forecasting
+		forecastHandler := NewForecastHandler(repo)
+		app.Get("/v1/analysis/forecast", forecastHandler.GetForecast)
+
+		// Inventory stock-out forecasting from real sales
+		inventoryHandler := NewInventoryHandler(repo, autoHandler)
+		app.Post("/v1/inventory/snapshots", inventoryHandler.IngestSnapshots)
+		app.Get("/v1/inventory/forecast", inventoryHandler.GetForecast)
+		StartInventoryMonitor(inventoryHandler)
 	}
 
 	// Start Background Jobs
@@ -166,6 +263,7 @@ func main() {
 	app.Get("/v1/segmentation/segments", segmentHandler.GetSegments)
 	app.Get("/v1/segmentation/leads", segmentHandler.GetLeads)
 	app.Post("/v1/segmentation/segments", segmentHandler.CreateSegment)
+	app.Post("/v1/segmentation/segments/preview", segmentHandler.PreviewSegment)
 	app.Delete("/v1/segmentation/segments/:id", segmentHandler.DeleteSegment)
 	app.Post("/v1/segmentation/downloads", segmentHandler.TrackDownload)
 
@@ -252,5 +350,9 @@ func main() {
 	system := app.Group("/v1/system")
 	system.Post("/seed", seederHandler.SeedDemoData)
 
-	log.Fatal(app.Listen(":" + port))
+	err = app.Listen(":" + port)
+	if blacklist != nil {
+		blacklist.StopWatching()
+	}
+	log.Fatal(err)
 }
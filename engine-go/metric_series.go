@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+)
+
+// metricSource describes where a monitored metric lives and how a bucket is aggregated
+type metricSource struct {
+	table     string
+	timeCol   string
+	valueExpr string
+	where     string
+	dense     bool // empty buckets are real zeros (counts); false for averages such as LCP
+}
+
+// seriesMetrics are the metrics anomaly detection and forecasting run on
+var seriesMetrics = map[string]metricSource{
+	"pageviews":            {"wp_apex_events", "created_at", "COUNT(*)", "event_type = 'pageview'", true},
+	"sessions":             {"wp_apex_sessions", "started_at", "COUNT(*)", "1 = 1", true},
+	"orders":               {"wp_apex_events", "created_at", "COUNT(*)", "event_type = 'order_completed'", true},
+	"revenue":              {"wp_apex_events", "created_at", "COALESCE(SUM(JSON_EXTRACT(payload, '$.revenue')), 0)", "event_type = 'order_completed'", true},
+	"404s":                 {"wp_apex_404_logs", "created_at", "COUNT(*)", "1 = 1", true},
+	"zero_result_searches": {"wp_apex_search_analytics", "created_at", "COUNT(*)", "result_count = 0", true},
+	"lcp":                  {"wp_apex_performance_metrics", "created_at", "AVG(lcp)", "lcp IS NOT NULL", false},
+}
+
+// seriesMetricNames lists the metrics anomaly detection watches, in a stable order
+var seriesMetricNames = []string{"pageviews", "sessions", "revenue", "404s", "zero_result_searches", "lcp"}
+
+// addBuckets moves t by n hourly or daily buckets; days follow the calendar across DST changes
+func addBuckets(t time.Time, granularity string, n int) time.Time {
+	if granularity == analysis.SeriesHourly {
+		return t.Add(time.Duration(n) * time.Hour)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// truncateBucket returns the start of the hour or day containing t
+func truncateBucket(t time.Time, granularity string) time.Time {
+	if granularity == analysis.SeriesHourly {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// LoadMetricSeries returns hourly or daily buckets of a metric in [from, to). Count metrics are
+// densified so quiet buckets appear as zeros.
+func (r *Repository) LoadMetricSeries(metric, granularity string, from, to time.Time) ([]analysis.SeriesPoint, error) {
+	src, ok := seriesMetrics[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+	format := "%Y-%m-%d 00:00:00"
+	if granularity == analysis.SeriesHourly {
+		format = "%Y-%m-%d %H:00:00"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT DATE_FORMAT(%s, '%s') AS bucket, %s
+		FROM %s
+		WHERE %s AND %s >= ? AND %s < ?
+		GROUP BY bucket`,
+		src.timeCol, format, src.valueExpr, src.table, src.where, src.timeCol, src.timeCol)
+
+	rows, err := r.db.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := map[time.Time]float64{}
+	for rows.Next() {
+		var bucket string
+		var value float64
+		if err := rows.Scan(&bucket, &value); err != nil {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", bucket, from.Location())
+		if err != nil {
+			continue
+		}
+		values[t] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var series []analysis.SeriesPoint
+	if src.dense {
+		for t := truncateBucket(from, granularity); t.Before(to); t = addBuckets(t, granularity, 1) {
+			series = append(series, analysis.SeriesPoint{Time: t, Value: values[t]})
+		}
+		return series, nil
+	}
+	for t, v := range values {
+		series = append(series, analysis.SeriesPoint{Time: t, Value: v})
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Time.Before(series[j].Time) })
+	return series, nil
+}
+
+// MetricBreakdown splits a metric over [from, to) by the dimensions that can explain a
+// movement: channel and page for traffic, channel and ordered product for revenue, referrer
+// channel and URL for 404s, normalized query for zero-result searches and page/device for LCP.
+func (r *Repository) MetricBreakdown(metric string, from, to time.Time) (map[string]map[string]float64, error) {
+	out := map[string]map[string]float64{}
+	add := func(dim, key string, v float64) {
+		if key == "" {
+			key = "(not set)"
+		}
+		if out[dim] == nil {
+			out[dim] = map[string]float64{}
+		}
+		out[dim][key] += v
+	}
+
+	switch metric {
+	case "pageviews", "sessions", "revenue":
+		eventType := "pageview"
+		if metric == "revenue" {
+			eventType = "order_completed"
+		}
+		events, err := r.LoadTrackedEvents(from, to, []string{eventType})
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, e := range events {
+			switch metric {
+			case "pageviews":
+				add("channel", e.Channel, 1)
+				add("page", analysis.URLPath(e.URL), 1)
+			case "sessions":
+				// Events arrive in time order, so the first one is the landing page
+				if seen[e.SessionID] {
+					continue
+				}
+				seen[e.SessionID] = true
+				add("channel", e.Channel, 1)
+				add("page", analysis.URLPath(e.URL), 1)
+			case "revenue":
+				revenue, _ := analysis.ToFloat(e.Props["revenue"])
+				add("channel", e.Channel, revenue)
+				for product, v := range analysis.ProductRevenue(e.Props, revenue) {
+					add("product", product, v)
+				}
+			}
+		}
+
+	case "404s":
+		rows, err := r.db.Query(`SELECT COALESCE(url, ''), COALESCE(referrer, '') FROM wp_apex_404_logs WHERE created_at >= ? AND created_at < ?`, from, to)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var url, referrer string
+			if rows.Scan(&url, &referrer) == nil {
+				add("page", analysis.URLPath(url), 1)
+				add("channel", analysis.ClassifyChannel(referrer, url), 1)
+			}
+		}
+
+	case "zero_result_searches":
+		rows, err := r.db.Query(`SELECT COALESCE(query, '') FROM wp_apex_search_analytics WHERE result_count = 0 AND created_at >= ? AND created_at < ?`, from, to)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var q string
+			if rows.Scan(&q) == nil {
+				add("query", strings.ToLower(strings.TrimSpace(q)), 1)
+			}
+		}
+
+	case "lcp":
+		rows, err := r.db.Query(`
+			SELECT COALESCE(url, ''), COALESCE(device_type, ''), lcp
+			FROM wp_apex_performance_metrics
+			WHERE lcp IS NOT NULL AND created_at >= ? AND created_at < ?`, from, to)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		sums := map[string]map[string][]float64{"page": {}, "device": {}}
+		for rows.Next() {
+			var url, device string
+			var lcp float64
+			if rows.Scan(&url, &device, &lcp) == nil {
+				sums["page"][analysis.URLPath(url)] = append(sums["page"][analysis.URLPath(url)], lcp)
+				sums["device"][device] = append(sums["device"][device], lcp)
+			}
+		}
+		for dim, byKey := range sums {
+			for k, vals := range byKey {
+				add(dim, k, analysis.Mean(vals))
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+	return out, nil
+}
@@ -2,37 +2,40 @@ package main
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
 type OptimizationHandler struct {
+	repo   *Repository
 	apiKey string
 }
 
-func NewOptimizationHandler() *OptimizationHandler {
+func NewOptimizationHandler(repo *Repository) *OptimizationHandler {
 	return &OptimizationHandler{
+		repo:   repo,
 		apiKey: os.Getenv("OPENAI_API_KEY"),
 	}
 }
 
+// OptimizationRequest names the form and range; the metrics themselves come from the engine's own form analytics
 type OptimizationRequest struct {
-	FormID  string `json:"form_id"`
-	Metrics struct {
-		Fields []struct {
-			Name      string  `json:"name"`
-			DwellTime float64 `json:"dwell_time"` // milliseconds
-			DropOffs  int     `json:"drop_offs"`
-		} `json:"fields"`
-		CompletionRate float64 `json:"completion_rate"`
-	} `json:"metrics"`
+	FormID string `json:"form_id"`
+	Range  string `json:"range"` // any date range preset, default 7d
+	Start  string `json:"start"` // or a YYYY-MM-DD start and inclusive end
+	End    string `json:"end"`
 }
 
 type OpenAIResponse struct {
@@ -43,11 +46,37 @@ type OpenAIResponse struct {
 	} `json:"choices"`
 }
 
+// FormSuggestion is a stored AI answer together with the metrics it was generated from
+type FormSuggestion struct {
+	ID          int64           `json:"id"`
+	FormID      string          `json:"form_id"`
+	RangeDays   int             `json:"range_days"`
+	Suggestions string          `json:"suggestions"`
+	Snapshot    json.RawMessage `json:"metrics_snapshot"`
+	Before      FormRate        `json:"before"`
+	After       *FormRate       `json:"after,omitempty"` // completion since the suggestion was applied
+	AppliedAt   *time.Time      `json:"applied_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type FormRate struct {
+	Starters       int     `json:"starters"`
+	Completions    int     `json:"completions"`
+	CompletionRate float64 `json:"completion_rate"`
+	Delta          float64 `json:"delta_pp,omitempty"` // percentage points vs before
+}
+
+// maxPromptFields caps how many fields are described to the model
+const maxPromptFields = 8
+
 func (h *OptimizationHandler) GetSuggestions(c *fiber.Ctx) error {
 	var req OptimizationRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
 	}
+	if req.FormID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "form_id is required"})
+	}
 
 	// Check license/grace period before AI features
 	license := GetLicenseValidator()
@@ -62,6 +91,22 @@ func (h *OptimizationHandler) GetSuggestions(c *fiber.Ctx) error {
 		})
 	}
 
+	period, err := analysis.ParseDateRange(analysis.DateRangeParams{Range: req.Range, Start: req.Start, End: req.End},
+		time.Now(), h.repo.SiteLocation(), "7d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	days := period.Days()
+	forms, err := h.repo.LoadFormSummaries(period.Period, req.FormID)
+	if err != nil {
+		log.Printf("[Optimization Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load form metrics"})
+	}
+	if len(forms) == 0 || forms[0].Starters == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "No form data for this range"})
+	}
+	form := forms[0]
+
 	// Graceful fallback if API key is missing
 	if h.apiKey == "" {
 		log.Println("OpenAI API key not configured, returning fallback suggestions")
@@ -69,40 +114,179 @@ func (h *OptimizationHandler) GetSuggestions(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
 			"suggestions": fallback.Insight,
 			"is_fallback": true,
+			"metrics":     form,
 		})
 	}
 
-	// Construct prompt for GPT-4o
-	prompt := fmt.Sprintf(`
-Analyze this form friction data and provide 3 specific, actionable UI/UX improvements to increase conversion.
-Form ID: %s
-Completion Rate: %.1f%%
-
-Field Metrics (High friction items):
-`, req.FormID, req.Metrics.CompletionRate)
-
-	for _, field := range req.Metrics.Fields {
-		prompt += fmt.Sprintf("- Field '%s': %.1fs dwell time, %d drop-offs\n", field.Name, field.DwellTime/1000, field.DropOffs)
-	}
-
-	prompt += "\nFormat response as a clean HTML list (<ul><li>...</li></ul>) without markdown code blocks."
-
 	// Call OpenAI API
-	response, err := h.callOpenAI(prompt)
+	response, err := h.callOpenAI(buildFormPrompt(form, days))
 	if err != nil {
 		log.Printf("OpenAI error: %v, returning fallback", err)
 		fallback := GetOptimizationFallback(err.Error())
 		return c.JSON(fiber.Map{
 			"suggestions": fallback.Insight,
 			"is_fallback": true,
+			"metrics":     form,
 		})
 	}
 
+	id, err := h.repo.SaveFormSuggestion(form, days, response)
+	if err != nil {
+		log.Printf("[Optimization Error] storing suggestion: %v", err)
+	}
+
 	return c.JSON(fiber.Map{
-		"suggestions": response,
+		"suggestions":   response,
+		"suggestion_id": id,
+		"metrics":       form,
 	})
 }
 
+// GetHistory lists stored suggestions, with before/after completion for applied ones
+// GET /v1/optimize/form/suggestions?form_id=
+func (h *OptimizationHandler) GetHistory(c *fiber.Ctx) error {
+	list, err := h.repo.LoadFormSuggestions(c.Query("form_id"))
+	if err != nil {
+		log.Printf("[Optimization Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load suggestions"})
+	}
+	return c.JSON(list)
+}
+
+// ApplySuggestion marks a suggestion as applied; completion is compared from that moment on
+// POST /v1/optimize/form/suggestions/:id/apply
+func (h *OptimizationHandler) ApplySuggestion(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	res, err := h.repo.db.Exec(`UPDATE wp_apex_form_suggestions SET applied_at = NOW() WHERE id = ? AND applied_at IS NULL`, id)
+	if err != nil {
+		log.Printf("[Optimization Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to apply suggestion"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Suggestion not found or already applied"})
+	}
+	return c.JSON(fiber.Map{"status": "applied"})
+}
+
+// buildFormPrompt describes the form's friction to the model, highest drop-off fields first
+func buildFormPrompt(form *FormSummary, days int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `
+Analyze this form friction data and provide 3 specific, actionable UI/UX improvements to increase conversion.
+Form ID: %s
+Period: %d days
+Starters: %d, Completions: %d, Abandons: %d
+Completion Rate: %.1f%%
+Median Time to Complete: %.0fs
+Rage Clicks on Submit: %d
+`, form.FormID, days, form.Starters, form.Completions, form.Abandons, form.CompletionRate,
+		form.TimeToComplete.Median, form.RageClicks)
+
+	if len(form.DeviceStats) > 0 {
+		devices := make([]string, 0, len(form.DeviceStats))
+		for d := range form.DeviceStats {
+			devices = append(devices, d)
+		}
+		sort.Strings(devices)
+		b.WriteString("Device Split:")
+		for _, d := range devices {
+			fmt.Fprintf(&b, " %s %.0f%%", d, float64(form.DeviceStats[d])/float64(form.Starters)*100)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\nField Metrics (High friction items):\n")
+	for i, f := range form.FieldList {
+		if i == maxPromptFields {
+			break
+		}
+		fmt.Fprintf(&b, "- Field '%s': %d sessions, %d drop-offs (%.1f%%), %.1fs avg dwell, %d validation errors, %d corrections, %d refocuses\n",
+			f.Name, f.Interactions, f.DropOffs, f.DropOffRate, f.AvgDwellTime/1000, f.Errors, f.Corrections, f.Refocuses)
+	}
+
+	if len(form.Funnel) > 0 {
+		order := make([]string, len(form.Funnel))
+		for i, s := range form.Funnel {
+			order[i] = fmt.Sprintf("%s (%.0f%%)", s.Field, s.ReachRate)
+		}
+		fmt.Fprintf(&b, "\nTypical fill order with reach: %s\n", strings.Join(order, " > "))
+	}
+
+	b.WriteString("\nFormat response as a clean HTML list (<ul><li>...</li></ul>) without markdown code blocks.")
+	return b.String()
+}
+
+// SaveFormSuggestion stores a suggestion with the form metrics it was based on
+func (r *Repository) SaveFormSuggestion(form *FormSummary, days int, suggestions string) (int64, error) {
+	snapshot, err := json.Marshal(form)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.db.Exec(`
+		INSERT INTO wp_apex_form_suggestions (form_id, range_days, suggestions, metrics_snapshot, starters, completions, completion_rate)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		form.FormID, days, suggestions, string(snapshot), form.Starters, form.Completions, form.CompletionRate)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// LoadFormSuggestions returns stored suggestions, newest first; applied ones carry completion since applied_at
+func (r *Repository) LoadFormSuggestions(formID string) ([]FormSuggestion, error) {
+	query := `SELECT id, form_id, range_days, suggestions, metrics_snapshot, starters, completions, completion_rate, applied_at, created_at
+		FROM wp_apex_form_suggestions`
+	var args []interface{}
+	if formID != "" {
+		query += ` WHERE form_id = ?`
+		args = append(args, formID)
+	}
+	rows, err := r.db.Query(query+` ORDER BY created_at DESC LIMIT 100`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []FormSuggestion{}
+	for rows.Next() {
+		var s FormSuggestion
+		var snapshot string
+		var applied sql.NullTime
+		if err := rows.Scan(&s.ID, &s.FormID, &s.RangeDays, &s.Suggestions, &snapshot,
+			&s.Before.Starters, &s.Before.Completions, &s.Before.CompletionRate, &applied, &s.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Snapshot = json.RawMessage(snapshot)
+		if applied.Valid {
+			s.AppliedAt = &applied.Time
+		}
+		list = append(list, s)
+	}
+	rows.Close()
+
+	for i := range list {
+		s := &list[i]
+		if s.AppliedAt == nil {
+			continue
+		}
+		var after FormRate
+		err := r.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(submitted), 0) FROM wp_apex_form_sessions WHERE form_id = ? AND started_at >= ?`,
+			s.FormID, *s.AppliedAt).Scan(&after.Starters, &after.Completions)
+		if err != nil {
+			return nil, err
+		}
+		if after.Starters > 0 {
+			after.CompletionRate = math.Round(float64(after.Completions)/float64(after.Starters)*1000) / 10
+			after.Delta = math.Round((after.CompletionRate-s.Before.CompletionRate)*10) / 10
+		}
+		s.After = &after
+	}
+	return list, nil
+}
+
 func (h *OptimizationHandler) callOpenAI(prompt string) (string, error) {
 	requestBody, _ := json.Marshal(map[string]interface{}{
 		"model": "gpt-4o",
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFormSummary() *FormSummary {
+	form := &FormSummary{
+		FormID: "checkout", Starters: 200, Completions: 120, Abandons: 80, CompletionRate: 60, RageClicks: 3,
+		DeviceStats:    map[string]int{"mobile": 150, "desktop": 50},
+		TimeToComplete: analysis.DurationDistribution{Count: 120, Median: 84},
+		Funnel: []analysis.FormFunnelStep{
+			{Field: "email", Position: 1, Reached: 190, ReachRate: 95},
+			{Field: "phone", Position: 2, Reached: 120, ReachRate: 60},
+		},
+	}
+	// Ten fields, highest drop-off first, as LoadFormSummaries orders them
+	for i := 0; i < 10; i++ {
+		form.FieldList = append(form.FieldList, &FormFieldStat{Name: fmt.Sprintf("field_%d", i), Interactions: 100, DropOffs: 10 - i,
+			DropOffRate: float64(10 - i), AvgDwellTime: 2500, Errors: i, Corrections: 1, Refocuses: 2})
+	}
+	return form
+}
+
+func TestBuildFormPromptUsesEngineMetrics(t *testing.T) {
+	prompt := buildFormPrompt(testFormSummary(), 7)
+
+	assert.Contains(t, prompt, "Form ID: checkout\nPeriod: 7 days\nStarters: 200, Completions: 120, Abandons: 80\nCompletion Rate: 60.0%\n")
+	assert.Contains(t, prompt, "Median Time to Complete: 84s\nRage Clicks on Submit: 3\n")
+	// Devices are listed in a stable order, as a share of starters
+	assert.Contains(t, prompt, "Device Split: desktop 25% mobile 75%\n")
+	assert.Contains(t, prompt, "- Field 'field_0': 100 sessions, 10 drop-offs (10.0%), 2.5s avg dwell, 0 validation errors, 1 corrections, 2 refocuses\n")
+	assert.Contains(t, prompt, "Typical fill order with reach: email (95%) > phone (60%)\n")
+
+	// Only the highest-friction fields are described
+	assert.Contains(t, prompt, "field_7")
+	assert.NotContains(t, prompt, "field_8")
+}
+
+func TestSaveFormSuggestionStoresMetricsSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := &Repository{db: db}
+
+	form := testFormSummary()
+	snapshot, err := json.Marshal(form)
+	require.NoError(t, err)
+	mock.ExpectExec("INSERT INTO wp_apex_form_suggestions").
+		WithArgs("checkout", 7, "<ul><li>Drop the phone field</li></ul>", string(snapshot), 200, 120, 60.0).
+		WillReturnResult(sqlmock.NewResult(12, 1))
+
+	id, err := repo.SaveFormSuggestion(form, 7, "<ul><li>Drop the phone field</li></ul>")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadFormSuggestionsComparesAppliedCompletion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := &Repository{db: db}
+
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	applied := created.Add(48 * time.Hour)
+	mock.ExpectQuery("FROM wp_apex_form_suggestions WHERE form_id = \\? ORDER BY created_at DESC").
+		WithArgs("checkout").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "form_id", "range_days", "suggestions", "metrics_snapshot",
+			"starters", "completions", "completion_rate", "applied_at", "created_at"}).
+			AddRow(12, "checkout", 7, "<ul><li>A</li></ul>", `{"formId": "checkout", "starters": 200}`, 200, 120, 60.0, applied, created).
+			AddRow(11, "checkout", 30, "<ul><li>B</li></ul>", `{"formId": "checkout"}`, 500, 250, 50.0, nil, created.AddDate(0, 0, -7)))
+	// Only the applied suggestion is compared, from the moment it was applied
+	mock.ExpectQuery("FROM wp_apex_form_sessions WHERE form_id = \\? AND started_at >= \\?").
+		WithArgs("checkout", applied).
+		WillReturnRows(sqlmock.NewRows([]string{"starters", "completions"}).AddRow(80, 52))
+
+	list, err := repo.LoadFormSuggestions("checkout")
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	require.Len(t, list, 2)
+	assert.JSONEq(t, `{"formId": "checkout", "starters": 200}`, string(list[0].Snapshot))
+	assert.Equal(t, FormRate{Starters: 200, Completions: 120, CompletionRate: 60}, list[0].Before)
+	require.NotNil(t, list[0].After)
+	assert.Equal(t, FormRate{Starters: 80, Completions: 52, CompletionRate: 65, Delta: 5}, *list[0].After)
+	assert.Nil(t, list[1].AppliedAt)
+	assert.Nil(t, list[1].After)
+}
+
+func TestApplySuggestionOnlyOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	h := NewOptimizationHandler(&Repository{db: db})
+	app := fiber.New()
+	app.Post("/v1/optimize/form/suggestions/:id/apply", h.ApplySuggestion)
+
+	mock.ExpectExec("UPDATE wp_apex_form_suggestions SET applied_at = NOW\\(\\) WHERE id = \\? AND applied_at IS NULL").
+		WithArgs(12).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE wp_apex_form_suggestions").WithArgs(12).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	for _, want := range []int{fiber.StatusOK, fiber.StatusNotFound} {
+		resp, err := app.Test(httptest.NewRequest("POST", "/v1/optimize/form/suggestions/12/apply", strings.NewReader("")))
+		require.NoError(t, err)
+		assert.Equal(t, want, resp.StatusCode)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -5,7 +5,7 @@ import (
 	"time"
 )
 
-// PruneRecordings deletes recordings older than 30 days
+// PruneRecordings deletes recordings and their annotations older than 30 days
 func (r *Repository) PruneRecordings() {
 	result, err := r.db.Exec(`
         DELETE FROM wp_apex_recordings 
@@ -20,6 +20,13 @@ func (r *Repository) PruneRecordings() {
 	if rows > 0 {
 		log.Printf("Pruned %d old recordings", rows)
 	}
+
+	if _, err := r.db.Exec(`
+        DELETE FROM wp_apex_recording_annotations
+        WHERE created_at < DATE_SUB(NOW(), INTERVAL 30 DAY)
+    `); err != nil {
+		log.Printf("Recording Annotation Prune Error: %v", err)
+	}
 }
 
 // StartRecordingPruner runs the pruner every 24 hours
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// QueryHandler serves ad-hoc metric queries through the semantic layer in analysis/query.go
+type QueryHandler struct {
+	repo *Repository
+}
+
+func NewQueryHandler(repo *Repository) *QueryHandler {
+	return &QueryHandler{repo: repo}
+}
+
+// QueryResult is a typed table: each row holds one value per column, in column order.
+// Dimensions are strings, integer metrics int64 and the rest float64; missing values are null.
+type QueryResult struct {
+	Columns []analysis.QueryColumn `json:"columns"`
+	Rows    [][]interface{}        `json:"rows"`
+}
+
+// GetSchema lists the available metrics and dimensions
+// GET /v1/query/schema
+func (h *QueryHandler) GetSchema(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"fields": analysis.QuerySchema()})
+}
+
+// RunQuery computes metrics by dimensions
+// POST /v1/query?range=7d|30d|90d|mtd|... (or start=YYYY-MM-DD&end=YYYY-MM-DD)&tz=&segment_id=
+//
+//	{"metrics": ["pageviews"], "dimensions": ["country"],
+//	 "filters": [{"field": "campaign", "operator": "eq", "value": "spring_sale"}],
+//	 "sort": [{"field": "pageviews", "desc": true}], "limit": 20}
+func (h *QueryHandler) RunQuery(c *fiber.Ctx) error {
+	var q analysis.QueryRequest
+	if err := c.BodyParser(&q); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	period, err := dateRangeFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	q.From, q.To, q.Location = period.Start, period.End, period.Location
+
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if segment != nil {
+		q.Scope, q.ScopeArgs = segment.fingerprintIn("s.fingerprint"), segment.args
+	}
+
+	compiled, err := analysis.CompileQuery(q)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result, err := h.repo.RunCompiledQuery(compiled)
+	if err != nil {
+		log.Printf("[Query Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Query failed"})
+	}
+	return c.JSON(fiber.Map{
+		"columns":    result.Columns,
+		"rows":       result.Rows,
+		"period":     rangeInfo(period),
+		"segment_id": segmentID(segment),
+	})
+}
+
+// RunCompiledQuery executes a compiled semantic query, scanning each column by its declared type
+func (r *Repository) RunCompiledQuery(q analysis.CompiledQuery) (QueryResult, error) {
+	result := QueryResult{Columns: q.Columns, Rows: [][]interface{}{}}
+	rows, err := r.db.Query(q.SQL, q.Args...)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dest := make([]interface{}, len(q.Columns))
+		for i, col := range q.Columns {
+			switch col.Type {
+			case analysis.ColumnInteger:
+				dest[i] = new(sql.NullInt64)
+			case analysis.ColumnPercent, analysis.ColumnCurrency:
+				dest[i] = new(sql.NullFloat64)
+			default:
+				dest[i] = new(sql.NullString)
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return result, err
+		}
+
+		row := make([]interface{}, len(dest))
+		for i, d := range dest {
+			switch v := d.(type) {
+			case *sql.NullInt64:
+				if v.Valid {
+					row[i] = v.Int64
+				}
+			case *sql.NullFloat64:
+				if v.Valid {
+					row[i] = v.Float64
+				}
+			case *sql.NullString:
+				if v.Valid {
+					row[i] = v.String
+				}
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
-	"encoding/json"
+	"log"
+	"strings"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -21,61 +23,163 @@ func NewReadabilityHandler(repo *Repository) *ReadabilityHandler {
 	return &ReadabilityHandler{repo: repo}
 }
 
-// AnalyzeReadability labels a session based on scroll/dwell patterns
+// PostContent is a post body pushed by the plugin for scoring
+type PostContent struct {
+	PostID  int    `json:"post_id"`
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	Content string `json:"content"` // post HTML
+}
+
+// Analyze labels a visit based on scroll/dwell patterns. When the word count is known, dwell is
+// judged against the expected read time; otherwise fixed thresholds apply.
 func (h *ReadabilityHandler) Analyze(m ReadabilityMetric) string {
-	if m.DwellTime < 15 && m.ScrollDist > 80 {
+	skimDwell, readDwell := 15.0, 120.0
+	if m.WordCount > 0 {
+		readTime := float64(m.WordCount) / 238 * 60
+		skimDwell, readDwell = readTime*0.25, readTime*0.5
+	}
+	if float64(m.DwellTime) < skimDwell && m.ScrollDist > 80 {
 		return "Skimmer"
 	}
-	if m.DwellTime > 120 && m.ScrollDist > 50 {
+	if float64(m.DwellTime) > readDwell && m.ScrollDist > 50 {
 		return "Reader"
 	}
 	return "Casual"
 }
 
+// GetStats labels every page visit in the range as Skimmer, Reader or Casual and lists posts
+// readers abandon early
+// GET /v1/analysis/readability?range=7d (or start=&end=, or the older days=7)
 func (h *ReadabilityHandler) GetStats(c *fiber.Ctx) error {
-	// Real-time aggregation of readability metrics
-	rows, err := h.repo.GetDB().Query(`
-		SELECT payload FROM wp_apex_events 
-		WHERE event_type IN ('pageview', 'heartbeat', 'leave') 
-		ORDER BY created_at DESC LIMIT 1000
-	`)
+	period, err := dateRangeOrDaysFromQuery(c, h.repo, "7d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	visits, err := analysis.LoadPageVisits(h.repo.GetDB(), period.Start, period.End)
 	if err != nil {
+		log.Printf("[Readability Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch metrics"})
+	}
+	byPost, byURL, err := h.wordCounts()
+	if err != nil {
+		log.Printf("[Readability Error] %v", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch metrics"})
 	}
-	defer rows.Close()
 
 	var skimmers, readers, casual int
-	for rows.Next() {
-		var payloadStr string
-		if err := rows.Scan(&payloadStr); err != nil {
-			continue
+	for _, v := range visits {
+		words, ok := byPost[v.PostID]
+		if !ok || v.PostID == 0 {
+			words = byURL[v.URL]
 		}
-
-		var data map[string]interface{}
-		json.Unmarshal([]byte(payloadStr), &data)
-
-		// Extract metrics from apex.js payload (sc, ts, sk)
-		scroll, _ := data["sc"].(float64)
-		dwell, _ := data["ts"].(float64)
-		isSkimmer, _ := data["sk"].(bool)
-
-		if isSkimmer || (dwell < 30 && scroll > 70) {
+		switch h.Analyze(ReadabilityMetric{SessionID: v.SessionID, WordCount: words, ScrollDist: int(v.Scroll), DwellTime: int(v.Dwell)}) {
+		case "Skimmer":
 			skimmers++
-		} else if dwell > 120 && scroll > 40 {
+		case "Reader":
 			readers++
-		} else {
+		default:
 			casual++
 		}
 	}
 
+	opts := analysis.ReadabilityOptions{AbandonedOnly: true, Limit: 5}
+	opts.Validate()
+	abandoned, err := analysis.CalculatePostReadability(h.repo.GetDB(), opts, period.Period)
+	if err != nil {
+		log.Printf("[Readability Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch metrics"})
+	}
+	titles := []string{}
+	for _, p := range abandoned {
+		titles = append(titles, p.Title)
+	}
+
 	return c.JSON(fiber.Map{
-		"skimmers": skimmers,
-		"readers":  readers,
-		"casual":   casual,
-		"content_decay_warnings": []string{
-			"The Ultimate Guide to Apex AI Insights",
-			"Why Your Analytics Are Lying To You",
-		},
-		"source": "Real-time DB Engine",
+		"skimmers":       skimmers,
+		"readers":        readers,
+		"casual":         casual,
+		"early_abandons": titles,
+		"source":         "Real-time DB Engine",
 	})
 }
+
+func (h *ReadabilityHandler) wordCounts() (map[int]int, map[string]int, error) {
+	rows, err := h.repo.db.Query(`SELECT post_id, url, words FROM wp_apex_post_readability`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	byPost, byURL := map[int]int{}, map[string]int{}
+	for rows.Next() {
+		var postID, words int
+		var url string
+		if err := rows.Scan(&postID, &url, &words); err != nil {
+			return nil, nil, err
+		}
+		byPost[postID] = words
+		byURL[url] = words
+	}
+	return byPost, byURL, rows.Err()
+}
+
+// IngestContent scores post content supplied by the plugin and stores the scores
+// POST /v1/content/readability  [{post_id, url, title, content}]
+func (h *ReadabilityHandler) IngestContent(c *fiber.Ctx) error {
+	var posts []PostContent
+	if err := c.BodyParser(&posts); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+
+	scored := []fiber.Map{}
+	for _, p := range posts {
+		if p.PostID <= 0 || p.URL == "" || strings.TrimSpace(p.Content) == "" {
+			continue
+		}
+		s := analysis.ScoreText(analysis.StripMarkup(p.Content))
+		_, err := h.repo.db.Exec(`
+			INSERT INTO wp_apex_post_readability (post_id, url, title, words, sentences, syllables, flesch_reading_ease,
+				flesch_kincaid_grade, avg_sentence_length, long_sentence_pct, passive_ratio, read_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE url = VALUES(url), title = VALUES(title), words = VALUES(words),
+				sentences = VALUES(sentences), syllables = VALUES(syllables), flesch_reading_ease = VALUES(flesch_reading_ease),
+				flesch_kincaid_grade = VALUES(flesch_kincaid_grade), avg_sentence_length = VALUES(avg_sentence_length),
+				long_sentence_pct = VALUES(long_sentence_pct), passive_ratio = VALUES(passive_ratio), read_time = VALUES(read_time)`,
+			p.PostID, p.URL, p.Title, s.Words, s.Sentences, s.Syllables, s.FleschReadingEase, s.FleschKincaidGrade,
+			s.AvgSentenceLength, s.LongSentencePct, s.PassiveRatio, s.ReadTime)
+		if err != nil {
+			log.Printf("[Readability Error] post %d: %v", p.PostID, err)
+			continue
+		}
+		scored = append(scored, fiber.Map{"post_id": p.PostID, "scores": s})
+	}
+	return c.JSON(scored)
+}
+
+// GetPostReadability joins each scored post with its scroll/dwell distribution
+// GET /v1/analysis/readability/posts?range=30d (or start=&end=, or the older days=30)&min_visits=20&abandoned=true&limit=50
+func (h *ReadabilityHandler) GetPostReadability(c *fiber.Ctx) error {
+	period, err := dateRangeOrDaysFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	opts := analysis.ReadabilityOptions{
+		MinVisits:     c.QueryInt("min_visits"),
+		AbandonRatio:  c.QueryFloat("abandon_ratio"),
+		AbandonScroll: c.QueryFloat("abandon_scroll"),
+		AbandonedOnly: c.QueryBool("abandoned"),
+		Limit:         c.QueryInt("limit"),
+	}
+	if err := opts.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	results, err := analysis.CalculatePostReadability(h.repo.GetDB(), opts, period.Period)
+	if err != nil {
+		log.Printf("[Readability Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(results)
+}
@@ -1,6 +1,7 @@
 package recon
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"os"
@@ -12,6 +13,12 @@ type ASNLookup struct {
 	db *geoip2.Reader
 }
 
+// ASNRecord is the autonomous system an IP belongs to
+type ASNRecord struct {
+	Number       uint
+	Organization string
+}
+
 func NewASNLookup(dbPath string) (*ASNLookup, error) {
 	// Check if file exists
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
@@ -34,30 +41,45 @@ func (a *ASNLookup) Close() {
 }
 
 func (a *ASNLookup) GetOrganization(ipStr string) (string, error) {
+	record, err := a.Lookup(ipStr)
+	if err != nil {
+		return "", err
+	}
+	return record.Organization, nil
+}
+
+// Lookup resolves both the AS number and the organization for an IP
+func (a *ASNLookup) Lookup(ipStr string) (ASNRecord, error) {
 	if a.db == nil {
 		// Mock logic for dev/demo if DB missing
 		if ipStr == "8.8.8.8" {
-			return "GOOGLE", nil
+			return ASNRecord{Number: 15169, Organization: "GOOGLE"}, nil
 		}
 		if ipStr == "1.1.1.1" {
-			return "CLOUDFLARENET", nil
+			return ASNRecord{Number: 13335, Organization: "CLOUDFLARENET"}, nil
 		}
 		// Default mock for testing positive hits
 		if ipStr == "12.34.56.78" {
-			return "Tesla Motors Inc", nil
+			return ASNRecord{Number: 394161, Organization: "Tesla Motors Inc"}, nil
 		}
 		// Default mock for testing negative hits (ISP)
 		if ipStr == "99.99.99.99" {
-			return "Comcast Cable Communications", nil
+			return ASNRecord{Number: 7922, Organization: "Comcast Cable Communications"}, nil
 		}
-		return "Unknown ISP", nil
+		return ASNRecord{Organization: "Unknown ISP"}, nil
 	}
 
 	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return ASNRecord{}, fmt.Errorf("invalid IP address: %q", ipStr)
+	}
 	record, err := a.db.ASN(ip)
 	if err != nil {
-		return "", err
+		return ASNRecord{}, err
 	}
 
-	return record.AutonomousSystemOrganization, nil
+	return ASNRecord{
+		Number:       record.AutonomousSystemNumber,
+		Organization: record.AutonomousSystemOrganization,
+	}, nil
 }
@@ -12,8 +12,10 @@ type ReconEngine struct {
 
 type ReconResult struct {
 	IP            string
+	ASN           uint
 	Organization  string
 	IsISP         bool
+	Category      string
 	Hostname      string
 	CompanyDomain string
 }
@@ -31,18 +33,31 @@ func NewReconEngine(asnPath, blacklistPath string) (*ReconEngine, error) {
 	}, nil
 }
 
-func (r *ReconEngine) Identify(ip string) ReconResult {
-	org, _ := r.asnLookup.GetOrganization(ip)
-	if org == "" {
-		org = "Unknown"
+// Filter exposes the ISP filter for admin listing and reloads
+func (r *ReconEngine) Filter() *ISPFilter {
+	return r.ispFilter
+}
+
+// Classify resolves the ASN of an IP and runs it through the ISP filter without any DNS lookups
+func (r *ReconEngine) Classify(ip string) FilterMatch {
+	record, _ := r.asnLookup.Lookup(ip)
+	if record.Organization == "" {
+		record.Organization = "Unknown"
 	}
+	return r.ispFilter.Match(record.Number, record.Organization)
+}
 
-	isISP := r.ispFilter.IsISP(org)
+func (r *ReconEngine) Identify(ip string) ReconResult {
+	match := r.Classify(ip)
+	org := match.Organization
+	isISP := match.IsISP
 
 	result := ReconResult{
 		IP:           ip,
+		ASN:          match.ASN,
 		Organization: org,
 		IsISP:        isISP,
+		Category:     match.Category,
 	}
 
 	// Only perform expensive lookups if NOT an ISP and NOT Unknown
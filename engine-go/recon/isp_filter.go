@@ -2,35 +2,74 @@ package recon
 
 import (
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Rule categories. Anything matched by a rule is treated as non-company traffic.
+const (
+	CategoryISP     = "isp"
+	CategoryHosting = "hosting"
+	CategoryVPN     = "vpn"
+	CategoryMobile  = "mobile"
+)
+
+// FilterRule matches an ASN by organization substring, regex pattern or AS number range.
+// A rule may combine several matchers; any one of them matching is a hit.
+type FilterRule struct {
+	Name     string `json:"name,omitempty"`
+	Category string `json:"category,omitempty"`
+	Contains string `json:"contains,omitempty"`
+	Pattern  string `json:"pattern,omitempty"`
+	ASNFrom  uint   `json:"asn_from,omitempty"`
+	ASNTo    uint   `json:"asn_to,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// FilterConfig is the on-disk format of the blacklist file.
+// The legacy format (a plain JSON array of substrings) is still accepted.
+type FilterConfig struct {
+	Rules []FilterRule `json:"rules"`
+	Allow []FilterRule `json:"allow"`
+}
+
+// FilterMatch describes why an organization was (or was not) filtered
+type FilterMatch struct {
+	ASN          uint   `json:"asn"`
+	Organization string `json:"organization"`
+	IsISP        bool   `json:"is_isp"`
+	Allowed      bool   `json:"allowed"`
+	Category     string `json:"category,omitempty"`
+	Rule         string `json:"rule,omitempty"`
+}
+
 type ISPFilter struct {
-	Blacklist []string
+	path    string
+	mu      sync.RWMutex
+	rules   []FilterRule
+	allow   []FilterRule
+	modTime time.Time
+	stop    chan struct{}
 }
 
 func NewISPFilter(path string) *ISPFilter {
 	filter := &ISPFilter{
-		Blacklist: []string{}, // Empty default
+		path:  path,
+		rules: []FilterRule{}, // Empty default
+		allow: []FilterRule{},
 	}
 
 	// Load from file if exists
 	if _, err := os.Stat(path); err == nil {
-		data, err := ioutil.ReadFile(path)
-		if err != nil {
+		if err := filter.Reload(); err != nil {
 			log.Printf("Error loading ISP blacklist: %v", err)
-			return filter
-		}
-		var list []string
-		if err := json.Unmarshal(data, &list); err != nil {
-			log.Printf("Error parsing ISP blacklist: %v", err)
-			return filter
 		}
-		filter.Blacklist = list
-		log.Printf("Loaded %d ISP filters", len(list))
 	} else {
 		log.Printf("Warning: ISP blacklist not found at %s", path)
 	}
@@ -38,12 +77,208 @@ func NewISPFilter(path string) *ISPFilter {
 	return filter
 }
 
+// Reload re-reads the rules file. On any error the previously loaded rules stay active.
+func (f *ISPFilter) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := ParseFilterConfig(data)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.rules = cfg.Rules
+	f.allow = cfg.Allow
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+
+	log.Printf("Loaded %d ISP filters (%d allow-list entries)", len(cfg.Rules), len(cfg.Allow))
+	return nil
+}
+
+// Watch polls the rules file and reloads it whenever its modification time changes
+func (f *ISPFilter) Watch(interval time.Duration) {
+	f.mu.Lock()
+	if f.stop != nil {
+		f.mu.Unlock()
+		return
+	}
+	f.stop = make(chan struct{})
+	stop := f.stop
+	f.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				info, err := os.Stat(f.path)
+				if err != nil {
+					continue
+				}
+				f.mu.RLock()
+				changed := !info.ModTime().Equal(f.modTime)
+				f.mu.RUnlock()
+				if !changed {
+					continue
+				}
+				if err := f.Reload(); err != nil {
+					log.Printf("ISP blacklist reload failed, keeping previous rules: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// StopWatching ends the background watcher started by Watch
+func (f *ISPFilter) StopWatching() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+}
+
+// Rules returns a snapshot of the active block and allow rules
+func (f *ISPFilter) Rules() FilterConfig {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return FilterConfig{
+		Rules: append([]FilterRule(nil), f.rules...),
+		Allow: append([]FilterRule(nil), f.allow...),
+	}
+}
+
+// IsISP reports whether an organization name is filtered, ignoring AS numbers
 func (f *ISPFilter) IsISP(orgName string) bool {
+	return f.Match(0, orgName).IsISP
+}
+
+// Match evaluates the allow-list first, then the block rules
+func (f *ISPFilter) Match(asn uint, orgName string) FilterMatch {
+	result := FilterMatch{ASN: asn, Organization: orgName}
 	lowerOrg := strings.ToLower(orgName)
-	for _, term := range f.Blacklist {
-		if strings.Contains(lowerOrg, term) {
-			return true
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, rule := range f.allow {
+		if rule.matches(asn, lowerOrg) {
+			result.Allowed = true
+			result.Rule = rule.label()
+			return result
 		}
 	}
+
+	for _, rule := range f.rules {
+		if rule.matches(asn, lowerOrg) {
+			result.IsISP = true
+			result.Category = rule.Category
+			result.Rule = rule.label()
+			return result
+		}
+	}
+	return result
+}
+
+func (r *FilterRule) matches(asn uint, lowerOrg string) bool {
+	if r.Contains != "" && strings.Contains(lowerOrg, r.Contains) {
+		return true
+	}
+	if r.re != nil && r.re.MatchString(lowerOrg) {
+		return true
+	}
+	if asn != 0 && r.ASNFrom != 0 && asn >= r.ASNFrom && asn <= r.ASNTo {
+		return true
+	}
 	return false
 }
+
+func (r *FilterRule) label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	switch {
+	case r.Contains != "":
+		return r.Contains
+	case r.Pattern != "":
+		return r.Pattern
+	case r.ASNFrom == r.ASNTo:
+		return fmt.Sprintf("AS%d", r.ASNFrom)
+	default:
+		return fmt.Sprintf("AS%d-AS%d", r.ASNFrom, r.ASNTo)
+	}
+}
+
+// ParseFilterConfig decodes either the legacy substring array or the structured rule format
+func ParseFilterConfig(data []byte) (FilterConfig, error) {
+	var cfg FilterConfig
+
+	var legacy []string
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		for _, term := range legacy {
+			cfg.Rules = append(cfg.Rules, FilterRule{Contains: term, Category: CategoryISP})
+		}
+	} else if err := json.Unmarshal(data, &cfg); err != nil {
+		return FilterConfig{}, fmt.Errorf("parse ISP blacklist: %w", err)
+	}
+
+	for i := range cfg.Rules {
+		if err := cfg.Rules[i].compile(); err != nil {
+			return FilterConfig{}, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if cfg.Rules[i].Category == "" {
+			cfg.Rules[i].Category = CategoryISP
+		}
+	}
+	for i := range cfg.Allow {
+		if err := cfg.Allow[i].compile(); err != nil {
+			return FilterConfig{}, fmt.Errorf("allow rule %d: %w", i, err)
+		}
+	}
+	if cfg.Rules == nil {
+		cfg.Rules = []FilterRule{}
+	}
+	if cfg.Allow == nil {
+		cfg.Allow = []FilterRule{}
+	}
+
+	return cfg, nil
+}
+
+func (r *FilterRule) compile() error {
+	r.Contains = strings.ToLower(r.Contains)
+	if r.Pattern != "" {
+		re, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", r.Pattern, err)
+		}
+		r.re = re
+	}
+	if r.ASNFrom != 0 && r.ASNTo == 0 {
+		r.ASNTo = r.ASNFrom
+	}
+	if r.ASNTo < r.ASNFrom {
+		return fmt.Errorf("invalid ASN range %d-%d", r.ASNFrom, r.ASNTo)
+	}
+	if r.Contains == "" && r.re == nil && r.ASNFrom == 0 {
+		return fmt.Errorf("rule has no contains, pattern or asn_from")
+	}
+	switch r.Category {
+	case "", CategoryISP, CategoryHosting, CategoryVPN, CategoryMobile:
+	default:
+		return fmt.Errorf("unknown category %q", r.Category)
+	}
+	return nil
+}
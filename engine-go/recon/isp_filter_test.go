@@ -0,0 +1,121 @@
+package recon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilterConfigLegacy(t *testing.T) {
+	cfg, err := ParseFilterConfig([]byte(`["Comcast", "Deutsche Telekom"]`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Rules, 2)
+	assert.Equal(t, "comcast", cfg.Rules[0].Contains)
+	assert.Equal(t, CategoryISP, cfg.Rules[0].Category)
+	assert.Equal(t, []FilterRule{}, cfg.Allow)
+}
+
+func TestParseFilterConfigRules(t *testing.T) {
+	cfg, err := ParseFilterConfig([]byte(`{
+		"rules": [
+			{"name": "Cloud", "category": "hosting", "pattern": "^(amazon|google cloud)"},
+			{"asn_from": 7922},
+			{"contains": "NordVPN", "category": "vpn"}
+		],
+		"allow": [{"contains": "Acme Corp"}]
+	}`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Rules, 3)
+	assert.Equal(t, uint(7922), cfg.Rules[1].ASNTo) // a single AS number is a one-wide range
+	assert.Equal(t, CategoryISP, cfg.Rules[1].Category)
+	assert.Equal(t, "nordvpn", cfg.Rules[2].Contains)
+	assert.Equal(t, "acme corp", cfg.Allow[0].Contains)
+}
+
+func TestParseFilterConfigErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"bad json":         `{"rules": [`,
+		"bad pattern":      `{"rules": [{"pattern": "(unclosed"}]}`,
+		"reversed range":   `{"rules": [{"asn_from": 200, "asn_to": 100}]}`,
+		"empty rule":       `{"rules": [{"name": "nothing"}]}`,
+		"unknown category": `{"rules": [{"contains": "x", "category": "satellite"}]}`,
+		"bad allow rule":   `{"allow": [{"category": "isp"}]}`,
+	} {
+		_, err := ParseFilterConfig([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func newTestFilter(t *testing.T, data string) *ISPFilter {
+	path := filepath.Join(t.TempDir(), "blacklist.json")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	return NewISPFilter(path)
+}
+
+func TestMatch(t *testing.T) {
+	f := newTestFilter(t, `{
+		"rules": [
+			{"name": "Cloud", "category": "hosting", "pattern": "^(amazon|google cloud)"},
+			{"asn_from": 7922, "asn_to": 7925},
+			{"contains": "comcast"}
+		],
+		"allow": [{"contains": "comcast business"}]
+	}`)
+
+	cases := []struct {
+		asn      uint
+		org      string
+		isISP    bool
+		allowed  bool
+		category string
+		rule     string
+	}{
+		{16509, "Amazon.com, Inc.", true, false, CategoryHosting, "Cloud"},
+		{0, "Not Amazon", false, false, "", ""},
+		{7924, "Some Org", true, false, CategoryISP, "AS7922-AS7925"},
+		{7926, "Some Org", false, false, "", ""},
+		{0, "COMCAST Cable", true, false, CategoryISP, "comcast"},
+		// The allow-list wins over block rules
+		{7922, "Comcast Business LLC", false, true, "", "comcast business"},
+	}
+	for _, c := range cases {
+		m := f.Match(c.asn, c.org)
+		assert.Equal(t, FilterMatch{ASN: c.asn, Organization: c.org, IsISP: c.isISP, Allowed: c.allowed, Category: c.category, Rule: c.rule}, m, c.org)
+	}
+
+	// IsISP ignores AS number ranges
+	assert.False(t, f.IsISP("Some Org"))
+	assert.True(t, f.IsISP("Google Cloud"))
+}
+
+func TestReloadKeepsRulesOnError(t *testing.T) {
+	f := newTestFilter(t, `["comcast"]`)
+	require.True(t, f.IsISP("Comcast"))
+
+	require.NoError(t, os.WriteFile(f.path, []byte(`{"rules": [{"pattern": "("}]}`), 0o644))
+	assert.Error(t, f.Reload())
+	assert.True(t, f.IsISP("Comcast"))
+	assert.Len(t, f.Rules().Rules, 1)
+}
+
+func TestWatchReloadsUntilStopped(t *testing.T) {
+	f := newTestFilter(t, `["comcast"]`)
+	f.Watch(10 * time.Millisecond)
+
+	write := func(data string, mod time.Time) {
+		require.NoError(t, os.WriteFile(f.path, []byte(data), 0o644))
+		require.NoError(t, os.Chtimes(f.path, mod, mod))
+	}
+	write(`["verizon"]`, time.Now().Add(time.Minute))
+	assert.Eventually(t, func() bool { return f.IsISP("Verizon") }, time.Second, 10*time.Millisecond)
+
+	f.StopWatching()
+	f.StopWatching() // stopping twice is fine
+	write(`["vodafone"]`, time.Now().Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, f.IsISP("Vodafone"))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/apex-ai/engine-go/recon"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReconHandler exposes admin endpoints for the ISP filter rules
+type ReconHandler struct {
+	engine *recon.ReconEngine
+}
+
+func NewReconHandler(engine *recon.ReconEngine) *ReconHandler {
+	return &ReconHandler{engine: engine}
+}
+
+// GetRules lists the active block rules and allow-list
+// GET /v1/recon/rules
+func (h *ReconHandler) GetRules(c *fiber.Ctx) error {
+	if h.engine == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Recon engine not available"})
+	}
+	return c.JSON(h.engine.Filter().Rules())
+}
+
+// TestRules shows how an IP is classified by the current rules
+// GET /v1/recon/rules/test?ip=1.2.3.4
+func (h *ReconHandler) TestRules(c *fiber.Ctx) error {
+	if h.engine == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Recon engine not available"})
+	}
+	ip := c.Query("ip")
+	if ip == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ip required"})
+	}
+	return c.JSON(h.engine.Classify(ip))
+}
+
+// ReloadRules forces an immediate reload of the rules file
+// POST /v1/recon/rules/reload
+func (h *ReconHandler) ReloadRules(c *fiber.Ctx) error {
+	if h.engine == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Recon engine not available"})
+	}
+	if err := h.engine.Filter().Reload(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	rules := h.engine.Filter().Rules()
+	return c.JSON(fiber.Map{
+		"status": "reloaded",
+		"rules":  len(rules.Rules),
+		"allow":  len(rules.Allow),
+	})
+}
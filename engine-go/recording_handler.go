@@ -5,7 +5,9 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"log"
+	"strings"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -51,7 +53,7 @@ func (h *RecordingHandler) IngestChunk(c *fiber.Ctx) error {
 	// Ideally client sends sequence. Let's assume sequential arrival for MVP or just query by created_at.
 	// In production, we'd want a sequence ID from client.
 
-	_, err := h.repo.db.Exec(`
+	res, err := h.repo.db.Exec(`
 		INSERT INTO wp_apex_recordings (session_id, chunk_sequence, events_blob, created_at)
 		VALUES (?, 0, ?, NOW())
 	`, payload.SessionID, compressedEvents)
@@ -61,9 +63,59 @@ func (h *RecordingHandler) IngestChunk(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Storage failed"})
 	}
 
-	// Future: Rage Click Analysis here on `payload.Events` before compression
+	// 3. Frustration detection on the uncompressed chunk
+	var events []analysis.RRWebEvent
+	signals := 0
+	if err := json.Unmarshal(payload.Events, &events); err == nil {
+		found := analysis.DetectFrustration(events)
+		recordingID, _ := res.LastInsertId()
+		if err := h.repo.SaveRecordingAnnotations(payload.SessionID, recordingID, found); err != nil {
+			log.Printf("Recording annotation error: %v", err)
+		} else {
+			signals = len(found)
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "ok", "signals": signals})
+}
+
+// SaveRecordingAnnotations stores frustration signals detected in one chunk
+func (r *Repository) SaveRecordingAnnotations(sessionID string, recordingID int64, signals []analysis.FrustrationSignal) error {
+	if len(signals) == 0 {
+		return nil
+	}
+	query := `INSERT INTO wp_apex_recording_annotations (session_id, recording_id, kind, ts_ms, x, y, node_id, hits, detail, created_at) VALUES `
+	args := make([]interface{}, 0, len(signals)*9)
+	for i, s := range signals {
+		if i > 0 {
+			query += ", "
+		}
+		query += "(?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())"
+		args = append(args, sessionID, recordingID, s.Kind, s.TimestampMs, s.X, s.Y, s.NodeID, s.Count, s.Detail)
+	}
+	_, err := r.db.Exec(query, args...)
+	return err
+}
+
+// LoadRecordingAnnotations returns a session's frustration signals in playback order
+func (r *Repository) LoadRecordingAnnotations(sessionID string) ([]analysis.FrustrationSignal, error) {
+	rows, err := r.db.Query(`
+		SELECT kind, ts_ms, x, y, node_id, hits, detail FROM wp_apex_recording_annotations
+		WHERE session_id = ? ORDER BY ts_ms ASC`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return c.JSON(fiber.Map{"status": "ok"})
+	list := []analysis.FrustrationSignal{}
+	for rows.Next() {
+		var s analysis.FrustrationSignal
+		if err := rows.Scan(&s.Kind, &s.TimestampMs, &s.X, &s.Y, &s.NodeID, &s.Count, &s.Detail); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
 }
 
 // GetSessionRecording retrieves and decompresses all chunks for a session
@@ -88,58 +140,81 @@ func (h *RecordingHandler) GetSessionRecording(c *fiber.Ctx) error {
 			continue
 		}
 
-		// Decompress
-		r, err := gzip.NewReader(bytes.NewReader(blob))
-		if err != nil {
-			continue
-		}
-
 		var chunkEvents []json.RawMessage
-		if err := json.NewDecoder(r).Decode(&chunkEvents); err == nil {
+		if err := gunzipJSON(blob, &chunkEvents); err == nil {
 			allEvents = append(allEvents, chunkEvents...)
 		}
-		r.Close()
+	}
+
+	annotations, err := h.repo.LoadRecordingAnnotations(sid)
+	if err != nil {
+		log.Printf("Recording annotation error: %v", err)
 	}
 
 	return c.JSON(fiber.Map{
-		"events": allEvents,
+		"events":      allEvents,
+		"annotations": annotations,
 	})
 }
 
+// gunzipJSON decodes a compressed events blob
+func gunzipJSON(blob []byte, v interface{}) error {
+	r, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(v)
+}
+
 // GetRecentRecordings lists valid sessions with optional filters
+// GET /v1/replay/list?filter=&segment_id=
 func (h *RecordingHandler) GetRecentRecordings(c *fiber.Ctx) error {
-	filter := c.Query("filter") // "rage", "errors", "active"
+	filter := c.Query("filter") // "rage", "errors", "dead", "thrash", "frustrated", "active"
 
 	baseQuery := `
-        SELECT r.session_id, MIN(r.created_at) as started_at, MAX(r.created_at) as last_active, COUNT(r.id) as chunks
+        SELECT r.session_id, MIN(r.created_at) as started_at, MAX(r.created_at) as last_active, COUNT(r.id) as chunks,
+            (SELECT COUNT(*) FROM wp_apex_recording_annotations a
+             WHERE a.session_id = r.session_id AND a.kind <> 'console_error') as signals
         FROM wp_apex_recordings r
     `
 	groupBy := ` GROUP BY r.session_id ORDER BY last_active DESC LIMIT 50`
+	hasSignal := func(kinds ...string) string {
+		return `EXISTS (SELECT 1 FROM wp_apex_recording_annotations a
+            WHERE a.session_id = r.session_id AND a.kind IN ('` + strings.Join(kinds, "', '") + `'))`
+	}
 
-	var query string
-	var args []interface{}
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
+	where := "1=1"
 	switch filter {
 	case "rage":
-		query = baseQuery + `
-            JOIN wp_apex_events e ON r.session_id = e.session_id
-            WHERE e.event_name = 'rage_click'
-        ` + groupBy
+		// Tracker rage clicks count too, for sessions recorded before detection ran on chunks
+		where = `(` + hasSignal(analysis.SignalRageClick) + `
+            OR EXISTS (SELECT 1 FROM wp_apex_events e WHERE e.session_id = r.session_id AND e.event_type = 'rage_click'))`
 	case "errors":
-		query = baseQuery + `
-            JOIN wp_apex_events e ON r.session_id = e.session_id
-            WHERE e.event_name = 'console_error'
-        ` + groupBy
-	case "active":
-		query = `
-			SELECT r.session_id, MIN(r.created_at) as started_at, MAX(r.created_at) as last_active, COUNT(r.id) as chunks
-			FROM wp_apex_recordings r
+		where = `(` + hasSignal(analysis.SignalErrorClick, analysis.SignalConsoleError) + `
+            OR EXISTS (SELECT 1 FROM wp_apex_events e WHERE e.session_id = r.session_id AND e.event_type = 'console_error'))`
+	case "dead":
+		where = hasSignal(analysis.SignalDeadClick)
+	case "thrash":
+		where = hasSignal(analysis.SignalThrashedMouse)
+	case "frustrated":
+		where = hasSignal(analysis.SignalRageClick, analysis.SignalDeadClick,
+			analysis.SignalErrorClick, analysis.SignalThrashedMouse)
+	}
+	segFilter, args := segment.SessionFilter("r.session_id")
+
+	query := baseQuery + ` WHERE ` + where + segFilter + groupBy
+	if filter == "active" {
+		query = baseQuery + ` WHERE ` + where + segFilter + `
 			GROUP BY r.session_id
 			HAVING last_active > DATE_SUB(NOW(), INTERVAL 5 MINUTE)
 			ORDER BY last_active DESC LIMIT 50
 		`
-	default:
-		query = baseQuery + groupBy
 	}
 
 	rows, err := h.repo.db.Query(query, args...)
@@ -154,13 +229,14 @@ func (h *RecordingHandler) GetRecentRecordings(c *fiber.Ctx) error {
 		StartedAt  string `json:"started_at"`
 		LastActive string `json:"last_active"`
 		Chunks     int    `json:"chunks"`
+		Signals    int    `json:"signals"` // frustration annotations, excluding bare console errors
 		IsActive   bool   `json:"is_active,omitempty"`
 	}
 
 	var recordings []RecordingSummary
 	for rows.Next() {
 		var r RecordingSummary
-		if err := rows.Scan(&r.SessionID, &r.StartedAt, &r.LastActive, &r.Chunks); err != nil {
+		if err := rows.Scan(&r.SessionID, &r.StartedAt, &r.LastActive, &r.Chunks, &r.Signals); err != nil {
 			continue
 		}
 		// Calculate IsActive (redundant for "active" filter but useful for "all")
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+type RedirectHandler struct {
+	repo *Repository
+}
+
+func NewRedirectHandler(repo *Repository) *RedirectHandler {
+	return &RedirectHandler{repo: repo}
+}
+
+// Redirect is an accepted redirect rule
+type Redirect struct {
+	ID          int     `json:"id"`
+	Source      string  `json:"source"`
+	Target      string  `json:"target"`
+	StatusCode  int     `json:"status_code"`
+	Confidence  float64 `json:"confidence"`
+	Active      bool    `json:"active"`
+	Hits        int     `json:"hits"`
+	LastHitAt   *string `json:"last_hit_at"`
+	CreatedAt   string  `json:"created_at"`
+	Residual404 int     `json:"residual_404s"` // 404s on the source logged since the rule was created
+}
+
+// GetSuggestions fuzzy-matches the most frequent 404 paths without a redirect against known-good URLs
+// GET /v1/redirects/suggestions?range=30d (or start=&end=, or the older days=30)&min_confidence=0.5&limit=50
+func (h *RedirectHandler) GetSuggestions(c *fiber.Ctx) error {
+	period, err := dateRangeOrDaysFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	minConfidence := c.QueryFloat("min_confidence", 0.5)
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || minConfidence < 0 || minConfidence > 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be positive and min_confidence 0-1"})
+	}
+
+	rows, err := h.repo.db.Query(`SELECT url, COUNT(*) FROM wp_apex_404_logs WHERE created_at >= ? AND created_at < ? GROUP BY url`,
+		period.Start, period.End)
+	if err != nil {
+		log.Printf("[Redirect Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	broken := map[string]int{}
+	for rows.Next() {
+		var url string
+		var n int
+		if rows.Scan(&url, &n) == nil {
+			broken[analysis.RedirectPath(url)] += n
+		}
+	}
+	rows.Close()
+
+	existing, err := h.sourcePaths()
+	if err != nil {
+		log.Printf("[Redirect Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	candidates, err := h.knownGoodPaths(broken)
+	if err != nil {
+		log.Printf("[Redirect Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	type item struct {
+		Path       string                       `json:"path"`
+		Count      int                          `json:"count"`
+		Suggestion *analysis.RedirectSuggestion `json:"suggestion"`
+	}
+	var items []item
+	for path, n := range broken {
+		if !existing[path] && path != "/" {
+			items = append(items, item{Path: path, Count: n})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Path < items[j].Path
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	for i := range items {
+		items[i].Suggestion = analysis.SuggestRedirect(items[i].Path, candidates, minConfidence)
+	}
+	if items == nil {
+		items = []item{}
+	}
+	return c.JSON(items)
+}
+
+// knownGoodPaths collects paths that have served pageviews recently or are known posts,
+// minus anything that is itself logged as a 404
+func (h *RedirectHandler) knownGoodPaths(broken map[string]int) ([]string, error) {
+	seen := map[string]bool{}
+	var paths []string
+	add := func(url string) {
+		p := analysis.RedirectPath(url)
+		if p == "/" || seen[p] || broken[p] > 0 {
+			return
+		}
+		seen[p] = true
+		paths = append(paths, p)
+	}
+
+	rows, err := h.repo.db.Query(`SELECT DISTINCT url FROM wp_apex_events
+		WHERE event_type = 'pageview' AND created_at >= DATE_SUB(NOW(), INTERVAL 180 DAY)`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var url string
+		if rows.Scan(&url) == nil {
+			add(url)
+		}
+	}
+	rows.Close()
+
+	rows, err = h.repo.db.Query(`SELECT url FROM wp_apex_post_meta`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var url string
+		if rows.Scan(&url) == nil {
+			add(url)
+		}
+	}
+	return paths, rows.Err()
+}
+
+func (h *RedirectHandler) sourcePaths() (map[string]bool, error) {
+	rows, err := h.repo.db.Query(`SELECT source_path FROM wp_apex_redirects`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]bool{}
+	for rows.Next() {
+		var p string
+		if rows.Scan(&p) == nil {
+			out[p] = true
+		}
+	}
+	return out, rows.Err()
+}
+
+// GetRedirects lists redirect rules with hit counts and any 404s still logged for their source
+// GET /v1/redirects
+func (h *RedirectHandler) GetRedirects(c *fiber.Ctx) error {
+	redirects, err := h.loadRedirects(false)
+	if err != nil {
+		log.Printf("[Redirect Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.countResidual404s(redirects); err != nil {
+		log.Printf("[Redirect Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(redirects)
+}
+
+// countResidual404s counts the 404s logged on each rule's exact source path since the rule was
+// created, reading the log once from the oldest rule on
+func (h *RedirectHandler) countResidual404s(redirects []Redirect) error {
+	if len(redirects) == 0 {
+		return nil
+	}
+	bySource := map[string]*Redirect{}
+	oldest := redirects[0].CreatedAt
+	for i := range redirects {
+		r := &redirects[i]
+		bySource[r.Source] = r
+		if r.CreatedAt < oldest {
+			oldest = r.CreatedAt
+		}
+	}
+
+	rows, err := h.repo.db.Query(`
+		SELECT url, DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s') AS logged_at, COUNT(*)
+		FROM wp_apex_404_logs WHERE created_at >= ? GROUP BY url, logged_at`, oldest)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var url, loggedAt string
+		var n int
+		if err := rows.Scan(&url, &loggedAt, &n); err != nil {
+			return err
+		}
+		// Timestamps share one layout, so they compare as strings
+		if r, ok := bySource[analysis.RedirectPath(url)]; ok && loggedAt >= r.CreatedAt {
+			r.Residual404 += n
+		}
+	}
+	return rows.Err()
+}
+
+func (h *RedirectHandler) loadRedirects(activeOnly bool) ([]Redirect, error) {
+	query := `SELECT id, source_path, target_url, status_code, confidence, is_active, hits,
+		DATE_FORMAT(last_hit_at, '%Y-%m-%d %H:%i:%s'), DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s') FROM wp_apex_redirects`
+	if activeOnly {
+		query += ` WHERE is_active = 1`
+	}
+	query += ` ORDER BY source_path`
+
+	rows, err := h.repo.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	redirects := []Redirect{}
+	for rows.Next() {
+		var r Redirect
+		if err := rows.Scan(&r.ID, &r.Source, &r.Target, &r.StatusCode, &r.Confidence, &r.Active, &r.Hits, &r.LastHitAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		redirects = append(redirects, r)
+	}
+	return redirects, rows.Err()
+}
+
+// CreateRedirect accepts a redirect (typically a suggestion); re-posting a source updates it
+// POST /v1/redirects  {source, target, status_code, confidence}
+func (h *RedirectHandler) CreateRedirect(c *fiber.Ctx) error {
+	var req Redirect
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
+	}
+	switch req.StatusCode {
+	case 0:
+		req.StatusCode = 301
+	case 301, 302, 307, 308, 410:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "status_code must be 301, 302, 307, 308 or 410"})
+	}
+	source := analysis.RedirectPath(req.Source)
+	req.Target = strings.TrimSpace(req.Target)
+	if req.Source == "" || source == "/" || (req.Target == "" && req.StatusCode != 410) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "source and target are required"})
+	}
+	// Decoding %0A and friends must not smuggle line breaks into exported server config
+	if hasControlChars(req.Source) || hasControlChars(source) || hasControlChars(req.Target) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "source and target must not contain control characters"})
+	}
+	if req.Target != "" && analysis.RedirectPath(req.Target) == source {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "target redirects to itself"})
+	}
+
+	// LAST_INSERT_ID(id) makes the update path report the existing row's id
+	res, err := h.repo.db.Exec(`
+		INSERT INTO wp_apex_redirects (source_path, target_url, status_code, confidence, is_active)
+		VALUES (?, ?, ?, ?, 1)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), target_url = VALUES(target_url), status_code = VALUES(status_code),
+			confidence = VALUES(confidence), is_active = 1`,
+		source, req.Target, req.StatusCode, req.Confidence)
+	if err != nil {
+		log.Printf("[Redirect Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save redirect"})
+	}
+	id, _ := res.LastInsertId()
+	return c.JSON(fiber.Map{"id": id, "source": source, "target": req.Target, "status_code": req.StatusCode})
+}
+
+// DeleteRedirect removes a redirect rule
+// DELETE /v1/redirects/:id
+func (h *RedirectHandler) DeleteRedirect(c *fiber.Ctx) error {
+	if _, err := h.repo.db.Exec(`DELETE FROM wp_apex_redirects WHERE id = ?`, c.Params("id")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete redirect"})
+	}
+	return c.JSON(fiber.Map{"status": "deleted"})
+}
+
+// RecordHit counts a redirect served by the plugin
+// POST /v1/redirects/hit  {source}
+func (h *RedirectHandler) RecordHit(c *fiber.Ctx) error {
+	var req struct {
+		Source string `json:"source"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Source == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "source is required"})
+	}
+	res, err := h.repo.db.Exec(`UPDATE wp_apex_redirects SET hits = hits + 1, last_hit_at = NOW() WHERE source_path = ?`,
+		analysis.RedirectPath(req.Source))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record hit"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown redirect"})
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// ExportRedirects renders active redirects for the WordPress plugin (json), nginx or Apache.
+// Sources are stored lowercased without a trailing slash, so server rules match them
+// case-insensitively with an optional trailing slash.
+// GET /v1/redirects/export?format=json|nginx|htaccess
+func (h *RedirectHandler) ExportRedirects(c *fiber.Ctx) error {
+	redirects, err := h.loadRedirects(true)
+	if err != nil {
+		log.Printf("[Redirect Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var b strings.Builder
+	switch c.Query("format", "json") {
+	case "json":
+		type rule struct {
+			Source     string `json:"source"`
+			Target     string `json:"target"`
+			StatusCode int    `json:"status_code"`
+		}
+		rules := make([]rule, 0, len(redirects))
+		for _, r := range redirects {
+			rules = append(rules, rule{r.Source, r.Target, r.StatusCode})
+		}
+		return c.JSON(rules)
+	case "nginx":
+		b.WriteString("# Apex redirects - include inside the server block\n")
+		for _, r := range redirects {
+			if r.StatusCode == 410 {
+				fmt.Fprintf(&b, "location ~* %s { return 410; }\n", nginxQuote(sourcePattern(r.Source)))
+				continue
+			}
+			fmt.Fprintf(&b, "location ~* %s { return %d %s; }\n", nginxQuote(sourcePattern(r.Source)), r.StatusCode, nginxQuote(redirectTarget(r.Target)))
+		}
+	case "htaccess":
+		b.WriteString("# Apex redirects (mod_alias)\n")
+		for _, r := range redirects {
+			if r.StatusCode == 410 {
+				fmt.Fprintf(&b, "RedirectMatch gone %s\n", apacheQuote("(?i)"+sourcePattern(r.Source)))
+				continue
+			}
+			fmt.Fprintf(&b, "RedirectMatch %d %s %s\n", r.StatusCode, apacheQuote("(?i)"+sourcePattern(r.Source)), apacheQuote(redirectTarget(r.Target)))
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be json, nginx or htaccess"})
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.SendString(b.String())
+}
+
+func hasControlChars(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
+
+// sourcePattern is an anchored regex for a source path with an optional trailing slash.
+// Control characters are written as \x{..} escapes so a rule never spans lines.
+func sourcePattern(source string) string {
+	var b strings.Builder
+	for _, r := range regexp.QuoteMeta(source) {
+		if unicode.IsControl(r) {
+			fmt.Fprintf(&b, `\x{%x}`, r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return "^" + b.String() + "/?$"
+}
+
+// redirectTarget percent-encodes $, which nginx expands as a variable and Apache as a
+// back-reference, and control characters
+func redirectTarget(target string) string {
+	var b strings.Builder
+	for _, r := range target {
+		if r != '$' && !unicode.IsControl(r) {
+			b.WriteRune(r)
+			continue
+		}
+		for _, c := range []byte(string(r)) {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// nginxQuote quotes values containing whitespace, braces, semicolons, quotes, comments or
+// backslashes; nginx unescapes \\ and \" inside quotes
+func nginxQuote(s string) string {
+	if strings.ContainsAny(s, " \t{};\"'#\\") {
+		return configQuote(s)
+	}
+	return s
+}
+
+// apacheQuote quotes values containing whitespace, quotes or backslashes; Apache unescapes
+// \\ and \" inside quotes
+func apacheQuote(s string) string {
+	if strings.ContainsAny(s, " \t\"\\") {
+		return configQuote(s)
+	}
+	return s
+}
+
+func configQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
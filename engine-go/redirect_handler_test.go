@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedirectTestApp(t *testing.T) (*fiber.App, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	h := NewRedirectHandler(&Repository{db: db})
+	app := fiber.New()
+	app.Get("/v1/redirects", h.GetRedirects)
+	app.Post("/v1/redirects", h.CreateRedirect)
+	app.Get("/v1/redirects/export", h.ExportRedirects)
+	return app, mock
+}
+
+var redirectColumns = []string{"id", "source_path", "target_url", "status_code", "confidence", "is_active", "hits", "last_hit_at", "created_at"}
+
+func TestCreateRedirectReturnsExistingID(t *testing.T) {
+	app, mock := newRedirectTestApp(t)
+	// An upsert that updates reports two affected rows and the id set by LAST_INSERT_ID(id)
+	mock.ExpectExec("ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID\\(id\\)").
+		WithArgs("/old-post", "/new-post", 301, 0.9).
+		WillReturnResult(sqlmock.NewResult(7, 2))
+
+	req := httptest.NewRequest("POST", "/v1/redirects", strings.NewReader(`{"source": "https://site.com/Old-Post/", "target": "/new-post", "confidence": 0.9}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, 7.0, body["id"])
+	assert.Equal(t, "/old-post", body["source"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetRedirectsCountsResidual404sInOneQuery(t *testing.T) {
+	app, mock := newRedirectTestApp(t)
+	mock.ExpectQuery("FROM wp_apex_redirects").WillReturnRows(sqlmock.NewRows(redirectColumns).
+		AddRow(1, "/old-post", "/new-post", 301, 0.9, true, 3, nil, "2024-05-01 10:00:00").
+		AddRow(2, "/shop/old", "/shop", 301, 0.8, true, 0, nil, "2024-05-10 00:00:00"))
+	mock.ExpectQuery("FROM wp_apex_404_logs WHERE created_at >= \\? GROUP BY url, logged_at").
+		WithArgs("2024-05-01 10:00:00").
+		WillReturnRows(sqlmock.NewRows([]string{"url", "logged_at", "count"}).
+			AddRow("https://site.com/Old-Post/", "2024-05-02 08:00:00", 2).
+			AddRow("https://site.com/old-post?ref=x", "2024-05-03 08:00:00", 1).
+			AddRow("https://site.com/blog/old-post", "2024-05-03 08:00:00", 5). // a different path
+			AddRow("https://site.com/shop/old", "2024-05-05 08:00:00", 4))      // before the rule
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/redirects", nil))
+	require.NoError(t, err)
+	var redirects []Redirect
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&redirects))
+	require.Len(t, redirects, 2)
+	assert.Equal(t, 3, redirects[0].Residual404)
+	assert.Equal(t, 0, redirects[1].Residual404)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportRedirectsMatchesSlashAndCase(t *testing.T) {
+	for format, want := range map[string]string{
+		"nginx": `location ~* "^/old\\.html/?$" { return 301 /new; }` + "\n" +
+			"location ~* ^/gone/?$ { return 410; }\n",
+		"htaccess": `RedirectMatch 301 "(?i)^/old\\.html/?$" /new` + "\n" +
+			"RedirectMatch gone (?i)^/gone/?$\n",
+	} {
+		app, mock := newRedirectTestApp(t)
+		mock.ExpectQuery("FROM wp_apex_redirects WHERE is_active = 1").WillReturnRows(sqlmock.NewRows(redirectColumns).
+			AddRow(1, "/old.html", "/new", 301, 1.0, true, 0, nil, "2024-05-01 10:00:00").
+			AddRow(2, "/gone", "", 410, 1.0, true, 0, nil, "2024-05-01 10:00:00"))
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/redirects/export?format="+format, nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(body), want, format)
+	}
+}
+
+func TestCreateRedirectRejectsControlCharacters(t *testing.T) {
+	for _, body := range []string{
+		`{"source": "/old%0Areturn 200", "target": "/new"}`,
+		`{"source": "/old", "target": "/new\nreturn 200"}`,
+		`{"source": "/old\r", "target": "/new"}`,
+	} {
+		app, mock := newRedirectTestApp(t)
+		req := httptest.NewRequest("POST", "/v1/redirects", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, body)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestExportRedirectsEscapesServerSyntax(t *testing.T) {
+	for format, want := range map[string]string{
+		"nginx": `location ~* "^/a \"b\"/?$" { return 301 /price%24?x=1; }` + "\n" +
+			`location ~* "^/c\\x{a}d/?$" { return 302 "/e f"; }` + "\n",
+		"htaccess": `RedirectMatch 301 "(?i)^/a \"b\"/?$" /price%24?x=1` + "\n" +
+			`RedirectMatch 302 "(?i)^/c\\x{a}d/?$" "/e f"` + "\n",
+	} {
+		app, mock := newRedirectTestApp(t)
+		// The newline predates validation; it must still not break the rule onto two lines
+		mock.ExpectQuery("FROM wp_apex_redirects WHERE is_active = 1").WillReturnRows(sqlmock.NewRows(redirectColumns).
+			AddRow(1, `/a "b"`, "/price$?x=1", 301, 1.0, true, 0, nil, "2024-05-01 10:00:00").
+			AddRow(2, "/c\nd", "/e f", 302, 1.0, true, 0, nil, "2024-05-01 10:00:00"))
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/redirects/export?format="+format, nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(body), want, format)
+	}
+}
@@ -300,6 +300,255 @@ func (r *Repository) Migrate() {
 			INDEX idx_cmd_status (status),
 			FOREIGN KEY (instance_id) REFERENCES wp_apex_instances(id) ON DELETE CASCADE
 		)`,
+		// Funnel definitions (reusable by reports and automation rules)
+		`CREATE TABLE IF NOT EXISTS wp_apex_funnels (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			definition JSON,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_anomalies (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			metric VARCHAR(50) NOT NULL,
+			granularity VARCHAR(10) NOT NULL,
+			bucket_start DATETIME NOT NULL,
+			value DOUBLE,
+			expected DOUBLE,
+			score DOUBLE,
+			direction VARCHAR(10),
+			breakdown JSON,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_anomaly (metric, granularity, bucket_start),
+			INDEX idx_anomaly_bucket (bucket_start)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_stock_snapshots (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			sku VARCHAR(100) NOT NULL,
+			product_name VARCHAR(255),
+			stock DOUBLE NOT NULL,
+			recorded_at DATETIME NOT NULL,
+			INDEX idx_stock_sku (sku, recorded_at)
+		)`,
+		// Last low-stock status alerted per SKU, so alerts only fire when the status changes
+		`CREATE TABLE IF NOT EXISTS wp_apex_stock_alerts (
+			sku VARCHAR(100) PRIMARY KEY,
+			status VARCHAR(20) NOT NULL,
+			alerted_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_content_decay_history (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			url VARCHAR(512) NOT NULL,
+			post_id BIGINT DEFAULT 0,
+			mode VARCHAR(10),
+			window_days INT,
+			current_views INT,
+			previous_views INT,
+			change_pct DOUBLE,
+			p_value DOUBLE,
+			run_at DATE NOT NULL,
+			UNIQUE KEY unique_decay_run (url(191), mode, window_days, run_at),
+			INDEX idx_decay_post (post_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_gsc_rows (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			date DATE NOT NULL,
+			query VARCHAR(255) NOT NULL,
+			page VARCHAR(512) NOT NULL,
+			device VARCHAR(20) NOT NULL DEFAULT '',
+			country VARCHAR(3) NOT NULL DEFAULT '',
+			clicks INT DEFAULT 0,
+			impressions INT DEFAULT 0,
+			ctr DOUBLE DEFAULT 0,
+			position DOUBLE DEFAULT 0,
+			UNIQUE KEY unique_gsc_row (date, query(191), page(191), device, country),
+			INDEX idx_gsc_query (query(191))
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_ga4_daily (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			date DATE NOT NULL,
+			source_medium VARCHAR(255) NOT NULL,
+			device VARCHAR(20) NOT NULL DEFAULT '',
+			landing_page VARCHAR(512) NOT NULL,
+			active_users INT DEFAULT 0,
+			sessions INT DEFAULT 0,
+			page_views INT DEFAULT 0,
+			UNIQUE KEY unique_ga4_row (date, source_medium(100), device, landing_page(191))
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_ga4_totals (
+			date DATE PRIMARY KEY,
+			active_users INT DEFAULT 0,
+			sessions INT DEFAULT 0,
+			page_views INT DEFAULT 0,
+			bounce_rate DOUBLE DEFAULT 0,
+			avg_session_duration DOUBLE DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_post_meta (
+			post_id BIGINT PRIMARY KEY,
+			url VARCHAR(512) NOT NULL,
+			title VARCHAR(255),
+			author_id BIGINT DEFAULT 0,
+			author_name VARCHAR(255),
+			published_at DATETIME NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			INDEX idx_post_meta_url (url(191)),
+			INDEX idx_post_meta_author (author_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_post_readability (
+			post_id BIGINT PRIMARY KEY,
+			url VARCHAR(512) NOT NULL,
+			title VARCHAR(255),
+			words INT DEFAULT 0,
+			sentences INT DEFAULT 0,
+			syllables INT DEFAULT 0,
+			flesch_reading_ease DOUBLE DEFAULT 0,
+			flesch_kincaid_grade DOUBLE DEFAULT 0,
+			avg_sentence_length DOUBLE DEFAULT 0,
+			long_sentence_pct DOUBLE DEFAULT 0,
+			passive_ratio DOUBLE DEFAULT 0,
+			read_time DOUBLE DEFAULT 0,
+			scored_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			INDEX idx_readability_url (url(191))
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_redirects (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			source_path VARCHAR(512) NOT NULL,
+			target_url VARCHAR(1024) NOT NULL,
+			status_code SMALLINT DEFAULT 301,
+			confidence DOUBLE DEFAULT 0,
+			is_active BOOLEAN DEFAULT TRUE,
+			hits INT DEFAULT 0,
+			last_hit_at DATETIME NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_redirect_source (source_path(191))
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_form_sessions (
+			form_id VARCHAR(191) NOT NULL,
+			session_id VARCHAR(191) NOT NULL,
+			device VARCHAR(20) NOT NULL DEFAULT 'desktop',
+			started_at DATETIME NOT NULL,
+			started_ms BIGINT NOT NULL,
+			last_ms BIGINT NOT NULL,
+			last_field VARCHAR(255) NOT NULL DEFAULT '',
+			submitted BOOLEAN DEFAULT FALSE,
+			submitted_ms BIGINT DEFAULT 0,
+			rage_clicks INT DEFAULT 0,
+			PRIMARY KEY (form_id, session_id),
+			INDEX idx_form_sessions_started (started_at)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_form_session_fields (
+			form_id VARCHAR(191) NOT NULL,
+			session_id VARCHAR(191) NOT NULL,
+			field VARCHAR(191) NOT NULL,
+			first_ms BIGINT NOT NULL,
+			focuses INT DEFAULT 0,
+			blurs INT DEFAULT 0,
+			changes INT DEFAULT 0,
+			errors INT DEFAULT 0,
+			dwell_ms DOUBLE DEFAULT 0,
+			PRIMARY KEY (form_id, session_id, field)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_form_suggestions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			form_id VARCHAR(191) NOT NULL,
+			range_days INT NOT NULL,
+			suggestions TEXT NOT NULL,
+			metrics_snapshot LONGTEXT NOT NULL,
+			starters INT DEFAULT 0,
+			completions INT DEFAULT 0,
+			completion_rate DOUBLE DEFAULT 0,
+			applied_at DATETIME NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_form_suggestions_form (form_id, created_at)
+		)`,
+		`ALTER TABLE wp_apex_recordings ADD COLUMN heatmap_done TINYINT(1) DEFAULT 0`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_heatmap_cells (
+			url_path VARCHAR(191) NOT NULL,
+			device VARCHAR(20) NOT NULL,
+			day DATE NOT NULL,
+			cell_col SMALLINT NOT NULL,
+			cell_row INT NOT NULL,
+			clicks INT DEFAULT 0,
+			PRIMARY KEY (url_path, device, day, cell_col, cell_row)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_heatmap_selectors (
+			url_path VARCHAR(191) NOT NULL,
+			device VARCHAR(20) NOT NULL,
+			day DATE NOT NULL,
+			selector VARCHAR(191) NOT NULL,
+			clicks INT DEFAULT 0,
+			offset_x_sum DOUBLE DEFAULT 0,
+			offset_y_sum DOUBLE DEFAULT 0,
+			offset_n INT DEFAULT 0,
+			PRIMARY KEY (url_path, device, day, selector)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_heatmap_scroll (
+			url_path VARCHAR(191) NOT NULL,
+			device VARCHAR(20) NOT NULL,
+			session_id VARCHAR(191) NOT NULL,
+			day DATE NOT NULL,
+			reach_pct DOUBLE DEFAULT -1,
+			reach_px INT DEFAULT 0,
+			PRIMARY KEY (url_path, device, session_id),
+			INDEX idx_heatmap_scroll_day (url_path, day)
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_heatmap_cursor (
+			source VARCHAR(20) PRIMARY KEY,
+			last_id BIGINT NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS wp_apex_recording_annotations (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			session_id VARCHAR(255) NOT NULL,
+			recording_id BIGINT NOT NULL,
+			kind VARCHAR(20) NOT NULL,
+			ts_ms BIGINT NOT NULL,
+			x DOUBLE DEFAULT 0,
+			y DOUBLE DEFAULT 0,
+			node_id INT DEFAULT 0,
+			hits INT DEFAULT 0,
+			detail VARCHAR(255) DEFAULT '',
+			created_at DATETIME,
+			INDEX idx_annotation_session (session_id, kind),
+			INDEX idx_annotation_kind (kind, created_at)
+		)`,
+		// Split tests; exposures are experiment_exposure events keyed by experiment_key
+		`CREATE TABLE IF NOT EXISTS wp_apex_experiments (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			experiment_key VARCHAR(100) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			definition JSON,
+			started_at DATETIME NOT NULL,
+			stopped_at DATETIME NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY unique_experiment_key (experiment_key)
+		)`,
+		// Customer model, rebuilt from order_completed events (RFM scores and predicted lifetime value)
+		`CREATE TABLE IF NOT EXISTS wp_apex_customers (
+			customer_key VARCHAR(191) PRIMARY KEY,
+			email VARCHAR(191) DEFAULT '',
+			first_order DATETIME NOT NULL,
+			last_order DATETIME NOT NULL,
+			orders INT DEFAULT 0,
+			revenue DOUBLE DEFAULT 0,
+			aov DOUBLE DEFAULT 0,
+			recency_days INT DEFAULT 0,
+			r_score TINYINT DEFAULT 0,
+			f_score TINYINT DEFAULT 0,
+			m_score TINYINT DEFAULT 0,
+			rfm_segment VARCHAR(30) NOT NULL,
+			alive_probability DOUBLE DEFAULT 0,
+			predicted_orders DOUBLE DEFAULT 0,
+			predicted_value DOUBLE DEFAULT 0,
+			updated_at DATETIME,
+			INDEX idx_customer_segment (rfm_segment)
+		)`,
+		// Visitors a customer browsed as, so customer fields work as segment criteria
+		`CREATE TABLE IF NOT EXISTS wp_apex_customer_visitors (
+			customer_key VARCHAR(191) NOT NULL,
+			fingerprint VARCHAR(64) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (customer_key, fingerprint),
+			INDEX idx_customer_visitor (fingerprint)
+		)`,
 	}
 
 	for _, q := range queries {
@@ -401,12 +650,17 @@ func (r *Repository) SaveEvent(event Event) error {
 		}
 	}
 
-	// Update or insert the session
+	// Update or insert the session; the first event decides its referrer and landing page.
+	// Only pageviews count as pages, so clicks and other events don't turn bounces into visits.
+	pages := 0
+	if event.Type == "pageview" {
+		pages = 1
+	}
 	_, err = r.db.Exec(`
-		INSERT INTO wp_apex_sessions (session_id, fingerprint, started_at, last_activity, page_count)
-		VALUES (?, ?, NOW(), NOW(), 1)
-		ON DUPLICATE KEY UPDATE last_activity = NOW(), page_count = page_count + 1
-	`, event.SessionID, fingerprint)
+		INSERT INTO wp_apex_sessions (session_id, fingerprint, started_at, last_activity, page_count, referrer, landing_page)
+		VALUES (?, ?, NOW(), NOW(), ?, ?, ?)
+		ON DUPLICATE KEY UPDATE last_activity = NOW(), page_count = page_count + VALUES(page_count)
+	`, event.SessionID, fingerprint, pages, event.Referrer, event.URL)
 	if err != nil {
 		log.Printf("Error inserting session: %v", err)
 	}
@@ -418,6 +672,11 @@ func (r *Repository) SaveEvent(event Event) error {
 		VALUES (?, ?, ?, ?, ?, NOW())
 	`, event.SessionID, event.Type, event.URL, event.Referrer, dataJSON)
 
+	// Orders arrive with the buyer's IP and user agent, so this fingerprint is the shopper's own
+	// even when the session is the shared webhook one
+	if err == nil && event.Type == "order_completed" {
+		r.LinkCustomerVisitor(event.Data, fingerprint)
+	}
 	return err
 }
 
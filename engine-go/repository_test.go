@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,7 +21,7 @@ func TestSaveEvent(t *testing.T) {
 
 	// Define event
 	event := Event{
-		Type:        "page_view",
+		Type:        "pageview",
 		SessionID:   "sess_123",
 		Timestamp:   time.Now().Unix(),
 		URL:         "https://example.com",
@@ -51,6 +52,9 @@ func TestSaveEvent(t *testing.T) {
 		WithArgs(
 			event.SessionID,
 			sqlmock.AnyArg(), // fingerprint
+			1,                // page_count
+			event.Referrer,
+			event.URL,
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
@@ -73,6 +77,27 @@ func TestSaveEvent(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSaveEventOnlyCountsPageviewsAsPages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("stub db error: %s", err)
+	}
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	event := Event{Type: "heatmap_click", SessionID: "sess_123", URL: "https://example.com", IP: "127.0.0.1", UserAgent: "Mozilla/5.0"}
+
+	mock.ExpectExec("INSERT INTO wp_apex_visitors").WillReturnResult(sqlmock.NewResult(1, 1))
+	// A click neither starts nor extends the page count, so the session can still bounce
+	mock.ExpectExec("INSERT INTO wp_apex_sessions .* page_count = page_count \\+ VALUES\\(page_count\\)").
+		WithArgs(event.SessionID, sqlmock.AnyArg(), 0, event.Referrer, event.URL).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO wp_apex_events").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	assert.NoError(t, repo.SaveEvent(event))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetDailyStats(t *testing.T) {
 	db, _, err := sqlmock.New()
 	if err != nil {
@@ -86,3 +111,66 @@ func TestGetDailyStats(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1200, stats["visitors"])
 }
+
+func TestRunCompiledQueryTypedValues(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("stub db error: %s", err)
+	}
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	q := analysis.CompiledQuery{
+		SQL:  "SELECT x",
+		Args: []interface{}{5},
+		Columns: []analysis.QueryColumn{
+			{Name: "date", Type: analysis.ColumnDate},
+			{Name: "pageviews", Type: analysis.ColumnInteger},
+			{Name: "bounce_rate", Type: analysis.ColumnPercent},
+		},
+	}
+	// The driver hands DECIMAL and text results back as bytes
+	mock.ExpectQuery("SELECT x").WithArgs(5).WillReturnRows(
+		sqlmock.NewRows([]string{"date", "pageviews", "bounce_rate"}).
+			AddRow([]byte("2024-03-01"), []byte("42"), []byte("37.5")).
+			AddRow([]byte("2024-03-02"), []byte("0"), nil))
+
+	result, err := repo.RunCompiledQuery(q)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]interface{}{
+		{"2024-03-01", int64(42), 37.5},
+		{"2024-03-02", int64(0), nil},
+	}, result.Rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadCustomerOrders(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("stub db error: %s", err)
+	}
+	defer db.Close()
+
+	repo := &Repository{db: db}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT e.payload, e.session_id").WillReturnRows(
+		sqlmock.NewRows([]string{"payload", "session_id", "fingerprint", "created_at"}).
+			// Webhook order: keyed by email, the shared session is not linked
+			AddRow([]byte(`{"revenue": 80.5, "customer_email": " Ann@Shop.com "}`), "system_woo_webhook", "fp_first_buyer", at).
+			// Tracked order with the older email property
+			AddRow([]byte(`{"revenue": "20", "email": "ann@shop.com"}`), "sess_1", "fp_ann", at).
+			// Anonymous tracked order falls back to the visitor
+			AddRow([]byte(`{"revenue": 15}`), "sess_2", "fp_guest", at).
+			// Anonymous webhook order cannot be attributed
+			AddRow([]byte(`{"revenue": 99}`), "system_woo_webhook", "fp_first_buyer", at))
+
+	orders, links, err := repo.LoadCustomerOrders()
+	assert.NoError(t, err)
+	assert.Equal(t, []analysis.CustomerOrder{
+		{CustomerID: "ann@shop.com", Email: "ann@shop.com", Time: at, Revenue: 80.5},
+		{CustomerID: "ann@shop.com", Email: "ann@shop.com", Time: at, Revenue: 20},
+		{CustomerID: "visitor:fp_guest", Time: at, Revenue: 15},
+	}, orders)
+	assert.Equal(t, []customerLink{{"ann@shop.com", "fp_ann"}, {"visitor:fp_guest", "fp_guest"}}, links)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
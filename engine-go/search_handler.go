@@ -2,11 +2,16 @@ package main
 
 import (
 	"log"
+	"strings"
 	"time"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
+// searchSessionTail is how far past the end of a range a searching session's later events are read
+const searchSessionTail = 24 * time.Hour
+
 type SearchHandler struct {
 	repo *Repository
 }
@@ -78,31 +83,18 @@ func (h *SearchHandler) Ingest404(c *fiber.Ctx) error {
 }
 
 // GetSearchStats aggregates search data for the dashboard
+// GET /v1/search/stats?range=7d|30d|90d|today|yesterday|mtd|last_month|ytd (or start=&end=)&compare=&tz=
 func (h *SearchHandler) GetSearchStats(c *fiber.Ctx) error {
-	rangeParam := c.Query("range", "7d")
-	var timeFilter string
-	switch rangeParam {
-	case "30d":
-		timeFilter = "AND created_at > DATE_SUB(NOW(), INTERVAL 30 DAY)"
-	case "90d":
-		timeFilter = "AND created_at > DATE_SUB(NOW(), INTERVAL 90 DAY)"
-	default: // 7d
-		timeFilter = "AND created_at > DATE_SUB(NOW(), INTERVAL 7 DAY)"
-	}
-
-	// 1. Top Queries
-	rows, err := h.repo.db.Query(`
-		SELECT query, COUNT(*) as count, AVG(result_count) as avg_results 
-		FROM wp_apex_search_analytics 
-		WHERE 1=1 ` + timeFilter + `
-		GROUP BY query 
-		ORDER BY count DESC 
-		LIMIT 10
-	`)
+	period, err := dateRangeFromQuery(c, h.repo, "7d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// 1. Top Queries and 2. Zero Result Searches (Content Gaps), by normalized cluster
+	insights, err := h.loadInsights(period.Period, []string{"order_completed"})
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer rows.Close()
 
 	type SearchStat struct {
 		Query      string  `json:"query"`
@@ -110,58 +102,34 @@ func (h *SearchHandler) GetSearchStats(c *fiber.Ctx) error {
 		AvgResults float64 `json:"avg_results"`
 	}
 	var topQueries []SearchStat = []SearchStat{} // Ensure empty array instead of nil
-
-	for rows.Next() {
-		var s SearchStat
-		if err := rows.Scan(&s.Query, &s.Count, &s.AvgResults); err == nil {
-			topQueries = append(topQueries, s)
+	for _, cl := range insights.Clusters {
+		if len(topQueries) == 10 {
+			break
 		}
+		topQueries = append(topQueries, SearchStat{Query: cl.Label, Count: cl.Searches, AvgResults: cl.AvgResults})
 	}
 
-	// 2. Zero Result Searches (Content Gaps)
-	gapRows, err := h.repo.db.Query(`
-		SELECT query, COUNT(*) as count 
-		FROM wp_apex_search_analytics 
-		WHERE result_count = 0 ` + timeFilter + `
-		GROUP BY query 
-		ORDER BY count DESC 
-		LIMIT 10
-	`)
-	if err != nil {
-		log.Printf("Gap query error: %v", err)
-	} else {
-		defer gapRows.Close()
-	}
-
-	var gaps []struct {
+	type SearchGap struct {
 		Query string `json:"query"`
 		Count int    `json:"count"`
-	} = make([]struct {
-		Query string `json:"query"`
-		Count int    `json:"count"`
-	}, 0)
-
-	if gapRows != nil {
-		for gapRows.Next() {
-			var g struct {
-				Query string `json:"query"`
-				Count int    `json:"count"`
-			}
-			if err := gapRows.Scan(&g.Query, &g.Count); err == nil {
-				gaps = append(gaps, g)
-			}
+	}
+	gaps := []SearchGap{}
+	for _, cl := range insights.ContentGaps {
+		if len(gaps) == 10 {
+			break
 		}
+		gaps = append(gaps, SearchGap{Query: cl.Label, Count: cl.ZeroResults})
 	}
 
 	// 3. Recent 404s
 	notfoundRows, err := h.repo.db.Query(`
 		SELECT url, referrer, COUNT(*) as count 
 		FROM wp_apex_404_logs 
-		WHERE 1=1 ` + timeFilter + `
+		WHERE created_at >= ? AND created_at < ?
 		GROUP BY url, referrer 
 		ORDER BY count DESC 
 		LIMIT 10
-	`)
+	`, period.Start, period.End)
 	if err != nil {
 		log.Printf("404 query error: %v", err)
 	} else {
@@ -191,9 +159,89 @@ func (h *SearchHandler) GetSearchStats(c *fiber.Ctx) error {
 		}
 	}
 
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"top_queries": topQueries,
 		"gaps":        gaps,
 		"recent_404s": recent404s,
-	})
+		"totals":      h.searchTotals(period.Period),
+		"period":      rangeInfo(period),
+	}
+	if period.Comparison != nil {
+		response["comparison"] = h.searchTotals(*period.Comparison)
+	}
+	return c.JSON(response)
+}
+
+// searchTotals counts searches and zero-result searches in a period
+func (h *SearchHandler) searchTotals(p analysis.Period) fiber.Map {
+	var searches, zero int
+	h.repo.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(result_count = 0), 0)
+		FROM wp_apex_search_analytics WHERE created_at >= ? AND created_at < ?`, p.Start, p.End).Scan(&searches, &zero)
+	return fiber.Map{"searches": searches, "zero_results": zero}
+}
+
+// GetSearchInsights returns query clusters, refinement chains, search exit rate, post-search
+// conversion rate and zero-result content gaps
+// GET /v1/search/insights?range=30d (or start=&end=, or the older days=30)&tz=&conversion=order_completed
+func (h *SearchHandler) GetSearchInsights(c *fiber.Ctx) error {
+	period, err := dateRangeOrDaysFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	conversions := strings.Split(c.Query("conversion", "order_completed"), ",")
+
+	insights, err := h.loadInsights(period.Period, conversions)
+	if err != nil {
+		log.Printf("[Search Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(insights)
+}
+
+// loadInsights reads a period's searches plus every later event of the searching sessions
+func (h *SearchHandler) loadInsights(p analysis.Period, conversionTypes []string) (analysis.SearchInsights, error) {
+	rows, err := h.repo.db.Query(`
+		SELECT COALESCE(query, ''), COALESCE(result_count, 0), COALESCE(session_id, ''), created_at
+		FROM wp_apex_search_analytics WHERE created_at >= ? AND created_at < ?`, p.Start, p.End)
+	if err != nil {
+		return analysis.SearchInsights{}, err
+	}
+	var searches []analysis.SearchEvent
+	for rows.Next() {
+		var s analysis.SearchEvent
+		if err := rows.Scan(&s.Query, &s.Results, &s.SessionID, &s.Time); err != nil {
+			rows.Close()
+			return analysis.SearchInsights{}, err
+		}
+		searches = append(searches, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return analysis.SearchInsights{}, err
+	}
+
+	evRows, err := h.repo.db.Query(`
+		SELECT e.session_id, e.event_type, e.created_at
+		FROM wp_apex_events e
+		JOIN (SELECT DISTINCT session_id FROM wp_apex_search_analytics WHERE created_at >= ? AND created_at < ? AND session_id <> '') s
+			ON s.session_id = e.session_id
+		WHERE e.created_at >= ? AND e.created_at < ?`, p.Start, p.End, p.Start, p.End.Add(searchSessionTail))
+	if err != nil {
+		return analysis.SearchInsights{}, err
+	}
+	defer evRows.Close()
+	var events []analysis.SessionEvent
+	for evRows.Next() {
+		var e analysis.SessionEvent
+		if err := evRows.Scan(&e.SessionID, &e.Type, &e.Time); err != nil {
+			return analysis.SearchInsights{}, err
+		}
+		events = append(events, e)
+	}
+	if err := evRows.Err(); err != nil {
+		return analysis.SearchInsights{}, err
+	}
+
+	return analysis.AnalyzeSearches(searches, events, conversionTypes), nil
 }
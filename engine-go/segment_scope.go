@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SegmentScope restricts a report to the visitors matching a stored segment. A nil scope
+// means no restriction, so handlers can pass it along unconditionally.
+type SegmentScope struct {
+	ID        int
+	Name      string
+	predicate string // over wp_apex_visitors v
+	args      []interface{}
+}
+
+// NewSegmentScope compiles a segment definition
+func NewSegmentScope(node analysis.SegmentNode) (*SegmentScope, error) {
+	predicate, args, err := analysis.CompileSegment(node)
+	if err != nil {
+		return nil, err
+	}
+	return &SegmentScope{predicate: predicate, args: args}, nil
+}
+
+// LoadSegmentScope compiles a saved segment
+func (r *Repository) LoadSegmentScope(id int) (*SegmentScope, error) {
+	var name string
+	var criteria []byte
+	err := r.db.QueryRow(`SELECT name, criteria FROM wp_apex_segments WHERE id = ?`, id).Scan(&name, &criteria)
+	if err != nil {
+		return nil, err
+	}
+	node, err := analysis.ParseSegment(criteria)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := NewSegmentScope(node)
+	if err != nil {
+		return nil, fmt.Errorf("segment %d: %w", id, err)
+	}
+	scope.ID, scope.Name = id, name
+	return scope, nil
+}
+
+// segmentFromQuery resolves ?segment_id=; without one the scope is nil
+func segmentFromQuery(c *fiber.Ctx, repo *Repository) (*SegmentScope, error) {
+	if c.Query("segment_id") == "" {
+		return nil, nil
+	}
+	id := c.QueryInt("segment_id", 0)
+	if id <= 0 {
+		return nil, errors.New("segment_id must be a positive integer")
+	}
+	scope, err := repo.LoadSegmentScope(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("segment %d not found", id)
+	}
+	return scope, err
+}
+
+// segmentID echoes the applied segment in responses, nil when unsegmented
+func segmentID(s *SegmentScope) interface{} {
+	if s == nil {
+		return nil
+	}
+	return s.ID
+}
+
+// FingerprintFilter returns " AND <col> IN (matching fingerprints)" and its arguments
+func (s *SegmentScope) FingerprintFilter(col string) (string, []interface{}) {
+	if s == nil {
+		return "", nil
+	}
+	return ` AND ` + s.fingerprintIn(col), s.args
+}
+
+// fingerprintIn is the bare "<col> IN (matching fingerprints)" predicate; it takes s.args
+func (s *SegmentScope) fingerprintIn(col string) string {
+	return col + ` IN (SELECT v.fingerprint FROM wp_apex_visitors v WHERE ` + s.predicate + `)`
+}
+
+// SessionFilter returns " AND <col> IN (sessions of matching visitors)" and its arguments
+func (s *SegmentScope) SessionFilter(col string) (string, []interface{}) {
+	if s == nil {
+		return "", nil
+	}
+	return ` AND ` + col + ` IN (SELECT seg_ss.session_id FROM wp_apex_sessions seg_ss
+		JOIN wp_apex_visitors v ON v.fingerprint = seg_ss.fingerprint WHERE ` + s.predicate + `)`, s.args
+}
+
+// Members lists the fingerprints in the segment, for reports that filter in Go
+func (s *SegmentScope) Members(r *Repository) (map[string]bool, error) {
+	rows, err := r.db.Query(`SELECT v.fingerprint FROM wp_apex_visitors v WHERE `+s.predicate, s.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := map[string]bool{}
+	for rows.Next() {
+		var fp string
+		if err := rows.Scan(&fp); err != nil {
+			return nil, err
+		}
+		members[fp] = true
+	}
+	return members, rows.Err()
+}
+
+// FilterEvents keeps the events of segment members
+func (s *SegmentScope) FilterEvents(r *Repository, events []analysis.TrackedEvent) ([]analysis.TrackedEvent, error) {
+	if s == nil {
+		return events, nil
+	}
+	members, err := s.Members(r)
+	if err != nil {
+		return nil, err
+	}
+	kept := events[:0]
+	for _, e := range events {
+		if members[e.PersonID] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// withArgs concatenates query arguments in placeholder order
+func withArgs(groups ...[]interface{}) []interface{} {
+	var out []interface{}
+	for _, g := range groups {
+		out = append(out, g...)
+	}
+	return out
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"strings"
+	"time"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -16,41 +20,233 @@ func NewSegmentationHandler(repo *Repository) *SegmentationHandler {
 	return &SegmentationHandler{repo: repo}
 }
 
-// Cohort Analysis: Retention rates for Day 1, 7, 30
+// Cohort Analysis: retention by cohort and period
+// GET /v1/segmentation/cohorts?granularity=day|week|month&mode=exact|rolling&periods=30&cohorts=10
+//   &cohort_by=first_visit|first_purchase|channel|campaign|country
+//   &return=any|purchase|event&return_event=signup&segment_id=
 func (h *SegmentationHandler) GetCohorts(c *fiber.Ctx) error {
-	query := `
-		WITH FirstVisit AS (
-			SELECT fingerprint, DATE(first_seen) as cohort_date
-			FROM wp_apex_visitors
-			WHERE first_seen >= DATE_SUB(NOW(), INTERVAL 60 DAY)
-			GROUP BY fingerprint, DATE(first_seen)
-		),
-		Retention AS (
-			SELECT 
-				f.cohort_date,
-				s.fingerprint,
-				DATEDIFF(DATE(s.started_at), f.cohort_date) as day_diff
-			FROM FirstVisit f
-			JOIN wp_apex_sessions s ON f.fingerprint = s.fingerprint
-		)
-		SELECT 
-			DATE_FORMAT(cohort_date, '%b %d') as date,
-			COUNT(DISTINCT fingerprint) as users,
-			ROUND(100 * COUNT(DISTINCT CASE WHEN day_diff >= 1 THEN fingerprint END) / COUNT(DISTINCT fingerprint), 1) as day1,
-			ROUND(100 * COUNT(DISTINCT CASE WHEN day_diff >= 7 THEN fingerprint END) / COUNT(DISTINCT fingerprint), 1) as day7,
-			ROUND(100 * COUNT(DISTINCT CASE WHEN day_diff >= 30 THEN fingerprint END) / COUNT(DISTINCT fingerprint), 1) as day30
-		FROM Retention
-		GROUP BY cohort_date
-		ORDER BY cohort_date DESC
-		LIMIT 10
-	`
-	rows, err := h.repo.RunReadOnlyQuery(query)
+	opts := analysis.RetentionOptions{
+		Granularity: c.Query("granularity"),
+		Mode:        c.Query("mode"),
+		Periods:     c.QueryInt("periods", 0),
+	}
+	if err := opts.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	cohortCount := c.QueryInt("cohorts", map[string]int{"day": 10, "week": 8, "month": 6}[opts.Granularity])
+	if cohortCount <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "cohorts must be positive"})
+	}
+	cohortBy := c.Query("cohort_by", "first_visit")
+	switch cohortBy {
+	case "first_visit", "first_purchase", "channel", "campaign", "country":
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "cohort_by must be first_visit, first_purchase, channel, campaign or country"})
+	}
+	returnKind, returnEvent := c.Query("return", "any"), c.Query("return_event")
+	switch returnKind {
+	case "any", "purchase":
+	case "event":
+		if returnEvent == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "return_event is required when return=event"})
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "return must be any, purchase or event"})
+	}
+
+	now := time.Now()
+	from := analysis.BucketStart(now, opts.Granularity)
+	switch opts.Granularity {
+	case analysis.GranularityMonth:
+		from = from.AddDate(0, -(cohortCount - 1), 0)
+	case analysis.GranularityWeek:
+		from = from.AddDate(0, 0, -7*(cohortCount-1))
+	default:
+		from = from.AddDate(0, 0, -(cohortCount - 1))
+	}
+
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	dateCohorts := cohortBy == "first_visit" || cohortBy == "first_purchase"
+	members, err := h.cohortMembers(cohortBy, from, now)
+	if err == nil && segment != nil {
+		members, err = filterCohortMembers(h.repo, segment, members)
+	}
 	if err != nil {
 		log.Printf("[Cohort Error] %v", err)
 		return c.Status(500).SendString("Cohort analysis failed")
 	}
 
-	return c.JSON(rows)
+	activity, err := h.returningActivity(returnKind, returnEvent, from)
+	if err != nil {
+		log.Printf("[Cohort Error] %v", err)
+		return c.Status(500).SendString("Cohort analysis failed")
+	}
+
+	rows := analysis.ComputeRetention(members, activity, opts, now)
+
+	// Keep the day1/day7/day30 columns the cohort grid already renders
+	out := make([]fiber.Map, 0, len(rows))
+	for _, r := range rows {
+		entry := fiber.Map{
+			"cohort":  r.Cohort,
+			"date":    r.Cohort,
+			"users":   r.Users,
+			"periods": r.Periods,
+		}
+		if dateCohorts && opts.Granularity == analysis.GranularityDay {
+			entry["date"] = r.Start.Format("Jan 02")
+		}
+		for _, day := range []int{1, 7, 30} {
+			if opts.Granularity == analysis.GranularityDay && day < len(r.Periods) && r.Periods[day].Rate != nil {
+				entry[fmt.Sprintf("day%d", day)] = math.Round(*r.Periods[day].Rate*10) / 10
+			} else {
+				entry[fmt.Sprintf("day%d", day)] = nil
+			}
+		}
+		out = append(out, entry)
+	}
+
+	return c.JSON(out)
+}
+
+// cohortMembers resolves each person's cohort entry. Date cohorts use the first visit or first
+// purchase (keyed by the buyer, see BuyerOrdersSQL); dimension cohorts still enter on the first visit but are grouped by first-touch value.
+func (h *SegmentationHandler) cohortMembers(cohortBy string, from, to time.Time) ([]analysis.CohortMember, error) {
+	var members []analysis.CohortMember
+
+	if cohortBy == "first_purchase" {
+		rows, err := h.repo.db.Query(`
+			SELECT s.fingerprint, MIN(o.created_at) as first_order
+			FROM `+analysis.BuyerOrdersSQL+` o
+			JOIN wp_apex_sessions s ON s.session_id = o.session_id
+			GROUP BY s.fingerprint
+			HAVING first_order >= ? AND first_order < ?
+		`, from, to)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var m analysis.CohortMember
+			if err := rows.Scan(&m.PersonID, &m.Entry); err == nil {
+				members = append(members, m)
+			}
+		}
+		return members, rows.Err()
+	}
+
+	rows, err := h.repo.db.Query(`
+		SELECT fingerprint, first_seen, COALESCE(country, '')
+		FROM wp_apex_visitors
+		WHERE first_seen >= ? AND first_seen < ?
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var countries = map[string]string{}
+	for rows.Next() {
+		var m analysis.CohortMember
+		var country string
+		if err := rows.Scan(&m.PersonID, &m.Entry, &country); err == nil {
+			members = append(members, m)
+			countries[m.PersonID] = country
+		}
+	}
+	rows.Close()
+
+	switch cohortBy {
+	case "first_visit":
+		return members, nil
+	case "country":
+		for i := range members {
+			members[i].Cohort = countries[members[i].PersonID]
+			if members[i].Cohort == "" {
+				members[i].Cohort = "(unknown)"
+			}
+		}
+		return members, nil
+	case "channel", "campaign":
+		events, err := h.repo.LoadTrackedEvents(from, to, []string{"pageview"})
+		if err != nil {
+			return nil, err
+		}
+		firstTouch := map[string]analysis.TrackedEvent{}
+		for _, e := range events { // ordered by time
+			if _, seen := firstTouch[e.PersonID]; !seen {
+				firstTouch[e.PersonID] = e
+			}
+		}
+		for i := range members {
+			e, ok := firstTouch[members[i].PersonID]
+			switch {
+			case !ok:
+				members[i].Cohort = "(unknown)"
+			case cohortBy == "channel":
+				members[i].Cohort = e.Channel
+			default:
+				members[i].Cohort = analysis.CampaignFromURL(e.URL)
+			}
+		}
+		return members, nil
+	}
+	return nil, fmt.Errorf("unknown cohort_by %q", cohortBy)
+}
+
+// filterCohortMembers keeps the members of a segment
+func filterCohortMembers(repo *Repository, segment *SegmentScope, members []analysis.CohortMember) ([]analysis.CohortMember, error) {
+	in, err := segment.Members(repo)
+	if err != nil {
+		return nil, err
+	}
+	kept := members[:0]
+	for _, m := range members {
+		if in[m.PersonID] {
+			kept = append(kept, m)
+		}
+	}
+	return kept, nil
+}
+
+// returningActivity collects the timestamps that count as "returning" for each person
+func (h *SegmentationHandler) returningActivity(kind, eventType string, from time.Time) (map[string][]time.Time, error) {
+	var query string
+	var args []interface{}
+	switch kind {
+	case "purchase":
+		query = `SELECT s.fingerprint, o.created_at FROM ` + analysis.BuyerOrdersSQL + ` o
+			JOIN wp_apex_sessions s ON s.session_id = o.session_id
+			WHERE o.created_at >= ?`
+		args = []interface{}{from}
+	case "event":
+		query = `SELECT s.fingerprint, e.created_at FROM wp_apex_events e
+			JOIN wp_apex_sessions s ON s.session_id = e.session_id
+			WHERE e.event_type = ? AND e.created_at >= ?`
+		args = []interface{}{eventType, from}
+	default:
+		query = `SELECT fingerprint, started_at FROM wp_apex_sessions WHERE started_at >= ?`
+		args = []interface{}{from}
+	}
+
+	rows, err := h.repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := map[string][]time.Time{}
+	for rows.Next() {
+		var fp string
+		var t time.Time
+		if err := rows.Scan(&fp, &t); err == nil {
+			activity[fp] = append(activity[fp], t)
+		}
+	}
+	return activity, rows.Err()
 }
 
 // Calculate Engagement Score & Personas
@@ -125,84 +321,67 @@ func (h *SegmentationHandler) CalculateScores(c *fiber.Ctx) error {
 }
 
 // User Journey / Sankey Data
+// GET /v1/segmentation/sankey?anchor_url=/pricing&direction=start|end&depth=3
+//   &templates=/product/*,/blog/*&min_share=2&max_branches=8
+//   &range=7d|30d|90d (or start=YYYY-MM-DD&end=YYYY-MM-DD)&channel=&device=&country=&segment_id=
 func (h *SegmentationHandler) GetSankey(c *fiber.Ctx) error {
-	query := `
-		WITH RawEvents AS (
-			SELECT session_id, url, ROW_NUMBER() OVER(PARTITION BY session_id ORDER BY created_at) as step
-			FROM wp_apex_events
-			WHERE event_type = 'pageview' AND created_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)
-		),
-		Transitions AS (
-			SELECT e1.url as source, e2.url as target
-			FROM RawEvents e1
-			JOIN RawEvents e2 ON e1.session_id = e2.session_id AND e1.step + 1 = e2.step
-		)
-		SELECT source, target, COUNT(*) as value
-		FROM Transitions
-		GROUP BY source, target
-		ORDER BY value DESC
-		LIMIT 50
-	`
-	rows, err := h.repo.RunReadOnlyQuery(query)
-	if err != nil {
-		log.Printf("[Sankey Error] %v", err)
-		return c.Status(500).SendString("Sankey analysis failed")
+	opts := analysis.PathOptions{
+		AnchorURL:   c.Query("anchor_url"),
+		AnchorEvent: c.Query("anchor_event"),
+		Direction:   c.Query("direction"),
+		Depth:       c.QueryInt("depth", 3),
+		MinShare:    c.QueryFloat("min_share", 0),
+		MaxBranches: c.QueryInt("max_branches", 8),
 	}
-
-	// Map to Nodes and Links
-	nodeMap := make(map[string]int)
-	nodes := []map[string]interface{}{}
-	links := []map[string]interface{}{}
-
-	getNode := func(name string) int {
-		if idx, ok := nodeMap[name]; ok {
-			return idx
-		}
-		idx := len(nodes)
-		nodeMap[name] = idx
-		nodes = append(nodes, map[string]interface{}{"name": simplifyURL(name)})
-		return idx
-	}
-
-	for _, row := range rows {
-		source := row["source"].(string)
-		target := row["target"].(string)
-		val := 0
-		switch v := row["value"].(type) {
-		case int64:
-			val = int(v)
-		case int:
-			val = v
+	if t := c.Query("templates"); t != "" {
+		for _, tpl := range strings.Split(t, ",") {
+			if tpl = strings.TrimSpace(tpl); tpl != "" {
+				opts.Templates = append(opts.Templates, tpl)
+			}
 		}
+	}
+	if err := opts.Normalize(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
-		links = append(links, map[string]interface{}{
-			"source": getNode(source),
-			"target": getNode(target),
-			"value":  val,
-		})
+	period, err := dateRangeFromQuery(c, h.repo, "30d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
+	from, to := period.Start, period.End
 
-	return c.JSON(fiber.Map{
-		"nodes": nodes,
-		"links": links,
-	})
-}
+	types := []string{"pageview"}
+	if opts.AnchorEvent != "" && opts.AnchorEvent != "pageview" {
+		types = append(types, opts.AnchorEvent)
+	}
+	segment, err := segmentFromQuery(c, h.repo)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	events, err := h.repo.LoadTrackedEvents(from, to, types)
+	if err == nil {
+		events, err = segment.FilterEvents(h.repo, events)
+	}
+	if err != nil {
+		log.Printf("[Sankey Error] %v", err)
+		return c.Status(500).SendString("Sankey analysis failed")
+	}
 
-func simplifyURL(rawURL string) string {
-	// Simple cleanup: /blog/post-1 -> Blog: post-1
-	if rawURL == "/" || rawURL == "" {
-		return "Home"
-	}
-	// Strip domain if exists
-	parts := strings.Split(rawURL, "/")
-	if len(parts) > 1 {
-		last := parts[len(parts)-1]
-		if last == "" && len(parts) > 2 {
-			last = parts[len(parts)-2]
+	// Segment filters
+	channel, device, country := c.Query("channel"), c.Query("device"), c.Query("country")
+	if channel != "" || device != "" || country != "" {
+		filtered := events[:0]
+		for _, e := range events {
+			if (channel == "" || strings.EqualFold(e.Channel, channel)) &&
+				(device == "" || e.Device == device) &&
+				(country == "" || strings.EqualFold(e.Country, country)) {
+				filtered = append(filtered, e)
+			}
 		}
-		return last
+		events = filtered
 	}
-	return rawURL
+
+	return c.JSON(analysis.ExplorePaths(opts, events))
 }
 
 // Ingest Download Event
@@ -240,22 +419,80 @@ func (h *SegmentationHandler) GetSegments(c *fiber.Ctx) error {
 	return c.JSON(rows)
 }
 
+// segmentPayload carries criteria either as a JSON object or as a string of JSON (the builder's textarea)
+type segmentPayload struct {
+	Name     string          `json:"name"`
+	Criteria json.RawMessage `json:"criteria"`
+}
+
 func (h *SegmentationHandler) CreateSegment(c *fiber.Ctx) error {
-	type Payload struct {
-		Name     string `json:"name"`
-		Criteria string `json:"criteria"`
-	}
-	var p Payload
+	var p segmentPayload
 	if err := c.BodyParser(&p); err != nil {
 		return c.Status(400).SendString("Invalid payload")
 	}
+	if strings.TrimSpace(p.Name) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "name is required"})
+	}
+	node, err := analysis.ParseSegment(p.Criteria)
+	if err == nil {
+		_, err = NewSegmentScope(node)
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	_, err := h.repo.GetDB().Exec("INSERT INTO wp_apex_segments (name, criteria) VALUES (?, ?)", p.Name, p.Criteria)
+	// Stored normalized, so every reader sees an object
+	criteria, _ := json.Marshal(node)
+	res, err := h.repo.GetDB().Exec("INSERT INTO wp_apex_segments (name, criteria) VALUES (?, ?)", p.Name, string(criteria))
 	if err != nil {
 		return c.Status(500).SendString(err.Error())
 	}
+	id, _ := res.LastInsertId()
 
-	return c.JSON(fiber.Map{"status": "success"})
+	return c.JSON(fiber.Map{"status": "success", "id": id})
+}
+
+// PreviewSegment counts who a definition matches before it is saved
+// POST /v1/segmentation/segments/preview {"criteria": {...}}
+func (h *SegmentationHandler) PreviewSegment(c *fiber.Ctx) error {
+	var p segmentPayload
+	if err := c.BodyParser(&p); err != nil {
+		return c.Status(400).SendString("Invalid payload")
+	}
+	node, err := analysis.ParseSegment(p.Criteria)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	scope, err := NewSegmentScope(node)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var total, members, sessions int
+	if err := h.repo.db.QueryRow(`SELECT COUNT(*) FROM wp_apex_visitors`).Scan(&total); err != nil {
+		log.Printf("[Segment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Segment preview failed"})
+	}
+	filter, args := scope.FingerprintFilter("fingerprint")
+	if err := h.repo.db.QueryRow(`SELECT COUNT(*) FROM wp_apex_visitors WHERE 1=1`+filter, args...).Scan(&members); err != nil {
+		log.Printf("[Segment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Segment preview failed"})
+	}
+	if err := h.repo.db.QueryRow(`SELECT COUNT(*) FROM wp_apex_sessions WHERE started_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)`+filter, args...).Scan(&sessions); err != nil {
+		log.Printf("[Segment Error] %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Segment preview failed"})
+	}
+
+	share := 0.0
+	if total > 0 {
+		share = math.Round(float64(members)/float64(total)*1000) / 10
+	}
+	return c.JSON(fiber.Map{
+		"members":        members,
+		"total_visitors": total,
+		"share":          share,
+		"sessions_30d":   sessions,
+	})
 }
 
 func (h *SegmentationHandler) DeleteSegment(c *fiber.Ctx) error {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCohortsRejectsBadParams(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	h := NewSegmentationHandler(&Repository{db: db})
+	app := fiber.New()
+	app.Get("/v1/segmentation/cohorts", h.GetCohorts)
+
+	// Rejected before any query runs
+	for _, q := range []string{
+		"cohorts=0",
+		"cohorts=-3",
+		"cohort_by=device",
+		"return=event",
+		"return=signup",
+		"granularity=year",
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/segmentation/cohorts?"+q, nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, q)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCohortsKeysPurchasesByBuyer(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	h := NewSegmentationHandler(&Repository{db: db})
+	app := fiber.New()
+	app.Get("/v1/segmentation/cohorts", h.GetCohorts)
+
+	// Webhook orders reach their buyers' sessions through the customer/visitor link
+	entry := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(`SELECT s.fingerprint, MIN\(o.created_at\).*wp_apex_customer_visitors buy_cv.*JOIN wp_apex_sessions s ON s.session_id = o.session_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "first_order"}).
+			AddRow("fp_ann", entry).
+			AddRow("fp_bob", entry))
+	mock.ExpectQuery(`SELECT s.fingerprint, o.created_at FROM \(SELECT bo_e.created_at.*wp_apex_customer_visitors buy_cv`).
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "created_at"}).
+			AddRow("fp_ann", entry).
+			AddRow("fp_bob", entry))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/segmentation/cohorts?cohort_by=first_purchase&return=purchase&cohorts=2", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var cohorts []map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&cohorts))
+	require.Len(t, cohorts, 1)
+	assert.Equal(t, 2.0, cohorts[0]["users"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
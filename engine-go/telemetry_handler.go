@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -40,7 +42,17 @@ func (h *TelemetryHandler) IngestTelemetry(c *fiber.Ctx) error {
 		payload.UA = c.Get("User-Agent")
 	}
 
-	// Store raw payload for now.
+	now := time.Now()
+	events := ParseFormEvents(payload.Events, payload.FormID, now)
+	if payload.FormID == "unknown" && len(events) > 0 && events[0].FormID != "" {
+		payload.FormID = events[0].FormID
+	}
+	if payload.SessionID == "" {
+		// Without a session the batch can't be joined to later ones; treat it as its own session
+		payload.SessionID = fmt.Sprintf("batch-%d", now.UnixNano())
+	}
+
+	// Keep the raw batch for replay/debugging
 	fullPayload := map[string]interface{}{
 		"ua":      payload.UA,
 		"events":  payload.Events,
@@ -51,12 +63,21 @@ func (h *TelemetryHandler) IngestTelemetry(c *fiber.Ctx) error {
 	_, err := h.repo.db.Exec(`
 		INSERT INTO wp_apex_form_analytics (session_id, form_id, payload, created_at)
 		VALUES (?, ?, ?, ?)
-	`, payload.SessionID, payload.FormID, blob, time.Now())
+	`, payload.SessionID, payload.FormID, blob, now)
 
 	if err != nil {
 		log.Printf("Telemetry insert error: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Storage failed"})
 	}
 
+	// Fold the batch into the incremental field-level aggregates
+	deltas := analysis.FoldFormEvents(events)
+	if len(deltas) > 0 {
+		if err := h.repo.ApplyFormDeltas(payload.SessionID, analysis.DeviceClass(payload.UA), deltas); err != nil {
+			log.Printf("Telemetry aggregate error: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Storage failed"})
+		}
+	}
+
 	return c.JSON(fiber.Map{"status": "ok"})
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apex-ai/engine-go/analysis"
+)
+
+// systemSessionPrefix marks the shared server-side sessions events are posted from, such as
+// the WooCommerce webhook's system_woo_webhook. Their visitor is whoever created them first.
+const systemSessionPrefix = "system_"
+
+// LoadTrackedEvents reads events of the given types in [from, to) joined with
+// their session and visitor, and tags each with the session's channel and device class.
+// Orders posted from a system session are moved to the buyer's session (see resolveBuyers).
+func (r *Repository) LoadTrackedEvents(from, to time.Time, eventTypes []string) ([]analysis.TrackedEvent, error) {
+	query := `
+		SELECT s.fingerprint, e.session_id, e.event_type, e.url, COALESCE(e.referrer, ''), e.payload, e.created_at,
+			COALESCE(s.referrer, ''), COALESCE(s.landing_page, ''), COALESCE(v.user_agent, ''), COALESCE(v.country, '')
+		FROM wp_apex_events e
+		JOIN wp_apex_sessions s ON s.session_id = e.session_id
+		LEFT JOIN wp_apex_visitors v ON v.fingerprint = s.fingerprint
+		WHERE e.created_at >= ? AND e.created_at < ?`
+	args := []interface{}{from, to}
+	if len(eventTypes) > 0 {
+		query += ` AND e.event_type IN (?` + strings.Repeat(", ?", len(eventTypes)-1) + `)`
+		for _, t := range eventTypes {
+			args = append(args, t)
+		}
+	}
+	query += ` ORDER BY e.created_at ASC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Channel is decided by the first thing we see of a session
+	channels := map[string]string{}
+	var events []analysis.TrackedEvent
+	var systemOrders []int
+
+	for rows.Next() {
+		var e analysis.TrackedEvent
+		var referrer, sessReferrer, landing, ua string
+		var payload []byte
+		if err := rows.Scan(&e.PersonID, &e.SessionID, &e.Type, &e.URL, &referrer, &payload, &e.Time,
+			&sessReferrer, &landing, &ua, &e.Country); err != nil {
+			continue
+		}
+
+		if len(payload) > 0 {
+			json.Unmarshal(payload, &e.Props)
+		}
+		if e.Props == nil {
+			e.Props = map[string]interface{}{}
+		}
+		if e.Type == "order_completed" && strings.HasPrefix(e.SessionID, systemSessionPrefix) {
+			systemOrders = append(systemOrders, len(events))
+			events = append(events, e)
+			continue
+		}
+
+		channel, ok := channels[e.SessionID]
+		if !ok {
+			if sessReferrer == "" {
+				sessReferrer = referrer
+			}
+			if landing == "" {
+				landing = e.URL
+			}
+			channel = analysis.ClassifyChannel(sessReferrer, landing)
+			channels[e.SessionID] = channel
+		}
+		e.Channel = channel
+		e.Device = analysis.DeviceClass(ua)
+
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(systemOrders) > 0 {
+		if err := r.resolveBuyers(events, systemOrders, channels); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// buyerSession is a session of a visitor linked to a customer
+type buyerSession struct {
+	id, fingerprint    string
+	started            time.Time
+	referrer, landing  string
+	userAgent, country string
+}
+
+// resolveBuyers gives orders posted from a system session the person, session, channel and
+// device of the buyer: the latest session, started by the time of the order, of a visitor
+// linked to the billing email in wp_apex_customer_visitors. Orders without one are keyed by
+// the email (or order id) so buyers stay apart; they have no session and count as Direct.
+// BuyerSessionSQL mirrors this for reports that run in SQL.
+func (r *Repository) resolveBuyers(events []analysis.TrackedEvent, orders []int, channels map[string]string) error {
+	var emails []interface{}
+	seen := map[string]bool{}
+	for _, i := range orders {
+		if email := customerEmail(events[i].Props); email != "" && !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+
+	sessions := map[string][]buyerSession{}
+	if len(emails) > 0 {
+		rows, err := r.db.Query(`
+			SELECT cv.customer_key, s.session_id, s.fingerprint, s.started_at, COALESCE(s.referrer, ''), COALESCE(s.landing_page, ''),
+				COALESCE(v.user_agent, ''), COALESCE(v.country, '')
+			FROM wp_apex_customer_visitors cv
+			JOIN wp_apex_sessions s ON s.fingerprint = cv.fingerprint
+			LEFT JOIN wp_apex_visitors v ON v.fingerprint = s.fingerprint
+			WHERE cv.customer_key IN (?`+strings.Repeat(", ?", len(emails)-1)+`) AND s.session_id NOT LIKE 'system\_%'`, emails...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key string
+			var b buyerSession
+			if err := rows.Scan(&key, &b.id, &b.fingerprint, &b.started, &b.referrer, &b.landing, &b.userAgent, &b.country); err != nil {
+				continue
+			}
+			sessions[key] = append(sessions[key], b)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, i := range orders {
+		e := &events[i]
+		email := customerEmail(e.Props)
+		var buyer *buyerSession
+		for j, b := range sessions[email] {
+			if !b.started.After(e.Time) && (buyer == nil || b.started.After(buyer.started)) {
+				buyer = &sessions[email][j]
+			}
+		}
+
+		if buyer == nil {
+			e.PersonID, e.SessionID, e.Channel, e.Device, e.Country = email, "", analysis.ChannelDirect, "", ""
+			if email == "" {
+				e.PersonID = fmt.Sprintf("order:%v", e.Props["order_id"])
+			}
+			continue
+		}
+		channel, ok := channels[buyer.id]
+		if !ok {
+			channel = analysis.ClassifyChannel(buyer.referrer, buyer.landing)
+			channels[buyer.id] = channel
+		}
+		e.PersonID, e.SessionID, e.Channel = buyer.fingerprint, buyer.id, channel
+		e.Device, e.Country = analysis.DeviceClass(buyer.userAgent), buyer.country
+	}
+	return nil
+}
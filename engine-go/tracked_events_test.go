@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func trackedEventRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"fingerprint", "session_id", "event_type", "url", "referrer", "payload", "created_at",
+		"session_referrer", "landing_page", "user_agent", "country"})
+}
+
+func buyerSessionRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"customer_key", "session_id", "fingerprint", "started_at", "referrer", "landing_page", "user_agent", "country"})
+}
+
+func TestLoadTrackedEventsResolvesWebhookBuyers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := &Repository{db: db}
+	t0 := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+
+	// Every order comes from the webhook session, which belongs to whoever created it first
+	order := func(email string, id int, revenue float64) []byte {
+		return []byte(fmt.Sprintf(`{"order_id": %d, "revenue": %g, "customer_email": %q}`, id, revenue, email))
+	}
+	mock.ExpectQuery("FROM wp_apex_events e").WillReturnRows(trackedEventRows().
+		AddRow("fp_ann", "s_ann", "pageview", "https://shop.com/", "https://www.google.com/", nil, t0,
+			"https://www.google.com/", "https://shop.com/", "Mozilla/5.0 (Windows NT 10.0)", "DE").
+		AddRow("fp_bob", "s_bob", "pageview", "https://shop.com/shoes", "https://facebook.com/", nil, t0.Add(time.Minute),
+			"https://facebook.com/", "https://shop.com/shoes", "Mozilla/5.0 (iPhone) Mobile", "US").
+		AddRow("fp_first", "system_woo_webhook", "order_completed", "https://shop.com/checkout/order-received/1/", "", order(" Ann@Shop.com ", 1, 50), t0.Add(time.Hour),
+			"", "", "WordPress", "FR").
+		AddRow("fp_first", "system_woo_webhook", "order_completed", "https://shop.com/checkout/order-received/2/", "", order("bob@shop.com", 2, 20), t0.Add(2*time.Hour),
+			"", "", "WordPress", "FR").
+		AddRow("fp_first", "system_woo_webhook", "order_completed", "https://shop.com/checkout/order-received/3/", "", order("carol@shop.com", 3, 10), t0.Add(3*time.Hour),
+			"", "", "WordPress", "FR"))
+
+	// Bob has an older visit and one that only started after his order
+	mock.ExpectQuery("FROM wp_apex_customer_visitors cv").
+		WithArgs("ann@shop.com", "bob@shop.com", "carol@shop.com").
+		WillReturnRows(buyerSessionRows().
+			AddRow("ann@shop.com", "s_ann", "fp_ann", t0, "https://www.google.com/", "https://shop.com/", "Mozilla/5.0 (Windows NT 10.0)", "DE").
+			AddRow("bob@shop.com", "s_bob_old", "fp_bob", t0.AddDate(0, 0, -3), "", "https://shop.com/?utm_medium=email", "Mozilla/5.0 (iPhone) Mobile", "US").
+			AddRow("bob@shop.com", "s_bob", "fp_bob", t0.Add(time.Minute), "https://facebook.com/", "https://shop.com/shoes", "Mozilla/5.0 (iPhone) Mobile", "US").
+			AddRow("bob@shop.com", "s_bob_later", "fp_bob", t0.Add(5*time.Hour), "", "https://shop.com/", "Mozilla/5.0 (iPhone) Mobile", "US"))
+
+	events, err := repo.LoadTrackedEvents(t0.Add(-time.Hour), t0.Add(24*time.Hour), []string{"pageview", "order_completed"})
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	ann, bob, carol := events[2], events[3], events[4]
+	assert.Equal(t, []string{"fp_ann", "s_ann", analysis.ChannelOrganicSearch, "desktop", "DE"}, []string{ann.PersonID, ann.SessionID, ann.Channel, ann.Device, ann.Country})
+	assert.Equal(t, []string{"fp_bob", "s_bob", analysis.ChannelSocial, "mobile", "US"}, []string{bob.PersonID, bob.SessionID, bob.Channel, bob.Device, bob.Country})
+	// Carol never browsed as a linked visitor
+	assert.Equal(t, []string{"carol@shop.com", "", analysis.ChannelDirect}, []string{carol.PersonID, carol.SessionID, carol.Channel})
+
+	// Each buyer converts on their own touchpoints
+	journeys := analysis.BuildJourneys(events, t0.Add(-time.Hour), t0.Add(24*time.Hour), 30*24*time.Hour)
+	require.Len(t, journeys, 3)
+	credited := map[string]string{}
+	for _, j := range journeys {
+		require.True(t, j.Converted)
+		require.Len(t, j.Touchpoints, 1)
+		credited[j.PersonID] = j.Touchpoints[0].Channel
+	}
+	assert.Equal(t, map[string]string{
+		"fp_ann":         analysis.ChannelOrganicSearch,
+		"fp_bob":         analysis.ChannelSocial,
+		"carol@shop.com": analysis.ChannelDirect,
+	}, credited)
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"log"
+
+	"github.com/apex-ai/engine-go/analysis"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -14,28 +17,15 @@ func NewWooCommerceHandler(repo *Repository) *WooCommerceHandler {
 }
 
 // GetWooStats returns aggregated WooCommerce metrics
-// GET /v1/woocommerce/stats?range=7d|30d|90d
+// GET /v1/woocommerce/stats?range=7d|30d|90d|today|yesterday|mtd|last_month|ytd (or start=&end=)&compare=&tz=
 func (h *WooCommerceHandler) GetWooStats(c *fiber.Ctx) error {
-	rangeParam := c.Query("range", "7d")
-
-	var days int
-	switch rangeParam {
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
+	period, err := dateRangeFromQuery(c, h.repo, "7d")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Total Revenue from order_completed events
-	var totalRevenue float64
-	h.repo.db.QueryRow(`
-		SELECT COALESCE(SUM(JSON_EXTRACT(payload, '$.revenue')), 0)
-		FROM wp_apex_events
-		WHERE event_type = 'order_completed'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, days).Scan(&totalRevenue)
+	// Total Revenue and order count from order_completed events
+	totalRevenue, orderCount := h.orderTotals(period.Period)
 
 	// Estimated COGS (36% of revenue - typical e-commerce margin)
 	cogs := totalRevenue * 0.36
@@ -52,25 +42,20 @@ func (h *WooCommerceHandler) GetWooStats(c *fiber.Ctx) error {
 		margin = (netProfit / totalRevenue) * 100
 	}
 
-	// Order count
-	var orderCount int
-	h.repo.db.QueryRow(`
-		SELECT COUNT(*)
-		FROM wp_apex_events
-		WHERE event_type = 'order_completed'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-	`, days).Scan(&orderCount)
-
 	// Top customers by LTV (from order events)
-	topCustomers := h.getTopCustomers(days)
+	topCustomers := h.getTopCustomers(period.Period)
 
 	// Checkout funnel (simplified based on event types)
-	funnel := h.getCheckoutFunnel(days)
+	funnel, err := h.getCheckoutFunnel(period.Period)
+	if err != nil {
+		log.Printf("[WooCommerce Error] checkout funnel: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Checkout funnel query failed"})
+	}
 
 	// Active high-value carts (whale watch - mock for now as carts aren't tracked yet)
 	whales := h.getActiveWhales()
 
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"net_profit": fiber.Map{
 			"revenue":    totalRevenue,
 			"cogs":       cogs,
@@ -82,24 +67,49 @@ func (h *WooCommerceHandler) GetWooStats(c *fiber.Ctx) error {
 		"top_customers": topCustomers,
 		"funnel":        funnel,
 		"whales":        whales,
-		"range":         rangeParam,
-	})
+		"range":         period.Preset,
+		"period":        rangeInfo(period),
+	}
+	if period.Comparison != nil {
+		prevRevenue, prevOrders := h.orderTotals(*period.Comparison)
+		response["comparison"] = fiber.Map{
+			"revenue":        prevRevenue,
+			"order_count":    prevOrders,
+			"revenue_change": calculateChange(totalRevenue, prevRevenue),
+			"orders_change":  calculateChange(float64(orderCount), float64(prevOrders)),
+		}
+	}
+	return c.JSON(response)
 }
 
-// getTopCustomers returns top customers by lifetime value
-func (h *WooCommerceHandler) getTopCustomers(days int) []fiber.Map {
-	rows, err := h.repo.db.Query(`
-		SELECT 
-			JSON_EXTRACT(payload, '$.email') as email,
-			COUNT(*) as order_count,
-			SUM(JSON_EXTRACT(payload, '$.revenue')) as ltv
+// orderTotals sums completed orders in a period
+func (h *WooCommerceHandler) orderTotals(p analysis.Period) (float64, int) {
+	var revenue float64
+	var orders int
+	h.repo.db.QueryRow(`
+		SELECT COALESCE(SUM(JSON_EXTRACT(payload, '$.revenue')), 0), COUNT(*)
 		FROM wp_apex_events
 		WHERE event_type = 'order_completed'
-		AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)
-		GROUP BY JSON_EXTRACT(payload, '$.email')
-		ORDER BY ltv DESC
+		AND created_at >= ? AND created_at < ?
+	`, p.Start, p.End).Scan(&revenue, &orders)
+	return revenue, orders
+}
+
+// getTopCustomers returns the customers who ordered in the period, ranked by lifetime value from
+// the customer model
+func (h *WooCommerceHandler) getTopCustomers(p analysis.Period) []fiber.Map {
+	rows, err := h.repo.db.Query(`
+		SELECT c.email, c.orders, c.revenue, c.predicted_value, c.rfm_segment
+		FROM wp_apex_customers c
+		WHERE c.email <> '' AND c.customer_key IN (
+			SELECT LOWER(TRIM(JSON_UNQUOTE(COALESCE(JSON_EXTRACT(payload, '$.customer_email'), JSON_EXTRACT(payload, '$.email')))))
+			FROM wp_apex_events
+			WHERE event_type = 'order_completed'
+			AND created_at >= ? AND created_at < ?
+		)
+		ORDER BY c.revenue DESC
 		LIMIT 5
-	`, days)
+	`, p.Start, p.End)
 
 	if err != nil {
 		// Return mock data
@@ -113,19 +123,21 @@ func (h *WooCommerceHandler) getTopCustomers(days int) []fiber.Map {
 
 	var customers []fiber.Map
 	for rows.Next() {
-		var email string
+		var email, segment string
 		var orderCount int
-		var ltv float64
-		if err := rows.Scan(&email, &orderCount, &ltv); err != nil {
+		var ltv, predicted float64
+		if err := rows.Scan(&email, &orderCount, &ltv, &predicted, &segment); err != nil {
 			continue
 		}
 		// Extract name from email
 		name := extractNameFromEmail(email)
 		customers = append(customers, fiber.Map{
-			"name":   name,
-			"email":  email,
-			"ltv":    ltv,
-			"orders": orderCount,
+			"name":          name,
+			"email":         email,
+			"ltv":           ltv,
+			"orders":        orderCount,
+			"predicted_ltv": predicted,
+			"segment":       segment,
 		})
 	}
 
@@ -140,37 +152,39 @@ func (h *WooCommerceHandler) getTopCustomers(days int) []fiber.Map {
 	return customers
 }
 
-// getCheckoutFunnel returns funnel step data
-func (h *WooCommerceHandler) getCheckoutFunnel(days int) []fiber.Map {
-	// In production, this would query actual funnel events
-	// For now, return mock data that looks realistic
-	var cartViews, checkoutStarts, shippingInfo, paymentMethod, purchases int
-
-	// Try to get actual data from events
-	h.repo.db.QueryRow(`SELECT COUNT(*) FROM wp_apex_events WHERE event_type = 'cart_view' AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)`, days).Scan(&cartViews)
-	h.repo.db.QueryRow(`SELECT COUNT(*) FROM wp_apex_events WHERE event_type = 'checkout_start' AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)`, days).Scan(&checkoutStarts)
-	h.repo.db.QueryRow(`SELECT COUNT(*) FROM wp_apex_events WHERE event_type = 'order_completed' AND created_at >= DATE_SUB(NOW(), INTERVAL ? DAY)`, days).Scan(&purchases)
-
-	// If no real data, use mock
-	if cartViews == 0 {
-		cartViews = 1240
-		checkoutStarts = 850
-		shippingInfo = 620
-		paymentMethod = 410
-		purchases = 380
-	} else {
-		// Estimate intermediate steps
-		shippingInfo = checkoutStarts * 73 / 100
-		paymentMethod = shippingInfo * 66 / 100
+// checkoutFunnel is the built-in WooCommerce funnel, evaluated by the generic funnel engine.
+// The tracker sends the first four steps from the cart and checkout pages; the order arrives
+// from the order webhook and is matched to the buyer by LoadTrackedEvents.
+var checkoutFunnel = analysis.FunnelDefinition{
+	Steps: []analysis.FunnelStep{
+		{Name: "Cart View", EventType: "cart_view"},
+		{Name: "Checkout Start", EventType: "checkout_start"},
+		{Name: "Shipping Info", EventType: "shipping_info"},
+		{Name: "Payment Method", EventType: "payment_info"},
+		{Name: "Purchase", EventType: "order_completed"},
+	},
+	Mode:             analysis.FunnelOrdered,
+	ConversionWindow: "7d",
+}
+
+// getCheckoutFunnel returns every checkout step with its count and the percentage of the
+// previous step lost before it. A period without checkout events has zero counts.
+func (h *WooCommerceHandler) getCheckoutFunnel(p analysis.Period) ([]fiber.Map, error) {
+	events, err := h.repo.LoadTrackedEvents(p.Start, p.End, checkoutFunnel.EventTypes())
+	if err != nil {
+		return nil, err
 	}
 
-	return []fiber.Map{
-		{"name": "Cart View", "count": cartViews, "dropoff": 0},
-		{"name": "Checkout Start", "count": checkoutStarts, "dropoff": 31},
-		{"name": "Shipping Info", "count": shippingInfo, "dropoff": 27},
-		{"name": "Payment Method", "count": paymentMethod, "dropoff": 34},
-		{"name": "Purchase", "count": purchases, "dropoff": 7},
+	report := analysis.ComputeFunnel(checkoutFunnel, events)
+	steps := make([]fiber.Map, 0, len(report.Steps))
+	for i, s := range report.Steps {
+		dropoff := 0
+		if i > 0 && report.Steps[i-1].Count > 0 {
+			dropoff = int(100 - s.StepConversionRate + 0.5)
+		}
+		steps = append(steps, fiber.Map{"name": s.Name, "count": s.Count, "dropoff": dropoff})
 	}
+	return steps, nil
 }
 
 // getActiveWhales returns high-value active carts
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/apex-ai/engine-go/analysis"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckoutFunnelWithoutEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	h := NewWooCommerceHandler(&Repository{db: db})
+	p := analysis.Period{Start: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)}
+
+	// No checkout events: every step is still there, with nothing counted or lost
+	mock.ExpectQuery("FROM wp_apex_events e").WillReturnRows(sqlmock.NewRows([]string{
+		"fingerprint", "session_id", "event_type", "url", "referrer", "payload", "created_at",
+		"session_referrer", "landing_page", "user_agent", "country"}))
+	steps, err := h.getCheckoutFunnel(p)
+	require.NoError(t, err)
+	assert.Equal(t, []fiber.Map{
+		{"name": "Cart View", "count": 0, "dropoff": 0},
+		{"name": "Checkout Start", "count": 0, "dropoff": 0},
+		{"name": "Shipping Info", "count": 0, "dropoff": 0},
+		{"name": "Payment Method", "count": 0, "dropoff": 0},
+		{"name": "Purchase", "count": 0, "dropoff": 0},
+	}, steps)
+
+	mock.ExpectQuery("FROM wp_apex_events e").WillReturnError(errors.New("connection reset"))
+	_, err = h.getCheckoutFunnel(p)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckoutFunnelCountsTrackedSteps(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	h := NewWooCommerceHandler(&Repository{db: db})
+	t0 := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+	p := analysis.Period{Start: t0.Add(-time.Hour), End: t0.AddDate(0, 0, 7)}
+
+	step := func(fp, eventType string, minutes int) []driver.Value {
+		return []driver.Value{fp, "s_" + fp, eventType, "https://shop.com/checkout/", "", nil, t0.Add(time.Duration(minutes) * time.Minute),
+			"", "https://shop.com/cart/", "Mozilla/5.0", "US"}
+	}
+	rows := trackedEventRows()
+	for _, e := range [][]driver.Value{
+		step("ann", "cart_view", 0), step("ann", "checkout_start", 1), step("ann", "shipping_info", 2), step("ann", "payment_info", 3),
+		step("bob", "cart_view", 0), step("bob", "checkout_start", 2),
+		step("cat", "cart_view", 5),
+		// Ann's order comes in through the webhook session
+		{"fp_first", "system_woo_webhook", "order_completed", "https://shop.com/checkout/order-received/7/", "",
+			[]byte(`{"order_id": 7, "revenue": 40, "customer_email": "ann@shop.com"}`), t0.Add(4 * time.Minute), "", "", "WordPress", "FR"},
+	} {
+		rows.AddRow(e...)
+	}
+	mock.ExpectQuery("FROM wp_apex_events e").WillReturnRows(rows)
+	mock.ExpectQuery("FROM wp_apex_customer_visitors cv").WithArgs("ann@shop.com").
+		WillReturnRows(buyerSessionRows().AddRow("ann@shop.com", "s_ann", "ann", t0, "", "https://shop.com/cart/", "Mozilla/5.0", "US"))
+
+	steps, err := h.getCheckoutFunnel(p)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []fiber.Map{
+		{"name": "Cart View", "count": 3, "dropoff": 0},
+		{"name": "Checkout Start", "count": 2, "dropoff": 33},
+		{"name": "Shipping Info", "count": 1, "dropoff": 50},
+		{"name": "Payment Method", "count": 1, "dropoff": 0},
+		{"name": "Purchase", "count": 1, "dropoff": 0},
+	}, steps)
+}
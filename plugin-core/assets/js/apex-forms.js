@@ -2,9 +2,9 @@
     'use strict';
 
     const CONFIG = window.apexFormsConfig || { api_root: '/wp-json/apex/v1', nonce: '' };
-    let sessionStartTime = Date.now();
-    let events = [];
-    let metrics = {};
+    const BATCH_INTERVAL = 5000;
+    let eventQueue = [];
+    const fieldTimers = {};
 
     // Auto-detect Form Type
     function detectFormType(form) {
@@ -64,9 +64,10 @@
 
         const payload = [...eventQueue];
         eventQueue = [];
+        const body = JSON.stringify({ session_id: localStorage.getItem('apex_sid') || '', events: payload });
 
         if (navigator.sendBeacon) {
-            const blob = new Blob([JSON.stringify({ events: payload })], { type: 'application/json' });
+            const blob = new Blob([body], { type: 'application/json' });
             // Use the standard telemetry endpoint, generic ingestion
             navigator.sendBeacon(`${CONFIG.api_root}/telemetry?_wpnonce=${CONFIG.nonce}`, blob);
         } else {
@@ -77,7 +78,7 @@
                     'Content-Type': 'application/json',
                     'X-WP-Nonce': CONFIG.nonce
                 },
-                body: JSON.stringify({ events: payload })
+                body: body
             }).catch(console.error);
         }
     }
@@ -118,6 +119,20 @@
         }
     }, true);
 
+    // Native validation failures
+    document.addEventListener('invalid', function (e) {
+        const target = e.target;
+        pushEvent('form_field_invalid', {
+            field: getSelector(target),
+            form: getSelector(target.form || document.body)
+        });
+    }, true);
+
+    document.addEventListener('submit', function (e) {
+        pushEvent('form_submit', { form: getSelector(e.target) });
+        flushEvents();
+    }, true);
+
     // Rage Click Detection on Submit
     let submitClicks = [];
     document.addEventListener('click', function (e) {
@@ -15,6 +15,7 @@
     // State
     const sessionStart = Date.now();
     let maxScroll = 0;
+    let maxReach = 0; // % of the page that has been on screen
     let totalScrollDistance = 0;
     let lastScrollTop = 0;
     let lastScrollTime = Date.now();
@@ -51,6 +52,10 @@
         if (scrollPct > maxScroll) {
             maxScroll = scrollPct;
         }
+        const reachPct = Math.round(((scrollTop + document.documentElement.clientHeight) / document.documentElement.scrollHeight) * 100);
+        if (reachPct > maxReach) {
+            maxReach = reachPct;
+        }
 
         // Calculate Velocity (pixels per second)
         // We only care about bursts, but this is a simple running check
@@ -98,6 +103,7 @@
                 pid: config.pid || 0,
                 aid: config.aid || 0,
                 sc: maxScroll, // Max Scroll Depth %
+                sr: maxReach, // Max Scroll Reach % (bottom of viewport)
                 ts: Math.round((Date.now() - sessionStart) / 1000), // Time on Site (sec)
                 sk: isSkimmer // Skimmer Flag
             }
@@ -120,6 +126,63 @@
     // Init: Track Pageview
     sendEvent('pageview');
 
+    // Experiments: call apex.exposure('checkout-cta', 'green') when a variant is rendered.
+    // Sent once per experiment and variant per session; the engine assigns visitors by first exposure.
+    function trackExposure(experiment, variant) {
+        if (!experiment || !variant) return;
+        const key = 'apex_exp_' + experiment + ':' + variant;
+        try {
+            if (sessionStorage.getItem(key)) return;
+            sessionStorage.setItem(key, '1');
+        } catch (e) { /* storage blocked: send anyway */ }
+        sendEvent('experiment_exposure', { experiment: String(experiment), variant: String(variant) });
+    }
+
+    // Exposures queued before the tracker loaded: window.apex = [['checkout-cta', 'green']]
+    const queuedExposures = Array.isArray(window.apex) ? window.apex : [];
+    window.apex = { exposure: trackExposure };
+    queuedExposures.forEach(args => trackExposure.apply(null, args));
+
+    // Server-rendered variants: <div data-apex-experiment="checkout-cta" data-apex-variant="green">
+    document.querySelectorAll('[data-apex-experiment][data-apex-variant]').forEach(el => {
+        trackExposure(el.getAttribute('data-apex-experiment'), el.getAttribute('data-apex-variant'));
+    });
+
+    // WooCommerce checkout funnel: cart_view > checkout_start > shipping_info > payment_info.
+    // The order itself comes from the order webhook. WooCommerce marks its pages with body classes;
+    // classic and block checkouts name address fields billing_/shipping_ (or billing-/shipping-).
+    const bodyClass = document.body.classList; // the tracker loads in the footer
+    const checkoutSent = {};
+    function trackCheckoutStep(type) {
+        if (checkoutSent[type]) return;
+        checkoutSent[type] = true;
+        sendEvent(type);
+    }
+    if (bodyClass.contains('woocommerce-cart')) {
+        trackCheckoutStep('cart_view');
+    }
+    if (bodyClass.contains('woocommerce-checkout') && !bodyClass.contains('woocommerce-order-received')) {
+        trackCheckoutStep('checkout_start');
+
+        document.addEventListener('change', function (e) {
+            const field = e.target.name || e.target.id || '';
+            if (/^(billing|shipping)[_-]/.test(field)) {
+                trackCheckoutStep('shipping_info');
+            } else if (field === 'payment_method' || (e.target.closest && e.target.closest('.wc-block-checkout__payment-method'))) {
+                trackCheckoutStep('shipping_info'); // address may have been prefilled
+                trackCheckoutStep('payment_info');
+            }
+        }, true);
+
+        // A prefilled checkout may get no change events before the order is placed
+        document.addEventListener('click', function (e) {
+            if (e.target.closest && e.target.closest('#place_order, .wc-block-components-checkout-place-order-button')) {
+                trackCheckoutStep('shipping_info');
+                trackCheckoutStep('payment_info');
+            }
+        }, true);
+    }
+
     // Track Engagement on Unload/Hidden
     // Visibility API is better than unload
     document.addEventListener('visibilitychange', function () {
@@ -142,8 +205,37 @@
         }
     }, 15000);
 
+    // Heatmap selector: up to 4 ancestors, stopping at an id (the engine drops unstable parts)
+    function heatmapSelector(el) {
+        const parts = [];
+        while (el && el.nodeType === 1 && parts.length < 4 && el !== document.body) {
+            let part = el.tagName.toLowerCase();
+            if (el.id) {
+                parts.unshift(part + '#' + el.id);
+                break;
+            }
+            if (typeof el.className === 'string' && el.className.trim()) {
+                part += '.' + el.className.trim().split(/\s+/).join('.');
+            }
+            parts.unshift(part);
+            el = el.parentElement;
+        }
+        return parts.join(' > ');
+    }
+
     // Tack Outbound/Affiliate Clicks
     document.addEventListener('click', function (e) {
+        // Heatmap click: page coordinates plus position inside the clicked element
+        const rect = e.target.getBoundingClientRect ? e.target.getBoundingClientRect() : null;
+        sendEvent('heatmap_click', {
+            sel: heatmapSelector(e.target),
+            x: Math.round(e.pageX),
+            y: Math.round(e.pageY),
+            vw: document.documentElement.clientWidth,
+            ox: rect && rect.width ? Math.round(((e.clientX - rect.left) / rect.width) * 1000) / 1000 : null,
+            oy: rect && rect.height ? Math.round(((e.clientY - rect.top) / rect.height) * 1000) / 1000 : null
+        });
+
         // Rage Click Detection
         // count clicks in short window
         if (!window.apexClickCount) window.apexClickCount = 0;
@@ -139,7 +139,7 @@ class StatsController
     {
         $range = $request->get_param('range') ?? '7d';
 
-        $kpi = $this->proxy_get('/v1/stats/kpi?range=' . $range, 120)->get_data();
+        $kpi = $this->proxy_get('/v1/stats/kpi?' . $this->range_query($request), 120)->get_data();
         // Assuming a 'traffic' endpoint exists or will be added.
         // For now, let's mock it or return an empty array if not implemented.
         // If it's meant to be a proxy_get, it needs a corresponding endpoint in the Go engine.
@@ -154,6 +154,22 @@ class StatsController
         ], 200);
     }
 
+    /**
+     * Build the date range query string forwarded to the engine, pinned to the site time zone
+     */
+    private function range_query(\WP_REST_Request $request, string $default_range = '7d'): string
+    {
+        $params = ['range' => $request->get_param('range') ?: $default_range];
+        foreach (['start', 'end', 'compare'] as $key) {
+            $value = $request->get_param($key);
+            if (!empty($value)) {
+                $params[$key] = sanitize_text_field($value);
+            }
+        }
+        $params['tz'] = wp_timezone_string();
+        return http_build_query($params);
+    }
+
     public function check_permission(): bool
     {
         return current_user_can('manage_options');
@@ -304,8 +320,7 @@ class StatsController
      */
     public function proxy_get_form_stats(\WP_REST_Request $request): \WP_REST_Response
     {
-        $range = $request->get_param('range') ?: '7d';
-        return $this->proxy_get('/v1/stats/forms?range=' . urlencode($range), 300); // 5 min cache
+        return $this->proxy_get('/v1/stats/forms?' . $this->range_query($request), 300); // 5 min cache
     }
 
     /**
@@ -313,8 +328,7 @@ class StatsController
      */
     public function proxy_get_kpi_stats(\WP_REST_Request $request): \WP_REST_Response
     {
-        $range = $request->get_param('range') ?? '7d';
-        return $this->proxy_get('/v1/stats/kpi?range=' . $range, 120); // 2 min cache
+        return $this->proxy_get('/v1/stats/kpi?' . $this->range_query($request), 120); // 2 min cache
     }
 
     /**
@@ -322,8 +336,7 @@ class StatsController
      */
     public function proxy_get_content_stats(\WP_REST_Request $request): \WP_REST_Response
     {
-        $range = $request->get_param('range') ?? '7d';
-        return $this->proxy_get('/v1/stats/content?range=' . $range, 300); // 5 min cache
+        return $this->proxy_get('/v1/stats/content?' . $this->range_query($request), 300); // 5 min cache
     }
 
     /**
@@ -363,8 +376,7 @@ class StatsController
      */
     public function proxy_get_woo_stats(\WP_REST_Request $request): \WP_REST_Response
     {
-        $range = $request->get_param('range') ?? '7d';
-        $go_engine_url = $this->get_engine_url('/v1/woocommerce/stats?range=' . $range);
+        $go_engine_url = $this->get_engine_url('/v1/woocommerce/stats?' . $this->range_query($request));
 
         if (!$go_engine_url) {
             return new \WP_REST_Response(['error' => 'Engine Unreachable'], 503);
@@ -413,8 +425,7 @@ class StatsController
      */
     public function proxy_get_search_stats(\WP_REST_Request $request): \WP_REST_Response
     {
-        $range = $request->get_param('range') ?? '7d';
-        return $this->proxy_get('/v1/search/stats?range=' . $range, 300); // 5 min cache
+        return $this->proxy_get('/v1/search/stats?' . $this->range_query($request), 300); // 5 min cache
     }
 
     public function proxy_get_readability(\WP_REST_Request $request)
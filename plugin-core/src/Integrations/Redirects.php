@@ -0,0 +1,84 @@
+<?php
+
+namespace ApexAI\Integrations;
+
+use ApexAI\Services\EngineClient;
+
+class Redirects
+{
+    private const CACHE_KEY = 'apex_redirect_rules';
+
+    public function register(): void
+    {
+        // Runs after WordPress has resolved the request, so only real 404s are redirected
+        add_action('template_redirect', [$this, 'maybe_redirect'], 1);
+    }
+
+    public function maybe_redirect(): void
+    {
+        if (!is_404()) {
+            return;
+        }
+
+        $path = self::normalize_path((string) wp_parse_url($_SERVER['REQUEST_URI'] ?? '/', PHP_URL_PATH));
+        $rules = $this->get_rules();
+        if (!isset($rules[$path])) {
+            return;
+        }
+        $rule = $rules[$path];
+
+        // Hit counts feed the dashboard's rollout report
+        EngineClient::proxy_post('/v1/redirects/hit', [
+            'blocking' => false,
+            'headers' => ['Content-Type' => 'application/json'],
+            'body' => wp_json_encode(['source' => $path]),
+        ]);
+
+        if ((int) $rule['status_code'] === 410) {
+            // Keep rendering the 404 template, but tell crawlers the page is gone for good
+            status_header(410);
+            return;
+        }
+        wp_redirect($rule['target'], (int) $rule['status_code'], 'Apex AI');
+        exit;
+    }
+
+    /**
+     * Active rules keyed by source path, cached for a few minutes so 404s don't each call the engine
+     */
+    private function get_rules(): array
+    {
+        $cached = get_transient(self::CACHE_KEY);
+        if (is_array($cached)) {
+            return $cached;
+        }
+
+        $response = EngineClient::proxy_get('/v1/redirects/export?format=json', ['timeout' => 2]);
+        if (is_wp_error($response) || wp_remote_retrieve_response_code($response) !== 200) {
+            // Back off briefly rather than retrying on every 404 while the engine is down
+            set_transient(self::CACHE_KEY, [], MINUTE_IN_SECONDS);
+            return [];
+        }
+
+        $rules = [];
+        foreach ((array) json_decode(wp_remote_retrieve_body($response), true) as $rule) {
+            if (!empty($rule['source']) && isset($rule['status_code'])) {
+                $rules[$rule['source']] = $rule;
+            }
+        }
+        set_transient(self::CACHE_KEY, $rules, 5 * MINUTE_IN_SECONDS);
+        return $rules;
+    }
+
+    /**
+     * Mirrors the engine's RedirectPath: decoded, lowercased, without trailing slash
+     */
+    private static function normalize_path(string $path): string
+    {
+        $path = mb_strtolower(rtrim(rawurldecode($path), '/'));
+        if ($path === '') {
+            return '/';
+        }
+        return $path[0] === '/' ? $path : '/' . $path;
+    }
+}
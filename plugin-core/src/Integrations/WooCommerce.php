@@ -123,7 +123,7 @@ class WooCommerce
             'sid' => 'system_woo_webhook', // Internal system session
             'ip' => $order->get_customer_ip_address(),
             'ua' => $order->get_customer_user_agent(),
-            'url' => 'woocommerce://order/' . $order_id,
+            'url' => $order->get_checkout_order_received_url(), // /collect only accepts http(s) URLs
             'd' => [
                 'order_id' => $order_id,
                 'currency' => $order->get_currency(),
@@ -383,6 +383,49 @@ class Plugin
 
     public function register_integrations()
     {
+        // Author leaderboard: push post metadata so the engine can resolve URLs to authors
+        // without reading wp_posts/wp_users directly
+        add_action('save_post', function ($post_id, $post) {
+            if (wp_is_post_revision($post_id) || $post->post_status !== 'publish' || !is_post_type_viewable($post->post_type)) {
+                return;
+            }
+            $payload = [[
+                'post_id' => $post_id,
+                'url' => get_permalink($post_id),
+                'title' => get_the_title($post_id),
+                'author_id' => (int) $post->post_author,
+                'author_name' => get_the_author_meta('display_name', $post->post_author),
+                'published_at' => get_post_time('Y-m-d H:i:s', true, $post),
+            ]];
+            \ApexAI\Services\EngineClient::proxy_post('/v1/content/posts', [
+                'blocking' => false,
+                'headers' => ['Content-Type' => 'application/json'],
+                'body' => wp_json_encode($payload),
+            ]);
+        }, 10, 2);
+
+        // Readability: push the post body so the engine can score it and judge dwell time
+        // against the expected read time
+        add_action('save_post', function ($post_id, $post) {
+            if (wp_is_post_revision($post_id) || $post->post_status !== 'publish' || !is_post_type_viewable($post->post_type)) {
+                return;
+            }
+            $payload = [[
+                'post_id' => $post_id,
+                'url' => get_permalink($post_id),
+                'title' => get_the_title($post_id),
+                'content' => strip_shortcodes($post->post_content), // block comments are stripped as markup
+            ]];
+            \ApexAI\Services\EngineClient::proxy_post('/v1/content/readability', [
+                'blocking' => false,
+                'headers' => ['Content-Type' => 'application/json'],
+                'body' => wp_json_encode($payload),
+            ]);
+        }, 10, 2);
+
+        // Serve redirects accepted in the dashboard on 404s and report their hits
+        (new \ApexAI\Integrations\Redirects())->register();
+
         // WooCommerce Integration - only register if WooCommerce is active
         if (class_exists('WooCommerce')) {
             // Trigger: Cart Abandonment / Activity
@@ -405,6 +448,50 @@ class Plugin
                     'body' => json_encode($payload)
                 ]);
             }, 10, 6);
+
+            // Inventory forecasting: push stock levels whenever WooCommerce changes them, plus a daily
+            // snapshot of every managed product so restocks made outside WooCommerce are seen too
+            $stock_snapshot = function ($product) {
+                if (!$product || !$product->managing_stock() || $product->get_stock_quantity() === null) {
+                    return null;
+                }
+                return [
+                    'sku' => $product->get_sku() ?: $product->get_name(), // order lines fall back to the name too
+                    'name' => $product->get_name(),
+                    'stock' => (float) $product->get_stock_quantity(),
+                ];
+            };
+            $push_snapshots = function (array $snapshots) {
+                if (empty($snapshots)) {
+                    return;
+                }
+                \ApexAI\Services\EngineClient::proxy_post('/v1/inventory/snapshots', [
+                    'blocking' => false,
+                    'headers' => ['Content-Type' => 'application/json'],
+                    'body' => wp_json_encode(['snapshots' => array_values($snapshots)]),
+                ]);
+            };
+            $on_stock_change = function ($product) use ($stock_snapshot, $push_snapshots) {
+                $push_snapshots(array_filter([$stock_snapshot($product)]));
+            };
+            add_action('woocommerce_product_set_stock', $on_stock_change);
+            add_action('woocommerce_variation_set_stock', $on_stock_change);
+
+            add_action('apex_daily_stock_snapshot', function () use ($stock_snapshot, $push_snapshots) {
+                $page = 1;
+                do {
+                    $products = wc_get_products([
+                        'type' => ['simple', 'variation'],
+                        'manage_stock' => true,
+                        'limit' => 200,
+                        'page' => $page++,
+                    ]);
+                    $push_snapshots(array_filter(array_map($stock_snapshot, $products)));
+                } while (count($products) === 200);
+            });
+            if (!wp_next_scheduled('apex_daily_stock_snapshot')) {
+                wp_schedule_event(time(), 'daily', 'apex_daily_stock_snapshot');
+            }
         }
     }
 
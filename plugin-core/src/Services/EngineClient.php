@@ -42,7 +42,8 @@ class EngineClient
     {
         $url = self::get_engine_url() . $path;
         $args['headers'] = array_merge($args['headers'] ?? [], [
-            'X-Apex-GDPR' => get_option('apex_gdpr_mode') ? 'true' : 'false'
+            'X-Apex-GDPR' => get_option('apex_gdpr_mode') ? 'true' : 'false',
+            'X-Apex-Timezone' => wp_timezone_string(),
         ]);
         return wp_remote_get($url, $args);
     }
@@ -51,7 +52,8 @@ class EngineClient
     {
         $url = self::get_engine_url() . $path;
         $args['headers'] = array_merge($args['headers'] ?? [], [
-            'X-Apex-GDPR' => get_option('apex_gdpr_mode') ? 'true' : 'false'
+            'X-Apex-GDPR' => get_option('apex_gdpr_mode') ? 'true' : 'false',
+            'X-Apex-Timezone' => wp_timezone_string(),
         ]);
         return wp_remote_post($url, $args);
     }